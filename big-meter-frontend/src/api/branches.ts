@@ -1,6 +1,6 @@
 import { buildUrl, fetchJson } from './http'
 
-export interface BranchItem { code: string; name?: string }
+export interface BranchItem { code: string; name?: string; alias?: string; display_name?: string }
 export interface BranchesResponse { items: BranchItem[]; total: number; limit: number; offset: number }
 
 export const getBranches = (params: { q?: string; limit?: number; offset?: number } = {}) =>
@@ -3,6 +3,7 @@ import { buildUrl, fetchJson } from './http'
 export interface CustCodeItem {
   fiscal_year: number
   branch_code: string
+  branch_name?: string | null // bm_branches.name, omitted for unknown branches
   org_name: string | null
   cust_code: string
   use_type: string | null
@@ -3,6 +3,7 @@ import { buildUrl, fetchJson } from './http'
 export interface DetailItem {
   year_month: string
   branch_code: string
+  branch_name?: string | null // bm_branches.name, omitted for unknown branches
   org_name?: string | null
   cust_code: string
   use_type?: string | null
@@ -20,17 +21,33 @@ export interface DetailItem {
   is_zeroed?: boolean
 }
 
-export interface DetailsResponse { items: DetailItem[]; total: number; limit: number; offset: number }
+export interface DetailsSummary {
+  total: number
+  zeroed: number
+  active: number
+  sum_present_water_usg: number
+  avg: number
+}
+
+export interface DetailsResponse {
+  items: DetailItem[]
+  total: number
+  limit: number
+  offset: number
+  summary?: DetailsSummary // only with include_summary=1
+}
 
 export function getDetails(params: {
   ym: string
   branch: string
   fiscal_year?: number
   q?: string
+  q_mode?: 'ilike' | 'fts' // fts: word search over name/address/org, ranked unless order_by is set
   limit?: number
   offset?: number
   order_by?: string
   sort?: 'ASC' | 'DESC' | 'asc' | 'desc'
+  include_summary?: 1
 }) {
   return fetchJson<DetailsResponse>(buildUrl('/api/v1/details', params as Record<string, string | number | boolean | undefined>))
 }
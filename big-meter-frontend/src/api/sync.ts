@@ -1,8 +1,16 @@
 import { buildUrl, fetchJson } from "./http";
 
+/** Sync log row tracking one branch of a triggered run (poll GET /sync/logs/:id) */
+export type SyncLogRef = {
+  branch: string;
+  log_id: number | null;
+};
+
 export type YearlyInitRequest = {
   branches: string[];
   debt_ym: string;
+  backfill_months?: number; // 0..24; omit to use BACKFILL_MONTHS
+  force?: boolean; // allow branch codes not yet in bm_branches
 };
 
 export type YearlyInitResponse = {
@@ -10,6 +18,11 @@ export type YearlyInitResponse = {
   fiscal_year: number;
   branches: string[];
   debt_ym: string;
+  debt_ym_gregorian?: string; // resolved month used (Gregorian YYYYMM)
+  debt_ym_thai?: string; // the same month in the Thai calendar, as sent to Oracle
+  debt_ym_defaulted?: boolean; // true when debt_ym was omitted and October of this year was used
+  backfill_months?: number; // Present in async 202 response
+  logs?: SyncLogRef[]; // Present in async 202 response
   stats?: {
     // Optional - only present in sync completion
     upserted: number;
@@ -22,12 +35,14 @@ export type YearlyInitResponse = {
 export type MonthlySyncRequest = {
   branches: string[];
   ym: string;
+  force?: boolean; // allow branch codes not yet in bm_branches
 };
 
 export type MonthlySyncResponse = {
   message?: string; // Present in async 202 response
   ym: string;
   branches: string[];
+  logs?: SyncLogRef[]; // Present in async 202 response
   stats?: {
     // Optional - only present in sync completion
     upserted: number;
@@ -38,6 +53,29 @@ export type MonthlySyncResponse = {
   note?: string;
 };
 
+/** Read-only runtime settings and feature flags (GET /config) */
+export type AppConfig = {
+  timezone: string;
+  cron_yearly: string;
+  cron_monthly: string;
+  branches_count: number;
+  enable_yearly_init: boolean;
+  enable_monthly_sync: boolean;
+  telegram_enabled: boolean;
+  alert_enabled: boolean;
+  alert_threshold: number;
+  cohort_size: number;
+  backfill_months: number;
+};
+
+/**
+ * Fetch runtime settings
+ * GET /api/v1/config
+ */
+export async function getConfig(): Promise<AppConfig> {
+  return fetchJson<AppConfig>(buildUrl("/api/v1/config"));
+}
+
 /**
  * Trigger yearly initialization sync
  * POST /api/v1/sync/init
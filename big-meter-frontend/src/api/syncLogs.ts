@@ -11,10 +11,15 @@ export interface SyncLog {
   started_at: string;
   finished_at?: string | null;
   duration_ms?: number | null;
+  duration_human?: string;
   records_upserted?: number | null;
   records_zeroed?: number | null;
   error_message?: string | null;
   triggered_by: string;
+  retry_count?: number;
+  processed_batches?: number; // committed monthly batches; grows while in_progress
+  last_offset?: number; // committed cohort entries; POST /sync/logs/:id/retry?resume=true starts here
+  request_id?: string; // X-Request-ID of the API call that started the run
   created_at: string;
 }
 
@@ -47,3 +52,26 @@ export async function getSyncLogs(
   const url = buildUrl("/api/v1/sync/logs", queryParams);
   return fetchJson<SyncLogsResponse>(url);
 }
+
+export interface RunningSync {
+  sync_type: string;
+  branch: string;
+  ym: string; // year_month for monthly_sync, debt_ym for yearly_init
+  fiscal_year: number;
+  triggered_by: string;
+  log_id: number | null;
+  started_at: string;
+  batches_done: number;
+  records_upserted: number;
+  records_zeroed: number;
+  source: "process" | "sync_log";
+}
+
+export interface SyncStatusResponse {
+  running: RunningSync[];
+  total: number;
+}
+
+export async function getSyncStatus(): Promise<SyncStatusResponse> {
+  return fetchJson<SyncStatusResponse>(buildUrl("/api/v1/sync/status"));
+}
@@ -5,6 +5,7 @@ import { useAuth } from "../lib/auth";
 import { useIsAdmin } from "../lib/useIsAdmin";
 import { getBranches } from "../api/branches";
 import {
+  getConfig,
   triggerYearlyInit,
   triggerMonthlySync,
   type YearlyInitResponse,
@@ -54,6 +55,15 @@ export default function AdminPage() {
 
   const syncLogs = syncLogsQuery.data?.items ?? [];
 
+  // Runtime flags; syncs disabled on the server cannot be started from here
+  const configQuery = useQuery({
+    queryKey: ["config"],
+    queryFn: getConfig,
+    enabled: isAuthenticated && isAdmin,
+  });
+  const yearlyEnabled = configQuery.data?.enable_yearly_init ?? true;
+  const monthlyEnabled = configQuery.data?.enable_monthly_sync ?? true;
+
   // Redirect non-authenticated users
   if (hydrated && !isAuthenticated) {
     return <Navigate to="/" replace />;
@@ -182,7 +192,7 @@ export default function AdminPage() {
                 >
                   {branches.map((branch) => (
                     <option key={branch.code} value={branch.code}>
-                      {branch.code} - {branch.name || "N/A"}
+                      {branch.code} - {branch.display_name || branch.name || "N/A"}
                     </option>
                   ))}
                 </select>
@@ -213,7 +223,10 @@ export default function AdminPage() {
               <button
                 type="submit"
                 disabled={
-                  yearlyLoading || yearlyBranches.length === 0 || !debtYm
+                  !yearlyEnabled ||
+                  yearlyLoading ||
+                  yearlyBranches.length === 0 ||
+                  !debtYm
                 }
                 className="w-full px-4 py-2 text-sm font-medium text-white bg-blue-600 rounded-md hover:bg-blue-700 disabled:bg-slate-300 disabled:cursor-not-allowed"
               >
@@ -288,7 +301,7 @@ export default function AdminPage() {
                 >
                   {branches.map((branch) => (
                     <option key={branch.code} value={branch.code}>
-                      {branch.code} - {branch.name || "N/A"}
+                      {branch.code} - {branch.display_name || branch.name || "N/A"}
                     </option>
                   ))}
                 </select>
@@ -319,7 +332,10 @@ export default function AdminPage() {
               <button
                 type="submit"
                 disabled={
-                  monthlyLoading || monthlyBranches.length === 0 || !monthlyYm
+                  !monthlyEnabled ||
+                  monthlyLoading ||
+                  monthlyBranches.length === 0 ||
+                  !monthlyYm
                 }
                 className="w-full px-4 py-2 text-sm font-medium text-white bg-blue-600 rounded-md hover:bg-blue-700 disabled:bg-slate-300 disabled:cursor-not-allowed"
               >
@@ -452,14 +468,22 @@ export default function AdminPage() {
                                 ? "bg-green-100 text-green-700"
                                 : log.status === "error"
                                   ? "bg-red-100 text-red-700"
-                                  : "bg-yellow-100 text-yellow-700"
+                                  : log.status === "timeout"
+                                    ? "bg-orange-100 text-orange-700"
+                                    : log.status === "cancelled"
+                                      ? "bg-slate-100 text-slate-700"
+                                      : "bg-yellow-100 text-yellow-700"
                             }`}
                           >
                             {log.status === "success"
                               ? "✓ Success"
                               : log.status === "error"
                                 ? "✗ Error"
-                                : "⋯ In Progress"}
+                                : log.status === "timeout"
+                                  ? "⏱ Timeout"
+                                  : log.status === "cancelled"
+                                    ? "⊘ Cancelled"
+                                    : "⋯ In Progress"}
                           </span>
                         </td>
                         <td className="px-4 py-3 text-right font-mono text-slate-700">
@@ -25,12 +25,31 @@ func main() {
 		log.Fatalf("postgres: %v", err)
 	}
 	defer pg.Close()
+	pg.ReadRetries = cfg.PostgresReadRetries
+	if err := pg.Ping(ctx); err != nil {
+		log.Fatalf("postgres: %v", err)
+	}
+
+	// Optional read replica for API read handlers; sync writes stay on the primary
+	var readPG *dbpkg.Postgres
+	if cfg.PostgresReadDSN != "" {
+		readPG, err = dbpkg.NewPostgres(ctx, cfg.PostgresReadDSN)
+		if err != nil {
+			log.Fatalf("postgres read replica: %v", err)
+		}
+		defer readPG.Close()
+		readPG.ReadRetries = cfg.PostgresReadRetries
+		if err := readPG.Ping(ctx); err != nil {
+			log.Fatalf("postgres read replica: %v", err)
+		}
+		log.Printf("api reads use POSTGRES_READ_DSN replica")
+	}
 
 	// Initialize Oracle connection for sync operations
 	// If Oracle DSN is not configured, sync endpoints will return errors
 	var ora *dbpkg.Oracle
 	if cfg.OracleDSN != "" {
-		ora, err = dbpkg.NewOracle(cfg.OracleDSN)
+		ora, err = dbpkg.NewOracle(cfg.OracleDSN, cfg.OracleSessionParams)
 		if err != nil {
 			log.Printf("warning: oracle connection failed (sync endpoints disabled): %v", err)
 			ora = nil
@@ -43,6 +62,9 @@ func main() {
 	}
 
 	srv := api.NewServer(cfg, pg, ora)
+	if readPG != nil {
+		srv.UseReadReplica(readPG)
+	}
 	engine := srv.Router()
 
 	addr := ":8089"
@@ -6,8 +6,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -33,16 +37,21 @@ func main() {
 	}
 	defer pg.Close()
 
-	ora, err := dbpkg.NewOracle(cfg.OracleDSN)
+	ora, err := dbpkg.NewOracle(cfg.OracleDSN, cfg.OracleSessionParams)
 	if err != nil {
 		log.Fatalf("oracle: %v", err)
 	}
 	defer ora.Close()
 
-	svc := syncsvc.NewService(ora, pg)
+	svc := syncsvc.NewService(ora, pg, cfg.Sync)
 
-	// Initialize Telegram notifier
-	notifier, err := notify.NewTelegramNotifier(notify.TelegramConfig{
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		log.Fatalf("timezone: %v", err)
+	}
+
+	// Initialize the notifier (NOTIFY_PROVIDER: telegram, slack or none)
+	tgConfig := notify.TelegramConfig{
 		BotToken:          cfg.Telegram.BotToken,
 		ChatID:            cfg.Telegram.ChatID,
 		Enabled:           cfg.Telegram.Enabled,
@@ -52,13 +61,79 @@ func main() {
 		YearlyFailureMsg:  cfg.Telegram.YearlyFailureMsg,
 		MonthlySuccessMsg: cfg.Telegram.MonthlySuccessMsg,
 		MonthlyFailureMsg: cfg.Telegram.MonthlyFailureMsg,
-	})
+		QuietHours:        cfg.Telegram.QuietHours,
+		CriticalBranches:  cfg.Telegram.CriticalBranches,
+		Location:          loc,
+		SuppressSuccess:   !cfg.Telegram.NotifyOnSuccess,
+		SendAttempts:      cfg.Telegram.SendAttempts,
+		RetryDelay:        cfg.Telegram.RetryDelay,
+	}
+	notifier, err := notify.NewNotifier(cfg.NotifyProvider, tgConfig, notify.SlackConfig{WebhookURL: cfg.Slack.WebhookURL}, notify.NewMuteStore(pg.Pool))
 	if err != nil {
-		log.Fatalf("telegram notifier: %v", err)
+		log.Fatalf("%s notifier: %v", cfg.NotifyProvider, err)
 	}
-	if cfg.Telegram.Enabled {
+	switch {
+	case cfg.NotifyProvider == notify.ProviderSlack:
+		log.Printf("slack notifications enabled")
+	case cfg.NotifyProvider == notify.ProviderNone:
+		log.Printf("notifications disabled (NOTIFY_PROVIDER=none)")
+	case cfg.Telegram.Enabled:
 		log.Printf("telegram notifications enabled (chat_id=%d)", cfg.Telegram.ChatID)
 	}
+	// Sync failures are also emailed for the audit trail
+	if cfg.Email.Enabled {
+		email, err := notify.NewEmailNotifier(notify.EmailConfig{
+			Host:     cfg.Email.Host,
+			Port:     cfg.Email.Port,
+			Username: cfg.Email.Username,
+			Password: cfg.Email.Password,
+			From:     cfg.Email.From,
+			To:       cfg.Email.To,
+		})
+		if err != nil {
+			log.Fatalf("email notifier: %v", err)
+		}
+		notifier = notify.MultiNotifier{notifier, email}
+		log.Printf("email failure notifications enabled (to=%s)", strings.Join(cfg.Email.To, ","))
+	}
+	// Cohort/details ratio alarms go out like alert digests
+	if cfg.Sync.DetailsRatioNotify {
+		svc.OnRatioAlarm = func(message string) {
+			if err := notifier.SendAlertMessage("⚠️ " + message); err != nil {
+				log.Printf("ratio alarm notify: %v", err)
+			}
+		}
+	}
+
+	// NOTIFY_PER_BRANCH: a short message per finished branch, on its own chat/webhook.
+	// The once modes wait for branchSends before exiting; the scheduler up to SHUTDOWN_TIMEOUT.
+	var branchSends sync.WaitGroup
+	if perBranchEnabled(cfg) {
+		branchTG := tgConfig
+		if cfg.Telegram.PerBranchChatID != 0 {
+			branchTG.ChatID = cfg.Telegram.PerBranchChatID
+		}
+		branchSlack := notify.SlackConfig{WebhookURL: cfg.Slack.WebhookURL}
+		if cfg.Slack.PerBranchWebhookURL != "" {
+			branchSlack.WebhookURL = cfg.Slack.PerBranchWebhookURL
+		}
+		branchNotifier, err := notify.NewNotifier(cfg.NotifyProvider, branchTG, branchSlack, notify.NewMuteStore(pg.Pool))
+		if err != nil {
+			log.Fatalf("per-branch %s notifier: %v", cfg.NotifyProvider, err)
+		}
+		svc.OnBranchDone = notifyBranchDone(branchNotifier.SendAlertMessage, &branchSends)
+		log.Printf("per-branch notifications enabled (NOTIFY_PER_BRANCH)")
+	}
+
+	// Optional sync-completion webhook; undelivered callbacks land in bm_webhook_failures
+	webhook := notify.NewWebhookNotifier(notify.WebhookConfig{
+		URL:     cfg.Webhook.URL,
+		Retries: cfg.Webhook.Retries,
+		Backoff: cfg.Webhook.RetryBackoff,
+	}, notify.NewWebhookFailureStore(pg.Pool))
+	if webhook != nil {
+		log.Printf("sync webhook enabled (retries=%d backoff=%s)", cfg.Webhook.Retries, cfg.Webhook.RetryBackoff)
+	}
 
 	// Optional Prometheus metrics server
 	if addr := strings.TrimSpace(os.Getenv("METRICS_ADDR")); addr != "" {
@@ -81,6 +156,9 @@ func main() {
 		if len(branches) == 0 {
 			log.Fatal("ora-test: BRANCHES is required")
 		}
+		if err := cfg.CheckBranchCodes([]string{strings.TrimSpace(branches[0])}); err != nil {
+			log.Fatalf("ora-test: %v", err)
+		}
 		// Accept Gregorian YM; if DEBT_YM is provided (Thai or Gregorian), normalize to Gregorian
 		ymIn := strings.TrimSpace(os.Getenv("YM"))
 		if ymIn == "" {
@@ -89,7 +167,7 @@ func main() {
 		if ymIn == "" {
 			log.Fatal("ora-test: YM=YYYYMM (Gregorian) required")
 		}
-		ymGreg, err := normalizeGregorianYM(ymIn)
+		ymGreg, err := syncsvc.NormalizeGregorianYM(ymIn)
 		if err != nil {
 			log.Fatalf("ora-test YM: %v", err)
 		}
@@ -110,7 +188,7 @@ func main() {
 		if ymIn == "" {
 			ymIn = fmt.Sprintf("%04d10", time.Now().Year())
 		}
-		ymGreg, err := normalizeGregorianYM(ymIn)
+		ymGreg, err := syncsvc.NormalizeGregorianYM(ymIn)
 		if err != nil {
 			log.Fatalf("init-once YM: %v", err)
 		}
@@ -119,16 +197,20 @@ func main() {
 			log.Fatalf("init-once Thai YM: %v", err)
 		}
 		for _, b := range cfg.Branches {
-			if _, _, err := svc.InitCustcodes(ctx, fiscal, strings.TrimSpace(b), thaiYM, "manual"); err != nil {
+			if _, _, err := svc.InitCustcodes(ctx, fiscal, strings.TrimSpace(b), thaiYM, cfg.Sync.BackfillMonths, "manual"); err != nil {
 				log.Printf("init %s: %v", b, err)
 			}
 		}
+		branchSends.Wait()
 		log.Println("init-once completed")
 	case "month-once":
 		ym := strings.TrimSpace(os.Getenv("YM"))
 		if ym == "" {
 			log.Fatal("month-once: YM=YYYYMM is required")
 		}
+		if syncsvc.IsFutureYM(ym, time.Now().In(loc)) && !getEnvBool("ALLOW_FUTURE", false) {
+			log.Fatalf("month-once: YM=%s is after the current month; Oracle has no data for it yet (set ALLOW_FUTURE=true to override)", ym)
+		}
 		bs := 100
 		if v := strings.TrimSpace(os.Getenv("BATCH_SIZE")); v != "" {
 			if n, err := fmt.Sscanf(v, "%d", &bs); n == 0 || err != nil {
@@ -140,174 +222,412 @@ func main() {
 				log.Printf("month %s: %v", b, err)
 			}
 		}
+		branchSends.Wait()
 		log.Println("month-once completed")
 	default:
 		// Scheduler mode (no MODE specified)
-		loc, err := time.LoadLocation(cfg.Timezone)
-		if err != nil {
-			log.Fatalf("timezone: %v", err)
-		}
+		// SIGINT/SIGTERM cancel rootCtx: running syncs abort between batches (the open
+		// batch transaction rolls back) and no new branches start
+		rootCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		var running atomic.Int32
+
 		// Use seconds-field cron (6 fields) to match defaults like "0 0 22 15 10 *"
-		cr := cron.New(cron.WithLocation(loc), cron.WithSeconds())
-
-		// Yearly cohort init (optional)
-		if cfg.EnableYearlyInit {
-			_, err = cr.AddFunc(cfg.YearlySpec, func() {
-			now := time.Now().In(loc)
-			fiscal := fiscalYear(now)
-			// Use Gregorian October of current year for YM; convert to Thai for Oracle
-			ymGreg := fmt.Sprintf("%04d10", now.Year())
-			thaiYM, _ := toThaiYM(ymGreg)
-			log.Printf("cron yearly: start fiscal=%d debt_ym=%s branches=%d", fiscal, thaiYM, len(cfg.Branches))
-
-			startTime := time.Now()
-			var failedBranches []string
-			var lastError error
-
-			// Concurrency + retry controls
-			conc := getEnvInt("SYNC_CONCURRENCY", 2)
-			retries := getEnvInt("SYNC_RETRIES", 2)
-			delay := getEnvDur("SYNC_RETRY_DELAY", 10*time.Second)
-			runBranchesConcurrent(cfg.Branches, conc, func(branch string) {
-				err := runWithRetry(retries, delay, func() error {
-					_, _, err := svc.InitCustcodes(context.Background(), fiscal, strings.TrimSpace(branch), thaiYM, "scheduler")
-					return err
-				}, func(attempt int, err error) {
-					log.Printf("cron yearly init %s attempt=%d: %v", branch, attempt, err)
-				})
-				if err != nil {
-					failedBranches = append(failedBranches, branch)
-					lastError = err
-				}
-			})
+		cr := cron.New(cron.WithLocation(loc), cron.WithSeconds(), cron.WithChain(countRunning(&running)))
 
-			duration := time.Since(startTime)
-			if len(failedBranches) > 0 {
-				log.Printf("cron yearly: completed with errors (failed: %d/%d)", len(failedBranches), len(cfg.Branches))
-				notifier.NotifyYearlyFailure(fiscal, cfg.Branches, failedBranches, lastError)
-			} else {
-				log.Printf("cron yearly: completed successfully")
-				notifier.NotifyYearlySuccess(fiscal, cfg.Branches, duration)
-			}
-		})
-		if err != nil {
-			log.Fatalf("cron yearly add: %v", err)
-		}
-		} else {
-			log.Printf("yearly init disabled (ENABLE_YEARLY_INIT=false)")
-		}
-
-		// Monthly details (optional)
-		if cfg.EnableMonthlySync {
-			_, err = cr.AddFunc(cfg.MonthlySpec, func() {
-			now := time.Now().In(loc)
-			ym := fmt.Sprintf("%04d%02d", now.Year(), int(now.Month()))
-			log.Printf("cron monthly: start ym=%s branches=%d", ym, len(cfg.Branches))
-
-			startTime := time.Now()
-			var failedBranches []string
-			var lastError error
-
-			// Controls
-			conc := getEnvInt("SYNC_CONCURRENCY", 2)
-			retries := getEnvInt("SYNC_RETRIES", 2)
-			delay := getEnvDur("SYNC_RETRY_DELAY", 10*time.Second)
-			bs := getEnvInt("BATCH_SIZE", 100)
-			runBranchesConcurrent(cfg.Branches, conc, func(branch string) {
-				err := runWithRetry(retries, delay, func() error {
-					_, _, err := svc.MonthlyDetails(context.Background(), ym, strings.TrimSpace(branch), bs, "scheduler")
-					return err
-				}, func(attempt int, err error) {
-					log.Printf("cron monthly %s attempt=%d: %v", branch, attempt, err)
+		// Jobs take a snapshot of live when they fire; SIGHUP swaps it and re-registers
+		// the entries through schedule
+		live := &liveConfig{cfg: cfg}
+		schedule := func(cfg config.Config) ([]cron.EntryID, error) {
+			var ids []cron.EntryID
+			// Yearly cohort init (optional)
+			if cfg.EnableYearlyInit {
+				id, err := cr.AddFunc(cfg.YearlySpec, func() {
+				cfg := live.Get()
+				now := time.Now().In(loc)
+				fiscal := fiscalYear(now)
+				// Use Gregorian October of current year for YM; convert to Thai for Oracle
+				ymGreg := fmt.Sprintf("%04d10", now.Year())
+				thaiYM, _ := toThaiYM(ymGreg)
+				log.Printf("cron yearly: start fiscal=%d debt_ym=%s branches=%d", fiscal, thaiYM, len(cfg.Branches))
+
+				startTime := time.Now()
+				var failedBranches []string
+				var lastError error
+
+				// Concurrency + retry controls
+				conc := getEnvInt("SYNC_CONCURRENCY", 2)
+				retries := getEnvInt("SYNC_RETRIES", 2)
+				delay := getEnvDur("SYNC_RETRY_DELAY", 10*time.Second)
+				// BACKFILL_MODE=deferred: inits queue their backfill, run once all are done
+				var backfills *syncsvc.BackfillQueue
+				if cfg.Sync.BackfillMode == syncsvc.BackfillDeferred {
+					backfills = &syncsvc.BackfillQueue{}
+				}
+				runYearlyInits(rootCtx, cfg.Branches, conc, backfills, func(initCtx context.Context, branch string) {
+					err := runWithRetry(rootCtx, retries, delay, func(attempt int) error {
+						_, _, err := svc.InitCustcodes(syncsvc.WithRetryAttempt(initCtx, attempt), fiscal, strings.TrimSpace(branch), thaiYM, cfg.Sync.BackfillMonths, "scheduler")
+						return err
+					}, func(attempt int, err error) {
+						log.Printf("cron yearly init %s attempt=%d: %v", branch, attempt, err)
+					})
+					if err != nil {
+						failedBranches = append(failedBranches, branch)
+						lastError = err
+					}
+				}, func(job syncsvc.BackfillJob) {
+					if err := svc.RunBackfill(rootCtx, job); err != nil {
+						log.Printf("cron yearly backfill %s: %v", job.Branch, err)
+					}
 				})
-				if err != nil {
-					failedBranches = append(failedBranches, branch)
-					lastError = err
+
+				duration := time.Since(startTime)
+				if len(failedBranches) > 0 {
+					log.Printf("cron yearly: completed with errors (failed: %d/%d)", len(failedBranches), len(cfg.Branches))
+					notifier.NotifyYearlyFailure(fiscal, cfg.Branches, failedBranches, lastError)
+				} else {
+					log.Printf("cron yearly: completed successfully")
+					notifier.NotifyYearlySuccess(fiscal, cfg.Branches, duration)
 				}
+				ev := syncEvent("yearly_init", cfg.Branches, failedBranches, lastError, duration)
+				ev.FiscalYear = fiscal
+				webhook.NotifySync(context.Background(), ev)
 			})
-
-			duration := time.Since(startTime)
-			if len(failedBranches) > 0 {
-				log.Printf("cron monthly: completed with errors (failed: %d/%d)", len(failedBranches), len(cfg.Branches))
-				notifier.NotifyMonthlyFailure(ym, cfg.Branches, failedBranches, lastError)
+			if err != nil {
+				return ids, fmt.Errorf("cron yearly add: %w", err)
+			}
+			ids = append(ids, id)
 			} else {
-				log.Printf("cron monthly: completed successfully ym=%s", ym)
-				notifier.NotifyMonthlySuccess(ym, cfg.Branches, duration)
+				log.Printf("yearly init disabled (ENABLE_YEARLY_INIT=false)")
 			}
-		})
-		if err != nil {
-			log.Fatalf("cron monthly add: %v", err)
-		}
-		} else {
-			log.Printf("monthly sync disabled (ENABLE_MONTHLY_SYNC=false)")
-		}
-
-		// Alert notification (optional)
-		if cfg.EnableAlert {
-			alertService := alert.NewService(
-				pg,
-				cfg.Telegram.BotToken,
-				cfg.Alert.ChatID,
-				cfg.Alert.Threshold,
-				cfg.Alert.Link,
-			)
-			_, err = cr.AddFunc(cfg.AlertSpec, func() {
+
+			// Monthly details (optional)
+			if cfg.EnableMonthlySync {
+				id, err := cr.AddFunc(cfg.MonthlySpec, func() {
+				cfg := live.Get()
 				now := time.Now().In(loc)
-				log.Printf("cron alert: starting threshold=%.1f%%", cfg.Alert.Threshold)
-				if err := alertService.RunDaily(context.Background(), now); err != nil {
-					log.Printf("cron alert: error %v", err)
+				ym := fmt.Sprintf("%04d%02d", now.Year(), int(now.Month()))
+				log.Printf("cron monthly: start ym=%s branches=%d", ym, len(cfg.Branches))
+
+				startTime := time.Now()
+				var failedBranches []string
+				var lastError error
+
+				// Controls
+				conc := getEnvInt("SYNC_CONCURRENCY", 2)
+				retries := getEnvInt("SYNC_RETRIES", 2)
+				delay := getEnvDur("SYNC_RETRY_DELAY", 10*time.Second)
+				bs := getEnvInt("BATCH_SIZE", 100)
+				runBranchesConcurrent(rootCtx, cfg.Branches, conc, func(branch string) {
+					err := runWithRetry(rootCtx, retries, delay, func(attempt int) error {
+						_, _, err := svc.MonthlyDetails(syncsvc.WithRetryAttempt(rootCtx, attempt), ym, strings.TrimSpace(branch), bs, "scheduler")
+						return err
+					}, func(attempt int, err error) {
+						log.Printf("cron monthly %s attempt=%d: %v", branch, attempt, err)
+					})
+					if err != nil {
+						failedBranches = append(failedBranches, branch)
+						lastError = err
+					}
+				})
+
+				duration := time.Since(startTime)
+				if len(failedBranches) > 0 {
+					log.Printf("cron monthly: completed with errors (failed: %d/%d)", len(failedBranches), len(cfg.Branches))
+					notifier.NotifyMonthlyFailure(ym, cfg.Branches, failedBranches, lastError)
 				} else {
-					log.Printf("cron alert: completed successfully")
+					log.Printf("cron monthly: completed successfully ym=%s", ym)
+					notifier.NotifyMonthlySuccess(ym, cfg.Branches, duration)
 				}
+				ev := syncEvent("monthly_sync", cfg.Branches, failedBranches, lastError, duration)
+				ev.YearMonth = ym
+				webhook.NotifySync(context.Background(), ev)
 			})
 			if err != nil {
-				log.Fatalf("cron alert add: %v", err)
+				return ids, fmt.Errorf("cron monthly add: %w", err)
 			}
-		} else {
-			log.Printf("alert notifications disabled (ENABLE_ALERT=false)")
+			ids = append(ids, id)
+			} else {
+				log.Printf("monthly sync disabled (ENABLE_MONTHLY_SYNC=false)")
+			}
+
+			// Alert notification (optional)
+			if cfg.EnableAlert {
+				alertService := alert.NewService(
+					pg,
+					cfg.Telegram.BotToken,
+					cfg.Alert.ChatID,
+					cfg.Alert.Threshold,
+					cfg.Alert.Link,
+					alert.Options{
+						Concurrency:     cfg.Alert.Concurrency,
+						SkipEmpty:       !cfg.Alert.NotifyEmpty,
+						Mode:            cfg.Alert.Mode,
+						MADThreshold:    cfg.Alert.MADThreshold,
+						Direction:       cfg.Alert.Direction,
+						MinUsage:        cfg.Alert.MinUsage,
+						InactiveStates:  cfg.Alert.InactiveStates,
+						BranchNameOrder: cfg.BranchNameOrder,
+						SendAttempts:    cfg.Telegram.SendAttempts,
+						SendRetryDelay:  cfg.Telegram.RetryDelay,
+						Provider:        cfg.NotifyProvider,
+						SlackWebhook:    cfg.Slack.WebhookURL,
+					},
+				)
+				id, err := cr.AddFunc(cfg.AlertSpec, func() {
+					now := time.Now().In(loc)
+					log.Printf("cron alert: starting threshold=%.1f%%", cfg.Alert.Threshold)
+					if err := alertService.RunDaily(rootCtx, now); err != nil {
+						log.Printf("cron alert: error %v", err)
+					} else {
+						log.Printf("cron alert: completed successfully")
+					}
+				})
+				if err != nil {
+					return ids, fmt.Errorf("cron alert add: %w", err)
+				}
+				ids = append(ids, id)
+			} else {
+				log.Printf("alert notifications disabled (ENABLE_ALERT=false)")
+			}
+
+			return ids, nil
+		}
+		entries, err := schedule(cfg)
+		if err != nil {
+			log.Fatalf("%v", err)
 		}
 
 		// Log scheduler status
-		yearlyStatus := "disabled"
-		if cfg.EnableYearlyInit {
-			yearlyStatus = cfg.YearlySpec
+		logSchedule := func(cfg config.Config) {
+			yearlyStatus := "disabled"
+			if cfg.EnableYearlyInit {
+				yearlyStatus = cfg.YearlySpec
+			}
+			monthlyStatus := "disabled"
+			if cfg.EnableMonthlySync {
+				monthlyStatus = cfg.MonthlySpec
+			}
+			alertStatus := "disabled"
+			if cfg.EnableAlert {
+				alertStatus = cfg.AlertSpec
+			}
+			log.Printf("scheduler running (TZ=%s) yearly='%s' monthly='%s' alert='%s'", cfg.Timezone, yearlyStatus, monthlyStatus, alertStatus)
+		}
+		logSchedule(cfg)
+
+		// SIGHUP reloads the config (see config.Reload) and re-registers the cron entries
+		// with the new specs and branches. A config that fails to load or parse is
+		// rejected and the current one kept; running jobs finish with their snapshot.
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for {
+				select {
+				case <-rootCtx.Done():
+					return
+				case <-hup:
+				}
+				next, err := config.Reload()
+				if err != nil {
+					log.Printf("reload: rejected, keeping the current config: %v", err)
+					continue
+				}
+				cur := live.Get()
+				applied, ignored := configChanges(cur, next)
+				if len(ignored) > 0 {
+					log.Printf("reload: %s changed but need a restart; ignored", strings.Join(ignored, ", "))
+				}
+				if len(applied) == 0 {
+					log.Printf("reload: no changes to apply")
+					continue
+				}
+				next = reloadable(cur, next)
+				for _, change := range applied {
+					log.Printf("reload: %s", change)
+				}
+				live.Set(next)
+				for _, id := range entries {
+					cr.Remove(id)
+				}
+				if entries, err = schedule(next); err != nil {
+					log.Printf("reload: %v", err)
+				}
+				logSchedule(next)
+			}
+		}()
+
+		// Dead-man's switch: GET /healthz/heartbeat on the API reports when this stops
+		go syncsvc.NewHeartbeat(pg).Run(rootCtx, cfg.Heartbeat.Interval)
+		cr.Start()
+
+		<-rootCtx.Done()
+		log.Printf("scheduler: shutdown signal received, %d job(s) still running", running.Load())
+		wait := getEnvDur("SHUTDOWN_TIMEOUT", time.Minute)
+		deadline := time.Now().Add(wait)
+		select {
+		case <-cr.Stop().Done():
+			log.Printf("scheduler: stopped")
+		case <-time.After(wait):
+			log.Printf("scheduler: %d job(s) still running after SHUTDOWN_TIMEOUT=%s, exiting", running.Load(), wait)
 		}
-		monthlyStatus := "disabled"
-		if cfg.EnableMonthlySync {
-			monthlyStatus = cfg.MonthlySpec
+		// Per-branch notifications are sent in the background; give them what is left
+		// of SHUTDOWN_TIMEOUT so the last jobs' results are not dropped
+		if !waitTimeout(&branchSends, time.Until(deadline)) {
+			log.Printf("scheduler: per-branch notifications still sending after SHUTDOWN_TIMEOUT=%s, exiting", wait)
 		}
-		alertStatus := "disabled"
-		if cfg.EnableAlert {
-			alertStatus = cfg.AlertSpec
+		// Notifications deferred by quiet hours are only held in memory; send them now
+		notifier.Flush()
+	}
+}
+
+// waitTimeout waits for wg for at most d and reports whether it finished
+func waitTimeout(wg *sync.WaitGroup, d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// perBranchEnabled reports whether NOTIFY_PER_BRANCH is on and has a notification
+// channel to send to, logging when it is ignored for lack of one
+func perBranchEnabled(cfg config.Config) bool {
+	switch {
+	case !cfg.Telegram.PerBranch:
+		return false
+	case cfg.NotifyProvider == notify.ProviderNone,
+		cfg.NotifyProvider == notify.ProviderTelegram && !cfg.Telegram.Enabled:
+		log.Printf("NOTIFY_PER_BRANCH ignored: no notification channel enabled")
+		return false
+	}
+	return true
+}
+
+// notifyBranchDone returns the OnBranchDone hook sending branchMessage through send.
+// Messages go out in the background so a slow chat API does not hold up the next
+// branch; wg tracks them so a run can wait for the last one before exiting.
+func notifyBranchDone(send func(string) error, wg *sync.WaitGroup) func(syncsvc.BranchResult) {
+	return func(r syncsvc.BranchResult) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := send(branchMessage(r)); err != nil {
+				log.Printf("per-branch notify %s: %v", r.Branch, err)
+			}
+		}()
+	}
+}
+
+// branchMessage is the NOTIFY_PER_BRANCH message for one finished branch
+func branchMessage(r syncsvc.BranchResult) string {
+	period := "ym=" + r.YM
+	if r.SyncType == "yearly_init" {
+		period = fmt.Sprintf("fiscal=%d debt_ym=%s", r.FiscalYear, r.YM)
+	}
+	retry := ""
+	if r.Attempt > 0 {
+		retry = fmt.Sprintf(" (retry %d)", r.Attempt)
+	}
+	if r.Err != nil {
+		return fmt.Sprintf("❌ %s %s %s failed after %s%s: %v", r.SyncType, r.Branch, period, notify.FormatDuration(r.Duration), retry, r.Err)
+	}
+	return fmt.Sprintf("✅ %s %s %s: upserted=%d zeroed=%d in %s%s", r.SyncType, r.Branch, period, r.Upserted, r.Zeroed, notify.FormatDuration(r.Duration), retry)
+}
+
+// countRunning tracks how many cron jobs are executing, for the shutdown log
+func countRunning(n *atomic.Int32) cron.JobWrapper {
+	return func(j cron.Job) cron.Job {
+		return cron.FuncJob(func() {
+			n.Add(1)
+			defer n.Add(-1)
+			j.Run()
+		})
+	}
+}
+
+// syncEvent builds the webhook payload for a finished scheduled run
+func syncEvent(event string, branches, failedBranches []string, lastError error, duration time.Duration) notify.SyncEvent {
+	ev := notify.SyncEvent{
+		Event:          event,
+		Status:         "success",
+		Branches:       branches,
+		FailedBranches: failedBranches,
+		DurationMs:     duration.Milliseconds(),
+		FinishedAt:     time.Now().Format(time.RFC3339),
+	}
+	if len(failedBranches) > 0 {
+		ev.Status = "error"
+		if lastError != nil {
+			ev.Error = lastError.Error()
 		}
-		log.Printf("scheduler running (TZ=%s) yearly='%s' monthly='%s' alert='%s'", cfg.Timezone, yearlyStatus, monthlyStatus, alertStatus)
-		cr.Run()
 	}
+	return ev
 }
 
 // helpers: concurrency & retry
-func runWithRetry(retries int, delay time.Duration, fn func() error, onErr func(attempt int, err error)) error {
+// runWithRetry calls fn until it succeeds or retries are exhausted; fn receives
+// the current attempt (0 = first try). It gives up without retrying once ctx is done.
+func runWithRetry(ctx context.Context, retries int, delay time.Duration, fn func(attempt int) error, onErr func(attempt int, err error)) error {
 	if retries < 0 {
 		retries = 0
 	}
 	attempt := 0
 	for {
-		err := fn()
+		err := fn(attempt)
 		if err == nil {
 			return nil
 		}
-		if attempt >= retries {
+		if attempt >= retries || ctx.Err() != nil {
 			return err
 		}
 		attempt++
 		if onErr != nil {
 			onErr(attempt, err)
 		}
-		time.Sleep(delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
 	}
 }
 
-func runBranchesConcurrent(branches []string, concurrency int, job func(branch string)) {
+// runYearlyInits runs initBranch for every branch, at most concurrency at a time. With a
+// backfill queue (BACKFILL_MODE=deferred) the inits queue their backfills on it
+// instead of running them, and backfill runs each queued job once every init has
+// finished, again at most concurrency at a time.
+func runYearlyInits(ctx context.Context, branches []string, concurrency int, backfills *syncsvc.BackfillQueue,
+	initBranch func(ctx context.Context, branch string), backfill func(job syncsvc.BackfillJob)) {
+	initCtx := ctx
+	if backfills != nil {
+		initCtx = syncsvc.WithDeferredBackfill(ctx, backfills)
+	}
+	runBranchesConcurrent(ctx, branches, concurrency, func(branch string) { initBranch(initCtx, branch) })
+	if backfills == nil {
+		return
+	}
+
+	jobs := backfills.Jobs()
+	log.Printf("cron yearly: all inits done, running %d deferred backfills (concurrency=%d)", len(jobs), concurrency)
+	byBranch := make(map[string]syncsvc.BackfillJob, len(jobs))
+	queued := make([]string, len(jobs))
+	for i, job := range jobs {
+		byBranch[job.Branch] = job
+		queued[i] = job.Branch
+	}
+	runBranchesConcurrent(ctx, queued, concurrency, func(branch string) { backfill(byBranch[branch]) })
+}
+
+// runBranchesConcurrent runs job for each branch, at most concurrency at a time.
+// Once ctx is done, branches that have not started are skipped.
+func runBranchesConcurrent(ctx context.Context, branches []string, concurrency int, job func(branch string)) {
 	if concurrency < 1 {
 		concurrency = 1
 	}
@@ -319,6 +639,11 @@ func runBranchesConcurrent(branches []string, concurrency int, job func(branch s
 	go func() {
 		for _, b := range branches {
 			sem <- struct{}{}
+			if ctx.Err() != nil {
+				log.Printf("shutdown: skipping branch %s", b)
+				<-sem
+				continue
+			}
 			branch := b
 			go func() {
 				defer func() { <-sem }()
@@ -343,32 +668,22 @@ func getEnvInt(key string, def int) int {
 	return def
 }
 
-func getEnvDur(key string, def time.Duration) time.Duration {
+func getEnvBool(key string, def bool) bool {
 	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			return d
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
 		}
 	}
 	return def
 }
 
-// normalizeGregorianYM accepts either Thai YYYYMM or Gregorian YYYYMM and returns Gregorian YYYYMM.
-func normalizeGregorianYM(ym string) (string, error) {
-	if len(ym) != 6 {
-		return "", fmt.Errorf("invalid ym; expect YYYYMM")
-	}
-	y, err := strconv.Atoi(ym[:4])
-	if err != nil {
-		return "", fmt.Errorf("invalid ym year")
-	}
-	m, err := strconv.Atoi(ym[4:])
-	if err != nil || m < 1 || m > 12 {
-		return "", fmt.Errorf("invalid ym month")
-	}
-	if y >= 2400 { // Thai -> convert to Gregorian
-		y -= 543
+func getEnvDur(key string, def time.Duration) time.Duration {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
 	}
-	return fmt.Sprintf("%04d%02d", y, m), nil
+	return def
 }
 
 func fiscalYear(t time.Time) int {
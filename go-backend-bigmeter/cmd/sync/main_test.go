@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-backend-bigmeter/internal/config"
+	"go-backend-bigmeter/internal/notify"
+	syncsvc "go-backend-bigmeter/internal/sync"
+)
+
+func TestRunYearlyInits(t *testing.T) {
+	branches := []string{"BA01", "BA02", "BA03", "BA04", "BA05"}
+	tests := []struct {
+		name          string
+		deferred      bool
+		wantBackfills []string
+	}{
+		{name: "inline", deferred: false},
+		{name: "deferred", deferred: true, wantBackfills: branches},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const concurrency = 2
+			var (
+				mu                sync.Mutex
+				events            []string
+				active, maxActive int
+				backfilled        []string
+			)
+			enter := func(event string) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, event)
+				active++
+				maxActive = max(maxActive, active)
+			}
+			leave := func(event string) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, event)
+				active--
+			}
+			var queue *syncsvc.BackfillQueue
+			if tt.deferred {
+				queue = &syncsvc.BackfillQueue{}
+			}
+
+			runYearlyInits(context.Background(), branches, concurrency, queue, func(ctx context.Context, branch string) {
+				enter("init")
+				defer leave("init done")
+				time.Sleep(10 * time.Millisecond)
+				if tt.deferred {
+					queue.Add(syncsvc.BackfillJob{Branch: branch, Months: 3})
+				}
+			}, func(job syncsvc.BackfillJob) {
+				enter("backfill")
+				defer leave("backfill done")
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				backfilled = append(backfilled, job.Branch)
+				mu.Unlock()
+			})
+
+			sort.Strings(backfilled)
+			if !reflect.DeepEqual(backfilled, tt.wantBackfills) {
+				t.Errorf("backfilled %v, want %v", backfilled, tt.wantBackfills)
+			}
+			if i := slices.Index(events, "backfill"); i >= 0 && slices.Contains(events[i:], "init done") {
+				t.Errorf("a backfill started before every init was done: %v", events)
+			}
+			if maxActive > concurrency {
+				t.Errorf("%d jobs ran at once, want at most %d", maxActive, concurrency)
+			}
+		})
+	}
+}
+
+func TestPerBranchNotifications(t *testing.T) {
+	tests := []struct {
+		name      string
+		perBranch bool
+		provider  string
+		telegram  bool
+		want      bool
+	}{
+		{name: "telegram", perBranch: true, provider: notify.ProviderTelegram, telegram: true, want: true},
+		{name: "slack", perBranch: true, provider: notify.ProviderSlack, want: true},
+		{name: "off by default", provider: notify.ProviderTelegram, telegram: true},
+		{name: "telegram disabled", perBranch: true, provider: notify.ProviderTelegram},
+		{name: "provider none", perBranch: true, provider: notify.ProviderNone},
+	}
+	results := []syncsvc.BranchResult{
+		{SyncType: "monthly_sync", Branch: "BA01", YM: "202410", Upserted: 200, Duration: 90 * time.Second},
+		{SyncType: "yearly_init", Branch: "BA02", YM: "256710", FiscalYear: 2025, Err: errors.New("oracle down")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config.Config
+			cfg.NotifyProvider = tt.provider
+			cfg.Telegram.PerBranch, cfg.Telegram.Enabled = tt.perBranch, tt.telegram
+			if got := perBranchEnabled(cfg); got != tt.want {
+				t.Fatalf("perBranchEnabled = %t, want %t", got, tt.want)
+			}
+
+			// wired the way main does: the service only calls the hook when it is set
+			svc := &syncsvc.Service{}
+			var mu sync.Mutex
+			var sent []string
+			var wg sync.WaitGroup
+			if perBranchEnabled(cfg) {
+				svc.OnBranchDone = notifyBranchDone(func(msg string) error {
+					time.Sleep(10 * time.Millisecond) // a slow chat API
+					mu.Lock()
+					defer mu.Unlock()
+					sent = append(sent, msg)
+					return nil
+				}, &wg)
+			}
+			for _, r := range results {
+				if svc.OnBranchDone != nil {
+					svc.OnBranchDone(r)
+				}
+			}
+			wg.Wait()
+
+			if !tt.want {
+				if len(sent) != 0 {
+					t.Errorf("sent %q, want nothing", sent)
+				}
+				return
+			}
+			if len(sent) != len(results) {
+				t.Fatalf("sent %d messages after Wait, want %d", len(sent), len(results))
+			}
+			sort.Strings(sent)
+			if !strings.Contains(sent[0], "monthly_sync BA01 ym=202410: upserted=200") ||
+				!strings.Contains(sent[1], "yearly_init BA02 fiscal=2025 debt_ym=256710 failed") {
+				t.Errorf("messages %q", sent)
+			}
+		})
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	if waitTimeout(&wg, 20*time.Millisecond) {
+		t.Fatal("waitTimeout reported done while a send is pending")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		wg.Done()
+	}()
+	if !waitTimeout(&wg, time.Second) {
+		t.Fatal("waitTimeout timed out after the send finished")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go-backend-bigmeter/internal/config"
+)
+
+// liveConfig is the scheduler's current config. SIGHUP swaps it while cron jobs read
+// it, so jobs take a snapshot with Get when they start.
+type liveConfig struct {
+	mu  sync.RWMutex
+	cfg config.Config
+}
+
+func (l *liveConfig) Get() config.Config {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.cfg
+}
+
+func (l *liveConfig) Set(cfg config.Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+}
+
+// reloadable returns cur with only the settings a SIGHUP can apply taken from next:
+// branches, cron specs, the ENABLE_* switches and the alert digest settings. The rest
+// (connections, timezone, notifier, sync tuning) is built once at startup and kept.
+func reloadable(cur, next config.Config) config.Config {
+	out := cur
+	out.Branches = next.Branches
+	out.YearlySpec = next.YearlySpec
+	out.MonthlySpec = next.MonthlySpec
+	out.AlertSpec = next.AlertSpec
+	out.EnableYearlyInit = next.EnableYearlyInit
+	out.EnableMonthlySync = next.EnableMonthlySync
+	out.EnableAlert = next.EnableAlert
+	out.Alert = next.Alert
+	out.BranchNameOrder = next.BranchNameOrder
+	return out
+}
+
+// configChanges describes what a reload changes: applied lists the differences in the
+// reloadable settings, ignored the changed settings that need a restart.
+func configChanges(cur, next config.Config) (applied, ignored []string) {
+	if added, removed := diffBranches(cur.Branches, next.Branches); len(added)+len(removed) > 0 {
+		applied = append(applied, fmt.Sprintf("branches %d -> %d (added: %s; removed: %s)",
+			len(cur.Branches), len(next.Branches), joinOrNone(added), joinOrNone(removed)))
+	}
+	str := func(name, a, b string) {
+		if a != b {
+			applied = append(applied, fmt.Sprintf("%s '%s' -> '%s'", name, a, b))
+		}
+	}
+	str("CRON_YEARLY", cur.YearlySpec, next.YearlySpec)
+	str("CRON_MONTHLY", cur.MonthlySpec, next.MonthlySpec)
+	str("CRON_ALERT", cur.AlertSpec, next.AlertSpec)
+	flag := func(name string, a, b bool) {
+		if a != b {
+			applied = append(applied, fmt.Sprintf("%s %t -> %t", name, a, b))
+		}
+	}
+	flag("ENABLE_YEARLY_INIT", cur.EnableYearlyInit, next.EnableYearlyInit)
+	flag("ENABLE_MONTHLY_SYNC", cur.EnableMonthlySync, next.EnableMonthlySync)
+	flag("ENABLE_ALERT", cur.EnableAlert, next.EnableAlert)
+	if !reflect.DeepEqual(cur.Alert, next.Alert) {
+		applied = append(applied, "alert settings (TELEGRAM_ALERT_*, ALERT_*)")
+	}
+	if !reflect.DeepEqual(cur.BranchNameOrder, next.BranchNameOrder) {
+		applied = append(applied, fmt.Sprintf("BRANCH_NAME_ORDER %s -> %s",
+			strings.Join(cur.BranchNameOrder, ","), strings.Join(next.BranchNameOrder, ",")))
+	}
+
+	restart := []struct {
+		name    string
+		changed bool
+	}{
+		{"TIMEZONE", cur.Timezone != next.Timezone},
+		{"POSTGRES_DSN", cur.PostgresDSN != next.PostgresDSN},
+		{"ORACLE_DSN", cur.OracleDSN != next.OracleDSN},
+		{"ORACLE_SESSION_PARAMS", !reflect.DeepEqual(cur.OracleSessionParams, next.OracleSessionParams)},
+		{"NOTIFY_PROVIDER", cur.NotifyProvider != next.NotifyProvider},
+		{"TELEGRAM_*", !reflect.DeepEqual(cur.Telegram, next.Telegram)},
+		{"SLACK_WEBHOOK_URL", cur.Slack != next.Slack},
+		{"EMAIL_*/SMTP_*", !reflect.DeepEqual(cur.Email, next.Email)},
+		{"SYNC_WEBHOOK_*", cur.Webhook != next.Webhook},
+		{"sync settings", !reflect.DeepEqual(cur.Sync, next.Sync)},
+		{"HEARTBEAT_*", !reflect.DeepEqual(cur.Heartbeat, next.Heartbeat)},
+	}
+	for _, r := range restart {
+		if r.changed {
+			ignored = append(ignored, r.name)
+		}
+	}
+	return applied, ignored
+}
+
+// diffBranches returns the codes only in next (added) and only in cur (removed)
+func diffBranches(cur, next []string) (added, removed []string) {
+	in := func(list []string) map[string]bool {
+		m := make(map[string]bool, len(list))
+		for _, b := range list {
+			m[strings.TrimSpace(b)] = true
+		}
+		return m
+	}
+	curSet, nextSet := in(cur), in(next)
+	for _, b := range next {
+		if !curSet[strings.TrimSpace(b)] {
+			added = append(added, b)
+		}
+	}
+	for _, b := range cur {
+		if !nextSet[strings.TrimSpace(b)] {
+			removed = append(removed, b)
+		}
+	}
+	return added, removed
+}
+
+func joinOrNone(list []string) string {
+	if len(list) == 0 {
+		return "none"
+	}
+	return strings.Join(list, ",")
+}
@@ -0,0 +1,67 @@
+package alert
+
+import (
+	"math"
+	"sort"
+)
+
+// Alert modes (ALERT_MODE)
+const (
+	ModePctDrop      = "pct_drop"
+	ModeCohortMedian = "cohort_median"
+)
+
+// medianOutliers flags customers whose current usage is more than madThreshold
+// median-absolute-deviations away from the branch cohort's median for the month.
+// Median/MAD are robust to the few very large users that dominate a mean. A MAD of 0
+// (most customers identical) gives no scale, so nothing is flagged.
+func medianOutliers(branchCode string, data []UsageData, madThreshold float64) []CustomerUsage {
+	if len(data) == 0 {
+		return nil
+	}
+	values := make([]float64, len(data))
+	for i, d := range data {
+		values[i] = d.PresentWaterUsage
+	}
+	med := median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - med)
+	}
+	mad := median(deviations)
+	if mad == 0 {
+		return nil
+	}
+
+	var customers []CustomerUsage
+	for _, d := range data {
+		score := (d.PresentWaterUsage - med) / mad
+		if math.Abs(score) <= madThreshold {
+			continue
+		}
+		var pct float64
+		if med != 0 {
+			pct = (d.PresentWaterUsage - med) / med * 100
+		}
+		customers = append(customers, CustomerUsage{
+			CustCode:      d.CustCode,
+			BranchCode:    branchCode,
+			CurrentUsage:  d.PresentWaterUsage,
+			PreviousUsage: med,
+			Percentage:    pct,
+			MADScore:      score,
+		})
+	}
+	return customers
+}
+
+// median returns the median of values (sorts a copy)
+func median(values []float64) float64 {
+	s := append([]float64(nil), values...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
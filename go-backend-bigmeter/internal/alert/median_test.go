@@ -0,0 +1,62 @@
+package alert
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMedianOutliers(t *testing.T) {
+	// median 13; absolute deviations 9,3,2,1,0,1,2,3,87 give a MAD of 2, so C01 scores
+	// -4.5 and C09 +43.5
+	spread := []float64{4, 10, 11, 12, 13, 14, 15, 16, 100}
+	tests := []struct {
+		name      string
+		usage     []float64
+		threshold float64
+		want      []string
+		wantScore []float64
+	}{
+		{name: "low and high outliers", usage: spread, threshold: 3, want: []string{"C01", "C09"}, wantScore: []float64{-4.5, 43.5}},
+		{name: "only the far outlier", usage: spread, threshold: 5, want: []string{"C09"}, wantScore: []float64{43.5}},
+		{name: "threshold above every score", usage: spread, threshold: 50},
+		{name: "identical usage, MAD 0", usage: []float64{7, 7, 7, 7, 500}, threshold: 3},
+		{name: "no rows", threshold: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]UsageData, len(tt.usage))
+			for i, u := range tt.usage {
+				data[i] = UsageData{CustCode: fmt.Sprintf("C%02d", i+1), PresentWaterUsage: u}
+			}
+			var got []string
+			var scores []float64
+			for _, c := range medianOutliers("BA01", data, tt.threshold) {
+				got = append(got, c.CustCode)
+				scores = append(scores, c.MADScore)
+				if c.BranchCode != "BA01" || c.PreviousUsage != 13 {
+					t.Errorf("%s: branch=%s baseline=%v, want BA01 and the median 13", c.CustCode, c.BranchCode, c.PreviousUsage)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(scores, tt.wantScore) {
+				t.Errorf("flagged %v scores %v, want %v %v", got, scores, tt.want, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{values: []float64{3, 1, 2}, want: 2},
+		{values: []float64{4, 1, 3, 2}, want: 2.5},
+		{values: []float64{5}, want: 5},
+	}
+	for _, tt := range tests {
+		if got := median(tt.values); got != tt.want {
+			t.Errorf("median(%v) = %v, want %v", tt.values, got, tt.want)
+		}
+	}
+}
@@ -25,7 +25,18 @@ func FormatAlertMessage(stats *AlertStats, link string) string {
 	// Header
 	builder.WriteString("🔔 แจ้งเตือน\n")
 	builder.WriteString(fmt.Sprintf("📅 ประจำวันที่ %s\n", dateStr))
-	builder.WriteString(fmt.Sprintf("📊 สรุปข้อมูลการใช้น้ำของผู้ใช้น้ำรายใหญ่ที่มีผลต่างการใช้น้ำลดลง %.0f%% ขึ้นไป ดังนี้\n", stats.Threshold))
+	if stats.Mode == ModeCohortMedian {
+		builder.WriteString(fmt.Sprintf("📊 สรุปข้อมูลผู้ใช้น้ำรายใหญ่ที่มีการใช้น้ำต่างจากค่ามัธยฐานของกลุ่มเกิน %.1f MAD ดังนี้\n", stats.MADThreshold))
+	} else {
+		change := "ลดลง"
+		switch stats.Direction {
+		case DirectionIncrease:
+			change = "เพิ่มขึ้น"
+		case DirectionBoth:
+			change = "ลดลงหรือเพิ่มขึ้น"
+		}
+		builder.WriteString(fmt.Sprintf("📊 สรุปข้อมูลการใช้น้ำของผู้ใช้น้ำรายใหญ่ที่มีผลต่างการใช้น้ำ%s %.0f%% ขึ้นไป ดังนี้\n", change, stats.Threshold))
+	}
 	builder.WriteString("\n---\n\n")
 
 	// Branch list
@@ -52,6 +63,38 @@ func FormatAlertMessage(stats *AlertStats, link string) string {
 	return builder.String()
 }
 
+// FormatStateAlertMessage formats meter_state transitions into a Thai language message
+func FormatStateAlertMessage(stats *StateAlertStats, link string) string {
+	var builder strings.Builder
+
+	builder.WriteString("🔔 แจ้งเตือนสถานะมาตร\n")
+	builder.WriteString(fmt.Sprintf("📅 ประจำวันที่ %s\n", FormatThaiDate(stats.GeneratedAt)))
+	builder.WriteString(fmt.Sprintf("📊 ผู้ใช้น้ำรายใหญ่ที่สถานะมาตรเปลี่ยนเป็น %s ในเดือน %s ดังนี้\n",
+		strings.Join(stats.InactiveStates, ", "), FormatThaiMonth(stats.YM)))
+	builder.WriteString("\n---\n\n")
+
+	if len(stats.Branches) == 0 {
+		builder.WriteString("ไม่พบรายการที่เข้าเงื่อนไข\n")
+	} else {
+		for _, branch := range stats.Branches {
+			branchName := branch.BranchName
+			if branchName == "" {
+				branchName = branch.BranchCode
+			}
+			builder.WriteString(fmt.Sprintf("- %s %d ราย\n", branchName, branch.Count))
+		}
+	}
+
+	builder.WriteString("\n---\n\n")
+
+	if link != "" {
+		builder.WriteString(fmt.Sprintf("💡 เข้าตรวจสอบข้อมูลเพิ่มเติมได้ที่ %s\n", link))
+	}
+	builder.WriteString("⏳ ขอให้เร่งรัดดำเนินการตรวจสอบด้วยครับ\n")
+
+	return builder.String()
+}
+
 // FormatThaiMonth formats YYYYMM to Thai month name
 func FormatThaiMonth(ym string) string {
 	if len(ym) != 6 {
@@ -2,8 +2,11 @@ package alert
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/jackc/pgx/v5"
+
 	dbpkg "go-backend-bigmeter/internal/database"
 )
 
@@ -21,11 +24,39 @@ func NewRepository(pg *dbpkg.Postgres) *Repository {
 type Branch struct {
 	Code string
 	Name string
+	// Alias is the optional short name preferred over the official Name
+	Alias string
+}
+
+// DefaultBranchNameOrder is the BRANCH_NAME_ORDER default
+var DefaultBranchNameOrder = []string{"alias", "name", "code"}
+
+// DisplayName renders the branch as the first non-empty of the fields in order
+// ("alias", "name", "code"); an empty order uses DefaultBranchNameOrder.
+func (b Branch) DisplayName(order []string) string {
+	if len(order) == 0 {
+		order = DefaultBranchNameOrder
+	}
+	for _, field := range order {
+		var v string
+		switch field {
+		case "alias":
+			v = b.Alias
+		case "name":
+			v = b.Name
+		case "code":
+			v = b.Code
+		}
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
 
 // GetAllBranches retrieves all branches from the database
 func (r *Repository) GetAllBranches(ctx context.Context) ([]Branch, error) {
-	query := `SELECT code, COALESCE(name, '') as name FROM bm_branches ORDER BY code`
+	query := `SELECT code, COALESCE(name, '') as name, COALESCE(alias, '') as alias FROM bm_branches ORDER BY code`
 	rows, err := r.pg.Pool.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query branches: %w", err)
@@ -35,7 +66,7 @@ func (r *Repository) GetAllBranches(ctx context.Context) ([]Branch, error) {
 	var branches []Branch
 	for rows.Next() {
 		var b Branch
-		if err := rows.Scan(&b.Code, &b.Name); err != nil {
+		if err := rows.Scan(&b.Code, &b.Name, &b.Alias); err != nil {
 			return nil, fmt.Errorf("failed to scan branch: %w", err)
 		}
 		branches = append(branches, b)
@@ -48,6 +79,16 @@ func (r *Repository) GetAllBranches(ctx context.Context) ([]Branch, error) {
 	return branches, nil
 }
 
+// GetBranch retrieves a single branch; a code missing from bm_branches is returned without a name
+func (r *Repository) GetBranch(ctx context.Context, code string) (Branch, error) {
+	b := Branch{Code: code}
+	err := r.pg.Pool.QueryRow(ctx, `SELECT COALESCE(name, ''), COALESCE(alias, '') FROM bm_branches WHERE code = $1`, code).Scan(&b.Name, &b.Alias)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return Branch{}, fmt.Errorf("failed to query branch %s: %w", code, err)
+	}
+	return b, nil
+}
+
 // UsageData represents usage data for a customer in a specific month
 type UsageData struct {
 	CustCode         string
@@ -84,3 +125,166 @@ func (r *Repository) GetMonthUsage(ctx context.Context, branchCode, ym string, f
 
 	return usageData, nil
 }
+
+// GetCustNames returns cust_name by cust_code from the fiscal-year cohort snapshot
+func (r *Repository) GetCustNames(ctx context.Context, branchCode string, fiscalYear int, custCodes []string) (map[string]string, error) {
+	query := `
+		SELECT cust_code, COALESCE(cust_name, '')
+		FROM bm_custcode_init
+		WHERE branch_code = $1 AND fiscal_year = $2 AND cust_code = ANY($3)
+	`
+	rows, err := r.pg.Pool.Query(ctx, query, branchCode, fiscalYear, custCodes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customer names for branch=%s: %w", branchCode, err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]string, len(custCodes))
+	for rows.Next() {
+		var code, name string
+		if err := rows.Scan(&code, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan customer name: %w", err)
+		}
+		names[code] = name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating customer names: %w", err)
+	}
+	return names, nil
+}
+
+// SaveAlertRun records an alert run and its per-branch counts in bm_alert_logs
+func (r *Repository) SaveAlertRun(ctx context.Context, stats *AlertStats) (int64, error) {
+	tx, err := r.pg.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin alert log: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var id int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO bm_alert_logs (ym, prev_ym, mode, direction, threshold, mad_threshold, total_branches, branches_with_alerts, total_customers, generated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, stats.YM, stats.PrevYM, stats.Mode, stats.Direction, stats.Threshold, stats.MADThreshold, stats.TotalBranches, stats.BranchesWithAlerts,
+		stats.TotalCustomers, stats.GeneratedAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert alert log: %w", err)
+	}
+	for _, b := range stats.BranchAlerts {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO bm_alert_log_branches (alert_log_id, branch_code, branch_name, alert_count)
+			VALUES ($1, $2, NULLIF($3, ''), $4)
+		`, id, b.BranchCode, b.BranchName, b.Count); err != nil {
+			return 0, fmt.Errorf("failed to insert alert log branch %s: %w", b.BranchCode, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit alert log: %w", err)
+	}
+	return id, nil
+}
+
+// ListAlertRuns returns stored runs with ym in from..to (either bound may be empty),
+// newest first, each with its per-branch counts
+func (r *Repository) ListAlertRuns(ctx context.Context, from, to string) ([]AlertRun, error) {
+	rows, err := r.pg.Pool.Query(ctx, `
+		SELECT `+alertRunColumns+`
+		FROM bm_alert_logs
+		WHERE ($1 = '' OR ym >= $1) AND ($2 = '' OR ym <= $2)
+		ORDER BY generated_at DESC, id DESC
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert logs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []AlertRun{}
+	index := map[int64]int{}
+	var ids []int64
+	for rows.Next() {
+		run, err := scanAlertRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[run.ID] = len(runs)
+		ids = append(ids, run.ID)
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating alert logs: %w", err)
+	}
+	if len(ids) == 0 {
+		return runs, nil
+	}
+	if err := r.loadAlertRunBranches(ctx, ids, func(id int64, b AlertRunBranch) {
+		i := index[id]
+		runs[i].Branches = append(runs[i].Branches, b)
+	}); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// ErrAlertRunNotFound is returned by GetAlertRun when no run has the given id
+var ErrAlertRunNotFound = errors.New("alert run not found")
+
+// GetAlertRun returns one stored run with its per-branch counts
+func (r *Repository) GetAlertRun(ctx context.Context, id int64) (*AlertRun, error) {
+	run, err := scanAlertRun(r.pg.Pool.QueryRow(ctx, `SELECT `+alertRunColumns+` FROM bm_alert_logs WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAlertRunNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadAlertRunBranches(ctx, []int64{id}, func(_ int64, b AlertRunBranch) {
+		run.Branches = append(run.Branches, b)
+	}); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+const alertRunColumns = `id, ym, prev_ym, mode, direction, threshold, COALESCE(mad_threshold, 0), total_branches,
+		branches_with_alerts, total_customers, generated_at`
+
+func scanAlertRun(row pgx.Row) (AlertRun, error) {
+	var run AlertRun
+	if err := row.Scan(&run.ID, &run.YM, &run.PrevYM, &run.Mode, &run.Direction, &run.Threshold, &run.MADThreshold,
+		&run.TotalBranches, &run.BranchesWithAlerts, &run.TotalCustomers, &run.GeneratedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return run, err
+		}
+		return run, fmt.Errorf("failed to scan alert log: %w", err)
+	}
+	run.Branches = []AlertRunBranch{}
+	return run, nil
+}
+
+// loadAlertRunBranches passes the per-branch counts of the runs in ids to add, ordered
+// by run and branch_code (the order the digest lists them)
+func (r *Repository) loadAlertRunBranches(ctx context.Context, ids []int64, add func(id int64, b AlertRunBranch)) error {
+	brows, err := r.pg.Pool.Query(ctx, `
+		SELECT alert_log_id, branch_code, COALESCE(branch_name, ''), alert_count
+		FROM bm_alert_log_branches
+		WHERE alert_log_id = ANY($1)
+		ORDER BY alert_log_id, branch_code
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to query alert log branches: %w", err)
+	}
+	defer brows.Close()
+	for brows.Next() {
+		var id int64
+		var b AlertRunBranch
+		if err := brows.Scan(&id, &b.BranchCode, &b.BranchName, &b.Count); err != nil {
+			return fmt.Errorf("failed to scan alert log branch: %w", err)
+		}
+		add(id, b)
+	}
+	if err := brows.Err(); err != nil {
+		return fmt.Errorf("error iterating alert log branches: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package alert
+
+import "testing"
+
+func TestBranchDisplayName(t *testing.T) {
+	full := Branch{Code: "BA01", Name: "สาขาหนึ่ง", Alias: "One"}
+	tests := []struct {
+		name   string
+		branch Branch
+		order  []string
+		want   string
+	}{
+		{name: "alias wins", branch: full, want: "One"},
+		{name: "alias wins in the explicit default", branch: full, order: []string{"alias", "name", "code"}, want: "One"},
+		{name: "no alias", branch: Branch{Code: "BA01", Name: "สาขาหนึ่ง"}, want: "สาขาหนึ่ง"},
+		{name: "code only", branch: Branch{Code: "BA01"}, want: "BA01"},
+		{name: "name first", branch: full, order: []string{"name", "alias"}, want: "สาขาหนึ่ง"},
+		{name: "code first", branch: full, order: []string{"code", "alias", "name"}, want: "BA01"},
+		{name: "no listed field set", branch: Branch{Code: "BA01"}, order: []string{"alias", "name"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.branch.DisplayName(tt.order); got != tt.want {
+				t.Errorf("DisplayName(%v) = %q, want %q", tt.order, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,96 +2,250 @@ package alert
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
+	"golang.org/x/sync/errgroup"
+
 	dbpkg "go-backend-bigmeter/internal/database"
 	"go-backend-bigmeter/internal/notify"
 )
 
+// Alert directions for pct_drop mode (ALERT_DIRECTION or a per-request direction)
+const (
+	DirectionDecrease = "decrease"
+	DirectionIncrease = "increase"
+	DirectionBoth     = "both"
+)
+
+// ParseDirection validates a direction; empty yields def
+func ParseDirection(v, def string) (string, error) {
+	switch v {
+	case "":
+		return def, nil
+	case DirectionDecrease, DirectionIncrease, DirectionBoth:
+		return v, nil
+	}
+	return "", fmt.Errorf("invalid direction %q: expect decrease, increase or both", v)
+}
+
+// Options holds optional tuning for the alert service
+type Options struct {
+	// Concurrency bounds how many branches are computed in parallel (minimum 1)
+	Concurrency int
+	// SkipEmpty suppresses the scheduled digest when no branch has alerts
+	SkipEmpty bool
+	// Mode is ModePctDrop (default: drop vs previous month >= threshold) or
+	// ModeCohortMedian (usage more than MADThreshold MADs from the branch median)
+	Mode string
+	// MADThreshold is the cohort_median cut-off in median-absolute-deviations
+	MADThreshold float64
+	// Direction is the default pct_drop direction: decrease (default), increase or both
+	Direction string
+	// MinUsage is the pct_drop floor on previous-month usage: a customer only counts
+	// when it used at least this many units last month (0 disables)
+	MinUsage float64
+	// InactiveStates are the meter_state values that count as inactive/removed; a
+	// customer moving into one is reported in a separate digest (empty disables)
+	InactiveStates []string
+	// BranchNameOrder picks the branch name shown in digests (see Branch.DisplayName)
+	BranchNameOrder []string
+	// SendAttempts and SendRetryDelay control Telegram send retries (see notify.TelegramConfig)
+	SendAttempts   int
+	SendRetryDelay time.Duration
+	// Provider is the notify provider for the digest (telegram, slack, none); empty is telegram
+	Provider string
+	// SlackWebhook is the incoming webhook used when Provider is slack
+	SlackWebhook string
+}
+
 // Service handles alert calculation and notification logic
 type Service struct {
 	repo      *Repository
-	notifier  *notify.TelegramNotifier
+	notifier  notify.Notifier
 	botToken  string
 	threshold float64
 	chatID    int64
 	link      string
+	opts      Options
 }
 
 // NewService creates a new alert service
-func NewService(pg *dbpkg.Postgres, botToken string, chatID int64, threshold float64, link string) *Service {
+func NewService(pg *dbpkg.Postgres, botToken string, chatID int64, threshold float64, link string, opts Options) *Service {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.Mode == "" {
+		opts.Mode = ModePctDrop
+	}
+	if opts.MADThreshold <= 0 {
+		opts.MADThreshold = 3
+	}
+	if opts.Direction == "" {
+		opts.Direction = DirectionDecrease
+	}
 	return &Service{
 		repo:      NewRepository(pg),
 		botToken:  botToken,
 		chatID:    chatID,
 		threshold: threshold,
 		link:      link,
+		opts:      opts,
 	}
 }
 
-// CalculateAlerts computes alert statistics for a given year-month
-func (s *Service) CalculateAlerts(ctx context.Context, ym string, threshold float64) (*AlertStats, error) {
-	// Calculate previous month
+// CalculateAlerts computes alert statistics for a given year-month. direction
+// (decrease, increase or both) selects which usage changes count in pct_drop mode;
+// empty uses Options.Direction.
+func (s *Service) CalculateAlerts(ctx context.Context, ym string, threshold float64, direction string) (*AlertStats, error) {
+	// Get all branches
+	branches, err := s.repo.GetAllBranches(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get branches: %w", err)
+	}
+	return s.calculate(ctx, ym, threshold, direction, branches)
+}
+
+// CalculateBranchAlerts computes alert statistics for a single branch only,
+// skipping the full branch enumeration (useful for targeted investigation).
+func (s *Service) CalculateBranchAlerts(ctx context.Context, ym string, threshold float64, direction string, branchCode string) (*AlertStats, error) {
+	branch, err := s.repo.GetBranch(ctx, branchCode)
+	if err != nil {
+		return nil, err
+	}
+	return s.calculate(ctx, ym, threshold, direction, []Branch{branch})
+}
+
+// TopDecliners returns up to limit customers of one branch whose usage dropped by at
+// least threshold percent versus the previous month, largest decline first, with
+// cust_name taken from the cohort snapshot.
+func (s *Service) TopDecliners(ctx context.Context, ym string, threshold float64, branchCode string, limit int) ([]CustomerUsage, error) {
 	prevYM, err := getPreviousMonth(ym)
 	if err != nil {
 		return nil, fmt.Errorf("invalid year-month format: %w", err)
 	}
-
-	// Calculate fiscal year from current month
 	fiscalYear := fiscalYearFromYM(ym)
 
-	// Get all branches
-	branches, err := s.repo.GetAllBranches(ctx)
+	customers, err := s.calculateBranchAlerts(ctx, branchCode, ym, prevYM, fiscalYear, threshold, DirectionDecrease)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get branches: %w", err)
+		return nil, err
+	}
+	sort.SliceStable(customers, func(i, j int) bool {
+		return customers[i].Percentage < customers[j].Percentage
+	})
+	if limit > 0 && len(customers) > limit {
+		customers = customers[:limit]
+	}
+	if len(customers) == 0 {
+		return []CustomerUsage{}, nil
+	}
+
+	codes := make([]string, len(customers))
+	for i, cu := range customers {
+		codes[i] = cu.CustCode
+	}
+	names, err := s.repo.GetCustNames(ctx, branchCode, fiscalYear, codes)
+	if err != nil {
+		return nil, err
+	}
+	for i := range customers {
+		customers[i].CustName = names[customers[i].CustCode]
+	}
+	return customers, nil
+}
+
+// calculate computes alert statistics over the given branches
+func (s *Service) calculate(ctx context.Context, ym string, threshold float64, direction string, branches []Branch) (*AlertStats, error) {
+	if direction == "" {
+		direction = s.opts.Direction
+	}
+	// Calculate previous month
+	prevYM, err := getPreviousMonth(ym)
+	if err != nil {
+		return nil, fmt.Errorf("invalid year-month format: %w", err)
 	}
 
+	// Calculate fiscal year from current month
+	fiscalYear := fiscalYearFromYM(ym)
+
 	stats := &AlertStats{
 		YM:             ym,
 		PrevYM:         prevYM,
 		Threshold:      threshold,
+		Mode:           s.opts.Mode,
+		Direction:      direction,
 		TotalBranches:  len(branches),
 		BranchAlerts:   make([]BranchAlert, 0),
 		GeneratedAt:    time.Now(),
 	}
 
-	// Process each branch
-	for _, branch := range branches {
-		count, err := s.calculateBranchAlerts(ctx, branch.Code, ym, prevYM, fiscalYear, threshold)
-		if err != nil {
-			log.Printf("alert: failed to calculate for branch %s: %v", branch.Code, err)
-			continue
-		}
+	// The usage floor only applies to pct_drop; cohort_median never reads it
+	if s.opts.Mode == ModeCohortMedian {
+		stats.MADThreshold = s.opts.MADThreshold
+	} else {
+		stats.MinUsage = s.opts.MinUsage
+	}
 
-		if count > 0 {
+	// Process branches with bounded concurrency; per-branch failures are logged and skipped
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(s.opts.Concurrency)
+	for _, branch := range branches {
+		branch := branch
+		g.Go(func() error {
+			customers, err := s.calculateBranchAlerts(gctx, branch.Code, ym, prevYM, fiscalYear, threshold, direction)
+			if err != nil {
+				log.Printf("alert: failed to calculate for branch %s: %v", branch.Code, err)
+				return nil
+			}
+			count := len(customers)
+			if count == 0 {
+				return nil
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
 			stats.BranchAlerts = append(stats.BranchAlerts, BranchAlert{
 				BranchCode: branch.Code,
-				BranchName: branch.Name,
+				BranchName: branch.DisplayName(s.opts.BranchNameOrder),
 				Count:      count,
+				Customers:  customers,
 			})
 			stats.BranchesWithAlerts++
 			stats.TotalCustomers += count
-		}
+			return nil
+		})
 	}
+	_ = g.Wait()
+
+	// Keep output deterministic regardless of completion order
+	sort.Slice(stats.BranchAlerts, func(i, j int) bool {
+		return stats.BranchAlerts[i].BranchCode < stats.BranchAlerts[j].BranchCode
+	})
 
 	return stats, nil
 }
 
-// calculateBranchAlerts calculates the number of customers in a branch that meet the threshold
-func (s *Service) calculateBranchAlerts(ctx context.Context, branchCode, ym, prevYM string, fiscalYear int, threshold float64) (int, error) {
+// calculateBranchAlerts returns the customers in a branch that meet the threshold
+func (s *Service) calculateBranchAlerts(ctx context.Context, branchCode, ym, prevYM string, fiscalYear int, threshold float64, direction string) ([]CustomerUsage, error) {
 	// Get current month usage
 	currentData, err := s.repo.GetMonthUsage(ctx, branchCode, ym, fiscalYear)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if s.opts.Mode == ModeCohortMedian {
+		return medianOutliers(branchCode, currentData, s.opts.MADThreshold), nil
 	}
 
 	// Get previous month usage
 	previousData, err := s.repo.GetMonthUsage(ctx, branchCode, prevYM, fiscalYear)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	// Create map for quick lookup of previous month data
@@ -100,25 +254,38 @@ func (s *Service) calculateBranchAlerts(ctx context.Context, branchCode, ym, pre
 		prevMap[data.CustCode] = data.PresentWaterUsage
 	}
 
-	// Count customers that meet threshold
-	count := 0
+	// Collect customers that meet threshold
+	var customers []CustomerUsage
 	for _, curr := range currentData {
 		prev, exists := prevMap[curr.CustCode]
 		if !exists || prev == 0 {
 			// Skip if no previous data or previous usage is 0
 			continue
 		}
+		if prev < s.opts.MinUsage {
+			// Too small for a percentage change to matter (e.g. 2 -> 1 unit is -50%)
+			continue
+		}
 
 		// Calculate percentage change
 		pct := ((curr.PresentWaterUsage - prev) / prev) * 100
 
-		// Check if decrease meets threshold (e.g., pct <= -20)
-		if pct <= -threshold {
-			count++
+		// Check if the change meets threshold in the requested direction
+		// (decrease: pct <= -20, increase: pct >= 20, both: either)
+		decreased := pct <= -threshold
+		increased := pct >= threshold
+		if (direction != DirectionIncrease && decreased) || (direction != DirectionDecrease && increased) {
+			customers = append(customers, CustomerUsage{
+				CustCode:      curr.CustCode,
+				BranchCode:    branchCode,
+				CurrentUsage:  curr.PresentWaterUsage,
+				PreviousUsage: prev,
+				Percentage:    pct,
+			})
 		}
 	}
 
-	return count, nil
+	return customers, nil
 }
 
 // RunDaily runs the daily alert check and sends notification
@@ -126,20 +293,83 @@ func (s *Service) RunDaily(ctx context.Context, now time.Time) error {
 	// Calculate current year-month
 	ym := fmt.Sprintf("%04d%02d", now.Year(), now.Month())
 
+	// The meter_state digest is a separate message: it runs whatever happens to the
+	// usage digest, and both errors are reported.
+	return errors.Join(s.runUsageCheck(ctx, ym), s.runStateCheck(ctx, ym))
+}
+
+// runUsageCheck calculates, records and sends the usage digest for ym
+func (s *Service) runUsageCheck(ctx context.Context, ym string) error {
 	log.Printf("alert: running daily check for ym=%s threshold=%.1f", ym, s.threshold)
 
 	// Calculate alerts
-	stats, err := s.CalculateAlerts(ctx, ym, s.threshold)
+	stats, err := s.CalculateAlerts(ctx, ym, s.threshold, "")
 	if err != nil {
 		return fmt.Errorf("failed to calculate alerts: %w", err)
 	}
+	log.Printf("alert: ym=%s prev_ym=%s mode=%s direction=%s branches=%d branches_with_alerts=%d customers=%d",
+		stats.YM, stats.PrevYM, stats.Mode, stats.Direction, stats.TotalBranches, stats.BranchesWithAlerts, stats.TotalCustomers)
+	s.RecordRun(ctx, stats)
+
+	if stats.BranchesWithAlerts == 0 && s.opts.SkipEmpty {
+		log.Printf("alert: no qualifying customers for ym=%s, empty digest skipped (ALERT_NOTIFY_EMPTY=false)", ym)
+		return nil
+	}
 
 	// Send notification
 	return s.SendNotification(stats)
 }
 
-// SendNotification sends alert notification via Telegram
+// RecordRun stores stats in the alert history (bm_alert_logs). A failure is only
+// logged so history problems never block the digest.
+func (s *Service) RecordRun(ctx context.Context, stats *AlertStats) {
+	if _, err := s.repo.SaveAlertRun(ctx, stats); err != nil {
+		log.Printf("alert: failed to record run for ym=%s: %v", stats.YM, err)
+	}
+}
+
+// ResendRun re-sends the digest of stored run id, rendered from the recorded counts
+// rather than recomputed from current data, and returns the message sent.
+func (s *Service) ResendRun(ctx context.Context, id int64) (string, error) {
+	run, err := s.repo.GetAlertRun(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	message := FormatAlertMessage(run.Stats(), s.link)
+	if err := s.send(message); err != nil {
+		return "", err
+	}
+	log.Printf("alert: resent run id=%d ym=%s branches_with_alerts=%d", run.ID, run.YM, run.BranchesWithAlerts)
+	return message, nil
+}
+
+// SendNotification sends alert notification via the configured provider
 func (s *Service) SendNotification(stats *AlertStats) error {
+	return s.send(FormatAlertMessage(stats, s.link))
+}
+
+// send delivers message via the configured provider, building the notifier on first use
+func (s *Service) send(message string) error {
+	switch s.opts.Provider {
+	case notify.ProviderNone:
+		log.Printf("alert: notifications disabled (NOTIFY_PROVIDER=none), skipping notification")
+		return nil
+	case notify.ProviderSlack:
+		if s.notifier == nil {
+			sn, err := notify.NewSlackNotifier(notify.SlackConfig{
+				WebhookURL:   s.opts.SlackWebhook,
+				SendAttempts: s.opts.SendAttempts,
+				RetryDelay:   s.opts.SendRetryDelay,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to initialize slack notifier: %w", err)
+			}
+			sn.SetMuteStore(notify.NewMuteStore(s.repo.pg.Pool))
+			s.notifier = sn
+		}
+		return s.notifier.SendAlertMessage(message)
+	}
+
 	if s.botToken == "" || s.chatID == 0 {
 		log.Printf("alert: telegram not configured, skipping notification")
 		return nil
@@ -147,24 +377,38 @@ func (s *Service) SendNotification(stats *AlertStats) error {
 
 	// Initialize notifier if needed
 	if s.notifier == nil {
-		var err error
-		s.notifier, err = notify.NewTelegramNotifier(notify.TelegramConfig{
-			Enabled:  true,
-			BotToken: s.botToken,
-			ChatID:   s.chatID,
+		tn, err := notify.NewTelegramNotifier(notify.TelegramConfig{
+			Enabled:      true,
+			BotToken:     s.botToken,
+			ChatID:       s.chatID,
+			SendAttempts: s.opts.SendAttempts,
+			RetryDelay:   s.opts.SendRetryDelay,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to initialize telegram notifier: %w", err)
 		}
+		tn.SetMuteStore(notify.NewMuteStore(s.repo.pg.Pool))
+		s.notifier = tn
 	}
 
-	// Format and send message
-	message := FormatAlertMessage(stats, s.link)
 	return s.notifier.SendAlertMessage(message)
 }
 
 // Helper functions
 
+// NormalizeThreshold converts a caller-supplied threshold to the percent form used by
+// the calculation (pct <= -threshold). With isFraction, 0.2 means 20%; otherwise the
+// value is already a percent.
+func NormalizeThreshold(v float64, isFraction bool) (float64, error) {
+	if !isFraction {
+		return v, nil
+	}
+	if v <= 0 || v > 1 {
+		return 0, fmt.Errorf("fractional threshold must be in (0, 1], got %v", v)
+	}
+	return v * 100, nil
+}
+
 // getPreviousMonth calculates the previous month from YYYYMM format
 func getPreviousMonth(ym string) (string, error) {
 	if len(ym) != 6 {
@@ -0,0 +1,261 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-backend-bigmeter/internal/database/dbtest"
+	"go-backend-bigmeter/internal/notify"
+)
+
+// slackSink is a fake Slack webhook recording the text of every digest posted
+type slackSink struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func newSlackSink(t *testing.T) (*slackSink, string) {
+	t.Helper()
+	sink := &slackSink{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		sink.mu.Lock()
+		sink.texts = append(sink.texts, body.Text)
+		sink.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	return sink, srv.URL
+}
+
+func (s *slackSink) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.texts...)
+}
+
+// TestCalculateAlertsConcurrency checks that ALERT_CONCURRENCY only changes how fast the
+// digest is computed, not what it contains. Run it with -race (make test does).
+func TestCalculateAlertsConcurrency(t *testing.T) {
+	pg := dbtest.Postgres(t)
+	ctx := context.Background()
+	const branches = 30
+	for b := 1; b <= branches; b++ {
+		code := fmt.Sprintf("B%02d", b)
+		if _, err := pg.Pool.Exec(ctx, `INSERT INTO bm_branches (code, name) VALUES ($1, $2)`, code, "Branch "+code); err != nil {
+			t.Fatal(err)
+		}
+		// b customers per branch; every other one drops 50% from September to October
+		for c := 1; c <= b; c++ {
+			cust := fmt.Sprintf("%s-C%02d", code, c)
+			now := 100.0
+			if c%2 == 0 {
+				now = 50
+			}
+			if _, err := pg.Pool.Exec(ctx, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg)
+			                                 VALUES (2025, '202409', $1, $2, 100), (2025, '202410', $1, $2, $3)`, code, cust, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	calc := func(concurrency int) *AlertStats {
+		s := NewService(pg, "", 0, 20, "", Options{Concurrency: concurrency})
+		stats, err := s.CalculateAlerts(ctx, "202410", 20, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats.GeneratedAt = time.Time{}
+		return stats
+	}
+	wantCustomers := 0
+	for b := 1; b <= branches; b++ {
+		wantCustomers += b / 2
+	}
+	want := calc(1)
+	if want.BranchesWithAlerts != branches-1 || want.TotalCustomers != wantCustomers {
+		t.Fatalf("sequential: branches_with_alerts=%d customers=%d", want.BranchesWithAlerts, want.TotalCustomers)
+	}
+	for _, concurrency := range []int{2, 8, branches} {
+		if got := calc(concurrency); !reflect.DeepEqual(got, want) {
+			t.Errorf("concurrency=%d: stats differ from the sequential run\ngot  %+v\nwant %+v", concurrency, got, want)
+		}
+	}
+}
+
+func TestNormalizeThreshold(t *testing.T) {
+	tests := []struct {
+		v          float64
+		isFraction bool
+		want       float64
+		wantErr    bool
+	}{
+		{v: 20, want: 20},
+		{v: 0.2, want: 0.2}, // a percent unless flagged as a fraction
+		{v: 0.2, isFraction: true, want: 20},
+		{v: 0.05, isFraction: true, want: 5},
+		{v: 1, isFraction: true, want: 100},
+		{v: 20, isFraction: true, wantErr: true},
+		{v: 0, isFraction: true, wantErr: true},
+		{v: -0.1, isFraction: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeThreshold(tt.v, tt.isFraction)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeThreshold(%v, %t) error = %v, wantErr %t", tt.v, tt.isFraction, err, tt.wantErr)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("NormalizeThreshold(%v, %t) = %v, want %v", tt.v, tt.isFraction, got, tt.want)
+		}
+	}
+}
+
+func TestRunDailyNotifyEmpty(t *testing.T) {
+	tests := []struct {
+		name        string
+		notifyEmpty bool
+		octUsage    float64 // C1 used 100 in September
+		wantSent    bool
+	}{
+		{name: "empty digest sent", notifyEmpty: true, octUsage: 100, wantSent: true},
+		{name: "empty digest skipped", notifyEmpty: false, octUsage: 100, wantSent: false},
+		{name: "alerts sent when empty is on", notifyEmpty: true, octUsage: 10, wantSent: true},
+		{name: "alerts sent when empty is off", notifyEmpty: false, octUsage: 10, wantSent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := dbtest.Postgres(t)
+			ctx := context.Background()
+			for _, stmt := range []string{
+				`INSERT INTO bm_branches (code, name) VALUES ('BA01', 'Branch 1')`,
+				fmt.Sprintf(`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg)
+				             VALUES (2025, '202409', 'BA01', 'C1', 100), (2025, '202410', 'BA01', 'C1', %v)`, tt.octUsage),
+			} {
+				if _, err := pg.Pool.Exec(ctx, stmt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sink, url := newSlackSink(t)
+			// cmd/sync maps ALERT_NOTIFY_EMPTY to SkipEmpty
+			s := NewService(pg, "", 0, 20, "", Options{SkipEmpty: !tt.notifyEmpty, Provider: notify.ProviderSlack, SlackWebhook: url})
+
+			if err := s.RunDaily(ctx, time.Date(2024, time.October, 20, 9, 0, 0, 0, time.UTC)); err != nil {
+				t.Fatal(err)
+			}
+			if sent := len(sink.received()) > 0; sent != tt.wantSent {
+				t.Errorf("digest sent = %t, want %t: %q", sent, tt.wantSent, sink.received())
+			}
+		})
+	}
+}
+
+func TestResendRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		change string // applied to the data between the run and the resend
+	}{
+		{name: "unchanged data"},
+		{name: "alert cleared since", change: `UPDATE bm_meter_details SET present_water_usg = 100 WHERE year_month = '202410'`},
+		{name: "new alert since", change: `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg)
+			VALUES (2025, '202409', 'BA01', 'C2', 100), (2025, '202410', 'BA01', 'C2', 5)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := dbtest.Postgres(t)
+			ctx := context.Background()
+			for _, stmt := range []string{
+				`INSERT INTO bm_branches (code, name) VALUES ('BA01', 'Branch 1')`,
+				`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg)
+				 VALUES (2025, '202409', 'BA01', 'C1', 100), (2025, '202410', 'BA01', 'C1', 10)`,
+			} {
+				if _, err := pg.Pool.Exec(ctx, stmt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sink, url := newSlackSink(t)
+			s := NewService(pg, "", 0, 20, "", Options{Provider: notify.ProviderSlack, SlackWebhook: url})
+			if err := s.RunDaily(ctx, time.Date(2024, time.October, 20, 9, 0, 0, 0, time.UTC)); err != nil {
+				t.Fatal(err)
+			}
+			if tt.change != "" {
+				if _, err := pg.Pool.Exec(ctx, tt.change); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var id int64
+			if err := pg.Pool.QueryRow(ctx, `SELECT max(id) FROM bm_alert_logs`).Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+
+			message, err := s.ResendRun(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sent := sink.received()
+			if len(sent) != 2 {
+				t.Fatalf("sent %d messages, want the digest and its resend", len(sent))
+			}
+			if sent[1] != sent[0] {
+				t.Errorf("resent %q, want the archived digest %q", sent[1], sent[0])
+			}
+			// the archived count, whatever the data says now
+			if !strings.Contains(message, "- Branch 1 1 ราย") {
+				t.Errorf("resend message %q does not list Branch 1 with 1 customer", message)
+			}
+		})
+	}
+}
+
+// TestCalculateAlertsMinUsage covers the small-meter case ALERT_MIN_USAGE exists for:
+// 2 -> 1 unit is a 50% drop, but it should only alert while the floor is at or below 2.
+func TestCalculateAlertsMinUsage(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          string
+		minUsage      float64
+		wantCustomers int
+		wantMinUsage  float64
+	}{
+		{name: "no floor", mode: ModePctDrop, wantCustomers: 2},
+		{name: "floor at previous usage", mode: ModePctDrop, minUsage: 2, wantCustomers: 2, wantMinUsage: 2},
+		{name: "floor above small meter", mode: ModePctDrop, minUsage: 10, wantCustomers: 1, wantMinUsage: 10},
+		{name: "cohort_median ignores floor", mode: ModeCohortMedian, minUsage: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := dbtest.Postgres(t)
+			ctx := context.Background()
+			if _, err := pg.Pool.Exec(ctx, `INSERT INTO bm_branches (code, name) VALUES ('B01', 'Branch 1')`); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := pg.Pool.Exec(ctx, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg)
+			                                 VALUES (2025, '202409', 'B01', 'SMALL', 2), (2025, '202410', 'B01', 'SMALL', 1),
+			                                        (2025, '202409', 'B01', 'BIG', 100), (2025, '202410', 'B01', 'BIG', 50)`); err != nil {
+				t.Fatal(err)
+			}
+			s := NewService(pg, "", 0, 20, "", Options{Mode: tt.mode, MADThreshold: 3, MinUsage: tt.minUsage})
+			stats, err := s.CalculateAlerts(ctx, "202410", 20, DirectionDecrease)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.mode == ModePctDrop && stats.TotalCustomers != tt.wantCustomers {
+				t.Errorf("customers=%d, want %d", stats.TotalCustomers, tt.wantCustomers)
+			}
+			if stats.MinUsage != tt.wantMinUsage {
+				t.Errorf("stats.MinUsage=%v, want %v", stats.MinUsage, tt.wantMinUsage)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StateChange is a cohort customer whose meter_state moved into the inactive set
+type StateChange struct {
+	CustCode   string `json:"cust_code"`
+	CustName   string `json:"cust_name,omitempty"`
+	BranchCode string `json:"branch_code"`
+	PrevState  string `json:"prev_state"`
+	State      string `json:"state"`
+}
+
+// BranchStateChanges groups the state changes of one branch
+type BranchStateChanges struct {
+	BranchCode string        `json:"branch_code"`
+	BranchName string        `json:"branch_name,omitempty"`
+	Count      int           `json:"count"`
+	Customers  []StateChange `json:"customers"`
+}
+
+// StateAlertStats is the result of a meter_state transition check
+type StateAlertStats struct {
+	YM                  string               `json:"ym"`
+	PrevYM              string               `json:"prev_ym"`
+	InactiveStates      []string             `json:"inactive_states"`
+	TotalBranches       int                  `json:"total_branches"`
+	BranchesWithChanges int                  `json:"branches_with_changes"`
+	TotalCustomers      int                  `json:"total_customers"`
+	Branches            []BranchStateChanges `json:"branches"`
+	GeneratedAt         time.Time            `json:"generated_at"`
+}
+
+// GetStateTransitions returns customers whose stored meter_state is in states for ym
+// but was not in the previous month (a missing or empty state counts as active).
+// Customers without a previous-month row are skipped. Empty branchCode means all.
+// Monthly rows carry no cust_name, so the name comes from the cohort snapshot.
+func (r *Repository) GetStateTransitions(ctx context.Context, branchCode, ym, prevYM string, fiscalYear, prevFiscalYear int, states []string) ([]StateChange, error) {
+	query := `
+		SELECT cur.branch_code, cur.cust_code, COALESCE(ci.cust_name, cur.cust_name, ''),
+		       COALESCE(prev.meter_state, ''), cur.meter_state
+		FROM bm_meter_details cur
+		JOIN bm_meter_details prev
+		  ON prev.branch_code = cur.branch_code AND prev.cust_code = cur.cust_code
+		 AND prev.year_month = $3 AND prev.fiscal_year = $4
+		LEFT JOIN bm_custcode_init ci
+		  ON ci.fiscal_year = cur.fiscal_year AND ci.branch_code = cur.branch_code AND ci.cust_code = cur.cust_code
+		WHERE cur.year_month = $1 AND cur.fiscal_year = $2
+		  AND cur.meter_state = ANY($5)
+		  AND NOT (COALESCE(prev.meter_state, '') = ANY($5))
+		  AND ($6 = '' OR cur.branch_code = $6)
+		ORDER BY cur.branch_code, cur.cust_code
+	`
+	rows, err := r.pg.Pool.Query(ctx, query, ym, fiscalYear, prevYM, prevFiscalYear, states, branchCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query meter_state transitions for ym=%s: %w", ym, err)
+	}
+	defer rows.Close()
+
+	var out []StateChange
+	for rows.Next() {
+		var sc StateChange
+		if err := rows.Scan(&sc.BranchCode, &sc.CustCode, &sc.CustName, &sc.PrevState, &sc.State); err != nil {
+			return nil, fmt.Errorf("failed to scan meter_state transition: %w", err)
+		}
+		out = append(out, sc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating meter_state transitions: %w", err)
+	}
+	return out, nil
+}
+
+// CalculateStateChanges lists cohort customers whose meter_state changed into
+// Options.InactiveStates between the previous month and ym, grouped by branch.
+// Empty branchCode checks every branch.
+func (s *Service) CalculateStateChanges(ctx context.Context, ym, branchCode string) (*StateAlertStats, error) {
+	if len(s.opts.InactiveStates) == 0 {
+		return nil, fmt.Errorf("no inactive meter states configured (ALERT_INACTIVE_STATES)")
+	}
+	prevYM, err := getPreviousMonth(ym)
+	if err != nil {
+		return nil, fmt.Errorf("invalid year-month format: %w", err)
+	}
+
+	var branches []Branch
+	if branchCode != "" {
+		b, err := s.repo.GetBranch(ctx, branchCode)
+		if err != nil {
+			return nil, err
+		}
+		branches = []Branch{b}
+	} else if branches, err = s.repo.GetAllBranches(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get branches: %w", err)
+	}
+
+	// The previous month belongs to the prior fiscal year in October
+	changes, err := s.repo.GetStateTransitions(ctx, branchCode, ym, prevYM, fiscalYearFromYM(ym), fiscalYearFromYM(prevYM), s.opts.InactiveStates)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &StateAlertStats{
+		YM:             ym,
+		PrevYM:         prevYM,
+		InactiveStates: s.opts.InactiveStates,
+		TotalBranches:  len(branches),
+		Branches:       make([]BranchStateChanges, 0),
+		GeneratedAt:    time.Now(),
+	}
+	names := make(map[string]string, len(branches))
+	for _, b := range branches {
+		names[b.Code] = b.DisplayName(s.opts.BranchNameOrder)
+	}
+	byBranch := map[string]*BranchStateChanges{}
+	for _, sc := range changes {
+		bc, ok := byBranch[sc.BranchCode]
+		if !ok {
+			bc = &BranchStateChanges{BranchCode: sc.BranchCode, BranchName: names[sc.BranchCode]}
+			byBranch[sc.BranchCode] = bc
+		}
+		bc.Customers = append(bc.Customers, sc)
+		bc.Count++
+	}
+	for _, bc := range byBranch {
+		stats.Branches = append(stats.Branches, *bc)
+		stats.TotalCustomers += bc.Count
+	}
+	stats.BranchesWithChanges = len(stats.Branches)
+	sort.Slice(stats.Branches, func(i, j int) bool {
+		return stats.Branches[i].BranchCode < stats.Branches[j].BranchCode
+	})
+	return stats, nil
+}
+
+// runStateCheck sends the meter_state digest for ym as its own message, independently
+// of the usage digest. It is skipped when no inactive states are configured.
+func (s *Service) runStateCheck(ctx context.Context, ym string) error {
+	if len(s.opts.InactiveStates) == 0 {
+		return nil
+	}
+	stats, err := s.CalculateStateChanges(ctx, ym, "")
+	if err != nil {
+		return fmt.Errorf("failed to calculate meter_state changes: %w", err)
+	}
+	log.Printf("alert: meter_state ym=%s prev_ym=%s states=%s branches_with_changes=%d customers=%d",
+		stats.YM, stats.PrevYM, strings.Join(stats.InactiveStates, ","), stats.BranchesWithChanges, stats.TotalCustomers)
+	if stats.TotalCustomers == 0 && s.opts.SkipEmpty {
+		log.Printf("alert: no meter_state changes for ym=%s, empty digest skipped (ALERT_NOTIFY_EMPTY=false)", ym)
+		return nil
+	}
+	return s.send(FormatStateAlertMessage(stats, s.link))
+}
@@ -0,0 +1,137 @@
+package alert
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend-bigmeter/internal/config"
+	"go-backend-bigmeter/internal/database/dbtest"
+	"go-backend-bigmeter/internal/notify"
+	syncsvc "go-backend-bigmeter/internal/sync"
+)
+
+// TestCalculateStateChanges syncs two months through the monthly sync so the check
+// reads the meter_state the sync captured, not values seeded by hand
+func TestCalculateStateChanges(t *testing.T) {
+	tests := []struct {
+		custCode  string
+		prevState any // nil: NULL from Oracle; "-": no November row
+		state     any // "-": no December row (zeroed from the cohort snapshot)
+		flagged   bool
+	}{
+		{custCode: "C1", prevState: "normal", state: "inactive", flagged: true},
+		{custCode: "C2", prevState: "inactive", state: "inactive"},
+		{custCode: "C3", prevState: "normal", state: "normal"},
+		{custCode: "C4", prevState: nil, state: "removed", flagged: true},
+		{custCode: "C5", prevState: "removed", state: "inactive"},
+		{custCode: "C6", prevState: "normal", state: "-"},
+	}
+	pg := dbtest.Postgres(t)
+	t.Chdir(dbtest.ModuleRoot(t))
+	ctx := context.Background()
+	if _, err := pg.Pool.Exec(ctx, `INSERT INTO bm_branches (code, name) VALUES ('BA01', 'Branch 1')`); err != nil {
+		t.Fatal(err)
+	}
+	// the details rows carry meter_state keyed by the bound DEBT_YM (Buddhist year)
+	states := map[string]map[string]any{"256711": {}, "256712": {}}
+	var want []string
+	for _, tt := range tests {
+		if _, err := pg.Pool.Exec(ctx, `INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code, cust_name, meter_state, debt_ym)
+			VALUES (2025, 'BA01', $1, $2, 'normal', '256710')`, tt.custCode, "Name "+tt.custCode); err != nil {
+			t.Fatal(err)
+		}
+		if tt.prevState != "-" {
+			states["256711"][tt.custCode] = tt.prevState
+		}
+		if tt.state != "-" {
+			states["256712"][tt.custCode] = tt.state
+		}
+		if tt.flagged {
+			want = append(want, tt.custCode)
+		}
+	}
+	ora, _ := dbtest.Oracle(t, func(query string, args []driver.NamedValue) (dbtest.Result, error) {
+		debtYM := fmt.Sprint(dbtest.Arg(args, "DEBT_YM"))
+		var rows [][]driver.Value
+		for _, a := range args {
+			if !strings.HasPrefix(a.Name, "C") {
+				continue
+			}
+			if st, ok := states[debtYM][fmt.Sprint(a.Value)]; ok {
+				rows = append(rows, []driver.Value{a.Value, "M-1", 10.0, 100.0, 10.0, debtYM, st})
+			}
+		}
+		return dbtest.Result{Columns: []string{"เลขที่ผู้ใช้น้ำ", "หมายเลขมาตร", "หน่วยน้ำเฉลี่ย", "เลขมาตรที่อ่านได้",
+			"หน่วยน้ำปัจจุบัน", "เดือนหนี้", "สถานะมาตร"}, Rows: rows}, nil
+	})
+	syncSvc := syncsvc.NewService(ora, pg, config.SyncConfig{})
+	for _, ym := range []string{"202411", "202412"} {
+		if _, _, err := syncSvc.MonthlyDetails(ctx, ym, "BA01", 100, "manual"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewService(pg, "", 0, 20, "", Options{InactiveStates: []string{"inactive", "removed"}})
+
+	stats, err := s.CalculateStateChanges(ctx, "202412", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, b := range stats.Branches {
+		for _, c := range b.Customers {
+			got = append(got, c.CustCode)
+			if c.CustName != "Name "+c.CustCode {
+				t.Errorf("%s: cust_name %q, want the cohort name", c.CustCode, c.CustName)
+			}
+		}
+	}
+	if !reflect.DeepEqual(got, want) || stats.TotalCustomers != len(want) || stats.BranchesWithChanges != 1 {
+		t.Errorf("flagged %v (total %d, branches %d), want %v in one branch", got, stats.TotalCustomers, stats.BranchesWithChanges, want)
+	}
+}
+
+// TestRunDailyStateDigest checks the meter_state digest is sent on its own, whether or
+// not the usage digest is
+func TestRunDailyStateDigest(t *testing.T) {
+	tests := []struct {
+		name     string
+		octUsage float64 // C1 used 100 in September
+		want     int     // messages sent
+	}{
+		{name: "usage digest skipped when empty", octUsage: 100, want: 1},
+		{name: "usage digest sent", octUsage: 10, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := dbtest.Postgres(t)
+			ctx := context.Background()
+			for _, stmt := range []string{
+				`INSERT INTO bm_branches (code, name) VALUES ('BA01', 'Branch 1')`,
+				// September under both fiscal years: the usage check reads it from the
+				// October cohort (2025), the state check from its own fiscal year (2024)
+				fmt.Sprintf(`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg, meter_state)
+				             VALUES (2024, '202409', 'BA01', 'C1', 100, 'normal'), (2025, '202409', 'BA01', 'C1', 100, 'normal'),
+				                    (2025, '202410', 'BA01', 'C1', %v, 'inactive')`, tt.octUsage),
+			} {
+				if _, err := pg.Pool.Exec(ctx, stmt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sink, url := newSlackSink(t)
+			s := NewService(pg, "", 0, 20, "", Options{SkipEmpty: true, InactiveStates: []string{"inactive"},
+				Provider: notify.ProviderSlack, SlackWebhook: url})
+
+			if err := s.RunDaily(ctx, time.Date(2024, time.October, 20, 9, 0, 0, 0, time.UTC)); err != nil {
+				t.Fatal(err)
+			}
+			if got := sink.received(); len(got) != tt.want {
+				t.Errorf("sent %d messages, want %d: %q", len(got), tt.want, got)
+			}
+		})
+	}
+}
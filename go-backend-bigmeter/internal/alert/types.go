@@ -4,28 +4,87 @@ import "time"
 
 // BranchAlert represents alert statistics for a single branch
 type BranchAlert struct {
-	BranchCode string
-	BranchName string
-	Count      int
+	BranchCode string          `json:"branch_code"`
+	BranchName string          `json:"branch_name,omitempty"`
+	Count      int             `json:"count"`
+	Customers  []CustomerUsage `json:"customers"`
 }
 
 // AlertStats represents overall alert statistics
 type AlertStats struct {
-	YM                  string
-	PrevYM              string
-	Threshold           float64
-	TotalBranches       int
-	BranchesWithAlerts  int
-	TotalCustomers      int
-	BranchAlerts        []BranchAlert
-	GeneratedAt         time.Time
+	YM                  string        `json:"ym"`
+	PrevYM              string        `json:"prev_ym"`
+	Threshold           float64       `json:"threshold"`
+	Mode                string        `json:"mode"`
+	Direction           string        `json:"direction"`
+	MinUsage            float64       `json:"min_usage,omitempty"`
+	MADThreshold        float64       `json:"mad_threshold,omitempty"`
+	TotalBranches       int           `json:"total_branches"`
+	BranchesWithAlerts  int           `json:"branches_with_alerts"`
+	TotalCustomers      int           `json:"total_customers"`
+	BranchAlerts        []BranchAlert `json:"branch_alerts"`
+	GeneratedAt         time.Time     `json:"generated_at"`
 }
 
 // CustomerUsage represents a customer's usage data for percentage calculation
 type CustomerUsage struct {
-	CustCode      string
-	BranchCode    string
-	CurrentUsage  float64
-	PreviousUsage float64
-	Percentage    float64
+	CustCode      string  `json:"cust_code"`
+	CustName      string  `json:"cust_name,omitempty"`
+	BranchCode    string  `json:"branch_code"`
+	CurrentUsage  float64 `json:"current_usage"`
+	PreviousUsage float64 `json:"previous_usage"`
+	Percentage    float64 `json:"percentage"`
+	// MADScore is the signed distance from the cohort median in MADs (cohort_median
+	// mode only; PreviousUsage then holds the median and Percentage the deviation from it)
+	MADScore float64 `json:"mad_score,omitempty"`
+}
+
+// AlertRun is one stored alert run from bm_alert_logs
+type AlertRun struct {
+	ID                 int64            `json:"id"`
+	YM                 string           `json:"ym"`
+	PrevYM             string           `json:"prev_ym"`
+	Mode               string           `json:"mode"`
+	Direction          string           `json:"direction"`
+	Threshold          float64          `json:"threshold"`
+	MADThreshold       float64          `json:"mad_threshold,omitempty"`
+	TotalBranches      int              `json:"total_branches"`
+	BranchesWithAlerts int              `json:"branches_with_alerts"`
+	TotalCustomers     int              `json:"total_customers"`
+	GeneratedAt        time.Time        `json:"generated_at"`
+	Branches           []AlertRunBranch `json:"branches"`
+}
+
+// Stats rebuilds the AlertStats the run was recorded from. Customer lists are not
+// stored, so BranchAlerts carry counts only; that is all the digest message uses.
+func (r *AlertRun) Stats() *AlertStats {
+	stats := &AlertStats{
+		YM:                 r.YM,
+		PrevYM:             r.PrevYM,
+		Threshold:          r.Threshold,
+		Mode:               r.Mode,
+		Direction:          r.Direction,
+		MADThreshold:       r.MADThreshold,
+		TotalBranches:      r.TotalBranches,
+		BranchesWithAlerts: r.BranchesWithAlerts,
+		TotalCustomers:     r.TotalCustomers,
+		BranchAlerts:       make([]BranchAlert, 0, len(r.Branches)),
+		GeneratedAt:        r.GeneratedAt,
+	}
+	for _, b := range r.Branches {
+		stats.BranchAlerts = append(stats.BranchAlerts, BranchAlert{
+			BranchCode: b.BranchCode,
+			BranchName: b.BranchName,
+			Count:      b.Count,
+			Customers:  []CustomerUsage{},
+		})
+	}
+	return stats
+}
+
+// AlertRunBranch is the alert count of one branch in a stored run
+type AlertRunBranch struct {
+	BranchCode string `json:"branch_code"`
+	BranchName string `json:"branch_name,omitempty"`
+	Count      int    `json:"count"`
 }
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-backend-bigmeter/internal/notify"
+	syncsvc "go-backend-bigmeter/internal/sync"
+)
+
+// maxMuteMinutes caps a single mute to one week so notifications cannot be silenced indefinitely.
+const maxMuteMinutes = 7 * 24 * 60
+
+// pNotificationsMute temporarily suppresses all notifications (e.g. during maintenance).
+func (s *Server) pNotificationsMute(c *gin.Context) {
+	minutes := 60
+	if v := c.Query("minutes"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxMuteMinutes {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "minutes must be between 1 and 10080"})
+			return
+		}
+		minutes = n
+	}
+
+	until := time.Now().Add(time.Duration(minutes) * time.Minute)
+	if err := notify.NewMuteStore(s.pg.Pool).Mute(c.Request.Context(), until); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Notifications muted",
+		"muted_until": until.Format(time.RFC3339),
+	})
+}
+
+// pNotificationsUnmute clears an active notification mute.
+func (s *Server) pNotificationsUnmute(c *gin.Context) {
+	if err := notify.NewMuteStore(s.pg.Pool).Unmute(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notifications unmuted"})
+}
+
+// dBranchData removes all stored data for one branch (decommissioned or corrupted).
+// Requires confirm=true; include_logs=true also removes the branch's sync logs. While a
+// sync of the branch runs (in this process or, per bm_sync_logs, elsewhere) it is a 409
+// Conflict, since the sync would write its rows back right after the purge.
+func (s *Server) dBranchData(c *gin.Context) {
+	code := strings.TrimSpace(c.Param("code"))
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branch code is required in path"})
+		return
+	}
+	if c.Query("confirm") != "true" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "confirm=true is required to purge branch data"})
+		return
+	}
+	includeLogs := c.Query("include_logs") == "true"
+
+	ctx := c.Request.Context()
+	if s.syncSvc != nil {
+		if busy := s.syncSvc.Jobs.RunningForBranch(code); len(busy) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "sync running for this branch; cancel it or retry when it finishes", "running": busy})
+			return
+		}
+	}
+	if s.syncSvc != nil && s.syncSvc.LogRepo != nil {
+		running, err := s.syncSvc.LogRepo.BranchInProgress(ctx, code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if running {
+			c.JSON(http.StatusConflict, gin.H{"error": "sync in progress for this branch (sync logs); retry when it finishes"})
+			return
+		}
+	}
+	tx, err := s.pg.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	deleted := gin.H{}
+	tables := []string{"bm_custcode_init", "bm_meter_details"}
+	if includeLogs {
+		tables = append(tables, "bm_sync_logs")
+	}
+	for _, table := range tables {
+		ct, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE branch_code=$1", code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("delete %s: %v", table, err)})
+			return
+		}
+		deleted[table] = ct.RowsAffected()
+	}
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("admin: purged branch=%s deleted=%v", code, deleted)
+	s.summaries.invalidate(code, "")
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Branch data purged",
+		"branch":  code,
+		"deleted": deleted,
+	})
+}
+
+// pPctChangeRecompute recalculates the stored month-over-month pct_change for one ym
+// (optionally one branch), e.g. after a manual data fix or for months synced before
+// migration 0013. Monthly syncs refresh it automatically with COMPUTE_PCT_CHANGE.
+func (s *Server) pPctChangeRecompute(c *gin.Context) {
+	ym := strings.TrimSpace(c.Query("ym"))
+	if _, _, err := parseYM(ym); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ym is required (YYYYMM)"})
+		return
+	}
+	fiscal, err := parseFiscalOrYM(c.Query("fiscal_year"), ym)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	branch := strings.TrimSpace(c.Query("branch"))
+
+	updated, err := syncsvc.RecomputePctChange(c.Request.Context(), s.pg, fiscal, ym, branch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("admin: recomputed pct_change ym=%s branch=%q fiscal=%d rows=%d", ym, branch, fiscal, updated)
+	c.JSON(http.StatusOK, gin.H{
+		"ym":          ym,
+		"branch":      branch,
+		"fiscal_year": fiscal,
+		"updated":     updated,
+	})
+}
+
+// gWebhookFailures lists sync-completion webhook callbacks that exhausted their retries.
+func (s *Server) gWebhookFailures(c *gin.Context) {
+	limit, offset, ok := listLimit(c, defaultMaxLimit)
+	if !ok {
+		return
+	}
+	items, total, err := notify.NewWebhookFailureStore(s.pg.Pool).List(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "limit": limit, "offset": offset})
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPurgeBranch(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		// rows left per table for BA01; BA02 is never touched
+		wantLeft map[string]int
+	}{
+		{
+			name:       "missing confirm",
+			query:      "",
+			wantStatus: http.StatusBadRequest,
+			wantLeft:   map[string]int{"bm_custcode_init": 2, "bm_meter_details": 2, "bm_sync_logs": 1},
+		},
+		{
+			name:       "confirm false",
+			query:      "?confirm=false",
+			wantStatus: http.StatusBadRequest,
+			wantLeft:   map[string]int{"bm_custcode_init": 2, "bm_meter_details": 2, "bm_sync_logs": 1},
+		},
+		{
+			name:       "confirmed",
+			query:      "?confirm=true",
+			wantStatus: http.StatusOK,
+			wantLeft:   map[string]int{"bm_custcode_init": 0, "bm_meter_details": 0, "bm_sync_logs": 1},
+		},
+		{
+			name:       "confirmed with logs",
+			query:      "?confirm=true&include_logs=true",
+			wantStatus: http.StatusOK,
+			wantLeft:   map[string]int{"bm_custcode_init": 0, "bm_meter_details": 0, "bm_sync_logs": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestServer(t, testConfig())
+			seed(t, pg,
+				`INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code)
+				 VALUES (2025, 'BA01', 'C1'), (2025, 'BA01', 'C2'), (2025, 'BA02', 'C3')`,
+				`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code)
+				 VALUES (2025, '202410', 'BA01', 'C1'), (2025, '202410', 'BA01', 'C2'), (2025, '202410', 'BA02', 'C3')`,
+				`INSERT INTO bm_sync_logs (sync_type, branch_code, status, started_at)
+				 VALUES ('monthly_sync', 'BA01', 'success', now()), ('monthly_sync', 'BA02', 'success', now())`)
+
+			w := serve(t, s, http.MethodDelete, "/api/v1/admin/branch/BA01"+tt.query, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			for table, want := range tt.wantLeft {
+				for branch, n := range map[string]int{"BA01": want, "BA02": 1} {
+					var got int
+					if err := pg.Pool.QueryRow(context.Background(),
+						"SELECT COUNT(1) FROM "+table+" WHERE branch_code=$1", branch).Scan(&got); err != nil {
+						t.Fatal(err)
+					}
+					if got != n {
+						t.Errorf("%s %s: %d rows left, want %d", table, branch, got, n)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPurgeBranchRunningSync(t *testing.T) {
+	tests := []struct {
+		name       string
+		job        string // key held in the job registry
+		log        string // extra bm_sync_logs row
+		wantStatus int
+	}{
+		{name: "monthly running here", job: "monthly_sync|BA01|202410", wantStatus: http.StatusConflict},
+		{name: "init running here", job: "yearly_init|BA01|256710", wantStatus: http.StatusConflict},
+		{name: "other branch running here", job: "monthly_sync|BA011|202410", wantStatus: http.StatusOK},
+		{name: "in progress elsewhere",
+			log:        `('yearly_init', 'BA01', 'in_progress', now())`,
+			wantStatus: http.StatusConflict},
+		{name: "stale in_progress log",
+			log:        `('monthly_sync', 'BA01', 'in_progress', now() - interval '3 hours')`,
+			wantStatus: http.StatusOK},
+		{name: "other branch in progress",
+			log:        `('monthly_sync', 'BA02', 'in_progress', now())`,
+			wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestServer(t, testConfig())
+			seed(t, pg, `INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code) VALUES (2025, 'BA01', 'C1')`)
+			if tt.log != "" {
+				seed(t, pg, `INSERT INTO bm_sync_logs (sync_type, branch_code, status, started_at) VALUES `+tt.log)
+			}
+			if tt.job != "" {
+				s.syncSvc.Jobs.TryAcquire(tt.job)
+				t.Cleanup(func() { s.syncSvc.Jobs.Release(tt.job) })
+			}
+
+			w := serve(t, s, http.MethodDelete, "/api/v1/admin/branch/BA01?confirm=true", nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var left int
+			if err := pg.Pool.QueryRow(context.Background(),
+				`SELECT COUNT(1) FROM bm_custcode_init WHERE branch_code='BA01'`).Scan(&left); err != nil {
+				t.Fatal(err)
+			}
+			if want := map[bool]int{true: 1, false: 0}[tt.wantStatus == http.StatusConflict]; left != want {
+				t.Errorf("%d cohort rows left, want %d", left, want)
+			}
+		})
+	}
+}
+
+func TestAdminRequiresAPIKey(t *testing.T) {
+	tests := []struct {
+		apiKey, header string
+		want           int
+	}{
+		{apiKey: "", header: "", want: http.StatusForbidden},
+		{apiKey: testAPIKey, header: "", want: http.StatusUnauthorized},
+		{apiKey: testAPIKey, header: "wrong", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.APIKey = tt.apiKey
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/branch/BA01?confirm=true", nil)
+		if tt.header != "" {
+			req.Header.Set("X-API-Key", tt.header)
+		}
+		w := httptest.NewRecorder()
+		NewServer(cfg, nil, nil).Router().ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("API_KEY=%q X-API-Key=%q: status %d, want %d", tt.apiKey, tt.header, w.Code, tt.want)
+		}
+	}
+}
+
+func TestWebhookFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   int
+		total  int
+	}{
+		{name: "with API key", header: testAPIKey, want: http.StatusOK, total: 1},
+		{name: "without API key", want: http.StatusUnauthorized},
+	}
+	s, pg := newTestServer(t, testConfig())
+	seed(t, pg, `INSERT INTO bm_webhook_failures (url, payload, attempts, last_error)
+	             VALUES ('https://hooks.example.com/bigmeter', '{"event": "monthly_sync"}', 4, 'unexpected status 503 Service Unavailable')`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/webhooks/failures", nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.Router().ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Total int `json:"total"`
+			}
+			decode(t, w, &resp)
+			if resp.Total != tt.total {
+				t.Errorf("total = %d, want %d", resp.Total, tt.total)
+			}
+		})
+	}
+}
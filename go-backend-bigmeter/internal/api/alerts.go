@@ -0,0 +1,209 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-backend-bigmeter/internal/alert"
+)
+
+// gAlertDigest computes the alert digest without sending it, returning the
+// per-branch/per-customer breakdown together with the rendered Thai message
+// so external jobs can archive it verbatim.
+func (s *Server) gAlertDigest(c *gin.Context) {
+	ym := strings.TrimSpace(c.Query("ym"))
+	if ym == "" {
+		now := time.Now()
+		ym = fmt.Sprintf("%04d%02d", now.Year(), now.Month())
+	}
+	if len(ym) != 6 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ym format, expect YYYYMM"})
+		return
+	}
+
+	threshold, ok := s.alertThreshold(c)
+	if !ok {
+		return
+	}
+	direction, err := alert.ParseDirection(strings.TrimSpace(c.Query("direction")), s.cfg.Alert.Direction)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stats, err := s.newAlertService(threshold).CalculateAlerts(c.Request.Context(), ym, threshold, direction)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stats":          stats,
+		"threshold_unit": "percent",
+		"message":        alert.FormatAlertMessage(stats, s.cfg.Alert.Link),
+	})
+}
+
+// gAlertHistory returns stored alert runs (scheduled digests and all-branch
+// /alerts/test runs) with ym in from..to, newest first, for charting alert volume.
+func (s *Server) gAlertHistory(c *gin.Context) {
+	from := strings.TrimSpace(c.Query("from"))
+	to := strings.TrimSpace(c.Query("to"))
+	for _, ym := range []string{from, to} {
+		if ym == "" {
+			continue
+		}
+		if _, _, err := parseYM(ym); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from/to; expect YYYYMM"})
+			return
+		}
+	}
+
+	runs, err := alert.NewRepository(s.read).ListAlertRuns(c.Request.Context(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": runs, "total": len(runs), "from": from, "to": to})
+}
+
+// pAlertResend re-sends a stored alert run's digest, e.g. after the channel was down
+// when the scheduled run fired. The message is rebuilt from the recorded counts, so it
+// matches the original rather than reflecting data synced since.
+func (s *Server) pAlertResend(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	message, err := s.newAlertService(s.cfg.Alert.Threshold).ResendRun(c.Request.Context(), id)
+	if errors.Is(err, alert.ErrAlertRunNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert run not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to resend notification: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "sent": true, "message": message})
+}
+
+// gAlertStateChanges lists cohort customers whose meter_state moved into
+// ALERT_INACTIVE_STATES between the previous month and ym, with the rendered message
+// the scheduled run sends separately from the usage digest.
+func (s *Server) gAlertStateChanges(c *gin.Context) {
+	ym := strings.TrimSpace(c.Query("ym"))
+	if ym == "" {
+		now := time.Now()
+		ym = fmt.Sprintf("%04d%02d", now.Year(), now.Month())
+	}
+	if _, _, err := parseYM(ym); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ym format, expect YYYYMM"})
+		return
+	}
+	if len(s.cfg.Alert.InactiveStates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ALERT_INACTIVE_STATES is not configured"})
+		return
+	}
+	branch := strings.TrimSpace(c.Query("branch"))
+
+	stats, err := s.newAlertService(s.cfg.Alert.Threshold).CalculateStateChanges(c.Request.Context(), ym, branch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"stats":   stats,
+		"message": alert.FormatStateAlertMessage(stats, s.cfg.Alert.Link),
+	})
+}
+
+// gDetailsDecliners lists the customers behind a branch's alert count: those whose
+// usage fell by at least threshold percent versus the previous month, largest drop first.
+func (s *Server) gDetailsDecliners(c *gin.Context) {
+	branch := strings.TrimSpace(c.Query("branch"))
+	ym := strings.TrimSpace(c.Query("ym"))
+	if branch == "" || len(ym) != 6 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branch and ym (YYYYMM) are required"})
+		return
+	}
+	threshold, ok := s.alertThreshold(c)
+	if !ok {
+		return
+	}
+	limit := 20
+	if l := strings.TrimSpace(c.Query("limit")); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit (1..200)"})
+			return
+		}
+		limit = v
+	}
+
+	items, err := s.newAlertService(threshold).TopDecliners(c.Request.Context(), ym, threshold, branch, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"branch":         branch,
+		"ym":             ym,
+		"threshold":      threshold,
+		"threshold_unit": "percent",
+		"items":          items,
+	})
+}
+
+// alertThreshold reads ?threshold (percent, or a fraction with threshold_is_fraction)
+// falling back to TELEGRAM_ALERT_THRESHOLD; it writes 400 and returns false when invalid.
+func (s *Server) alertThreshold(c *gin.Context) (float64, bool) {
+	threshold := s.cfg.Alert.Threshold
+	if t := strings.TrimSpace(c.Query("threshold")); t != "" {
+		v, err := strconv.ParseFloat(t, 64)
+		if err != nil || v <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid threshold"})
+			return 0, false
+		}
+		isFraction := c.Query("threshold_is_fraction") == "true" || c.Query("threshold_is_fraction") == "1"
+		if threshold, err = alert.NormalizeThreshold(v, isFraction); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return 0, false
+		}
+	}
+	return threshold, true
+}
+
+// newAlertService builds an alert service for read-only calculations
+func (s *Server) newAlertService(threshold float64) *alert.Service {
+	return alert.NewService(
+		s.read,
+		s.cfg.Telegram.BotToken,
+		s.cfg.Alert.ChatID,
+		threshold,
+		s.cfg.Alert.Link,
+		s.alertOptions(),
+	)
+}
+
+// alertOptions maps the ALERT_* config onto the alert service options
+func (s *Server) alertOptions() alert.Options {
+	return alert.Options{
+		Concurrency:     s.cfg.Alert.Concurrency,
+		Mode:            s.cfg.Alert.Mode,
+		MADThreshold:    s.cfg.Alert.MADThreshold,
+		Direction:       s.cfg.Alert.Direction,
+		MinUsage:        s.cfg.Alert.MinUsage,
+		InactiveStates:  s.cfg.Alert.InactiveStates,
+		BranchNameOrder: s.cfg.BranchNameOrder,
+		SendAttempts:    s.cfg.Telegram.SendAttempts,
+		SendRetryDelay:  s.cfg.Telegram.RetryDelay,
+		Provider:        s.cfg.NotifyProvider,
+		SlackWebhook:    s.cfg.Slack.WebhookURL,
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-backend-bigmeter/internal/alert"
+)
+
+// seedAlerts gives BA01 two and BA02 one customer whose usage halved from 202409 to 202410
+func seedAlerts(t *testing.T, s *Server) {
+	t.Helper()
+	seed(t, s.pg,
+		`INSERT INTO bm_branches (code, name) VALUES ('BA01', 'Branch 1'), ('BA02', 'Branch 2')`,
+		`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg)
+		 VALUES (2025, '202409', 'BA01', 'C1', 100), (2025, '202410', 'BA01', 'C1', 50),
+		        (2025, '202409', 'BA01', 'C2', 100), (2025, '202410', 'BA01', 'C2', 40),
+		        (2025, '202409', 'BA02', 'C3', 100), (2025, '202410', 'BA02', 'C3', 10)`)
+}
+
+func TestAlertTestBranch(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          map[string]any
+		target        string
+		wantBranches  int
+		wantAlerts    int
+		wantCustomers int
+		wantRecorded  int
+	}{
+		{name: "all branches", body: map[string]any{"ym": "202410"}, target: "/api/v1/alerts/test",
+			wantBranches: 2, wantAlerts: 2, wantCustomers: 3, wantRecorded: 1},
+		{name: "branch in body", body: map[string]any{"ym": "202410", "branch": "BA01"}, target: "/api/v1/alerts/test",
+			wantBranches: 1, wantAlerts: 1, wantCustomers: 2},
+		{name: "branch in query", body: map[string]any{"ym": "202410"}, target: "/api/v1/alerts/test?branch=BA02",
+			wantBranches: 1, wantAlerts: 1, wantCustomers: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestServer(t, testConfig())
+			seedAlerts(t, s)
+
+			var resp struct {
+				TotalBranches      int `json:"total_branches"`
+				BranchesWithAlerts int `json:"branches_with_alerts"`
+				TotalCustomers     int `json:"total_customers"`
+			}
+			decode(t, serve(t, s, http.MethodPost, tt.target, tt.body), &resp)
+			if resp.TotalBranches != tt.wantBranches || resp.BranchesWithAlerts != tt.wantAlerts || resp.TotalCustomers != tt.wantCustomers {
+				t.Errorf("got branches=%d with_alerts=%d customers=%d, want %d %d %d",
+					resp.TotalBranches, resp.BranchesWithAlerts, resp.TotalCustomers, tt.wantBranches, tt.wantAlerts, tt.wantCustomers)
+			}
+			// single-branch runs stay out of the alert history
+			var recorded int
+			if err := pg.Pool.QueryRow(context.Background(), `SELECT COUNT(1) FROM bm_alert_logs`).Scan(&recorded); err != nil {
+				t.Fatal(err)
+			}
+			if recorded != tt.wantRecorded {
+				t.Errorf("alert runs recorded = %d, want %d", recorded, tt.wantRecorded)
+			}
+		})
+	}
+}
+
+func TestAlertDigest(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantCusts map[string][]string
+		wantLines []string
+	}{
+		{
+			name:      "20 percent",
+			query:     "?ym=202410&threshold=20",
+			wantCusts: map[string][]string{"BA01": {"C1", "C2"}, "BA02": {"C3"}},
+			wantLines: []string{"- Branch 1 2 ราย", "- Branch 2 1 ราย", "20%"},
+		},
+		{
+			name:      "55 percent",
+			query:     "?ym=202410&threshold=55",
+			wantCusts: map[string][]string{"BA01": {"C2"}, "BA02": {"C3"}},
+			wantLines: []string{"- Branch 1 1 ราย", "- Branch 2 1 ราย", "55%"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, testConfig())
+			seedAlerts(t, s)
+
+			var resp struct {
+				Stats struct {
+					BranchAlerts []struct {
+						BranchCode string `json:"branch_code"`
+						Customers  []struct {
+							CustCode string `json:"cust_code"`
+						} `json:"customers"`
+					} `json:"branch_alerts"`
+				} `json:"stats"`
+				Message string `json:"message"`
+			}
+			decode(t, serve(t, s, http.MethodGet, "/api/v1/alerts/digest"+tt.query, nil), &resp)
+
+			got := map[string][]string{}
+			for _, b := range resp.Stats.BranchAlerts {
+				for _, cu := range b.Customers {
+					got[b.BranchCode] = append(got[b.BranchCode], cu.CustCode)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.wantCusts) {
+				t.Errorf("customers = %v, want %v", got, tt.wantCusts)
+			}
+			for _, line := range tt.wantLines {
+				if !strings.Contains(resp.Message, line) {
+					t.Errorf("message misses %q:\n%s", line, resp.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertTestThreshold(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          map[string]any
+		wantStatus    int
+		wantThreshold float64
+		wantCustomers int
+	}{
+		{name: "percent", body: map[string]any{"ym": "202410", "threshold": 55}, wantStatus: http.StatusOK, wantThreshold: 55, wantCustomers: 2},
+		{name: "fraction", body: map[string]any{"ym": "202410", "threshold": 0.55, "threshold_is_fraction": true}, wantStatus: http.StatusOK, wantThreshold: 55, wantCustomers: 2},
+		{name: "small percent", body: map[string]any{"ym": "202410", "threshold": 0.55}, wantStatus: http.StatusOK, wantThreshold: 0.55, wantCustomers: 3},
+		{name: "fraction over 1", body: map[string]any{"ym": "202410", "threshold": 55, "threshold_is_fraction": true}, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, testConfig())
+			seedAlerts(t, s)
+			w := serve(t, s, http.MethodPost, "/api/v1/alerts/test", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Threshold      float64 `json:"threshold"`
+				ThresholdUnit  string  `json:"threshold_unit"`
+				TotalCustomers int     `json:"total_customers"`
+			}
+			decode(t, w, &resp)
+			if math.Abs(resp.Threshold-tt.wantThreshold) > 1e-9 || resp.ThresholdUnit != "percent" || resp.TotalCustomers != tt.wantCustomers {
+				t.Errorf("got threshold=%v %s customers=%d, want %v percent %d",
+					resp.Threshold, resp.ThresholdUnit, resp.TotalCustomers, tt.wantThreshold, tt.wantCustomers)
+			}
+		})
+	}
+}
+
+func TestAlertTestMinUsageCohortMedian(t *testing.T) {
+	cfg := testConfig()
+	cfg.Alert.Mode = alert.ModeCohortMedian
+	w := serve(t, NewServer(cfg, nil, nil), http.MethodPost, "/api/v1/alerts/test", map[string]any{"ym": "202410", "min_usage": 10})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400: %s", w.Code, w.Body.String())
+	}
+}
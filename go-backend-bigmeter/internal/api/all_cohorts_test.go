@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	syncsvc "go-backend-bigmeter/internal/sync"
+)
+
+func TestSyncMonthlyAllCohorts(t *testing.T) {
+	type job struct {
+		Branch     string `json:"branch"`
+		FiscalYear int    `json:"fiscal_year"`
+	}
+	tests := []struct {
+		name        string
+		ym          string
+		wantJobs    []job
+		wantSkipped []string
+	}{
+		// September 2024 is fiscal 2024; BA01's fiscal 2025 init also backfilled it
+		{name: "month before the boundary", ym: "202409",
+			wantJobs:    []job{{"BA01", 2024}, {"BA01", 2025}, {"BA02", 2024}},
+			wantSkipped: []string{"BA03"}},
+		{name: "month after the boundary", ym: "202410",
+			wantJobs:    []job{{"BA01", 2025}, {"BA03", 2025}},
+			wantSkipped: []string{"BA02"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newSyncTestServer(t, testConfig())
+			seed(t, pg,
+				`INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code) VALUES
+				 (2024, 'BA01', 'C001'), (2025, 'BA01', 'C001'), (2024, 'BA02', 'C002'), (2025, 'BA03', 'C003')`,
+				`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code) VALUES
+				 (2025, '202409', 'BA01', 'C001')`)
+
+			w := serve(t, s, http.MethodPost, "/api/v1/sync/monthly/all-cohorts",
+				map[string]any{"branches": []string{"BA01", "BA02", "BA03"}, "ym": tt.ym})
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status %d: %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Branches []string `json:"branches"`
+				Skipped  []string `json:"skipped"`
+				Jobs     []job    `json:"jobs"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %s: %v", w.Body.String(), err)
+			}
+			if !reflect.DeepEqual(resp.Jobs, tt.wantJobs) || !reflect.DeepEqual(resp.Skipped, tt.wantSkipped) {
+				t.Errorf("jobs %v skipped %v, want %v skipped %v", resp.Jobs, resp.Skipped, tt.wantJobs, tt.wantSkipped)
+			}
+			var keys []string
+			for _, b := range resp.Branches {
+				keys = append(keys, syncsvc.JobKey("monthly_sync", b, tt.ym))
+			}
+			waitJobs(t, s, keys...)
+
+			// every cohort got its own rows for the month
+			rows, err := pg.Pool.Query(context.Background(),
+				`SELECT branch_code, fiscal_year FROM bm_meter_details WHERE year_month=$1 ORDER BY 1, 2`, tt.ym)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var stored []job
+			for rows.Next() {
+				var j job
+				if err := rows.Scan(&j.Branch, &j.FiscalYear); err != nil {
+					t.Fatal(err)
+				}
+				stored = append(stored, j)
+			}
+			if !reflect.DeepEqual(stored, tt.wantJobs) {
+				t.Errorf("stored %v, want %v", stored, tt.wantJobs)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBranchesDisplayName(t *testing.T) {
+	tests := []struct {
+		name  string
+		order []string
+		want  map[string]string
+	}{
+		{name: "alias wins", order: []string{"alias", "name", "code"},
+			want: map[string]string{"BA01": "One", "BA02": "Branch 2", "BA03": "BA03"}},
+		{name: "name first", order: []string{"name", "alias", "code"},
+			want: map[string]string{"BA01": "Branch 1", "BA02": "Branch 2", "BA03": "BA03"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.BranchNameOrder = tt.order
+			s, pg := newTestServer(t, cfg)
+			seed(t, pg, `INSERT INTO bm_branches (code, name, alias) VALUES
+				('BA01', 'Branch 1', 'One'), ('BA02', 'Branch 2', NULL), ('BA03', NULL, NULL)`)
+
+			var resp struct {
+				Items []map[string]string `json:"items"`
+			}
+			decode(t, serve(t, s, http.MethodGet, "/api/v1/branches", nil), &resp)
+			if len(resp.Items) != len(tt.want) {
+				t.Fatalf("got %d branches, want %d", len(resp.Items), len(tt.want))
+			}
+			for _, it := range resp.Items {
+				if got := it["display_name"]; got != tt.want[it["code"]] {
+					t.Errorf("%s display_name = %q, want %q", it["code"], got, tt.want[it["code"]])
+				}
+			}
+		})
+	}
+}
+
+func TestItemsBranchName(t *testing.T) {
+	tests := []struct {
+		name   string
+		branch string
+		order  []string
+		want   string // "" expects branch_name omitted
+	}{
+		{name: "alias wins", branch: "BA01", order: []string{"alias", "name", "code"}, want: "One"},
+		{name: "name first", branch: "BA01", order: []string{"name", "alias", "code"}, want: "Branch 1"},
+		{name: "no alias", branch: "BA02", order: []string{"alias", "name", "code"}, want: "Branch 2"},
+		{name: "unknown branch", branch: "BA09", order: []string{"alias", "name", "code"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.BranchNameOrder = tt.order
+			s, pg := newTestServer(t, cfg)
+			seed(t, pg,
+				`INSERT INTO bm_branches (code, name, alias) VALUES ('BA01', 'Branch 1', 'One'), ('BA02', 'Branch 2', NULL)`,
+				`INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code, debt_ym) VALUES
+				 (2025, 'BA01', 'C001', '256710'), (2025, 'BA02', 'C001', '256710'), (2025, 'BA09', 'C001', '256710')`,
+				`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg) VALUES
+				 (2025, '202410', 'BA01', 'C001', 10), (2025, '202410', 'BA02', 'C001', 10), (2025, '202410', 'BA09', 'C001', 10)`)
+
+			for _, ep := range []string{"/api/v1/custcodes", "/api/v1/details"} {
+				var resp struct {
+					Items []map[string]any `json:"items"`
+				}
+				decode(t, serve(t, s, http.MethodGet, ep+"?ym=202410&branch="+tt.branch, nil), &resp)
+				if len(resp.Items) != 1 {
+					t.Fatalf("%s: got %d items, want 1", ep, len(resp.Items))
+				}
+				got, ok := resp.Items[0]["branch_name"]
+				if tt.want == "" {
+					if ok {
+						t.Errorf("%s: branch_name = %v, want it omitted", ep, got)
+					}
+				} else if got != tt.want {
+					t.Errorf("%s: branch_name = %v, want %q", ep, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gDetailsCompare joins a branch's details for two months on cust_code so the
+// frontend can render a month-over-month table from one call. Customers stored in
+// only one of the months are included with the other side null.
+func (s *Server) gDetailsCompare(c *gin.Context) {
+	branch := strings.TrimSpace(c.Query("branch"))
+	ym := strings.TrimSpace(c.Query("ym"))
+	if branch == "" || ym == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branch and ym are required"})
+		return
+	}
+	if _, _, err := parseYM(ym); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ym: " + err.Error()})
+		return
+	}
+	prevYM := strings.TrimSpace(c.Query("prev_ym"))
+	if prevYM == "" {
+		prevYM, _ = addMonths(ym, -1)
+	} else if _, _, err := parseYM(prevYM); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid prev_ym: " + err.Error()})
+		return
+	}
+	// Both months are read for the cohort of ym's fiscal year (as the init backfill stores them)
+	fiscal, err := parseFiscalOrYM(c.Query("fiscal_year"), ym)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	const q = `WITH cur AS (
+                   SELECT cust_code, present_water_usg FROM bm_meter_details
+                   WHERE fiscal_year=$1 AND branch_code=$2 AND year_month=$3
+               ), prev AS (
+                   SELECT cust_code, present_water_usg FROM bm_meter_details
+                   WHERE fiscal_year=$1 AND branch_code=$2 AND year_month=$4
+               )
+               SELECT COALESCE(cur.cust_code, prev.cust_code), cur.present_water_usg, prev.present_water_usg
+               FROM cur FULL OUTER JOIN prev ON prev.cust_code = cur.cust_code
+               ORDER BY 1`
+	rows, err := s.read.Query(c.Request.Context(), q, fiscal, branch, ym, prevYM)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []compareItem{}
+	for rows.Next() {
+		var it compareItem
+		if err := rows.Scan(&it.CustCode, &it.CurrentUsage, &it.PreviousUsage); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		it.fillDelta()
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"branch":      branch,
+		"ym":          ym,
+		"prev_ym":     prevYM,
+		"fiscal_year": fiscal,
+		"items":       applyJSONPolicy(jsonPolicy{DecimalAsString: s.cfg.DecimalAsString}, items),
+		"total":       len(items),
+	})
+}
+
+// gDetailsYoY compares a month against the same month a year earlier. Each side is read
+// for its own fiscal-year cohort (fiscalYearFromYM); the rows are this year's cohort
+// members, with in_prev_cohort=false marking customers absent from last year's cohort.
+func (s *Server) gDetailsYoY(c *gin.Context) {
+	branch := strings.TrimSpace(c.Query("branch"))
+	ym := strings.TrimSpace(c.Query("ym"))
+	if branch == "" || ym == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branch and ym are required"})
+		return
+	}
+	prevYM, err := addMonths(ym, -12)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ym: " + err.Error()})
+		return
+	}
+	fiscal, prevFiscal := fiscalYearFromYM(ym), fiscalYearFromYM(prevYM)
+
+	const q = `SELECT ci.cust_code, cur.present_water_usg, prev.present_water_usg, (pci.cust_code IS NOT NULL)
+               FROM bm_custcode_init ci
+               LEFT JOIN bm_meter_details cur
+                      ON cur.fiscal_year=ci.fiscal_year AND cur.branch_code=ci.branch_code
+                     AND cur.cust_code=ci.cust_code AND cur.year_month=$3
+               LEFT JOIN bm_custcode_init pci
+                      ON pci.fiscal_year=$4 AND pci.branch_code=ci.branch_code AND pci.cust_code=ci.cust_code
+               LEFT JOIN bm_meter_details prev
+                      ON prev.fiscal_year=$4 AND prev.branch_code=ci.branch_code
+                     AND prev.cust_code=ci.cust_code AND prev.year_month=$5
+               WHERE ci.fiscal_year=$1 AND ci.branch_code=$2
+               ORDER BY ci.cust_code`
+	rows, err := s.read.Query(c.Request.Context(), q, fiscal, branch, ym, prevFiscal, prevYM)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	type item struct {
+		compareItem
+		InPrevCohort bool `json:"in_prev_cohort"`
+	}
+	items := []item{}
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.CustCode, &it.CurrentUsage, &it.PreviousUsage, &it.InPrevCohort); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		it.fillDelta()
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"branch":           branch,
+		"ym":               ym,
+		"prev_ym":          prevYM,
+		"fiscal_year":      fiscal,
+		"prev_fiscal_year": prevFiscal,
+		"items":            applyJSONPolicy(jsonPolicy{DecimalAsString: s.cfg.DecimalAsString}, items),
+		"total":            len(items),
+	})
+}
+
+// compareItem is one customer's usage in two months; a side with no stored row is null.
+type compareItem struct {
+	CustCode      string   `json:"cust_code"`
+	CurrentUsage  *float64 `json:"current_usage" decimal:"string"`
+	PreviousUsage *float64 `json:"previous_usage" decimal:"string"`
+	Delta         *float64 `json:"delta" decimal:"string"`
+	PctChange     *float64 `json:"pct_change" decimal:"string"`
+}
+
+// fillDelta sets Delta when both sides exist, and PctChange when previous usage is non-zero.
+func (it *compareItem) fillDelta() {
+	if it.CurrentUsage == nil || it.PreviousUsage == nil {
+		return
+	}
+	d := *it.CurrentUsage - *it.PreviousUsage
+	it.Delta = &d
+	if *it.PreviousUsage != 0 {
+		pct := d / *it.PreviousUsage * 100
+		it.PctChange = &pct
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCustcodeDetailsFull(t *testing.T) {
+	fullOnly := []string{"meter_no", "meter_state", "use_type", "cust_name", "fiscal_year"}
+	tests := []struct {
+		name     string
+		query    string
+		wantFull bool
+		wantLen  int
+	}{
+		{name: "lean by default", query: "", wantLen: 2},
+		{name: "full=1", query: "&full=1", wantFull: true, wantLen: 2},
+		{name: "full other than 1", query: "&full=true", wantLen: 2},
+		{name: "full with gaps", query: "&full=1&fill_gaps=1", wantFull: true, wantLen: 3},
+	}
+
+	s, pg := newTestServer(t, testConfig())
+	seed(t, pg, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, org_name, use_type, cust_name, meter_no, meter_state, present_water_usg, present_meter_count) VALUES
+		(2025, '202410', 'BA01', 'C001', 'Org', '11', 'Somchai', 'M-1', 'normal', 10, 100),
+		(2025, '202412', 'BA01', 'C001', 'Org', '12', 'Somchai', 'M-2', 'replaced', 12, 112)`)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Series []map[string]any `json:"series"`
+			}
+			decode(t, serve(t, s, http.MethodGet, "/api/v1/custcodes/C001/details?branch=BA01&from=202410&to=202412"+tt.query, nil), &resp)
+			if len(resp.Series) != tt.wantLen {
+				t.Fatalf("got %d months, want %d: %v", len(resp.Series), tt.wantLen, resp.Series)
+			}
+			for _, p := range resp.Series {
+				if p["missing"] == true {
+					for _, col := range fullOnly {
+						if _, ok := p[col]; ok {
+							t.Errorf("%v: gap month has %s", p["ym"], col)
+						}
+					}
+					continue
+				}
+				for _, col := range fullOnly {
+					if _, ok := p[col]; ok != tt.wantFull {
+						t.Errorf("%v: has %s = %t, want %t", p["ym"], col, ok, tt.wantFull)
+					}
+				}
+			}
+			if tt.wantFull {
+				last := resp.Series[len(resp.Series)-1]
+				if last["meter_no"] != "M-2" || last["meter_state"] != "replaced" || last["use_type"] != "12" {
+					t.Errorf("202412 = %v, want meter_no M-2, meter_state replaced, use_type 12", last)
+				}
+			}
+		})
+	}
+}
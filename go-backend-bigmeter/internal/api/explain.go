@@ -0,0 +1,23 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// explainQuery answers ?explain=1 on list endpoints: it runs EXPLAIN (ANALYZE, FORMAT JSON)
+// on the list query the request would have executed and returns the plan instead of items.
+// ANALYZE executes the query, so this is gated behind the admin API key.
+func (s *Server) explainQuery(c *gin.Context, listSQL string, args []any) {
+	if !s.checkAPIKey(c) {
+		return
+	}
+	var plan []byte
+	if err := s.read.QueryRow(c.Request.Context(), "EXPLAIN (ANALYZE, FORMAT JSON) "+listSQL, args...).Scan(&plan); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"query": listSQL, "plan": json.RawMessage(plan)})
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{name: "details", target: "/api/v1/details?ym=202410&branch=BA01&explain=1"},
+		{name: "custcodes", target: "/api/v1/custcodes?ym=202410&branch=BA01&explain=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestServer(t, testConfig())
+			seed(t, pg,
+				`INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code, debt_ym) VALUES (2025, 'BA01', 'C001', '256710')`,
+				`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg, present_meter_count)
+				 VALUES (2025, '202410', 'BA01', 'C001', 10, 100)`)
+
+			var resp map[string]json.RawMessage
+			decode(t, serve(t, s, http.MethodGet, tt.target, nil), &resp)
+			if _, ok := resp["items"]; ok {
+				t.Errorf("explain returned items: %v", resp)
+			}
+			var plan []map[string]any
+			if err := json.Unmarshal(resp["plan"], &plan); err != nil || len(plan) != 1 || plan[0]["Plan"] == nil {
+				t.Errorf("plan = %s, want one EXPLAIN JSON plan (err %v)", resp["plan"], err)
+			}
+
+			// ANALYZE runs the query, so it needs the API key
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			w := httptest.NewRecorder()
+			s.Router().ServeHTTP(w, req)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("without API key: status %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/xuri/excelize/v2"
+)
+
+// detailsCSVHeader matches the JSON field names of detailItem.
+var detailsCSVHeader = []string{
+	"year_month", "branch_code", "org_name", "cust_code", "use_type", "use_name", "cust_name", "address",
+	"route_code", "meter_no", "meter_size", "meter_brand", "meter_state", "average", "present_meter_count",
+	"present_water_usg", "debt_ym", "created_at", "is_zeroed",
+}
+
+// setAttachment sets Content-Disposition for a download. name is built from query
+// params, so anything but letters, digits, '.', '-' and '_' is replaced with '_'
+// before it is quoted; a header can never be split or a path smuggled in.
+func setAttachment(c *gin.Context, name string) {
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", safeFilename(name)))
+}
+
+func safeFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// gDetailsCSV streams the same rows as /details (every row unless ?limit or
+// EXPORT_MAX_LIMIT bounds it) as text/csv, or with format=jsonl as newline-delimited
+// JSON (one object per row, every field present with explicit nulls) for warehouse
+// ingestion.
+func (s *Server) gDetailsCSV(c *gin.Context) {
+	ctx := c.Request.Context()
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "csv")))
+	if format != "csv" && format != "jsonl" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format; expect csv or jsonl"})
+		return
+	}
+	if s.rejectFutureYM(c, c.Query("ym")) {
+		return
+	}
+	mode, ok := s.detailsSearch(c)
+	if !ok {
+		return
+	}
+	base, args, rank, ok := detailsQuery(c, mode)
+	if !ok {
+		return
+	}
+	orderBy, sortDir := detailsOrder(c, rank)
+	limit, offset := exportLimit(c, s.cfg.Limits.Export)
+	listSQL := base + fmt.Sprintf(" ORDER BY %s %s", orderBy, sortDir) + limitOffsetSQL(limit, offset)
+
+	rows, err := s.read.Query(ctx, listSQL, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// The reader goroutine owns rows from here; cancel stops it if the response ends early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	items, readErr := bufferDetailRows(ctx, rows, s.cfg.ExportBufferRows, s.cfg.BranchNameOrder)
+
+	branch := strings.TrimSpace(c.Query("branch"))
+	ym := strings.TrimSpace(c.Query("ym"))
+	if format == "jsonl" {
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	}
+	setAttachment(c, fmt.Sprintf("details_%s_%s.%s", branch, ym, format))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent once streaming starts, so failures past this
+	// point can only be logged and end the stream early.
+	w := csv.NewWriter(c.Writer)
+	enc := json.NewEncoder(c.Writer) // Encode terminates each object with '\n'
+	policy := jsonPolicy{Nulls: jsonNullsExplicit, DecimalAsString: s.cfg.DecimalAsString}
+	if format == "csv" {
+		if err := w.Write(detailsCSVHeader); err != nil {
+			log.Printf("details.csv: write header: %v", err)
+			return
+		}
+	}
+	n := 0
+	for it := range items {
+		var err error
+		if format == "jsonl" {
+			err = enc.Encode(policy.wrap(it))
+		} else {
+			err = w.Write(detailCSVRecord(it))
+		}
+		if err != nil {
+			log.Printf("details.%s: write: %v", format, err)
+			return
+		}
+		// flush periodically so rows are streamed rather than buffered
+		if n++; n%500 == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+	}
+	if err := readErr(); err != nil {
+		log.Printf("details.%s: rows: %v", format, err)
+	}
+	w.Flush()
+}
+
+// bufferDetailRows scans rows (naming branches in order, BRANCH_NAME_ORDER) on a
+// goroutine and hands the items over in query order through a channel holding up to
+// size rows (EXPORT_BUFFER_ROWS). With a buffer the query runs ahead of a slow client
+// and its connection is released as soon as the last row is read; size 0 keeps reading
+// in step with the writer. The goroutine closes rows and the channel; the returned func
+// waits for it and reports the scan or iteration error. Canceling ctx stops it early.
+func bufferDetailRows(ctx context.Context, rows pgx.Rows, size int, order []string) (<-chan detailItem, func() error) {
+	out := make(chan detailItem, size)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer rows.Close()
+		for rows.Next() {
+			it, err := scanDetailItem(rows, order)
+			if err != nil {
+				errc <- fmt.Errorf("scan: %w", err)
+				return
+			}
+			select {
+			case out <- it:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+		errc <- rows.Err()
+	}()
+	return out, func() error { return <-errc }
+}
+
+// detailCSVRecord renders a detailItem in detailsCSVHeader order. Floats use plain
+// decimal notation (no exponent) and NULLs become empty cells.
+func detailCSVRecord(it detailItem) []string {
+	return []string{
+		it.YearMonth, it.BranchCode, csvStr(it.OrgName), it.CustCode, csvStr(it.UseType), csvStr(it.UseName),
+		csvStr(it.CustName), csvStr(it.Address), csvStr(it.RouteCode), csvStr(it.MeterNo), csvStr(it.MeterSize),
+		csvStr(it.MeterBrand), csvStr(it.MeterState), csvFloat(it.Average), csvFloat(it.PresentMeterCount),
+		csvFloat(it.PresentWaterUsg), csvStr(it.DebtYM), it.CreatedAt.Format(time.RFC3339), strconv.FormatBool(it.IsZeroed),
+	}
+}
+
+func csvStr(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+func csvFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// custcodesXLSXHeader matches the JSON field names of custcodeItem.
+var custcodesXLSXHeader = []string{
+	"fiscal_year", "branch_code", "org_name", "cust_code", "use_type", "use_name", "cust_name", "address",
+	"route_code", "meter_no", "meter_size", "meter_brand", "meter_state", "debt_ym", "created_at",
+}
+
+// gCustcodesXLSX exports the /custcodes cohort (every row unless ?limit or
+// EXPORT_MAX_LIMIT bounds it) as an .xlsx workbook with a title row, a frozen header row
+// and columns sized to their content. xlsx stores text as UTF-8 so Thai names/addresses
+// open correctly in Excel, unlike a plain CSV.
+func (s *Server) gCustcodesXLSX(c *gin.Context) {
+	ctx := c.Request.Context()
+	if s.rejectFutureYM(c, c.Query("ym")) {
+		return
+	}
+	base, args, fiscal, ok := custcodesQuery(c, s.trigramSearch(ctx, custcodesSearchIndex))
+	if !ok {
+		return
+	}
+	orderBy, sortDir := custcodesOrder(c)
+	limit, offset := exportLimit(c, s.cfg.Limits.Export)
+	rows, err := s.read.Query(ctx, base+fmt.Sprintf(" ORDER BY %s %s", orderBy, sortDir)+limitOffsetSQL(limit, offset), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	branch := strings.TrimSpace(c.Query("branch"))
+	f := excelize.NewFile()
+	defer f.Close()
+	const sheet = "Sheet1"
+
+	widths := make([]int, len(custcodesXLSXHeader))
+	setRow := func(row int, values []string) error {
+		for i, v := range values {
+			cell, err := excelize.CoordinatesToCellName(i+1, row)
+			if err != nil {
+				return err
+			}
+			if err := f.SetCellStr(sheet, cell, v); err != nil {
+				return err
+			}
+			if n := utf8.RuneCountInString(v); n > widths[i] {
+				widths[i] = n
+			}
+		}
+		return nil
+	}
+
+	// Row 1: title, row 2: header, data from row 3
+	if err := f.SetCellStr(sheet, "A1", fmt.Sprintf("Custcodes - branch %s, fiscal year %d", branch, fiscal)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := setRow(2, custcodesXLSXHeader); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	row := 3
+	for rows.Next() {
+		it, err := scanCustcodeItem(rows, s.cfg.BranchNameOrder)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := setRow(row, custcodeRecord(it)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		row++
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := styleCustcodesSheet(f, sheet, widths); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	setAttachment(c, fmt.Sprintf("custcodes_%s_%d.xlsx", branch, fiscal))
+	c.Status(http.StatusOK)
+	if err := f.Write(c.Writer); err != nil {
+		log.Printf("custcodes.xlsx: write: %v", err)
+	}
+}
+
+// styleCustcodesSheet bolds the title/header, freezes everything above row 3 and sizes columns.
+func styleCustcodesSheet(f *excelize.File, sheet string, widths []int) error {
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	lastCol, err := excelize.ColumnNumberToName(len(widths))
+	if err != nil {
+		return err
+	}
+	if err := f.SetCellStyle(sheet, "A1", lastCol+"2", bold); err != nil {
+		return err
+	}
+	if err := f.SetPanes(sheet, &excelize.Panes{
+		Freeze:      true,
+		YSplit:      2,
+		TopLeftCell: "A3",
+		ActivePane:  "bottomLeft",
+	}); err != nil {
+		return err
+	}
+	for i, w := range widths {
+		col, err := excelize.ColumnNumberToName(i + 1)
+		if err != nil {
+			return err
+		}
+		// a little padding; clamp very long addresses
+		width := float64(w + 2)
+		if width > 60 {
+			width = 60
+		}
+		if err := f.SetColWidth(sheet, col, col, width); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// custcodeRecord renders a custcodeItem in custcodesXLSXHeader order; NULLs become empty cells.
+func custcodeRecord(it custcodeItem) []string {
+	return []string{
+		strconv.Itoa(it.FiscalYear), it.BranchCode, csvStr(it.OrgName), it.CustCode, csvStr(it.UseType),
+		csvStr(it.UseName), csvStr(it.CustName), csvStr(it.Address), csvStr(it.RouteCode), csvStr(it.MeterNo),
+		csvStr(it.MeterSize), csvStr(it.MeterBrand), csvStr(it.MeterState), csvStr(it.DebtYM),
+		it.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestSetAttachment(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "details_BA01_202410.csv", want: `attachment; filename="details_BA01_202410.csv"`},
+		{name: "custcodes_BA01_2025.xlsx", want: `attachment; filename="custcodes_BA01_2025.xlsx"`},
+		{name: "details__202410.jsonl", want: `attachment; filename="details__202410.jsonl"`},
+		{name: "details_a\"b_202410.csv", want: `attachment; filename="details_a_b_202410.csv"`},
+		{name: "details_x\r\nSet-Cookie: a=b_202410.csv", want: `attachment; filename="details_x__Set-Cookie__a_b_202410.csv"`},
+		{name: "details_../../etc/passwd_1.csv", want: `attachment; filename="details_.._.._etc_passwd_1.csv"`},
+		{name: "details_สาขา_202410.csv", want: `attachment; filename="details______202410.csv"`},
+	}
+	gin.SetMode(gin.ReleaseMode)
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		setAttachment(c, tt.name)
+		if got := c.Writer.Header().Get("Content-Disposition"); got != tt.want {
+			t.Errorf("setAttachment(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeDetailRows is a pgx.Rows of n details rows with cust_codes C0001..; Scan fails on
+// row failAt (1-based, 0 never)
+type fakeDetailRows struct {
+	n, failAt int
+	next      atomic.Int32
+	closed    atomic.Bool
+}
+
+func (r *fakeDetailRows) Next() bool {
+	if r.closed.Load() || int(r.next.Load()) >= r.n {
+		return false
+	}
+	r.next.Add(1)
+	return true
+}
+
+func (r *fakeDetailRows) Scan(dest ...any) error {
+	i := int(r.next.Load())
+	if i == r.failAt {
+		return errors.New("bad row")
+	}
+	*dest[0].(*string) = "202410"
+	*dest[1].(*string) = "BA01"
+	*dest[3].(*string) = fmt.Sprintf("C%04d", i)
+	return nil
+}
+
+func (r *fakeDetailRows) Close()                                       { r.closed.Store(true) }
+func (r *fakeDetailRows) Err() error                                   { return nil }
+func (r *fakeDetailRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *fakeDetailRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeDetailRows) Values() ([]any, error)                       { return nil, nil }
+func (r *fakeDetailRows) RawValues() [][]byte                          { return nil }
+func (r *fakeDetailRows) Conn() *pgx.Conn                              { return nil }
+
+func TestBufferDetailRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		rows    int
+		failAt  int
+		want    int
+		wantErr bool
+	}{
+		{name: "unbuffered", rows: 50, want: 50},
+		{name: "buffered", size: 8, rows: 50, want: 50},
+		{name: "buffer larger than the result", size: 100, rows: 50, want: 50},
+		{name: "empty result", size: 8},
+		{name: "scan error", size: 8, rows: 50, failAt: 21, want: 20, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := &fakeDetailRows{n: tt.rows, failAt: tt.failAt}
+			items, readErr := bufferDetailRows(context.Background(), rows, tt.size, nil)
+			var got []string
+			for it := range items {
+				got = append(got, it.CustCode)
+			}
+			if err := readErr(); (err != nil) != tt.wantErr {
+				t.Fatalf("readErr() = %v, want error %t", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("got %d items, want %d", len(got), tt.want)
+			}
+			for i, code := range got {
+				if want := fmt.Sprintf("C%04d", i+1); code != want {
+					t.Fatalf("item %d = %s, want %s (query order)", i, code, want)
+				}
+			}
+			if !rows.closed.Load() {
+				t.Error("rows not closed")
+			}
+		})
+	}
+}
+
+// A client that goes away stops the reader: it closes rows without reading the rest
+func TestBufferDetailRowsCancel(t *testing.T) {
+	for _, size := range []int{0, 4} {
+		t.Run(fmt.Sprintf("size=%d", size), func(t *testing.T) {
+			const total = 1000
+			rows := &fakeDetailRows{n: total}
+			ctx, cancel := context.WithCancel(context.Background())
+			items, readErr := bufferDetailRows(ctx, rows, size, nil)
+			<-items
+			cancel()
+
+			if err := readErr(); !errors.Is(err, context.Canceled) {
+				t.Fatalf("readErr() = %v, want context.Canceled", err)
+			}
+			for range items { // closed once the goroutine returned
+			}
+			if !rows.closed.Load() {
+				t.Error("rows not closed")
+			}
+			if n := rows.next.Load(); n >= total {
+				t.Errorf("read %d rows after cancel, want fewer than %d", n, total)
+			}
+		})
+	}
+}
+
+func TestDetailsExportFormat(t *testing.T) {
+	tests := []struct {
+		format     string
+		wantStatus int
+	}{
+		{format: "xml", wantStatus: http.StatusBadRequest},
+		{format: "json", wantStatus: http.StatusBadRequest},
+	}
+	s := NewServer(testConfig(), nil, nil)
+	for _, tt := range tests {
+		w := serve(t, s, http.MethodGet, "/api/v1/details.csv?ym=202410&branch=BA01&format="+tt.format, nil)
+		if w.Code != tt.wantStatus {
+			t.Errorf("format=%s: status %d, want %d: %s", tt.format, w.Code, tt.wantStatus, w.Body.String())
+		}
+	}
+}
+
+// TestDetailsJSONL parses every line of format=jsonl on its own and expects each
+// detailItem field, with explicit nulls for the unset ones
+func TestDetailsJSONL(t *testing.T) {
+	s, pg := newTestServer(t, testConfig())
+	seed(t, pg,
+		`INSERT INTO bm_branches (code, name) VALUES ('BA01', 'Branch 1')`,
+		`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, org_name, cust_name, address,
+		   meter_state, average, present_meter_count, present_water_usg, debt_ym) VALUES
+		 (2025, '202410', 'BA01', 'C001', 'Org', 'สมชาย "A"', E'1 Main\nRoad', 'N', 10.5, 100, 12.25, '256710'),
+		 (2025, '202410', 'BA01', 'C002', '', NULL, NULL, NULL, 0, 0, 0, NULL)`)
+
+	w := serve(t, s, http.MethodGet, "/api/v1/details.csv?ym=202410&branch=BA01&format=jsonl&order_by=cust_code&sort=asc", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/x-ndjson") {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+	}
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), w.Body.String())
+	}
+
+	fields := append([]string{"branch_name"}, detailsCSVHeader...)
+	tests := []struct {
+		custCode string
+		want     map[string]any // other fields must be present; nil expects null
+	}{
+		{custCode: "C001", want: map[string]any{"branch_name": "Branch 1", "cust_name": `สมชาย "A"`, "address": "1 Main\nRoad",
+			"meter_state": "N", "present_water_usg": 12.25, "use_type": nil, "is_zeroed": false}},
+		{custCode: "C002", want: map[string]any{"branch_name": "Branch 1", "cust_name": nil, "address": nil,
+			"meter_state": nil, "debt_ym": nil, "present_water_usg": 0.0, "is_zeroed": true}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.custCode, func(t *testing.T) {
+			var obj map[string]any
+			if err := json.Unmarshal([]byte(lines[i]), &obj); err != nil {
+				t.Fatalf("line %d does not parse on its own: %v\n%s", i+1, err, lines[i])
+			}
+			if obj["cust_code"] != tt.custCode {
+				t.Fatalf("line %d cust_code = %v, want %s", i+1, obj["cust_code"], tt.custCode)
+			}
+			for _, f := range fields {
+				if _, ok := obj[f]; !ok {
+					t.Errorf("field %s missing", f)
+				}
+			}
+			for f, want := range tt.want {
+				if got := obj[f]; got != want {
+					t.Errorf("%s = %#v, want %#v", f, got, want)
+				}
+			}
+		})
+	}
+}
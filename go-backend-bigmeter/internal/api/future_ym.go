@@ -0,0 +1,40 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// futureYMGrace widens "now" so a client a few hours ahead of the server's
+// TIMEZONE (month rollover at midnight) is not rejected.
+const futureYMGrace = 24 * time.Hour
+
+// latestAllowedYM is the last YYYYMM a request may ask for: the current month in
+// TIMEZONE (plus futureYMGrace), shifted by MAX_FUTURE_MONTHS.
+func (s *Server) latestAllowedYM(now time.Time) string {
+	loc, err := time.LoadLocation(s.cfg.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	t := now.In(loc).Add(futureYMGrace)
+	i := t.Year()*12 + int(t.Month()) - 1 + s.cfg.MaxFutureMonths
+	return fmt.Sprintf("%04d%02d", i/12, i%12+1)
+}
+
+// rejectFutureYM writes 400 when ym lies beyond latestAllowedYM. A typo such as next
+// year's ym would otherwise derive a future fiscal year and silently return nothing.
+// Empty or malformed ym is left to the handler's own validation.
+func (s *Server) rejectFutureYM(c *gin.Context, ym string) bool {
+	if _, _, err := parseYM(ym); err != nil {
+		return false
+	}
+	latest := s.latestAllowedYM(time.Now())
+	if ym <= latest {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ym %s is in the future (latest allowed %s)", ym, latest)})
+	return true
+}
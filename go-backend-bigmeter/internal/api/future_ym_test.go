@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLatestAllowedYM(t *testing.T) {
+	bkk := time.FixedZone("ICT", 7*3600)
+	tests := []struct {
+		name            string
+		now             time.Time
+		maxFutureMonths int
+		want            string
+	}{
+		{name: "mid month", now: time.Date(2024, 10, 15, 12, 0, 0, 0, bkk), maxFutureMonths: 1, want: "202411"},
+		{name: "no future months", now: time.Date(2024, 10, 15, 12, 0, 0, 0, bkk), maxFutureMonths: 0, want: "202410"},
+		{name: "last day within grace", now: time.Date(2024, 10, 31, 20, 0, 0, 0, bkk), maxFutureMonths: 0, want: "202411"},
+		{name: "year rollover", now: time.Date(2024, 12, 10, 9, 0, 0, 0, bkk), maxFutureMonths: 1, want: "202501"},
+		{name: "server clock in UTC", now: time.Date(2024, 10, 15, 20, 0, 0, 0, time.UTC), maxFutureMonths: 0, want: "202410"},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.MaxFutureMonths = tt.maxFutureMonths
+		s := NewServer(cfg, nil, nil)
+		if got := s.latestAllowedYM(tt.now); got != tt.want {
+			t.Errorf("%s: latestAllowedYM = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRejectFutureYM(t *testing.T) {
+	ym := func(months int) string {
+		now := time.Now().In(time.FixedZone("ICT", 7*3600))
+		i := now.Year()*12 + int(now.Month()) - 1 + months
+		return fmt.Sprintf("%04d%02d", i/12, i%12+1)
+	}
+	tests := []struct {
+		name string
+		ym   string
+		want int
+	}{
+		{name: "current month", ym: ym(0), want: http.StatusOK},
+		{name: "next month within YM_MAX_FUTURE_MONTHS", ym: ym(1), want: http.StatusOK},
+		{name: "next year", ym: ym(12), want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, testConfig())
+			for _, target := range []string{
+				"/api/v1/details?branch=BA01&ym=" + tt.ym,
+				"/api/v1/custcodes?branch=BA01&ym=" + tt.ym,
+			} {
+				if w := serve(t, s, http.MethodGet, target, nil); w.Code != tt.want {
+					t.Errorf("GET %s: status %d, want %d: %s", target, w.Code, tt.want, w.Body.String())
+				}
+			}
+		})
+	}
+}
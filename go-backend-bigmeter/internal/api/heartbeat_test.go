@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	syncsvc "go-backend-bigmeter/internal/sync"
+)
+
+func TestHeartbeat(t *testing.T) {
+	tests := []struct {
+		name       string
+		beatAge    time.Duration // 0: the scheduler never beat
+		monthly    bool          // expect a monthly run every minute
+		ranMonthly bool          // the scheduler logged a monthly run just now
+		wantCode   int
+		wantStatus string
+	}{
+		{name: "never beat", wantCode: http.StatusServiceUnavailable, wantStatus: "stale"},
+		{name: "fresh", beatAge: time.Minute, wantCode: http.StatusOK, wantStatus: "ok"},
+		{name: "old", beatAge: 2 * time.Hour, wantCode: http.StatusServiceUnavailable, wantStatus: "stale"},
+		{name: "monthly run missed", beatAge: time.Minute, monthly: true, wantCode: http.StatusServiceUnavailable, wantStatus: "stale"},
+		{name: "monthly run logged", beatAge: time.Minute, monthly: true, ranMonthly: true, wantCode: http.StatusOK, wantStatus: "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Heartbeat.MaxAge = 30 * time.Minute
+			if tt.monthly {
+				cfg.EnableMonthlySync = true
+				cfg.MonthlySpec = "0 * * * * *"
+			}
+			s, pg := newTestServer(t, cfg)
+			ctx := context.Background()
+			if tt.beatAge > 0 {
+				if err := syncsvc.NewHeartbeat(pg).Beat(ctx, time.Now().Add(-tt.beatAge)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.ranMonthly {
+				seed(t, pg, `INSERT INTO bm_sync_logs (sync_type, branch_code, status, started_at, triggered_by)
+					VALUES ('monthly_sync', 'BA01', 'success', now(), 'scheduler')`)
+			}
+
+			w := serve(t, s, http.MethodGet, "/api/v1/healthz/heartbeat", nil)
+			var resp struct {
+				Status string `json:"status"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %s: %v", w.Body.String(), err)
+			}
+			if w.Code != tt.wantCode || resp.Status != tt.wantStatus {
+				t.Errorf("got %d %q, want %d %q: %s", w.Code, resp.Status, tt.wantCode, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestDetailsIncludeSummary(t *testing.T) {
+	type summary struct {
+		Total           int     `json:"total"`
+		Zeroed          int     `json:"zeroed"`
+		Active          int     `json:"active"`
+		SumPresentWater float64 `json:"sum_present_water_usg"`
+		Avg             float64 `json:"avg"`
+	}
+	tests := []struct {
+		name   string
+		ym     string
+		query  string
+		wantIn bool
+	}{
+		{name: "without the flag", ym: "202410", query: ""},
+		{name: "include_summary=1", ym: "202410", query: "&include_summary=1", wantIn: true},
+		{name: "empty month", ym: "202411", query: "&include_summary=1", wantIn: true},
+	}
+
+	s, pg := newTestServer(t, testConfig())
+	seed(t, pg, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, org_name, present_water_usg, present_meter_count) VALUES
+		(2025, '202410', 'BA01', 'C001', 'Org', 10, 100),
+		(2025, '202410', 'BA01', 'C002', '', 0, 0),
+		(2025, '202410', 'BA01', 'C003', 'Org', 7.5, 80),
+		(2025, '202410', 'BA02', 'C101', 'Org', 50, 500)`)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want summary
+			decode(t, serve(t, s, http.MethodGet, "/api/v1/details/summary?branch=BA01&ym="+tt.ym, nil), &want)
+			if want.Total > 0 {
+				want.Avg = want.SumPresentWater / float64(want.Total)
+			}
+
+			var resp struct {
+				Total   int      `json:"total"`
+				Summary *summary `json:"summary"`
+			}
+			decode(t, serve(t, s, http.MethodGet, "/api/v1/details?limit=1&branch=BA01&ym="+tt.ym+tt.query, nil), &resp)
+			if (resp.Summary != nil) != tt.wantIn {
+				t.Fatalf("summary present = %t, want %t", resp.Summary != nil, tt.wantIn)
+			}
+			if resp.Summary == nil {
+				return
+			}
+			got := *resp.Summary
+			if got.Total != want.Total || got.Zeroed != want.Zeroed || got.Active != want.Active ||
+				math.Abs(got.SumPresentWater-want.SumPresentWater) > 1e-9 || math.Abs(got.Avg-want.Avg) > 1e-9 {
+				t.Errorf("summary = %+v, /details/summary gives %+v", got, want)
+			}
+			if resp.Total != want.Total {
+				t.Errorf("total = %d, want %d", resp.Total, want.Total)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	syncsvc "go-backend-bigmeter/internal/sync"
+)
+
+func TestSyncInitDebtYM(t *testing.T) {
+	october := fmt.Sprintf("%04d10", time.Now().Year())
+	tests := []struct {
+		name          string
+		debtYM        string
+		require       bool
+		wantCode      int
+		wantGregorian string
+		wantThai      string
+		wantDefaulted bool
+	}{
+		{name: "gregorian", debtYM: "202410", wantCode: http.StatusAccepted, wantGregorian: "202410", wantThai: "256710"},
+		{name: "thai", debtYM: "256710", wantCode: http.StatusAccepted, wantGregorian: "202410", wantThai: "256710"},
+		{name: "empty defaults to October", debtYM: "", wantCode: http.StatusAccepted,
+			wantGregorian: october, wantThai: fmt.Sprintf("%04d10", time.Now().Year()+543), wantDefaulted: true},
+		{name: "empty rejected", debtYM: " ", require: true, wantCode: http.StatusBadRequest},
+		{name: "explicit with require", debtYM: "202410", require: true, wantCode: http.StatusAccepted, wantGregorian: "202410", wantThai: "256710"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.RequireDebtYM = tt.require
+			s, _ := newSyncTestServer(t, cfg)
+
+			w := serve(t, s, http.MethodPost, "/api/v1/sync/init",
+				map[string]any{"branches": []string{"BA01"}, "debt_ym": tt.debtYM, "backfill_months": 0, "force": true})
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if w.Code != http.StatusAccepted {
+				if !strings.Contains(w.Body.String(), "INIT_REQUIRE_DEBT_YM") {
+					t.Errorf("error does not name INIT_REQUIRE_DEBT_YM: %s", w.Body.String())
+				}
+				return
+			}
+			var resp struct {
+				Gregorian string `json:"debt_ym_gregorian"`
+				Thai      string `json:"debt_ym_thai"`
+				Defaulted bool   `json:"debt_ym_defaulted"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			waitJobs(t, s, syncsvc.JobKey("yearly_init", "BA01", resp.Thai))
+			if resp.Gregorian != tt.wantGregorian || resp.Thai != tt.wantThai || resp.Defaulted != tt.wantDefaulted {
+				t.Errorf("resolved %+v, want gregorian %s thai %s defaulted %t", resp, tt.wantGregorian, tt.wantThai, tt.wantDefaulted)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSON_NULLS modes
+const (
+	jsonNullsOmit     = "omit"
+	jsonNullsExplicit = "explicit"
+)
+
+// jsonPolicy holds the list-response shaping options: JSON_NULLS and DECIMAL_AS_STRING.
+type jsonPolicy struct {
+	Nulls           string
+	DecimalAsString bool
+}
+
+func (s *Server) jsonPolicy() jsonPolicy {
+	return jsonPolicy{Nulls: s.cfg.JSONNulls, DecimalAsString: s.cfg.DecimalAsString}
+}
+
+// policyJSON wraps a response struct and serializes it according to a jsonPolicy:
+// in explicit mode nil pointer fields tagged omitempty are emitted as null instead of
+// being dropped, and with DecimalAsString float fields tagged `decimal:"string"` are
+// emitted as exact decimal strings ("12.34"). Field order follows the struct.
+type policyJSON struct {
+	v any
+	p jsonPolicy
+}
+
+func (e policyJSON) MarshalJSON() ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(e.v))
+	if rv.Kind() != reflect.Struct {
+		return json.Marshal(e.v)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	if err := e.writeFields(&buf, rv, &first); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// writeFields writes rv's fields as key:value pairs; untagged embedded structs are
+// flattened into the parent object as encoding/json does.
+func (e policyJSON) writeFields(buf *bytes.Buffer, rv reflect.Value, first *bool) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			if err := e.writeFields(buf, rv.Field(i), first); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fv := rv.Field(i)
+		if strings.Contains(opts, "omitempty") && fv.IsZero() {
+			// Non-pointer omitempty fields keep the normal omit behaviour; only nullable
+			// fields change, and only in explicit mode.
+			if fv.Kind() != reflect.Ptr || e.p.Nulls != jsonNullsExplicit {
+				continue
+			}
+		}
+		key, _ := json.Marshal(name)
+		var val []byte
+		if e.p.DecimalAsString && f.Tag.Get("decimal") == "string" {
+			val = decimalString(fv)
+		} else {
+			var err error
+			if val, err = json.Marshal(fv.Interface()); err != nil {
+				return err
+			}
+		}
+		if !*first {
+			buf.WriteByte(',')
+		}
+		*first = false
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	return nil
+}
+
+// decimalString renders a float (or *float, nil -> null) as a JSON string in plain
+// decimal notation.
+func decimalString(fv reflect.Value) []byte {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return []byte("null")
+		}
+		fv = fv.Elem()
+	}
+	return strconv.AppendQuote(nil, strconv.FormatFloat(fv.Float(), 'f', -1, 64))
+}
+
+// decimalValue applies DECIMAL_AS_STRING to a single scalar (e.g. a summary total).
+func (p jsonPolicy) decimalValue(f float64) any {
+	if p.DecimalAsString {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return f
+}
+
+// wrap applies the policy to a single object (e.g. a totals row).
+func (p jsonPolicy) wrap(v any) any {
+	if p.Nulls != jsonNullsExplicit && !p.DecimalAsString {
+		return v
+	}
+	return policyJSON{v: v, p: p}
+}
+
+// applyJSONPolicy returns items unchanged when no option is active, or wrapped so
+// they serialize according to p.
+func applyJSONPolicy[T any](p jsonPolicy, items []T) any {
+	if p.Nulls != jsonNullsExplicit && !p.DecimalAsString {
+		return items
+	}
+	out := make([]policyJSON, len(items))
+	for i := range items {
+		out[i] = policyJSON{v: items[i], p: p}
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestJSONNulls(t *testing.T) {
+	name := "Org 1"
+	tests := []struct {
+		name     string
+		nulls    string
+		orgName  *string
+		wantKey  bool
+		wantNull bool
+	}{
+		{name: "omit, null org_name", nulls: jsonNullsOmit, wantKey: false},
+		{name: "explicit, null org_name", nulls: jsonNullsExplicit, wantKey: true, wantNull: true},
+		{name: "omit, set org_name", nulls: jsonNullsOmit, orgName: &name, wantKey: true},
+		{name: "explicit, set org_name", nulls: jsonNullsExplicit, orgName: &name, wantKey: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := []detailItem{{YearMonth: "202410", BranchCode: "BA01", CustCode: "C001", OrgName: tt.orgName}}
+			b, err := json.Marshal(applyJSONPolicy(jsonPolicy{Nulls: tt.nulls}, items))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []map[string]any
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			v, ok := got[0]["org_name"]
+			if ok != tt.wantKey {
+				t.Fatalf("org_name present = %t, want %t: %s", ok, tt.wantKey, b)
+			}
+			if ok && (v == nil) != tt.wantNull {
+				t.Errorf("org_name = %v, want null %t", v, tt.wantNull)
+			}
+			// non-pointer fields are emitted as before in both modes
+			if got[0]["cust_code"] != "C001" || got[0]["is_zeroed"] != false {
+				t.Errorf("unexpected row %s", b)
+			}
+		})
+	}
+}
+
+func TestDecimalAsString(t *testing.T) {
+	tests := []struct {
+		name  string
+		on    bool
+		nulls string
+		want  map[string]any
+	}{
+		{name: "disabled", want: map[string]any{"average": 12.34, "present_meter_count": 123456789.5, "present_water_usg": 0.1}},
+		{name: "enabled", on: true, want: map[string]any{"average": "12.34", "present_meter_count": "123456789.5", "present_water_usg": "0.1"}},
+		{name: "enabled with explicit nulls", on: true, nulls: jsonNullsExplicit, want: map[string]any{"average": "12.34", "present_meter_count": "123456789.5", "present_water_usg": "0.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := []detailItem{{YearMonth: "202410", BranchCode: "BA01", CustCode: "C001", Average: 12.34, PresentMeterCount: 123456789.5, PresentWaterUsg: 0.1}}
+			b, err := json.Marshal(applyJSONPolicy(jsonPolicy{Nulls: tt.nulls, DecimalAsString: tt.on}, items))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []map[string]any
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			for k, want := range tt.want {
+				if got[0][k] != want {
+					t.Errorf("%s = %#v, want %#v: %s", k, got[0][k], want, b)
+				}
+			}
+			if got[0]["cust_code"] != "C001" {
+				t.Errorf("unexpected row %s", b)
+			}
+		})
+	}
+}
+
+func TestDetailsDecimalAsString(t *testing.T) {
+	tests := []struct {
+		on   bool
+		want any
+	}{
+		{on: false, want: 12.34},
+		{on: true, want: "12.34"},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.DecimalAsString = tt.on
+		s, pg := newTestServer(t, cfg)
+		seed(t, pg, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg, present_meter_count)
+		             VALUES (2025, '202410', 'BA01', 'C001', 12.34, 100)`)
+		var resp struct {
+			Items []map[string]any `json:"items"`
+		}
+		decode(t, serve(t, s, http.MethodGet, "/api/v1/details?ym=202410&branch=BA01", nil), &resp)
+		if len(resp.Items) != 1 {
+			t.Fatalf("got %d items, want 1", len(resp.Items))
+		}
+		if got := resp.Items[0]["present_water_usg"]; got != tt.want {
+			t.Errorf("DECIMAL_AS_STRING=%t: present_water_usg = %#v, want %#v", tt.on, got, tt.want)
+		}
+	}
+}
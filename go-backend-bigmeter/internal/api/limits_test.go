@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestListLimit(t *testing.T) {
+	tests := []struct {
+		query      string
+		maxLimit   int
+		wantLimit  int
+		wantOffset int
+		wantOK     bool
+	}{
+		{query: "", maxLimit: 500, wantLimit: 50, wantOK: true},
+		{query: "limit=120&offset=40", maxLimit: 500, wantLimit: 120, wantOffset: 40, wantOK: true},
+		{query: "limit=1000", maxLimit: 200, wantLimit: 200, wantOK: true},
+		{query: "limit=-1&offset=x", maxLimit: 200, wantLimit: 50, wantOK: true},
+		{query: "limit=all", maxLimit: 500},
+		{query: "limit=ALL", maxLimit: 500},
+	}
+	gin.SetMode(gin.ReleaseMode)
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		limit, offset, ok := listLimit(c, tt.maxLimit)
+		if ok != tt.wantOK || limit != tt.wantLimit || offset != tt.wantOffset {
+			t.Errorf("listLimit(%q, %d) = %d, %d, %t, want %d, %d, %t",
+				tt.query, tt.maxLimit, limit, offset, ok, tt.wantLimit, tt.wantOffset, tt.wantOK)
+		}
+		if !ok && w.Code != http.StatusBadRequest {
+			t.Errorf("listLimit(%q): status %d, want 400", tt.query, w.Code)
+		}
+	}
+}
+
+func TestExportLimit(t *testing.T) {
+	tests := []struct {
+		query      string
+		maxLimit   int // EXPORT_MAX_LIMIT; 0 is uncapped
+		wantLimit  int // 0 is every row
+		wantOffset int
+	}{
+		{query: "", wantLimit: 0},
+		{query: "limit=all", wantLimit: 0},
+		{query: "limit=10000&offset=20", wantLimit: 10000, wantOffset: 20},
+		{query: "", maxLimit: 5000, wantLimit: 5000},
+		{query: "limit=all", maxLimit: 5000, wantLimit: 5000},
+		{query: "limit=10000", maxLimit: 5000, wantLimit: 5000},
+		{query: "limit=100", maxLimit: 5000, wantLimit: 100},
+	}
+	gin.SetMode(gin.ReleaseMode)
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		if limit, offset := exportLimit(c, tt.maxLimit); limit != tt.wantLimit || offset != tt.wantOffset {
+			t.Errorf("exportLimit(%q, %d) = %d, %d, want %d, %d", tt.query, tt.maxLimit, limit, offset, tt.wantLimit, tt.wantOffset)
+		}
+	}
+}
+
+func TestEndpointLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		wantCode  int
+		wantLimit int // /details and /sync/logs report their limit
+		wantRows  int // /details.csv data rows
+	}{
+		{name: "details capped by DETAILS_MAX_LIMIT", target: "/api/v1/details?ym=202410&branch=BA01&limit=100", wantCode: http.StatusOK, wantLimit: 2},
+		{name: "details rejects all", target: "/api/v1/details?ym=202410&branch=BA01&limit=all", wantCode: http.StatusBadRequest},
+		{name: "sync logs capped by LOGS_MAX_LIMIT", target: "/api/v1/sync/logs?limit=100", wantCode: http.StatusOK, wantLimit: 3},
+		{name: "sync logs rejects all", target: "/api/v1/sync/logs?limit=all", wantCode: http.StatusBadRequest},
+		{name: "export all", target: "/api/v1/details.csv?ym=202410&branch=BA01&limit=all", wantCode: http.StatusOK, wantRows: 4},
+		{name: "export not bound by the details cap", target: "/api/v1/details.csv?ym=202410&branch=BA01&limit=3", wantCode: http.StatusOK, wantRows: 3},
+	}
+	cfg := testConfig()
+	cfg.Limits.Details = 2
+	cfg.Limits.SyncLogs = 3
+	s, pg := newTestServer(t, cfg)
+	seed(t, pg, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code) VALUES
+		(2025, '202410', 'BA01', 'C001'), (2025, '202410', 'BA01', 'C002'),
+		(2025, '202410', 'BA01', 'C003'), (2025, '202410', 'BA01', 'C004')`)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, s, http.MethodGet, tt.target, nil)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			switch {
+			case w.Code != http.StatusOK:
+			case tt.wantLimit > 0:
+				var resp struct {
+					Limit int `json:"limit"`
+				}
+				decode(t, w, &resp)
+				if resp.Limit != tt.wantLimit {
+					t.Errorf("limit = %d, want %d", resp.Limit, tt.wantLimit)
+				}
+			default:
+				lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+				if got := len(lines) - 1; got != tt.wantRows {
+					t.Errorf("exported %d rows, want %d", got, tt.wantRows)
+				}
+			}
+		})
+	}
+}
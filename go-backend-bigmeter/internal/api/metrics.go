@@ -0,0 +1,54 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "API requests by route, method and status",
+		},
+		[]string{"route", "method", "status"},
+	)
+
+	httpDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "API request latency by route, method and status",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"route", "method", "status"},
+	)
+
+	httpInFlight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "API requests currently being served",
+		},
+	)
+)
+
+// observeRequests records every request in the http_* metrics. The route label is the
+// registered path template (e.g. /api/v1/sync/logs/:id) so ids do not explode the
+// label set; requests that match no route are labeled "unmatched".
+func observeRequests(c *gin.Context) {
+	started := time.Now()
+	httpInFlight.Inc()
+	defer httpInFlight.Dec()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	status := strconv.Itoa(c.Writer.Status())
+	httpRequests.WithLabelValues(route, c.Request.Method, status).Inc()
+	httpDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(started).Seconds())
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestDetailsNRW(t *testing.T) {
+	type point struct {
+		YM              string  `json:"ym"`
+		Total           int     `json:"total"`
+		Zeroed          int     `json:"zeroed"`
+		Active          int     `json:"active"`
+		ZeroedPct       float64 `json:"zeroed_pct"`
+		SumPresentWater float64 `json:"sum_present_water_usg"`
+		Missing         bool    `json:"missing"`
+	}
+	want := []point{
+		{YM: "202410", Total: 4, Zeroed: 1, Active: 3, ZeroedPct: 25, SumPresentWater: 17.5},
+		{YM: "202411", Missing: true},
+		{YM: "202412", Total: 2, Active: 2, SumPresentWater: 20},
+	}
+
+	s, pg := newTestServer(t, testConfig())
+	seed(t, pg, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, org_name, present_water_usg, present_meter_count) VALUES
+		(2025, '202410', 'BA01', 'C001', 'Org', 10, 100),
+		(2025, '202410', 'BA01', 'C002', '', 0, 0),
+		(2025, '202410', 'BA01', 'C003', 'Org', 7.5, 80),
+		(2025, '202410', 'BA01', 'C004', 'Org', 0, 0),
+		(2025, '202412', 'BA01', 'C001', 'Org', 12, 112),
+		(2025, '202412', 'BA01', 'C003', 'Org', 8, 88),
+		(2025, '202410', 'BA02', 'C101', '', 0, 0)`)
+
+	var resp struct {
+		Series []point `json:"series"`
+	}
+	decode(t, serve(t, s, http.MethodGet, "/api/v1/details/nrw?branch=BA01&from=202410&to=202412", nil), &resp)
+	if len(resp.Series) != len(want) {
+		t.Fatalf("got %d months, want %d: %+v", len(resp.Series), len(want), resp.Series)
+	}
+	for i, got := range resp.Series {
+		w := want[i]
+		if got.YM != w.YM || got.Total != w.Total || got.Zeroed != w.Zeroed || got.Active != w.Active ||
+			got.Missing != w.Missing || math.Abs(got.ZeroedPct-w.ZeroedPct) > 1e-9 || math.Abs(got.SumPresentWater-w.SumPresentWater) > 1e-9 {
+			t.Errorf("month %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestDetailsNRWRequiresRange(t *testing.T) {
+	tests := []string{
+		"/api/v1/details/nrw?from=202410&to=202412",
+		"/api/v1/details/nrw?branch=BA01&to=202412",
+		"/api/v1/details/nrw?branch=BA01&from=202412&to=202410",
+	}
+	s := NewServer(testConfig(), nil, nil)
+	for _, target := range tests {
+		if w := serve(t, s, http.MethodGet, target, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status %d, want 400", target, w.Code)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// TestStoredPctChange checks that the pct_change stored by the admin recompute equals
+// the value /details/compare derives on read, customer by customer.
+func TestStoredPctChange(t *testing.T) {
+	s, pg := newTestServer(t, testConfig())
+	seed(t, pg, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg) VALUES
+		(2025, '202409', 'BA01', 'C001', 100), (2025, '202410', 'BA01', 'C001', 50),
+		(2025, '202409', 'BA01', 'C002', 7),   (2025, '202410', 'BA01', 'C002', 3),
+		(2025, '202409', 'BA01', 'C003', 0.3), (2025, '202410', 'BA01', 'C003', 12.7),
+		(2025, '202409', 'BA01', 'C004', 0),   (2025, '202410', 'BA01', 'C004', 40),
+		                                       (2025, '202410', 'BA01', 'C005', 25),
+		(2025, '202409', 'BA02', 'C101', 10),  (2025, '202410', 'BA02', 'C101', 20)`)
+
+	var recomputed struct {
+		Updated int `json:"updated"`
+	}
+	decode(t, serve(t, s, http.MethodPost, "/api/v1/admin/pct-change/recompute?ym=202410&branch=BA01", nil), &recomputed)
+	if recomputed.Updated != 5 {
+		t.Errorf("updated = %d, want the 5 BA01 rows of 202410", recomputed.Updated)
+	}
+
+	var compare struct {
+		Items []compareItem `json:"items"`
+	}
+	decode(t, serve(t, s, http.MethodGet, "/api/v1/details/compare?branch=BA01&ym=202410", nil), &compare)
+	if len(compare.Items) != 5 {
+		t.Fatalf("compare returned %d items, want 5", len(compare.Items))
+	}
+	for _, it := range compare.Items {
+		var stored *float64
+		if err := pg.Pool.QueryRow(context.Background(),
+			`SELECT pct_change FROM bm_meter_details WHERE fiscal_year=2025 AND year_month='202410' AND branch_code='BA01' AND cust_code=$1`,
+			it.CustCode).Scan(&stored); err != nil {
+			t.Fatalf("%s: %v", it.CustCode, err)
+		}
+		switch {
+		case (stored == nil) != (it.PctChange == nil):
+			t.Errorf("%s: stored %v, compare %v", it.CustCode, deref(stored), deref(it.PctChange))
+		case stored != nil && *stored != *it.PctChange:
+			t.Errorf("%s: stored %v, compare %v", it.CustCode, *stored, *it.PctChange)
+		}
+	}
+
+	// other branches are left alone
+	var untouched *float64
+	if err := pg.Pool.QueryRow(context.Background(),
+		`SELECT pct_change FROM bm_meter_details WHERE year_month='202410' AND branch_code='BA02'`).Scan(&untouched); err != nil {
+		t.Fatal(err)
+	}
+	if untouched != nil {
+		t.Errorf("BA02 pct_change = %v, want NULL", *untouched)
+	}
+}
+
+func deref(f *float64) any {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gReconcile compares each branch's cohort (bm_custcode_init) against the detail rows
+// stored for a month, across all branches in a single grouped query.
+func (s *Server) gReconcile(c *gin.Context) {
+	ym := strings.TrimSpace(c.Query("ym"))
+	if ym == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ym is required"})
+		return
+	}
+	fiscal, err := parseFiscalOrYM(c.Query("fiscal_year"), ym)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	const q = `SELECT ci.branch_code,
+                      COUNT(1) AS cohort_size,
+                      COUNT(d.cust_code) AS detail_rows,
+                      COUNT(d.cust_code) FILTER (
+                          WHERE d.present_water_usg=0 AND d.present_meter_count=0 AND d.org_name=''
+                      ) AS zeroed_rows,
+                      COUNT(1) FILTER (WHERE d.cust_code IS NULL) AS missing
+               FROM bm_custcode_init ci
+               LEFT JOIN bm_meter_details d
+                      ON d.fiscal_year=ci.fiscal_year AND d.branch_code=ci.branch_code
+                     AND d.cust_code=ci.cust_code AND d.year_month=$2
+               WHERE ci.fiscal_year=$1
+               GROUP BY ci.branch_code
+               ORDER BY ci.branch_code`
+	rows, err := s.read.Query(c.Request.Context(), q, fiscal, ym)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	type item struct {
+		BranchCode string `json:"branch_code"`
+		CohortSize int    `json:"cohort_size"`
+		DetailRows int    `json:"detail_rows"`
+		ZeroedRows int    `json:"zeroed_rows"`
+		Missing    int    `json:"missing"`
+	}
+	items := []item{}
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.BranchCode, &it.CohortSize, &it.DetailRows, &it.ZeroedRows, &it.Missing); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ym": ym, "fiscal_year": fiscal, "items": items, "total": len(items)})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	s, pg := newTestServer(t, testConfig())
+	seed(t, pg,
+		`INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code)
+		 VALUES (2025, 'BA01', 'C1'), (2025, 'BA01', 'C2'), (2025, 'BA01', 'C3'),
+		        (2025, 'BA02', 'C4'), (2025, 'BA02', 'C5')`,
+		`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, org_name, present_water_usg, present_meter_count)
+		 VALUES (2025, '202410', 'BA01', 'C1', 'Org 1', 10, 100),
+		        (2025, '202410', 'BA01', 'C2', '', 0, 0),
+		        (2025, '202410', 'BA02', 'C4', 'Org 4', 4, 40),
+		        (2025, '202410', 'BA02', 'C5', 'Org 5', 5, 50),
+		        (2025, '202411', 'BA01', 'C3', 'Org 3', 3, 30)`)
+
+	type item struct {
+		BranchCode string `json:"branch_code"`
+		CohortSize int    `json:"cohort_size"`
+		DetailRows int    `json:"detail_rows"`
+		ZeroedRows int    `json:"zeroed_rows"`
+		Missing    int    `json:"missing"`
+	}
+	var resp struct {
+		Items []item `json:"items"`
+	}
+	decode(t, serve(t, s, http.MethodGet, "/api/v1/reconcile?ym=202410", nil), &resp)
+
+	want := []item{
+		{BranchCode: "BA01", CohortSize: 3, DetailRows: 2, ZeroedRows: 1, Missing: 1},
+		{BranchCode: "BA02", CohortSize: 2, DetailRows: 2, ZeroedRows: 0, Missing: 0},
+	}
+	if len(resp.Items) != len(want) {
+		t.Fatalf("got %d branches, want %d: %+v", len(resp.Items), len(want), resp.Items)
+	}
+	for i, it := range resp.Items {
+		if it != want[i] {
+			t.Errorf("branch %d = %+v, want %+v", i, it, want[i])
+		}
+	}
+}
+
+func TestReconcileRequiresYM(t *testing.T) {
+	s := NewServer(testConfig(), nil, nil)
+	if w := serve(t, s, http.MethodGet, "/api/v1/reconcile", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", w.Code)
+	}
+}
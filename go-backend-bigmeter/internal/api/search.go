@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Columns searched by q. The trigram path matches q against one concatenated
+// expression per table, which must stay identical to the GIN index expressions in
+// migrations/0014_search_trgm.sql or Postgres will not use the index.
+var (
+	custcodesSearchColumns = []string{"cust_code", "meter_no", "use_type", "org_name", "use_name", "cust_name",
+		"address", "route_code", "meter_size", "meter_brand", "meter_state", "debt_ym"}
+	detailsSearchColumns = []string{"cust_code", "meter_no", "cust_name", "address", "route_code", "org_name",
+		"use_type", "use_name"}
+)
+
+const (
+	custcodesSearchIndex = "idx_bm_cust_init_search_trgm"
+	detailsSearchIndex   = "idx_bm_details_search_trgm"
+	// detailsFTSIndex is the GIN index on bm_meter_details.search_tsv, from
+	// migrations/0020_details_search_fts.sql
+	detailsFTSIndex = "idx_bm_details_search_tsv"
+)
+
+// ftsMinQueryLen is the shortest q (in characters) that q_mode=fts searches as words;
+// shorter ones are usually partial codes and keep the substring match.
+const ftsMinQueryLen = 3
+
+// ftsSearchable reports whether q_mode=fts can match q as words: at least
+// ftsMinQueryLen characters and no Thai script. Thai is written without spaces between
+// words and the 'simple' parser keeps a whole run of it as one token, so a Thai q would
+// only match where it is that entire run; the substring search finds it anywhere.
+func ftsSearchable(q string) bool {
+	q = strings.TrimSpace(q)
+	if utf8.RuneCountInString(q) < ftsMinQueryLen {
+		return false
+	}
+	for _, r := range q {
+		if unicode.Is(unicode.Thai, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchMode is how q is matched
+type searchMode int
+
+const (
+	searchILIKE   searchMode = iota // per-column ILIKE
+	searchTrigram                   // one ILIKE over searchExpr, served by the pg_trgm index
+	searchFTS                       // websearch_to_tsquery over search_tsv, ranked
+)
+
+// searchIndexes records which search indexes exist, each looked up once per process
+type searchIndexes struct {
+	mu      sync.Mutex
+	present map[string]bool
+}
+
+// searchIndex reports whether the named index exists. A missing index is logged once
+// with the migration that creates it; a failed lookup is retried on the next call.
+func (s *Server) searchIndex(ctx context.Context, name, migration string) bool {
+	si := &s.searchIdx
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	if ok, checked := si.present[name]; checked {
+		return ok
+	}
+	var ok bool
+	if err := s.read.Pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&ok); err != nil {
+		log.Printf("search: index %s lookup failed, using ILIKE: %v", name, err)
+		return false
+	}
+	if !ok {
+		log.Printf("search: index %s is missing (run migration %s); using ILIKE", name, migration)
+	}
+	if si.present == nil {
+		si.present = map[string]bool{}
+	}
+	si.present[name] = ok
+	return ok
+}
+
+// trigramSearch reports whether q on the table behind index should use the pg_trgm
+// path: SEARCH_TRGM is on and the migration's index exists. Otherwise callers fall
+// back to per-column ILIKE.
+func (s *Server) trigramSearch(ctx context.Context, index string) bool {
+	if !s.cfg.SearchTrigram {
+		return false
+	}
+	return s.searchIndex(ctx, index, "0014")
+}
+
+// detailsSearch picks the q mode of /details and /details.csv. q_mode=fts uses the
+// full-text column for an ftsSearchable q when migration 0020 is applied; anything
+// else gets the default substring search. An unknown q_mode is a 400 and returns
+// ok=false.
+func (s *Server) detailsSearch(c *gin.Context) (searchMode, bool) {
+	ctx := c.Request.Context()
+	switch strings.ToLower(strings.TrimSpace(c.Query("q_mode"))) {
+	case "", "ilike":
+	case "fts":
+		if ftsSearchable(c.Query("q")) && s.searchIndex(ctx, detailsFTSIndex, "0020") {
+			return searchFTS, true
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid q_mode; expect ilike or fts"})
+		return searchILIKE, false
+	}
+	if s.trigramSearch(ctx, detailsSearchIndex) {
+		return searchTrigram, true
+	}
+	return searchILIKE, true
+}
+
+// ftsClause returns the q_mode=fts filter using placeholder $p (bound to q as typed)
+// and the matching rank expression for ORDER BY.
+func ftsClause(p int) (clause, rank string) {
+	query := fmt.Sprintf("websearch_to_tsquery('simple', $%d)", p)
+	return " AND search_tsv @@ " + query, "ts_rank(search_tsv, " + query + ")"
+}
+
+// searchClause returns the q filter over columns using placeholder $p (bound to
+// '%q%'). Both forms match the same rows: the trigram form joins the columns with a
+// newline, and a q that could match across that boundary (a newline or the %/_
+// wildcards) takes the ILIKE form.
+func searchClause(columns []string, p int, search string, trgm bool) string {
+	if trgm && !strings.ContainsAny(search, "\n%_") {
+		return fmt.Sprintf(" AND %s ILIKE $%d", searchExpr(columns), p)
+	}
+	terms := make([]string, len(columns))
+	for i, col := range columns {
+		terms[i] = fmt.Sprintf("%s ILIKE $%d", col, p)
+	}
+	return " AND (" + strings.Join(terms, " OR ") + ")"
+}
+
+// searchExpr is the concatenated, NULL-safe search text of columns
+func searchExpr(columns []string) string {
+	parts := make([]string, len(columns))
+	for i, col := range columns {
+		parts[i] = fmt.Sprintf("coalesce(%s, '')", col)
+	}
+	return "(" + strings.Join(parts, ` || E'\n' || `) + ")"
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchClause(t *testing.T) {
+	cols := []string{"cust_code", "meter_no"}
+	tests := []struct {
+		search string
+		trgm   bool
+		want   string
+	}{
+		{search: "C001", trgm: false, want: " AND (cust_code ILIKE $3 OR meter_no ILIKE $3)"},
+		{search: "C001", trgm: true, want: ` AND (coalesce(cust_code, '') || E'\n' || coalesce(meter_no, '')) ILIKE $3`},
+		// wildcards could match across the joined columns, so they keep the per-column form
+		{search: "C_01", trgm: true, want: " AND (cust_code ILIKE $3 OR meter_no ILIKE $3)"},
+		{search: "50%", trgm: true, want: " AND (cust_code ILIKE $3 OR meter_no ILIKE $3)"},
+	}
+	for _, tt := range tests {
+		if got := searchClause(cols, 3, tt.search, tt.trgm); got != tt.want {
+			t.Errorf("searchClause(%q, trgm=%t) = %s, want %s", tt.search, tt.trgm, got, tt.want)
+		}
+	}
+}
+
+// TestSearchPathsMatch runs the same q through the ILIKE and the pg_trgm paths of
+// /custcodes and /details and expects the same cust_codes.
+func TestSearchPathsMatch(t *testing.T) {
+	queries := []string{"C00", "c002", "main", "MAIN ROAD", "ถนน", "M-3", "route 9", "zzz", "C_0", "1\n2"}
+	endpoints := []string{"/api/v1/custcodes", "/api/v1/details"}
+
+	search := func(trgm bool) map[string][]string {
+		cfg := testConfig()
+		cfg.SearchTrigram = trgm
+		s, pg := newTestServer(t, cfg)
+		if trgm && !s.trigramSearch(t.Context(), custcodesSearchIndex) {
+			t.Skip("pg_trgm indexes not available (migration 0014)")
+		}
+		seed(t, pg,
+			`INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code, meter_no, cust_name, address, route_code, debt_ym) VALUES
+			 (2025, 'BA01', 'C001', 'M-1', 'Somchai', '1 Main Road', 'route 1', '256710'),
+			 (2025, 'BA01', 'C002', 'M-2', 'Suda', '2 ถนนสุขุมวิท', 'route 9', '256710'),
+			 (2025, 'BA01', 'C003', 'M-3', 'Main Office', NULL, NULL, '256710'),
+			 (2025, 'BA01', 'X100', 'M-12', 'Other', '12 Side Lane', 'route 2', '256710')`,
+			`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, meter_no, cust_name, address, route_code, present_water_usg) VALUES
+			 (2025, '202410', 'BA01', 'C001', 'M-1', 'Somchai', '1 Main Road', 'route 1', 10),
+			 (2025, '202410', 'BA01', 'C002', 'M-2', 'Suda', '2 ถนนสุขุมวิท', 'route 9', 10),
+			 (2025, '202410', 'BA01', 'C003', 'M-3', 'Main Office', NULL, NULL, 10),
+			 (2025, '202410', 'BA01', 'X100', 'M-12', 'Other', '12 Side Lane', 'route 2', 10)`)
+		got := map[string][]string{}
+		for _, ep := range endpoints {
+			for _, q := range queries {
+				var resp struct {
+					Items []struct {
+						CustCode string `json:"cust_code"`
+					} `json:"items"`
+				}
+				decode(t, serve(t, s, http.MethodGet, ep+"?branch=BA01&ym=202410&order_by=cust_code&sort=asc&q="+url.QueryEscape(q), nil), &resp)
+				codes := []string{}
+				for _, it := range resp.Items {
+					codes = append(codes, it.CustCode)
+				}
+				got[ep+" q="+q] = codes
+			}
+		}
+		return got
+	}
+
+	ilike := search(false)
+	trgm := search(true)
+	for key, want := range ilike {
+		if !reflect.DeepEqual(trgm[key], want) {
+			t.Errorf("%s: trigram %v, ILIKE %v", strings.ReplaceAll(key, "\n", `\n`), trgm[key], want)
+		}
+	}
+	if got := ilike["/api/v1/custcodes q=main"]; !reflect.DeepEqual(got, []string{"C001", "C003"}) {
+		t.Errorf("custcodes q=main = %v, want [C001 C003]", got)
+	}
+}
+
+func TestFTSSearchable(t *testing.T) {
+	tests := []struct {
+		q    string
+		want bool
+	}{
+		{q: "Somchai", want: true},
+		{q: `"main road" -lane`, want: true},
+		{q: "C0", want: false},
+		{q: "  ab  ", want: false},
+		{q: "ถนนสุขุมวิท", want: false},
+		{q: "สุขุมวิท", want: false},
+		{q: "Soi สุขุมวิท 21", want: false},
+	}
+	for _, tt := range tests {
+		if got := ftsSearchable(tt.q); got != tt.want {
+			t.Errorf("ftsSearchable(%q) = %t, want %t", tt.q, got, tt.want)
+		}
+	}
+}
+
+// TestDetailsFTSThai checks q_mode=fts finds Thai text inside a longer run, which the
+// 'simple' parser keeps as one token, and still matches Latin words
+func TestDetailsFTSThai(t *testing.T) {
+	s, pg := newTestServer(t, testConfig())
+	if !s.searchIndex(t.Context(), detailsFTSIndex, "0020") {
+		t.Skip("full-text column not available (migration 0020)")
+	}
+	seed(t, pg, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, cust_name, address, present_water_usg) VALUES
+		(2025, '202410', 'BA01', 'C001', 'Somchai', '1 Main Road', 10),
+		(2025, '202410', 'BA01', 'C002', 'สุดาใจดี', '2 ถนนสุขุมวิท', 10)`)
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{q: "สุขุมวิท", want: []string{"C002"}},
+		{q: "ใจดี", want: []string{"C002"}},
+		{q: "main road", want: []string{"C001"}},
+	}
+	for _, tt := range tests {
+		var resp struct {
+			Items []struct {
+				CustCode string `json:"cust_code"`
+			} `json:"items"`
+		}
+		decode(t, serve(t, s, http.MethodGet, "/api/v1/details?branch=BA01&ym=202410&q_mode=fts&q="+url.QueryEscape(tt.q), nil), &resp)
+		got := []string{}
+		for _, it := range resp.Items {
+			got = append(got, it.CustCode)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("q=%s: got %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
@@ -2,16 +2,24 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go-backend-bigmeter/internal/alert"
 	"go-backend-bigmeter/internal/config"
 	dbpkg "go-backend-bigmeter/internal/database"
@@ -20,37 +28,56 @@ import (
 )
 
 type Server struct {
-	cfg     config.Config
-	pg      *dbpkg.Postgres
-	ora     *dbpkg.Oracle
-	syncSvc *syncsvc.Service
+	cfg      config.Config
+	pg       *dbpkg.Postgres // primary: writes, sync and notification state
+	read     *dbpkg.Postgres // read-only handlers; pg unless POSTGRES_READ_DSN is set
+	ora      *dbpkg.Oracle
+	syncSvc  *syncsvc.Service
+	triggers *triggerLimiter
+	// summaries caches past-month summary responses (SUMMARY_CACHE_TTL; 0 disables)
+	summaries *summaryCache
+	// searchIdx remembers which pg_trgm search indexes exist (SEARCH_TRGM)
+	searchIdx searchIndexes
 }
 
 func NewServer(cfg config.Config, pg *dbpkg.Postgres, ora *dbpkg.Oracle) *Server {
 	var syncService *syncsvc.Service
 	if ora != nil {
-		syncService = syncsvc.NewService(ora, pg)
+		syncService = syncsvc.NewService(ora, pg, cfg.Sync)
 	}
 	return &Server{
-		cfg:     cfg,
-		pg:      pg,
-		ora:     ora,
-		syncSvc: syncService,
+		cfg:       cfg,
+		pg:        pg,
+		read:      pg,
+		ora:       ora,
+		syncSvc:   syncService,
+		triggers:  newTriggerLimiter(cfg.SyncTriggerCooldown),
+		summaries: newSummaryCache(cfg.SummaryCacheTTL),
 	}
 }
 
+// UseReadReplica routes read-only handlers (lists, details, exports, summaries) to a
+// replica pool (POSTGRES_READ_DSN) so dashboard reads do not contend with sync writes.
+func (s *Server) UseReadReplica(read *dbpkg.Postgres) {
+	s.read = read
+}
+
 // Router constructs a Gin engine with routes.
 func (s *Server) Router() *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Recovery())
+	r.Use(requestID)
+	r.Use(s.requestLogger)
+	r.Use(observeRequests)
 	// Minimal CORS + headers
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
 		c.Writer.Header().Set("Cache-Control", "no-store")
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		if c.Request.Method == http.MethodOptions {
 			c.AbortWithStatus(http.StatusNoContent)
 			return
@@ -58,40 +85,466 @@ func (s *Server) Router() *gin.Engine {
 		c.Next()
 	})
 
-	v1 := r.Group("/api/v1")
+	// Prometheus scrape endpoint (http_requests_total, http_request_duration_seconds, ...)
+	r.GET(s.cfg.HTTPBasePath+"/metrics", gin.WrapH(promhttp.Handler()))
+
+	// HTTP_BASE_PATH (e.g. /bigmeter) prefixes every route, including /healthz
+	v1 := r.Group(s.cfg.HTTPBasePath + "/api/v1")
 	{
 		v1.GET("/healthz", s.gHealth)
+		v1.GET("/healthz/heartbeat", s.gHeartbeat)
+		// Kubernetes probes; like every route outside /admin they need no API key
+		v1.GET("/livez", s.gLive)
+		v1.GET("/readyz", s.gReady)
 		v1.GET("/version", s.gVersion)
 		v1.GET("/branches", s.gBranches)
 		v1.GET("/custcodes", s.gCustcodes)
+		v1.GET("/custcodes.xlsx", s.gCustcodesXLSX)
 		v1.GET("/details", s.gDetails)
+		v1.GET("/details.csv", s.gDetailsCSV)
 		v1.GET("/details/summary", s.gDetailsSummary)
+		v1.GET("/details/summary/by-use-type", s.gDetailsSummaryByUseType)
+		v1.GET("/summary", s.gSummary)
+		v1.GET("/details/decliners", s.gDetailsDecliners)
+		v1.GET("/details/compare", s.gDetailsCompare)
+		v1.GET("/details/yoy", s.gDetailsYoY)
+		v1.GET("/details/nrw", s.gDetailsNRW)
 		v1.GET("/custcodes/:cust_code/details", s.gCustcodeDetails)
+		v1.GET("/reconcile", s.gReconcile)
 		// Admin/stub endpoints for frontend integration
 		v1.POST("/sync/init", s.pSyncInit)
 		v1.POST("/sync/monthly", s.pSyncMonthly)
+		v1.POST("/sync/monthly/all-cohorts", s.pSyncMonthlyAllCohorts)
+		v1.GET("/sync/status", s.gSyncStatus)
 		v1.GET("/sync/logs", s.gSyncLogs)
+		v1.GET("/sync/logs/facets", s.gSyncLogFacets)
+		v1.GET("/sync/logs/:id", s.gSyncLog)
+		v1.POST("/sync/logs/:id/retry", s.pSyncLogRetry)
+		v1.POST("/sync/cancel", s.pSyncCancel)
 		v1.GET("/config", s.gConfig)
 		// Telegram test endpoint
 		v1.POST("/telegram/test", s.pTelegramTest)
 		// Alert test endpoint
 		v1.POST("/alerts/test", s.pAlertTest)
+		v1.GET("/alerts/digest", s.gAlertDigest)
+		v1.GET("/alerts/history", s.gAlertHistory)
+		v1.POST("/alerts/runs/:id/resend", s.pAlertResend)
+		v1.GET("/alerts/state-changes", s.gAlertStateChanges)
+
+		// Admin endpoints (require X-API-Key)
+		admin := v1.Group("/admin", s.requireAPIKey)
+		admin.POST("/notifications/mute", s.pNotificationsMute)
+		admin.POST("/notifications/unmute", s.pNotificationsUnmute)
+		admin.DELETE("/branch/:code", s.dBranchData)
+		admin.POST("/pct-change/recompute", s.pPctChangeRecompute)
+		admin.GET("/webhooks/failures", s.gWebhookFailures)
 	}
 	return r
 }
 
+// requestLogger logs one line per request (method, path, status, latency, client IP
+// and the branch/ym query params) to stdout, as text or JSON per LOG_FORMAT. Health
+// probes and /metrics scrapes are not logged.
+func (s *Server) requestLogger(c *gin.Context) {
+	started := time.Now()
+	c.Next()
+
+	path := c.Request.URL.Path
+	if path == s.cfg.HTTPBasePath+"/metrics" {
+		return
+	}
+	switch strings.TrimPrefix(path, s.cfg.HTTPBasePath+"/api/v1") {
+	case "/healthz", "/healthz/heartbeat", "/livez", "/readyz":
+		return
+	}
+	latency := time.Since(started)
+	if s.cfg.LogFormat == "json" {
+		line, err := json.Marshal(requestLogLine{
+			Time:      started.Format(time.RFC3339Nano),
+			Method:    c.Request.Method,
+			Path:      path,
+			Status:    c.Writer.Status(),
+			LatencyMs: float64(latency.Microseconds()) / 1000,
+			ClientIP:  c.ClientIP(),
+			RequestID: syncsvc.RequestID(c.Request.Context()),
+			Branch:    c.Query("branch"),
+			YM:        c.Query("ym"),
+		})
+		if err == nil {
+			os.Stdout.Write(append(line, '\n'))
+		}
+		return
+	}
+	fmt.Fprintf(os.Stdout, "%s http: %s %s status=%d latency=%s ip=%s branch=%s ym=%s request_id=%s\n",
+		started.Format("2006/01/02 15:04:05"), c.Request.Method, path, c.Writer.Status(), latency, c.ClientIP(), c.Query("branch"), c.Query("ym"),
+		syncsvc.RequestID(c.Request.Context()))
+}
+
+// requestLogLine is one LOG_FORMAT=json request log entry
+type requestLogLine struct {
+	Time      string  `json:"time"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	ClientIP  string  `json:"client_ip"`
+	RequestID string  `json:"request_id"`
+	Branch    string  `json:"branch,omitempty"`
+	YM        string  `json:"ym,omitempty"`
+}
+
+// requestID takes the caller's X-Request-ID (or generates a UUID), echoes it in the
+// response header and puts it on the request context, where sync triggers pick it up
+// for their log lines and bm_sync_logs.request_id.
+func requestID(c *gin.Context) {
+	id := strings.TrimSpace(c.GetHeader("X-Request-ID"))
+	if id == "" || len(id) > 128 {
+		id = newUUID()
+	}
+	c.Set("request_id", id)
+	c.Header("X-Request-ID", id)
+	c.Request = c.Request.WithContext(syncsvc.WithRequestID(c.Request.Context(), id))
+	c.Next()
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// requestRunLog returns the request id of c and a logger that prefixes it, for the
+// background goroutine of a sync trigger
+func requestRunLog(c *gin.Context) (string, *log.Logger) {
+	id := syncsvc.RequestID(c.Request.Context())
+	return id, log.New(log.Writer(), "request_id="+id+" ", log.Flags()|log.Lmsgprefix)
+}
+
+// requireAPIKey rejects requests whose X-API-Key header does not match API_KEY.
+// Admin endpoints are disabled entirely when API_KEY is not configured.
+func (s *Server) requireAPIKey(c *gin.Context) {
+	if !s.checkAPIKey(c) {
+		return
+	}
+	c.Next()
+}
+
+// checkAPIKey validates X-API-Key against API_KEY, aborting with 403/401 when it fails.
+func (s *Server) checkAPIKey(c *gin.Context) bool {
+	if s.cfg.APIKey == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints disabled (API_KEY not configured)"})
+		return false
+	}
+	key := c.GetHeader("X-API-Key")
+	if subtle.ConstantTimeCompare([]byte(key), []byte(s.cfg.APIKey)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing API key"})
+		return false
+	}
+	return true
+}
+
+// triggerLimiter rejects a repeated sync trigger (same endpoint + branch set) within
+// a cooldown window, e.g. an accidental double-click on "sync now".
+type triggerLimiter struct {
+	mu       sync.Mutex
+	cooldown time.Duration
+	last     map[string]time.Time
+}
+
+func newTriggerLimiter(cooldown time.Duration) *triggerLimiter {
+	return &triggerLimiter{cooldown: cooldown, last: map[string]time.Time{}}
+}
+
+// wait returns how long until endpoint may be triggered again for branches, or 0.
+// It only checks; record starts the cooldown once the trigger was accepted.
+func (l *triggerLimiter) wait(endpoint string, branches []string) time.Duration {
+	if l == nil || l.cooldown <= 0 {
+		return 0
+	}
+	key := triggerKey(endpoint, branches)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if at, ok := l.last[key]; ok {
+		if wait := l.cooldown - time.Since(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// record starts the cooldown for endpoint + branches
+func (l *triggerLimiter) record(endpoint string, branches []string) {
+	if l == nil || l.cooldown <= 0 {
+		return
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.last[triggerKey(endpoint, branches)] = now
+	// drop expired keys so the map stays small
+	for k, at := range l.last {
+		if now.Sub(at) >= l.cooldown {
+			delete(l.last, k)
+		}
+	}
+}
+
+// triggerKey is endpoint plus the sorted branch set, so the order branches were
+// requested in does not matter
+func triggerKey(endpoint string, branches []string) string {
+	set := make([]string, 0, len(branches))
+	for _, b := range branches {
+		set = append(set, strings.TrimSpace(b))
+	}
+	sort.Strings(set)
+	return endpoint + "|" + strings.Join(set, ",")
+}
+
+// rejectInvalidBranches writes 400 when a requested branch code does not match
+// BRANCH_CODE_PATTERN (Oracle would otherwise just return no rows for it).
+func (s *Server) rejectInvalidBranches(c *gin.Context, branches []string) bool {
+	trimmed := make([]string, len(branches))
+	for i, b := range branches {
+		trimmed[i] = strings.TrimSpace(b)
+	}
+	if err := s.cfg.CheckBranchCodes(trimmed); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
+
+// validateBranches returns the requested codes that are neither in bm_branches nor in
+// BRANCHES, in request order.
+func (s *Server) validateBranches(ctx context.Context, branches []string) ([]string, error) {
+	known := make(map[string]bool, len(s.cfg.Branches))
+	for _, b := range s.cfg.Branches {
+		known[strings.TrimSpace(b)] = true
+	}
+	rows, err := s.pg.Pool.Query(ctx, `SELECT code FROM bm_branches`)
+	if err != nil {
+		return nil, fmt.Errorf("load branches: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, fmt.Errorf("scan branch: %w", err)
+		}
+		known[code] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load branches: %w", err)
+	}
+	var unknown []string
+	for _, b := range branches {
+		if b = strings.TrimSpace(b); !known[b] {
+			unknown = append(unknown, b)
+		}
+	}
+	return unknown, nil
+}
+
+// rejectUnknownBranches writes 400 listing the requested branches validateBranches does
+// not know, unless force (body, or ?force=true) allows an intentionally new branch.
+func (s *Server) rejectUnknownBranches(c *gin.Context, branches []string, force bool) bool {
+	if force || c.Query("force") == "true" {
+		return false
+	}
+	unknown, err := s.validateBranches(c.Request.Context(), branches)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "unknown branch code(s); pass force=true to sync a branch not yet in bm_branches",
+			"unknown": unknown,
+		})
+		return true
+	}
+	return false
+}
+
+// rejectIfCoolingDown writes 429 with Retry-After when the trigger is rate limited.
+// The cooldown only starts once the sync jobs were acquired (triggerLimiter.record), so a
+// request rejected with 409 or 400 does not block the retry.
+func (s *Server) rejectIfCoolingDown(c *gin.Context, endpoint string, branches []string) bool {
+	wait := s.triggers.wait(endpoint, branches)
+	if wait <= 0 {
+		return false
+	}
+	secs := int((wait + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(secs))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":               "sync already triggered for these branches; try again later",
+		"retry_after_seconds": secs,
+	})
+	return true
+}
+
+// acquireSyncJobs reserves syncType|branch|ym for every branch, or writes 409 Conflict
+// when any of them is already running (in this process or, per bm_sync_logs, elsewhere).
+func (s *Server) acquireSyncJobs(c *gin.Context, syncType, ym string, branches []string) ([]string, bool) {
+	keys := make([]string, len(branches))
+	for i, b := range branches {
+		keys[i] = syncsvc.JobKey(syncType, strings.TrimSpace(b), ym)
+	}
+	if busy := s.syncSvc.Jobs.TryAcquire(keys...); len(busy) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "sync already running", "running": busy})
+		return nil, false
+	}
+	var busy []string
+	for i, b := range branches {
+		running, err := s.syncSvc.LogRepo.HasInProgress(c.Request.Context(), syncType, strings.TrimSpace(b), ym)
+		if err != nil {
+			log.Printf("warning: in-progress check failed for %s: %v", keys[i], err)
+			continue
+		}
+		if running {
+			busy = append(busy, keys[i])
+		}
+	}
+	if len(busy) > 0 {
+		s.syncSvc.Jobs.Release(keys...)
+		c.JSON(http.StatusConflict, gin.H{"error": "sync already in progress (sync logs)", "running": busy})
+		return nil, false
+	}
+	return keys, true
+}
+
 func (s *Server) gHealth(c *gin.Context) {
 	// Report time in configured local timezone
 	loc, err := time.LoadLocation(s.cfg.Timezone)
 	if err != nil {
 		loc = time.Local
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"status": "ok",
+	if c.Query("deep") != "1" {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "ok",
+			"time":   time.Now().In(loc).Format(time.RFC3339),
+		})
+		return
+	}
+
+	// deep=1: ping each dependency; any failure makes the whole check 503
+	checks, healthy := s.dependencyChecks(c.Request.Context())
+	status, code := "ok", http.StatusOK
+	if !healthy {
+		status, code = "error", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status": status,
 		"time":   time.Now().In(loc).Format(time.RFC3339),
+		"checks": checks,
 	})
 }
 
+// gHeartbeat is the scheduler dead-man's switch for external probes: 503 when the
+// sync scheduler's heartbeat is older than HEARTBEAT_MAX_AGE, or when the last
+// CRON_MONTHLY time passed (plus HEARTBEAT_RUN_GRACE) without a scheduled monthly run.
+func (s *Server) gHeartbeat(c *gin.Context) {
+	ctx := c.Request.Context()
+	loc, err := time.LoadLocation(s.cfg.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	now := time.Now().In(loc)
+
+	last, err := syncsvc.NewHeartbeat(s.read).Last(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	status, code := "ok", http.StatusOK
+	resp := gin.H{"max_age_seconds": int(s.cfg.Heartbeat.MaxAge.Seconds()), "last_heartbeat": nil}
+	if last.IsZero() {
+		status, code = "stale", http.StatusServiceUnavailable
+	} else {
+		age := now.Sub(last)
+		resp["last_heartbeat"] = last.In(loc).Format(time.RFC3339)
+		resp["age_seconds"] = int(age.Seconds())
+		if age > s.cfg.Heartbeat.MaxAge {
+			status, code = "stale", http.StatusServiceUnavailable
+		}
+	}
+
+	if s.cfg.EnableMonthlySync {
+		expected, err := syncsvc.PreviousRun(s.cfg.MonthlySpec, loc, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		monthly := gin.H{"spec": s.cfg.MonthlySpec, "expected_at": nil, "last_run_at": nil, "missed": false}
+		if !expected.IsZero() {
+			monthly["expected_at"] = expected.Format(time.RFC3339)
+			lastRun, err := syncsvc.NewLogRepository(s.read.Pool).LastScheduledStart(ctx, "monthly_sync")
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if !lastRun.IsZero() {
+				monthly["last_run_at"] = lastRun.In(loc).Format(time.RFC3339)
+			}
+			// A run started shortly before its slot (clock skew) still counts
+			if now.After(expected.Add(s.cfg.Heartbeat.RunGrace)) && lastRun.Before(expected.Add(-time.Minute)) {
+				monthly["missed"] = true
+				status, code = "stale", http.StatusServiceUnavailable
+			}
+		}
+		resp["monthly"] = monthly
+	}
+
+	resp["status"] = status
+	resp["time"] = now.Format(time.RFC3339)
+	c.JSON(code, resp)
+}
+
+// gLive is the liveness probe: the process is up and serving
+func (s *Server) gLive(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// gReady is the readiness probe: 503 until Postgres and, when configured, Oracle answer
+func (s *Server) gReady(c *gin.Context) {
+	checks, healthy := s.dependencyChecks(c.Request.Context())
+	if !healthy {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not ready", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+}
+
+// dependencyChecks pings Postgres and Oracle (5s budget) and reports each as ok,
+// error or, for an API running without Oracle, disabled. healthy is false when any
+// configured dependency failed.
+func (s *Server) dependencyChecks(ctx context.Context) (gin.H, bool) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	healthy := true
+	checks := gin.H{}
+	if err := s.pg.Pool.Ping(ctx); err != nil {
+		checks["postgres"] = gin.H{"status": "error", "error": err.Error()}
+		healthy = false
+	} else {
+		checks["postgres"] = gin.H{"status": "ok"}
+	}
+	if s.ora == nil {
+		checks["oracle"] = gin.H{"status": "disabled"}
+	} else if err := s.ora.Ping(ctx); err != nil {
+		checks["oracle"] = gin.H{"status": "error", "error": err.Error()}
+		healthy = false
+	} else {
+		checks["oracle"] = gin.H{"status": "ok"}
+	}
+	return checks, healthy
+}
+
 func (s *Server) gVersion(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"service": "bigmeter-sync-api",
@@ -101,163 +554,328 @@ func (s *Server) gVersion(c *gin.Context) {
 }
 
 func (s *Server) gBranches(c *gin.Context) {
-	q := strings.TrimSpace(c.Query("q"))
+	q := strings.ToLower(strings.TrimSpace(c.Query("q")))
 	// Prefer DB source if table exists; otherwise fallback to config list
-	type row struct{ Code, Name string }
-	var rows []row
+	var rows []alert.Branch
 	// Attempt DB; ignore error and fallback
-	const sqlList = `SELECT code, COALESCE(name,'') FROM bm_branches ORDER BY code`
-	if s.pg != nil {
-		if r, err := s.pg.Pool.Query(c.Request.Context(), sqlList); err == nil {
+	const sqlList = `SELECT code, COALESCE(name,''), COALESCE(alias,'') FROM bm_branches ORDER BY code`
+	if s.read != nil {
+		if r, err := s.read.Query(c.Request.Context(), sqlList); err == nil {
 			defer r.Close()
 			for r.Next() {
-				var rr row
-				if err := r.Scan(&rr.Code, &rr.Name); err != nil {
+				var rr alert.Branch
+				if err := r.Scan(&rr.Code, &rr.Name, &rr.Alias); err != nil {
 					break
 				}
 				rows = append(rows, rr)
 			}
 		}
 	}
-	items := make([]map[string]string, 0)
-	if len(rows) > 0 {
-		for _, r := range rows {
-			if q == "" || strings.Contains(strings.ToLower(r.Code), strings.ToLower(q)) || strings.Contains(strings.ToLower(r.Name), strings.ToLower(q)) {
-				m := map[string]string{"code": r.Code}
-				if r.Name != "" {
-					m["name"] = r.Name
-				}
-				items = append(items, m)
-			}
+	if len(rows) == 0 {
+		// Fallback to env/CSV branches
+		for _, b := range s.cfg.Branches {
+			rows = append(rows, alert.Branch{Code: b})
 		}
-		c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items), "limit": 0, "offset": 0})
-		return
 	}
-	// Fallback to env/CSV branches
-	for _, b := range s.cfg.Branches {
-		if q == "" || strings.Contains(strings.ToLower(b), strings.ToLower(q)) {
-			items = append(items, map[string]string{"code": b})
+	items := make([]map[string]string, 0)
+	for _, r := range rows {
+		if q != "" && !strings.Contains(strings.ToLower(r.Code), q) && !strings.Contains(strings.ToLower(r.Name), q) && !strings.Contains(strings.ToLower(r.Alias), q) {
+			continue
+		}
+		m := map[string]string{"code": r.Code}
+		if r.Name != "" {
+			m["name"] = r.Name
+		}
+		if r.Alias != "" {
+			m["alias"] = r.Alias
 		}
+		if dn := r.DisplayName(s.cfg.BranchNameOrder); dn != "" {
+			m["display_name"] = dn
+		}
+		items = append(items, m)
 	}
 	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items), "limit": 0, "offset": 0})
 }
 
 func (s *Server) gCustcodes(c *gin.Context) {
 	ctx := c.Request.Context()
+	if s.rejectFutureYM(c, c.Query("ym")) {
+		return
+	}
+	base, args, _, ok := custcodesQuery(c, s.trigramSearch(ctx, custcodesSearchIndex))
+	if !ok {
+		return
+	}
+
+	limit, offset, ok := listLimit(c, s.cfg.Limits.Custcodes)
+	if !ok {
+		return
+	}
+	orderBy, sortDir := custcodesOrder(c)
+	countSQL := "SELECT COUNT(1) FROM (" + base + ") t"
+	listSQL := base + fmt.Sprintf(" ORDER BY %s %s LIMIT %d OFFSET %d", orderBy, sortDir, limit, offset)
+	if c.Query("explain") == "1" {
+		s.explainQuery(c, listSQL, args)
+		return
+	}
+
+	var total int
+	if err := s.read.QueryRow(ctx, countSQL, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	rows, err := s.read.Query(ctx, listSQL, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var items []custcodeItem
+	for rows.Next() {
+		it, err := scanCustcodeItem(rows, s.cfg.BranchNameOrder)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": applyJSONPolicy(s.jsonPolicy(), items), "total": total, "limit": limit, "offset": offset})
+}
+
+// custcodeItem is one bm_custcode_init row as returned by /custcodes and its exports.
+type custcodeItem struct {
+	FiscalYear int       `json:"fiscal_year"`
+	BranchCode string    `json:"branch_code"`
+	BranchName *string   `json:"branch_name,omitempty"`
+	OrgName    *string   `json:"org_name,omitempty"`
+	CustCode   string    `json:"cust_code"`
+	UseType    *string   `json:"use_type,omitempty"`
+	UseName    *string   `json:"use_name,omitempty"`
+	CustName   *string   `json:"cust_name,omitempty"`
+	Address    *string   `json:"address,omitempty"`
+	RouteCode  *string   `json:"route_code,omitempty"`
+	MeterNo    *string   `json:"meter_no,omitempty"`
+	MeterSize  *string   `json:"meter_size,omitempty"`
+	MeterBrand *string   `json:"meter_brand,omitempty"`
+	MeterState *string   `json:"meter_state,omitempty"`
+	DebtYM     *string   `json:"debt_ym,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// branchNameJoin adds branch_name and branch_alias (bm_branches.name and alias, '' when
+// unset, NULL for an unknown branch) to a query over a table with branch_code. Only
+// these columns are exposed, so the query's unqualified column names stay unambiguous.
+const branchNameJoin = `
+             LEFT JOIN (SELECT code AS branch_ref, COALESCE(name, '') AS branch_name, COALESCE(alias, '') AS branch_alias
+                        FROM bm_branches) bn ON bn.branch_ref = branch_code`
+
+// branchDisplayName renders the branch_name and branch_alias selected through
+// branchNameJoin in BRANCH_NAME_ORDER, like /branches; nil for a branch missing from
+// bm_branches, so its items stay compact.
+func branchDisplayName(code string, name, alias *string, order []string) *string {
+	if name == nil || alias == nil {
+		return nil
+	}
+	dn := alert.Branch{Code: code, Name: *name, Alias: *alias}.DisplayName(order)
+	if dn == "" {
+		return nil
+	}
+	return &dn
+}
+
+// custcodesQuery builds the filtered SELECT shared by /custcodes and /custcodes.xlsx
+// (branch, fiscal_year or ym, q); trgm selects the pg_trgm search form. On invalid
+// input it writes a 400 and returns ok=false.
+func custcodesQuery(c *gin.Context, trgm bool) (string, []any, int, bool) {
 	branch := strings.TrimSpace(c.Query("branch"))
 	if branch == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "branch is required"})
-		return
+		return "", nil, 0, false
 	}
 	fiscalYear, err := parseFiscalOrYM(c.Query("fiscal_year"), c.Query("ym"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return "", nil, 0, false
 	}
-
-	limit, offset := parseLimitOffset(c.Query("limit"), c.Query("offset"))
-    orderBy := sanitizeOrderBy(c.Query("order_by"), map[string]string{
-        "cust_code":  "cust_code",
-        "meter_no":   "meter_no",
-        "use_type":   "use_type",
-        "created_at": "created_at",
-        // new sortable fields
-        "org_name":   "org_name",
-        "use_name":   "use_name",
-        "cust_name":  "cust_name",
-        "address":    "address",
-        "route_code": "route_code",
-        "meter_size": "meter_size",
-        "meter_brand": "meter_brand",
-        "meter_state": "meter_state",
-        "debt_ym":     "debt_ym",
-    }, "cust_code")
-	sortDir := sanitizeSort(c.Query("sort"))
 	search := strings.TrimSpace(c.Query("q"))
 
 	base := `SELECT fiscal_year, branch_code, org_name, cust_code, use_type, use_name, cust_name, address, route_code,
-                     meter_no, meter_size, meter_brand, meter_state, debt_ym, created_at
-             FROM bm_custcode_init WHERE branch_code=$1 AND fiscal_year=$2`
+                     meter_no, meter_size, meter_brand, meter_state, debt_ym, created_at, branch_name, branch_alias
+             FROM bm_custcode_init` + branchNameJoin + ` WHERE branch_code=$1 AND fiscal_year=$2`
 	args := []any{branch, fiscalYear}
-    if search != "" {
-        // Use the same placeholder $3 for all OR terms (same value)
-        base += ` AND (
-            cust_code ILIKE $3 OR meter_no ILIKE $3 OR use_type ILIKE $3 OR org_name ILIKE $3 OR
-            use_name ILIKE $3 OR cust_name ILIKE $3 OR address ILIKE $3 OR route_code ILIKE $3 OR
-            meter_size ILIKE $3 OR meter_brand ILIKE $3 OR meter_state ILIKE $3 OR debt_ym ILIKE $3
-        )`
-        args = append(args, "%"+search+"%")
-    }
+	if search != "" {
+		// Use the same placeholder $3 for all OR terms (same value)
+		base += searchClause(custcodesSearchColumns, 3, search, trgm)
+		args = append(args, "%"+search+"%")
+	}
+	return base, args, fiscalYear, true
+}
+
+// custcodesOrder returns the sanitized ORDER BY column and direction for custcode queries.
+func custcodesOrder(c *gin.Context) (string, string) {
+	orderBy := sanitizeOrderBy(c.Query("order_by"), map[string]string{
+		"cust_code":  "cust_code",
+		"meter_no":   "meter_no",
+		"use_type":   "use_type",
+		"created_at": "created_at",
+		// new sortable fields
+		"org_name":    "org_name",
+		"use_name":    "use_name",
+		"cust_name":   "cust_name",
+		"address":     "address",
+		"route_code":  "route_code",
+		"meter_size":  "meter_size",
+		"meter_brand": "meter_brand",
+		"meter_state": "meter_state",
+		"debt_ym":     "debt_ym",
+	}, "cust_code")
+	return orderBy, sanitizeSort(c.Query("sort"))
+}
+
+// scanCustcodeItem scans one row selected by custcodesQuery, naming the branch in order
+// (BRANCH_NAME_ORDER).
+func scanCustcodeItem(rows pgx.Rows, order []string) (custcodeItem, error) {
+	var it custcodeItem
+	var org, ut, uname, cname, addr, route, mn, msize, mbrand, mstate, dym sql.NullString
+	var branchName, branchAlias *string
+	if err := rows.Scan(
+		&it.FiscalYear, &it.BranchCode, &org, &it.CustCode, &ut, &uname, &cname, &addr, &route,
+		&mn, &msize, &mbrand, &mstate, &dym, &it.CreatedAt, &branchName, &branchAlias,
+	); err != nil {
+		return custcodeItem{}, err
+	}
+	it.BranchName = branchDisplayName(it.BranchCode, branchName, branchAlias, order)
+	it.OrgName = stringPtr(org)
+	it.UseType = stringPtr(ut)
+	it.UseName = stringPtr(uname)
+	it.CustName = stringPtr(cname)
+	it.Address = stringPtr(addr)
+	it.RouteCode = stringPtr(route)
+	it.MeterNo = stringPtr(mn)
+	it.MeterSize = stringPtr(msize)
+	it.MeterBrand = stringPtr(mbrand)
+	it.MeterState = stringPtr(mstate)
+	it.DebtYM = stringPtr(dym)
+	return it, nil
+}
+
+func (s *Server) gDetails(c *gin.Context) {
+	ctx := c.Request.Context()
+	if s.rejectFutureYM(c, c.Query("ym")) {
+		return
+	}
+	mode, ok := s.detailsSearch(c)
+	if !ok {
+		return
+	}
+	base, args, rank, ok := detailsQuery(c, mode)
+	if !ok {
+		return
+	}
+
+	limit, offset, ok := listLimit(c, s.cfg.Limits.Details)
+	if !ok {
+		return
+	}
+	orderBy, sortDir := detailsOrder(c, rank)
 	countSQL := "SELECT COUNT(1) FROM (" + base + ") t"
 	listSQL := base + fmt.Sprintf(" ORDER BY %s %s LIMIT %d OFFSET %d", orderBy, sortDir, limit, offset)
+	if c.Query("explain") == "1" {
+		s.explainQuery(c, listSQL, args)
+		return
+	}
 
-	var total int
-	if err := s.pg.Pool.QueryRow(ctx, countSQL, args...).Scan(&total); err != nil {
+	// include_summary=1 widens the count into the /details/summary aggregate
+	includeSummary := c.Query("include_summary") == "1"
+	var total, zeroed int
+	var sum float64
+	if includeSummary {
+		countSQL = "SELECT " + detailsSummaryColumns + " FROM (" + base + ") t"
+		if err := s.read.QueryRow(ctx, countSQL, args...).Scan(&total, &zeroed, &sum); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else if err := s.read.QueryRow(ctx, countSQL, args...).Scan(&total); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	rows, err := s.pg.Pool.Query(ctx, listSQL, args...)
+	rows, err := s.read.Query(ctx, listSQL, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	defer rows.Close()
 
-    type item struct {
-        FiscalYear int       `json:"fiscal_year"`
-        BranchCode string    `json:"branch_code"`
-        OrgName    *string   `json:"org_name,omitempty"`
-        CustCode   string    `json:"cust_code"`
-        UseType    *string   `json:"use_type,omitempty"`
-        UseName    *string   `json:"use_name,omitempty"`
-        CustName   *string   `json:"cust_name,omitempty"`
-        Address    *string   `json:"address,omitempty"`
-        RouteCode  *string   `json:"route_code,omitempty"`
-        MeterNo    *string   `json:"meter_no,omitempty"`
-        MeterSize  *string   `json:"meter_size,omitempty"`
-        MeterBrand *string   `json:"meter_brand,omitempty"`
-        MeterState *string   `json:"meter_state,omitempty"`
-        DebtYM     *string   `json:"debt_ym,omitempty"`
-        CreatedAt  time.Time `json:"created_at"`
-    }
-	var items []item
+	var items []detailItem
 	for rows.Next() {
-		var it item
-		var org, ut, uname, cname, addr, route, mn, msize, mbrand, mstate, dym sql.NullString
-		if err := rows.Scan(
-			&it.FiscalYear, &it.BranchCode, &org, &it.CustCode, &ut, &uname, &cname, &addr, &route,
-			&mn, &msize, &mbrand, &mstate, &dym, &it.CreatedAt,
-		); err != nil {
+		it, err := scanDetailItem(rows, s.cfg.BranchNameOrder)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		it.OrgName = stringPtr(org)
-		it.UseType = stringPtr(ut)
-		it.UseName = stringPtr(uname)
-		it.CustName = stringPtr(cname)
-		it.Address = stringPtr(addr)
-		it.RouteCode = stringPtr(route)
-		it.MeterNo = stringPtr(mn)
-		it.MeterSize = stringPtr(msize)
-		it.MeterBrand = stringPtr(mbrand)
-		it.MeterState = stringPtr(mstate)
-		it.DebtYM = stringPtr(dym)
 		items = append(items, it)
 	}
 	if err := rows.Err(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "limit": limit, "offset": offset})
+	resp := gin.H{"items": applyJSONPolicy(s.jsonPolicy(), items), "total": total, "limit": limit, "offset": offset}
+	if includeSummary {
+		var avg float64
+		if total > 0 {
+			avg = sum / float64(total)
+		}
+		policy := s.jsonPolicy()
+		resp["summary"] = gin.H{
+			"total":                 total,
+			"zeroed":                zeroed,
+			"active":                total - zeroed,
+			"sum_present_water_usg": policy.decimalValue(sum),
+			"avg":                   policy.decimalValue(avg),
+		}
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
-func (s *Server) gDetails(c *gin.Context) {
-	ctx := c.Request.Context()
+// detailItem is one bm_meter_details row as returned by /details and its exports.
+type detailItem struct {
+	YearMonth         string    `json:"year_month"`
+	BranchCode        string    `json:"branch_code"`
+	BranchName        *string   `json:"branch_name,omitempty"`
+	OrgName           *string   `json:"org_name,omitempty"`
+	CustCode          string    `json:"cust_code"`
+	UseType           *string   `json:"use_type,omitempty"`
+	UseName           *string   `json:"use_name,omitempty"`
+	CustName          *string   `json:"cust_name,omitempty"`
+	Address           *string   `json:"address,omitempty"`
+	RouteCode         *string   `json:"route_code,omitempty"`
+	MeterNo           *string   `json:"meter_no,omitempty"`
+	MeterSize         *string   `json:"meter_size,omitempty"`
+	MeterBrand        *string   `json:"meter_brand,omitempty"`
+	MeterState        *string   `json:"meter_state,omitempty"`
+	Average           float64   `json:"average" decimal:"string"`
+	PresentMeterCount float64   `json:"present_meter_count" decimal:"string"`
+	PresentWaterUsg   float64   `json:"present_water_usg" decimal:"string"`
+	DebtYM            *string   `json:"debt_ym,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	IsZeroed          bool      `json:"is_zeroed"`
+}
+
+// detailsQuery builds the filtered SELECT shared by /details and /details.csv
+// (ym, branch, fiscal_year, cust_code, q); mode selects how q is matched. With
+// searchFTS it also returns the ts_rank expression to order by (otherwise ""). On
+// invalid input it writes a 400 and returns ok=false.
+func detailsQuery(c *gin.Context, mode searchMode) (string, []any, string, bool) {
 	ym := strings.TrimSpace(c.Query("ym"))
 	branch := strings.TrimSpace(c.Query("branch"))
 	if ym == "" || branch == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ym and branch are required"})
-		return
+		return "", nil, "", false
 	}
 
 	// Get fiscal year from query param if provided, otherwise calculate from ym
@@ -268,41 +886,19 @@ func (s *Server) gDetails(c *gin.Context) {
 			fiscal = fy
 		} else {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid fiscal_year parameter"})
-			return
+			return "", nil, "", false
 		}
 	} else {
 		// Default: calculate from year_month (YYYYMM format)
 		// Fiscal year: Oct-Dec = year+1, Jan-Sep = year
 		fiscal = fiscalYearFromYM(ym)
 	}
-
-	limit, offset := parseLimitOffset(c.Query("limit"), c.Query("offset"))
-    orderBy := sanitizeOrderBy(c.Query("order_by"), map[string]string{
-        "cust_code":           "cust_code",
-        "present_water_usg":   "present_water_usg",
-        "present_meter_count": "present_meter_count",
-        "average":             "average",
-        "created_at":          "created_at",
-        // optional sort on descriptive fields
-        "org_name":   "org_name",
-        "use_type":   "use_type",
-        "use_name":   "use_name",
-        "cust_name":  "cust_name",
-        "address":    "address",
-        "route_code": "route_code",
-        "meter_no":   "meter_no",
-        "meter_size": "meter_size",
-        "meter_brand": "meter_brand",
-        "meter_state": "meter_state",
-        "debt_ym":     "debt_ym",
-    }, "cust_code")
-	sortDir := sanitizeSort(c.Query("sort"))
 	search := strings.TrimSpace(c.Query("q"))
 
 	base := `SELECT year_month, branch_code, org_name, cust_code, use_type, use_name, cust_name, address, route_code,
                     meter_no, meter_size, meter_brand, meter_state, average, present_meter_count, present_water_usg,
-                    debt_ym, created_at
-             FROM bm_meter_details WHERE fiscal_year=$1 AND year_month=$2 AND branch_code=$3`
+                    debt_ym, created_at, branch_name, branch_alias
+             FROM bm_meter_details` + branchNameJoin + ` WHERE fiscal_year=$1 AND year_month=$2 AND branch_code=$3`
 	args := []any{fiscal, ym, branch}
 
 	custs := multiValues(c.Request.URL.Query(), "cust_code")
@@ -316,68 +912,68 @@ func (s *Server) gDetails(c *gin.Context) {
 			args = append(args, cc)
 		}
 	}
-    if search != "" {
-        args = append(args, "%"+search+"%")
-        // one placeholder index for all OR-ed columns
-        p := len(args)
-        base += fmt.Sprintf(" AND (cust_code ILIKE $%d OR meter_no ILIKE $%d OR cust_name ILIKE $%d OR address ILIKE $%d OR route_code ILIKE $%d OR org_name ILIKE $%d OR use_type ILIKE $%d OR use_name ILIKE $%d)", p, p, p, p, p, p, p, p)
-    }
-	countSQL := "SELECT COUNT(1) FROM (" + base + ") t"
-	listSQL := base + fmt.Sprintf(" ORDER BY %s %s LIMIT %d OFFSET %d", orderBy, sortDir, limit, offset)
+	var rank string
+	switch {
+	case search == "":
+	case mode == searchFTS:
+		args = append(args, search)
+		var clause string
+		clause, rank = ftsClause(len(args))
+		base += clause
+	default:
+		args = append(args, "%"+search+"%")
+		// one placeholder index for all OR-ed columns
+		p := len(args)
+		base += searchClause(detailsSearchColumns, p, search, mode == searchTrigram)
+	}
+	return base, args, rank, true
+}
 
-	var total int
-	if err := s.pg.Pool.QueryRow(ctx, countSQL, args...).Scan(&total); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	rows, err := s.pg.Pool.Query(ctx, listSQL, args...)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer rows.Close()
+// detailsOrder returns the sanitized ORDER BY column and direction for details queries.
+// Without order_by, a full-text search (rank != "") orders by relevance, best first,
+// with sort applied to the cust_code tiebreak.
+func detailsOrder(c *gin.Context, rank string) (string, string) {
+	if rank != "" && strings.TrimSpace(c.Query("order_by")) == "" {
+		return rank + " DESC, cust_code", sanitizeSort(c.Query("sort"))
+	}
+	orderBy := sanitizeOrderBy(c.Query("order_by"), map[string]string{
+		"cust_code":           "cust_code",
+		"present_water_usg":   "present_water_usg",
+		"present_meter_count": "present_meter_count",
+		"average":             "average",
+		"created_at":          "created_at",
+		// optional sort on descriptive fields
+		"org_name":    "org_name",
+		"use_type":    "use_type",
+		"use_name":    "use_name",
+		"cust_name":   "cust_name",
+		"address":     "address",
+		"route_code":  "route_code",
+		"meter_no":    "meter_no",
+		"meter_size":  "meter_size",
+		"meter_brand": "meter_brand",
+		"meter_state": "meter_state",
+		"debt_ym":     "debt_ym",
+	}, "cust_code")
+	return orderBy, sanitizeSort(c.Query("sort"))
+}
 
-    type item struct {
-        YearMonth         string    `json:"year_month"`
-        BranchCode        string    `json:"branch_code"`
-        OrgName           *string   `json:"org_name,omitempty"`
-        CustCode          string    `json:"cust_code"`
-        UseType           *string   `json:"use_type,omitempty"`
-        UseName           *string   `json:"use_name,omitempty"`
-        CustName          *string   `json:"cust_name,omitempty"`
-        Address           *string   `json:"address,omitempty"`
-        RouteCode         *string   `json:"route_code,omitempty"`
-        MeterNo           *string   `json:"meter_no,omitempty"`
-        MeterSize         *string   `json:"meter_size,omitempty"`
-        MeterBrand        *string   `json:"meter_brand,omitempty"`
-        MeterState        *string   `json:"meter_state,omitempty"`
-        Average           float64   `json:"average"`
-        PresentMeterCount float64   `json:"present_meter_count"`
-        PresentWaterUsg   float64   `json:"present_water_usg"`
-        DebtYM            *string   `json:"debt_ym,omitempty"`
-        CreatedAt         time.Time `json:"created_at"`
-        IsZeroed          bool      `json:"is_zeroed"`
-    }
-	var items []item
-	for rows.Next() {
-		var it item
-		var org, ut, un, cn, ad, rc, mn, ms, mb, mst, dym *string
-		if err := rows.Scan(&it.YearMonth, &it.BranchCode, &org, &it.CustCode, &ut, &un, &cn, &ad, &rc,
-			&mn, &ms, &mb, &mst, &it.Average, &it.PresentMeterCount, &it.PresentWaterUsg, &dym, &it.CreatedAt); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		it.OrgName = org
-		it.UseType, it.UseName, it.CustName, it.Address, it.RouteCode = ut, un, cn, ad, rc
-		it.MeterNo, it.MeterSize, it.MeterBrand, it.MeterState, it.DebtYM = mn, ms, mb, mst, dym
-		it.IsZeroed = (it.PresentWaterUsg == 0 && it.PresentMeterCount == 0 && (it.OrgName == nil || *it.OrgName == ""))
-		items = append(items, it)
-	}
-	if err := rows.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "limit": limit, "offset": offset})
+// scanDetailItem scans one row selected by detailsQuery, naming the branch in order
+// (BRANCH_NAME_ORDER), and derives is_zeroed.
+func scanDetailItem(rows pgx.Rows, order []string) (detailItem, error) {
+	var it detailItem
+	var org, ut, un, cn, ad, rc, mn, ms, mb, mst, dym, branchName, branchAlias *string
+	if err := rows.Scan(&it.YearMonth, &it.BranchCode, &org, &it.CustCode, &ut, &un, &cn, &ad, &rc,
+		&mn, &ms, &mb, &mst, &it.Average, &it.PresentMeterCount, &it.PresentWaterUsg, &dym, &it.CreatedAt,
+		&branchName, &branchAlias); err != nil {
+		return detailItem{}, err
+	}
+	it.BranchName = branchDisplayName(it.BranchCode, branchName, branchAlias, order)
+	it.OrgName = org
+	it.UseType, it.UseName, it.CustName, it.Address, it.RouteCode = ut, un, cn, ad, rc
+	it.MeterNo, it.MeterSize, it.MeterBrand, it.MeterState, it.DebtYM = mn, ms, mb, mst, dym
+	it.IsZeroed = (it.PresentWaterUsg == 0 && it.PresentMeterCount == 0 && (it.OrgName == nil || *it.OrgName == ""))
+	return it, nil
 }
 
 func (s *Server) gCustcodeDetails(c *gin.Context) {
@@ -393,29 +989,69 @@ func (s *Server) gCustcodeDetails(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "branch, from, to are required"})
 		return
 	}
+	// full=1 adds every stored column per month (support view); the lean series stays
+	// the default for charts
+	full := c.Query("full") == "1"
+	cols := "year_month, present_water_usg, present_meter_count, org_name"
+	if full {
+		cols += `, fiscal_year, use_type, use_name, cust_name, address, route_code, meter_no, meter_size,
+                 meter_brand, meter_state, average, debt_ym, usage_clamped, pct_change, created_at`
+	}
 	ctx := c.Request.Context()
-	sql := `SELECT year_month, present_water_usg, present_meter_count, org_name
+	sql := `SELECT ` + cols + `
             FROM bm_meter_details
             WHERE cust_code=$1 AND branch_code=$2 AND year_month BETWEEN $3 AND $4
             ORDER BY year_month`
-	rows, err := s.pg.Pool.Query(ctx, sql, custCode, branch, from, to)
+	rows, err := s.read.Query(ctx, sql, custCode, branch, from, to)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	defer rows.Close()
+	// Values are pointers so gap-filled months (fill_gaps=1) can be serialized as null.
 	type point struct {
-		YM                string  `json:"ym"`
-		PresentWaterUsg   float64 `json:"present_water_usg"`
-		PresentMeterCount float64 `json:"present_meter_count"`
-		IsZeroed          bool    `json:"is_zeroed"`
+		YM                string   `json:"ym"`
+		PresentWaterUsg   *float64 `json:"present_water_usg" decimal:"string"`
+		PresentMeterCount *float64 `json:"present_meter_count" decimal:"string"`
+		IsZeroed          bool     `json:"is_zeroed"`
+		Missing           bool     `json:"missing,omitempty"`
+	}
+	// record holds the descriptive columns of full=1; all nullable so gap-filled months stay empty
+	type record struct {
+		FiscalYear   *int       `json:"fiscal_year,omitempty"`
+		OrgName      *string    `json:"org_name,omitempty"`
+		UseType      *string    `json:"use_type,omitempty"`
+		UseName      *string    `json:"use_name,omitempty"`
+		CustName     *string    `json:"cust_name,omitempty"`
+		Address      *string    `json:"address,omitempty"`
+		RouteCode    *string    `json:"route_code,omitempty"`
+		MeterNo      *string    `json:"meter_no,omitempty"`
+		MeterSize    *string    `json:"meter_size,omitempty"`
+		MeterBrand   *string    `json:"meter_brand,omitempty"`
+		MeterState   *string    `json:"meter_state,omitempty"`
+		Average      *float64   `json:"average,omitempty" decimal:"string"`
+		DebtYM       *string    `json:"debt_ym,omitempty"`
+		UsageClamped *bool      `json:"usage_clamped,omitempty"`
+		PctChange    *float64   `json:"pct_change,omitempty"`
+		CreatedAt    *time.Time `json:"created_at,omitempty"`
+	}
+	type fullPoint struct {
+		point
+		record
 	}
 	var series []point
+	records := map[string]record{}
 	for rows.Next() {
 		var ym string
 		var org *string
 		var usg, cnt float64
-		if err := rows.Scan(&ym, &usg, &cnt, &org); err != nil {
+		dest := []any{&ym, &usg, &cnt, &org}
+		var r record
+		if full {
+			dest = append(dest, &r.FiscalYear, &r.UseType, &r.UseName, &r.CustName, &r.Address, &r.RouteCode, &r.MeterNo,
+				&r.MeterSize, &r.MeterBrand, &r.MeterState, &r.Average, &r.DebtYM, &r.UsageClamped, &r.PctChange, &r.CreatedAt)
+		}
+		if err := rows.Scan(dest...); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -423,11 +1059,57 @@ func (s *Server) gCustcodeDetails(c *gin.Context) {
 		if org != nil {
 			zero = *org
 		}
-		series = append(series, point{YM: ym, PresentWaterUsg: usg, PresentMeterCount: cnt, IsZeroed: (usg == 0 && cnt == 0 && zero == "")})
+		series = append(series, point{YM: ym, PresentWaterUsg: &usg, PresentMeterCount: &cnt, IsZeroed: (usg == 0 && cnt == 0 && zero == "")})
+		if full {
+			r.OrgName = org
+			records[ym] = r
+		}
 	}
-	c.JSON(http.StatusOK, gin.H{"cust_code": custCode, "branch_code": branch, "from": from, "to": to, "series": series})
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// By default only months that exist in bm_meter_details are returned (sparse series).
+	// fill_gaps=1 expands the requested range and marks absent months as missing with null values.
+	if c.Query("fill_gaps") == "1" {
+		months, err := monthRange(from, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		byYM := make(map[string]point, len(series))
+		for _, p := range series {
+			byYM[p.YM] = p
+		}
+		filled := make([]point, 0, len(months))
+		for _, ym := range months {
+			if p, ok := byYM[ym]; ok {
+				filled = append(filled, p)
+				continue
+			}
+			filled = append(filled, point{YM: ym, Missing: true})
+		}
+		series = filled
+	}
+	policy := jsonPolicy{DecimalAsString: s.cfg.DecimalAsString}
+	if full {
+		out := make([]fullPoint, len(series))
+		for i, p := range series {
+			out[i] = fullPoint{point: p, record: records[p.YM]}
+		}
+		c.JSON(http.StatusOK, gin.H{"cust_code": custCode, "branch_code": branch, "from": from, "to": to, "series": applyJSONPolicy(policy, out)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cust_code": custCode, "branch_code": branch, "from": from, "to": to, "series": applyJSONPolicy(policy, series)})
 }
 
+// detailsSummaryColumns aggregates total, zeroed and summed usage over bm_meter_details
+// rows; shared by /details/summary and the per-month /details/nrw series.
+const detailsSummaryColumns = `COUNT(1) AS total,
+                COALESCE(SUM(CASE WHEN present_water_usg=0 AND present_meter_count=0 AND org_name='' THEN 1 ELSE 0 END), 0) AS zeroed,
+                COALESCE(SUM(present_water_usg), 0) AS sum_usg`
+
 func (s *Server) gDetailsSummary(c *gin.Context) {
 	ctx := c.Request.Context()
 	ym := strings.TrimSpace(c.Query("ym"))
@@ -436,209 +1118,887 @@ func (s *Server) gDetailsSummary(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ym and branch are required"})
 		return
 	}
+	cacheKey := summaryCacheKey("details/summary", branch, ym)
+	if s.serveCachedSummary(c, cacheKey) {
+		return
+	}
 	var total, zeroed int
 	var sum float64
-	err := s.pg.Pool.QueryRow(ctx,
-		`SELECT COUNT(1) AS total,
-                COALESCE(SUM(CASE WHEN present_water_usg=0 AND present_meter_count=0 AND org_name='' THEN 1 ELSE 0 END), 0) AS zeroed,
-                COALESCE(SUM(present_water_usg), 0) AS sum_usg
+	err := s.read.QueryRow(ctx,
+		`SELECT `+detailsSummaryColumns+`
          FROM bm_meter_details WHERE year_month=$1 AND branch_code=$2`, ym, branch,
 	).Scan(&total, &zeroed, &sum)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"ym": ym, "branch": branch, "total": total, "zeroed": zeroed, "active": total - zeroed, "sum_present_water_usg": sum})
+	s.respondSummary(c, cacheKey, branch, ym, ym, gin.H{"ym": ym, "branch": branch, "total": total, "zeroed": zeroed, "active": total - zeroed, "sum_present_water_usg": s.jsonPolicy().decimalValue(sum)})
+}
+
+// gDetailsSummaryByUseType splits the /details/summary figures of a branch and month
+// by use_type. Rows synced before use_type was stored on active rows take it from the
+// cohort snapshot in bm_custcode_init; rows with neither are grouped under "".
+func (s *Server) gDetailsSummaryByUseType(c *gin.Context) {
+	ym := strings.TrimSpace(c.Query("ym"))
+	branch := strings.TrimSpace(c.Query("branch"))
+	if ym == "" || branch == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ym and branch are required"})
+		return
+	}
+	cacheKey := summaryCacheKey("details/summary/by-use-type", branch, ym)
+	if s.serveCachedSummary(c, cacheKey) {
+		return
+	}
+	rows, err := s.read.Query(c.Request.Context(),
+		`SELECT use_type, `+detailsSummaryColumns+`
+         FROM (
+             SELECT COALESCE(NULLIF(d.use_type, ''), i.use_type, '') AS use_type,
+                    d.present_water_usg, d.present_meter_count, d.org_name
+             FROM bm_meter_details d
+             LEFT JOIN bm_custcode_init i
+               ON i.fiscal_year = d.fiscal_year AND i.branch_code = d.branch_code AND i.cust_code = d.cust_code
+             WHERE d.year_month=$1 AND d.branch_code=$2
+         ) t
+         GROUP BY use_type ORDER BY use_type`, ym, branch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	type item struct {
+		UseType         string  `json:"use_type"`
+		Total           int     `json:"total"`
+		Zeroed          int     `json:"zeroed"`
+		Active          int     `json:"active"`
+		SumPresentWater float64 `json:"sum_present_water_usg" decimal:"string"`
+	}
+	items := []item{}
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.UseType, &it.Total, &it.Zeroed, &it.SumPresentWater); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		it.Active = it.Total - it.Zeroed
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.respondSummary(c, cacheKey, branch, ym, ym, gin.H{
+		"ym":     ym,
+		"branch": branch,
+		"items":  applyJSONPolicy(s.jsonPolicy(), items),
+	})
+}
+
+// gSummary aggregates every branch's details for one month in a single grouped query,
+// with a grand total across branches, for the dashboard overview.
+func (s *Server) gSummary(c *gin.Context) {
+	ym := strings.TrimSpace(c.Query("ym"))
+	if ym == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ym is required"})
+		return
+	}
+	cacheKey := summaryCacheKey("summary", ym)
+	if s.serveCachedSummary(c, cacheKey) {
+		return
+	}
+	rows, err := s.read.Query(c.Request.Context(),
+		`SELECT branch_code, `+detailsSummaryColumns+`
+         FROM bm_meter_details WHERE year_month=$1
+         GROUP BY branch_code ORDER BY branch_code`, ym)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	type item struct {
+		BranchCode      string  `json:"branch_code,omitempty"`
+		Total           int     `json:"total"`
+		Zeroed          int     `json:"zeroed"`
+		Active          int     `json:"active"`
+		SumPresentWater float64 `json:"sum_present_water_usg" decimal:"string"`
+	}
+	items := []item{}
+	var grand item
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.BranchCode, &it.Total, &it.Zeroed, &it.SumPresentWater); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		it.Active = it.Total - it.Zeroed
+		items = append(items, it)
+		grand.Total += it.Total
+		grand.Zeroed += it.Zeroed
+		grand.Active += it.Active
+		grand.SumPresentWater += it.SumPresentWater
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	policy := jsonPolicy{DecimalAsString: s.cfg.DecimalAsString}
+	s.respondSummary(c, cacheKey, "", ym, ym, gin.H{
+		"ym":          ym,
+		"items":       applyJSONPolicy(policy, items),
+		"grand_total": policy.wrap(grand),
+	})
 }
 
 // pSyncInit triggers yearly initialization sync for specified branches.
 func (s *Server) pSyncInit(c *gin.Context) {
 	var req struct {
-		Branches []string `json:"branches"`
-		DebtYM   string   `json:"debt_ym"`
+		Branches       []string `json:"branches"`
+		DebtYM         string   `json:"debt_ym"`
+		BackfillMonths *int     `json:"backfill_months"`
+		// Force skips the known-branch check, for a branch not yet in bm_branches
+		Force bool `json:"force,omitempty"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
 		return
 	}
-
-	// Check if sync service is available
-	if s.syncSvc == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sync service not available (Oracle not configured)"})
+
+	// backfill_months overrides BACKFILL_MONTHS for this run; 0 skips the backfill
+	backfillMonths := s.cfg.Sync.BackfillMonths
+	if req.BackfillMonths != nil {
+		if *req.BackfillMonths < 0 || *req.BackfillMonths > config.MaxBackfillMonths {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("backfill_months must be between 0 and %d", config.MaxBackfillMonths)})
+			return
+		}
+		backfillMonths = *req.BackfillMonths
+	}
+
+	// Check if sync service is available
+	if s.syncSvc == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sync service not available (Oracle not configured)"})
+		return
+	}
+
+	// Default branches from config if not provided
+	branches := req.Branches
+	if len(branches) == 0 {
+		branches = s.cfg.Branches
+	}
+	if len(branches) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branches are required"})
+		return
+	}
+
+	if s.rejectInvalidBranches(c, branches) || s.rejectUnknownBranches(c, branches, req.Force) {
+		return
+	}
+
+	// Default DEBT_YM to October of current year, unless INIT_REQUIRE_DEBT_YM asks callers to be explicit
+	debtYM := strings.TrimSpace(req.DebtYM)
+	defaulted := debtYM == ""
+	if defaulted {
+		if s.cfg.RequireDebtYM {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "debt_ym is required (YYYYMM); INIT_REQUIRE_DEBT_YM is set"})
+			return
+		}
+		debtYM = fmt.Sprintf("%04d10", time.Now().Year())
+	}
+
+	// Normalize to Gregorian YM
+	ymGreg, err := syncsvc.NormalizeGregorianYM(debtYM)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid debt_ym; expect YYYYMM"})
+		return
+	}
+
+	// Convert to Thai YM for Oracle query
+	thaiYM, err := toThaiYM(ymGreg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert to Thai calendar"})
+		return
+	}
+
+	fiscal, err := parseFiscalOrYM("", ymGreg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid debt_ym"})
+		return
+	}
+
+	if s.rejectIfCoolingDown(c, "sync/init", branches) {
+		return
+	}
+	keys, ok := s.acquireSyncJobs(c, "yearly_init", thaiYM, branches)
+	if !ok {
+		return
+	}
+	s.triggers.record("sync/init", branches)
+
+	// Pre-create one log row per branch so the client can poll /sync/logs/:id
+	logIDs := s.preCreateSyncLogs(c, "yearly_init", "api", branches, nil, &thaiYM, fiscal)
+
+	started := time.Now()
+
+	// Run sync in background to avoid HTTP timeout issues
+	// User can monitor progress via sync logs table
+	rid, rlog := requestRunLog(c)
+	go func() {
+		// Use background context instead of request context
+		ctx := syncsvc.WithRequestID(context.Background(), rid)
+
+		rlog.Printf("yearly init: starting background sync for %d branches", len(branches))
+		totalUpserted := 0
+		totalZeroed := 0
+		failedCount := 0
+
+		// Execute sync for each branch sequentially (one at a time)
+		// This avoids Oracle connection pool exhaustion from concurrent queries
+		for i, branch := range branches {
+			b := strings.TrimSpace(branch)
+			rlog.Printf("yearly init: processing branch=%s", b)
+			jctx := s.syncSvc.JobContext(ctx, keys[i])
+			upserted, zeroed, err := s.syncSvc.InitCustcodes(syncsvc.WithPreCreatedLog(jctx, logIDs[i]), fiscal, b, thaiYM, backfillMonths, "api")
+			s.syncSvc.Jobs.Release(keys[i])
+			s.summaries.invalidate(b, "") // the backfill rewrites several months
+			if err != nil {
+				rlog.Printf("yearly init: branch=%s failed: %v", b, err)
+				failedCount++
+				// Continue with other branches even if one fails
+			} else {
+				rlog.Printf("yearly init: branch=%s completed (upserted=%d)", b, upserted)
+				totalUpserted += upserted
+				totalZeroed += zeroed
+			}
+		}
+
+		elapsed := time.Since(started)
+		rlog.Printf("yearly init: background sync completed (total branches=%d, failed=%d, upserted=%d, elapsed=%v)",
+			len(branches), failedCount, totalUpserted, elapsed)
+	}()
+
+	// Return immediately with 202 Accepted
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":           "Yearly initialization started in background",
+		"fiscal_year":       fiscal,
+		"branches":          branches,
+		"debt_ym":           debtYM,
+		"debt_ym_gregorian": ymGreg,
+		"debt_ym_thai":      thaiYM,
+		"debt_ym_defaulted": defaulted,
+		"backfill_months":   backfillMonths,
+		"logs":              syncLogRefs(branches, logIDs),
+		"started_at":        started.Format(time.RFC3339),
+		"note":              "Monitor progress via GET /sync/logs/:id",
+	})
+}
+
+// pSyncMonthly triggers monthly details sync for specified branches.
+func (s *Server) pSyncMonthly(c *gin.Context) {
+	var req struct {
+		Branches  []string `json:"branches"`
+		YM        string   `json:"ym"`
+		BatchSize int      `json:"batch_size,omitempty"`
+		// DryRun returns projected counts synchronously without writing anything
+		DryRun bool `json:"dry_run,omitempty"`
+		// AllowFuture skips the future-month guard (testing only)
+		AllowFuture bool `json:"allow_future,omitempty"`
+		// Force skips the known-branch check, for a branch not yet in bm_branches
+		Force bool `json:"force,omitempty"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+		return
+	}
+
+	// Check if sync service is available
+	if s.syncSvc == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sync service not available (Oracle not configured)"})
+		return
+	}
+
+	branches := req.Branches
+	if len(branches) == 0 {
+		branches = s.cfg.Branches
+	}
+	if len(branches) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branches are required"})
+		return
+	}
+	if s.rejectInvalidBranches(c, branches) || s.rejectUnknownBranches(c, branches, req.Force) {
+		return
+	}
+
+	ym := strings.TrimSpace(req.YM)
+	if len(ym) != 6 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ym is required (YYYYMM)"})
+		return
+	}
+	if _, err := strconv.Atoi(ym[:4]); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ym year"})
+		return
+	}
+	if m, err := strconv.Atoi(ym[4:]); err != nil || m < 1 || m > 12 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ym month"})
+		return
+	}
+	loc, err := time.LoadLocation(s.cfg.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	if !req.AllowFuture && c.Query("allow_future") != "true" && syncsvc.IsFutureYM(ym, time.Now().In(loc)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ym %s is after the current month; Oracle has no data for it yet (set allow_future=true to override)", ym)})
+		return
+	}
+
+	batchSize := req.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100 // default
+	}
+
+	if req.DryRun || c.Query("dry_run") == "true" {
+		s.syncMonthlyDryRun(c, ym, branches, batchSize)
+		return
+	}
+
+	if s.rejectIfCoolingDown(c, "sync/monthly", branches) {
+		return
+	}
+	keys, ok := s.acquireSyncJobs(c, "monthly_sync", ym, branches)
+	if !ok {
+		return
+	}
+	s.triggers.record("sync/monthly", branches)
+
+	// Pre-create one log row per branch so the client can poll /sync/logs/:id
+	logIDs := s.preCreateSyncLogs(c, "monthly_sync", "api", branches, &ym, nil, fiscalYearFromYM(ym))
+
+	started := time.Now()
+
+	// Run sync in background to avoid HTTP timeout issues
+	// User can monitor progress via sync logs table
+	rid, rlog := requestRunLog(c)
+	go func() {
+		// Use background context instead of request context
+		ctx := syncsvc.WithRequestID(context.Background(), rid)
+
+		rlog.Printf("monthly sync: starting background sync for %d branches (ym=%s)", len(branches), ym)
+		totalUpserted := 0
+		totalZeroed := 0
+		failedCount := 0
+
+		// Execute sync for each branch sequentially (one at a time)
+		// This avoids Oracle connection pool exhaustion from concurrent queries
+		for i, branch := range branches {
+			b := strings.TrimSpace(branch)
+			rlog.Printf("monthly sync: processing branch=%s ym=%s", b, ym)
+			jctx := s.syncSvc.JobContext(ctx, keys[i])
+			upserted, zeroed, err := s.syncSvc.MonthlyDetails(syncsvc.WithPreCreatedLog(jctx, logIDs[i]), ym, b, batchSize, "api")
+			s.syncSvc.Jobs.Release(keys[i])
+			s.summaries.invalidate(b, ym)
+			if err != nil {
+				rlog.Printf("monthly sync: branch=%s ym=%s failed: %v", b, ym, err)
+				failedCount++
+				// Continue with other branches even if one fails
+			} else {
+				rlog.Printf("monthly sync: branch=%s ym=%s completed (upserted=%d, zeroed=%d)", b, ym, upserted, zeroed)
+				totalUpserted += upserted
+				totalZeroed += zeroed
+			}
+		}
+
+		elapsed := time.Since(started)
+		rlog.Printf("monthly sync: background sync completed (total branches=%d, failed=%d, upserted=%d, zeroed=%d, elapsed=%v)",
+			len(branches), failedCount, totalUpserted, totalZeroed, elapsed)
+	}()
+
+	// Return immediately with 202 Accepted
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Monthly sync started in background",
+		"ym":         ym,
+		"branches":   branches,
+		"logs":       syncLogRefs(branches, logIDs),
+		"started_at": started.Format(time.RFC3339),
+		"note":       "Monitor progress via GET /sync/logs/:id",
+	})
+}
+
+// pSyncMonthlyAllCohorts syncs ym into every fiscal cohort that should hold it, per
+// branch, instead of only the cohort derived from ym. A historical month before October
+// can belong to its own fiscal year and to the next year's cohort via the init
+// backfill; both are refreshed. Branches with no such cohort are skipped.
+func (s *Server) pSyncMonthlyAllCohorts(c *gin.Context) {
+	var req struct {
+		Branches  []string `json:"branches"`
+		YM        string   `json:"ym"`
+		BatchSize int      `json:"batch_size,omitempty"`
+		Force     bool     `json:"force,omitempty"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+		return
+	}
+	if s.syncSvc == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sync service not available (Oracle not configured)"})
+		return
+	}
+
+	branches := req.Branches
+	if len(branches) == 0 {
+		branches = s.cfg.Branches
+	}
+	if len(branches) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branches are required"})
+		return
+	}
+	if s.rejectInvalidBranches(c, branches) || s.rejectUnknownBranches(c, branches, req.Force) {
+		return
+	}
+	ym := strings.TrimSpace(req.YM)
+	if _, _, err := parseYM(ym); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ym is required (YYYYMM)"})
+		return
+	}
+	loc, err := time.LoadLocation(s.cfg.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	if syncsvc.IsFutureYM(ym, time.Now().In(loc)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ym %s is after the current month; Oracle has no data for it yet", ym)})
+		return
+	}
+	batchSize := req.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	// Resolve the cohorts up front so the response lists every job it starts
+	type cohortJob struct {
+		Branch     string `json:"branch"`
+		FiscalYear int    `json:"fiscal_year"`
+		LogID      *int64 `json:"log_id"`
+	}
+	var jobs []cohortJob
+	active, skipped := []string{}, []string{}
+	for _, branch := range branches {
+		b := strings.TrimSpace(branch)
+		cohorts, err := s.syncSvc.CohortsForMonth(c.Request.Context(), ym, b)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(cohorts) == 0 {
+			skipped = append(skipped, b)
+			continue
+		}
+		active = append(active, b)
+		for _, fy := range cohorts {
+			jobs = append(jobs, cohortJob{Branch: b, FiscalYear: fy})
+		}
+	}
+	if len(jobs) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "no fiscal cohort holds this month for the given branches", "ym": ym, "skipped": skipped})
+		return
+	}
+
+	if s.rejectIfCoolingDown(c, "sync/monthly", active) {
+		return
+	}
+	keys, ok := s.acquireSyncJobs(c, "monthly_sync", ym, active)
+	if !ok {
+		return
+	}
+	s.triggers.record("sync/monthly", active)
+	for i := range jobs {
+		jobs[i].LogID = logIDRef(s.preCreateSyncLogs(c, "monthly_sync", "api", []string{jobs[i].Branch}, &ym, nil, jobs[i].FiscalYear)[0])
+	}
+
+	started := time.Now()
+	rid, rlog := requestRunLog(c)
+	go func() {
+		ctx := syncsvc.WithRequestID(context.Background(), rid)
+		rlog.Printf("monthly sync (all cohorts): starting %d jobs over %d branches (ym=%s)", len(jobs), len(active), ym)
+		failedCount := 0
+		next := 0
+		// Cohorts of one branch run back to back; the branch's job key is released after its last
+		for i, b := range active {
+			// One timeout covers all cohorts of a branch, like its job key
+			jctx := s.syncSvc.JobContext(ctx, keys[i])
+			for ; next < len(jobs) && jobs[next].Branch == b; next++ {
+				job := jobs[next]
+				var logID int64
+				if job.LogID != nil {
+					logID = *job.LogID
+				}
+				upserted, zeroed, err := s.syncSvc.MonthlyDetailsWithOptions(jctx, ym, b, batchSize, "api", job.FiscalYear, syncsvc.SyncOptions{LogID: logID})
+				if err != nil {
+					rlog.Printf("monthly sync (all cohorts): branch=%s ym=%s fiscal=%d failed: %v", b, ym, job.FiscalYear, err)
+					failedCount++
+					continue
+				}
+				rlog.Printf("monthly sync (all cohorts): branch=%s ym=%s fiscal=%d completed (upserted=%d, zeroed=%d)", b, ym, job.FiscalYear, upserted, zeroed)
+			}
+			s.syncSvc.Jobs.Release(keys[i])
+			s.summaries.invalidate(b, ym)
+		}
+		rlog.Printf("monthly sync (all cohorts): completed (jobs=%d, failed=%d, elapsed=%v)", len(jobs), failedCount, time.Since(started))
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Monthly sync for all cohorts started in background",
+		"ym":         ym,
+		"branches":   active,
+		"skipped":    skipped,
+		"jobs":       jobs,
+		"started_at": started.Format(time.RFC3339),
+		"note":       "Monitor progress via GET /sync/logs/:id",
+	})
+}
+
+// logIDRef returns a pointer for a pre-created log id, nil when creation failed
+func logIDRef(id int64) *int64 {
+	if id <= 0 {
+		return nil
+	}
+	return &id
+}
+
+// syncMonthlyDryRun previews POST /sync/monthly: each branch is run against Oracle in
+// turn without writing, and the projected counts are returned synchronously (200).
+func (s *Server) syncMonthlyDryRun(c *gin.Context, ym string, branches []string, batchSize int) {
+	type projection struct {
+		Branch   string `json:"branch"`
+		Upserted int    `json:"upserted"`
+		Zeroed   int    `json:"zeroed"`
+		Error    string `json:"error,omitempty"`
+	}
+	started := time.Now()
+	results := make([]projection, 0, len(branches))
+	for _, branch := range branches {
+		b := strings.TrimSpace(branch)
+		upserted, zeroed, err := s.syncSvc.MonthlyDetailsDryRun(c.Request.Context(), ym, b, batchSize)
+		p := projection{Branch: b, Upserted: upserted, Zeroed: zeroed}
+		if err != nil {
+			p.Error = err.Error()
+		}
+		results = append(results, p)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":     true,
+		"ym":          ym,
+		"branches":    results,
+		"started_at":  started.Format(time.RFC3339),
+		"finished_at": time.Now().Format(time.RFC3339),
+	})
+}
+
+// syncLogRef identifies the sync log row tracking one branch of a triggered run
+type syncLogRef struct {
+	Branch string `json:"branch"`
+	LogID  *int64 `json:"log_id"`
+}
+
+// preCreateSyncLogs inserts one in_progress log row per branch before the background run
+// starts; the run reuses these rows. An id of 0 means creation failed and the run will
+// record its own row. Each row is bound to the branch's job, acquired under ym (monthly)
+// or debtYM (yearly init), so POST /sync/cancel finds it by log id.
+func (s *Server) preCreateSyncLogs(c *gin.Context, syncType, triggeredBy string, branches []string, ym, debtYM *string, fiscal int) []int64 {
+	jobYM := debtYM
+	if ym != nil {
+		jobYM = ym
+	}
+	ids := make([]int64, len(branches))
+	for i, b := range branches {
+		id, err := s.syncSvc.LogRepo.RecordSyncStart(c.Request.Context(), syncType, strings.TrimSpace(b), triggeredBy, ym, debtYM, &fiscal)
+		if err != nil {
+			log.Printf("warning: failed to pre-create sync log for branch=%s: %v", b, err)
+		}
+		if jobYM != nil {
+			s.syncSvc.Jobs.BindLog(syncsvc.JobKey(syncType, strings.TrimSpace(b), *jobYM), id)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+// syncLogRefs pairs each branch with its pre-created log id (null when creation failed)
+func syncLogRefs(branches []string, ids []int64) []syncLogRef {
+	out := make([]syncLogRef, len(branches))
+	for i, b := range branches {
+		out[i] = syncLogRef{Branch: strings.TrimSpace(b), LogID: logIDRef(ids[i])}
+	}
+	return out
+}
+
+// gSyncLog returns a single sync log by id, for polling a run started via /sync/*
+func (s *Server) gSyncLog(c *gin.Context) {
+	if s.syncSvc == nil || s.syncSvc.LogRepo == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sync logs not available"})
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	entry, err := s.syncSvc.LogRepo.GetSyncLog(c.Request.Context(), id)
+	if errors.Is(err, syncsvc.ErrSyncLogNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sync log not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setDurationHuman(entry)
+	c.JSON(http.StatusOK, entry)
+}
+
+// setDurationHuman fills duration_human from duration_ms, e.g. 78000 -> "1.3m"
+func setDurationHuman(l *syncsvc.SyncLog) {
+	if l.DurationMs != nil {
+		l.DurationHuman = notify.FormatDuration(time.Duration(*l.DurationMs) * time.Millisecond)
+	}
+}
+
+// pSyncLogRetry re-runs a failed sync with the parameters stored on its log row
+// (branch, year_month/debt_ym, fiscal_year). The re-run gets a new log row with
+// triggered_by="retry", whose id is returned for polling.
+func (s *Server) pSyncLogRetry(c *gin.Context) {
+	if s.syncSvc == nil || s.syncSvc.LogRepo == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sync service not available"})
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	entry, err := s.syncSvc.LogRepo.GetSyncLog(c.Request.Context(), id)
+	if errors.Is(err, syncsvc.ErrSyncLogNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sync log not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Default branches from config if not provided
-	branches := req.Branches
-	if len(branches) == 0 {
-		branches = s.cfg.Branches
+	if entry.Status != "error" && entry.Status != "timeout" && entry.Status != "cancelled" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only failed syncs can be retried", "status": entry.Status})
+		return
 	}
-	if len(branches) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "branches are required"})
+	if entry.FiscalYear == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sync log has no fiscal_year; cannot retry"})
 		return
 	}
+	fiscal := *entry.FiscalYear
+	branch := entry.BranchCode
 
-	// Default DEBT_YM to October of current year
-	debtYM := strings.TrimSpace(req.DebtYM)
-	if debtYM == "" {
-		debtYM = fmt.Sprintf("%04d10", time.Now().Year())
+	// resume=true continues a monthly sync from the failed run's last committed offset
+	resume := false
+	if v := c.Query("resume"); v != "" {
+		if resume, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid resume; expect true or false"})
+			return
+		}
 	}
-
-	// Normalize to Gregorian YM
-	ymGreg, err := normalizeGregorianYM(debtYM)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid debt_ym; expect YYYYMM"})
+	if resume && entry.SyncType != "monthly_sync" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resume is only supported for monthly_sync"})
 		return
 	}
+	resumeFrom := 0
+	if resume {
+		resumeFrom = entry.LastOffset
+	}
 
-	// Convert to Thai YM for Oracle query
-	thaiYM, err := toThaiYM(ymGreg)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert to Thai calendar"})
+	var (
+		ym, debtYM *string
+		jobYM      string
+		run        func(ctx context.Context, logID int64) (int, int, error)
+	)
+	switch entry.SyncType {
+	case "yearly_init":
+		if entry.DebtYM == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sync log has no debt_ym; cannot retry"})
+			return
+		}
+		debtYM, jobYM = entry.DebtYM, *entry.DebtYM
+		run = func(ctx context.Context, logID int64) (int, int, error) {
+			return s.syncSvc.InitCustcodes(syncsvc.WithPreCreatedLog(ctx, logID), fiscal, branch, jobYM, s.cfg.Sync.BackfillMonths, "retry")
+		}
+	case "monthly_sync":
+		if entry.YearMonth == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sync log has no year_month; cannot retry"})
+			return
+		}
+		ym, jobYM = entry.YearMonth, *entry.YearMonth
+		// Keep the stored fiscal year so a failed backfill month reuses the same cohort
+		run = func(ctx context.Context, logID int64) (int, int, error) {
+			return s.syncSvc.MonthlyDetailsWithOptions(ctx, jobYM, branch, 100, "retry", fiscal, syncsvc.SyncOptions{ResumeFrom: resumeFrom, LogID: logID})
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported sync_type: " + entry.SyncType})
 		return
 	}
 
-	fiscal, err := parseFiscalOrYM("", ymGreg)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid debt_ym"})
+	keys, ok := s.acquireSyncJobs(c, entry.SyncType, jobYM, []string{branch})
+	if !ok {
 		return
 	}
-
+	logIDs := s.preCreateSyncLogs(c, entry.SyncType, "retry", []string{branch}, ym, debtYM, fiscal)
 	started := time.Now()
 
-	// Run sync in background to avoid HTTP timeout issues
-	// User can monitor progress via sync logs table
+	rid, rlog := requestRunLog(c)
 	go func() {
-		// Use background context instead of request context
-		ctx := context.Background()
-
-		log.Printf("yearly init: starting background sync for %d branches", len(branches))
-		totalUpserted := 0
-		totalZeroed := 0
-		failedCount := 0
-
-		// Execute sync for each branch sequentially (one at a time)
-		// This avoids Oracle connection pool exhaustion from concurrent queries
-		for _, branch := range branches {
-			b := strings.TrimSpace(branch)
-			log.Printf("yearly init: processing branch=%s", b)
-			upserted, zeroed, err := s.syncSvc.InitCustcodes(ctx, fiscal, b, thaiYM, "api")
-			if err != nil {
-				log.Printf("yearly init: branch=%s failed: %v", b, err)
-				failedCount++
-				// Continue with other branches even if one fails
-			} else {
-				log.Printf("yearly init: branch=%s completed (upserted=%d)", b, upserted)
-				totalUpserted += upserted
-				totalZeroed += zeroed
-			}
+		defer s.syncSvc.Jobs.Release(keys...)
+		rlog.Printf("retry: sync log %d (%s branch=%s ym=%s) starting", id, entry.SyncType, branch, jobYM)
+		upserted, zeroed, err := run(s.syncSvc.JobContext(syncsvc.WithRequestID(context.Background(), rid), keys[0]), logIDs[0])
+		// A failed run may still have committed batches; yearly_init also backfills
+		if entry.SyncType == "monthly_sync" {
+			s.summaries.invalidate(branch, jobYM)
+		} else {
+			s.summaries.invalidate(branch, "")
 		}
-
-		elapsed := time.Since(started)
-		log.Printf("yearly init: background sync completed (total branches=%d, failed=%d, upserted=%d, elapsed=%v)",
-			len(branches), failedCount, totalUpserted, elapsed)
+		if err != nil {
+			rlog.Printf("retry: sync log %d failed again: %v", id, err)
+			return
+		}
+		rlog.Printf("retry: sync log %d completed (upserted=%d, zeroed=%d, elapsed=%v)", id, upserted, zeroed, time.Since(started))
 	}()
 
-	// Return immediately with 202 Accepted
 	c.JSON(http.StatusAccepted, gin.H{
-		"message":     "Yearly initialization started in background",
-		"fiscal_year": fiscal,
-		"branches":    branches,
+		"message":     "Retry started in background",
+		"retry_of":    id,
+		"sync_type":   entry.SyncType,
+		"branch":      branch,
+		"year_month":  ym,
 		"debt_ym":     debtYM,
+		"fiscal_year": fiscal,
+		"resume_from": resumeFrom,
+		"logs":        syncLogRefs([]string{branch}, logIDs),
 		"started_at":  started.Format(time.RFC3339),
-		"note":        "Monitor progress via sync logs table",
 	})
 }
 
-// pSyncMonthly triggers monthly details sync for specified branches.
-func (s *Server) pSyncMonthly(c *gin.Context) {
+// pSyncCancel aborts a sync running in this API process, identified by log_id or by
+// branch+ym (optionally sync_type). The job's context is canceled: the in-flight Oracle
+// query and open batch transaction roll back, and its log row ends as 'cancelled'.
+func (s *Server) pSyncCancel(c *gin.Context) {
 	var req struct {
-		Branches  []string `json:"branches"`
-		YM        string   `json:"ym"`
-		BatchSize int      `json:"batch_size,omitempty"`
+		LogID    int64  `json:"log_id,omitempty"`
+		Branch   string `json:"branch,omitempty"`
+		YM       string `json:"ym,omitempty"`
+		SyncType string `json:"sync_type,omitempty"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
 		return
 	}
-
-	// Check if sync service is available
-	if s.syncSvc == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sync service not available (Oracle not configured)"})
+	if s.syncSvc == nil || s.syncSvc.LogRepo == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sync service not available"})
 		return
 	}
 
-	branches := req.Branches
-	if len(branches) == 0 {
-		branches = s.cfg.Branches
-	}
-	if len(branches) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "branches are required"})
+	var keys []string
+	switch {
+	case req.LogID > 0:
+		// A run started by this API is bound to its log id; the log's debt_ym may no
+		// longer match the job key once DEBT_YM_FALLBACK_STEPS rewrote it
+		if key, ok := s.syncSvc.Jobs.KeyForLog(req.LogID); ok {
+			keys = []string{key}
+			break
+		}
+		entry, err := s.syncSvc.LogRepo.GetSyncLog(c.Request.Context(), req.LogID)
+		if errors.Is(err, syncsvc.ErrSyncLogNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "sync log not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// Job keys use year_month for monthly_sync and debt_ym for yearly_init
+		for _, ym := range []*string{entry.YearMonth, entry.DebtYM} {
+			if ym != nil {
+				keys = append(keys, syncsvc.JobKey(entry.SyncType, entry.BranchCode, *ym))
+			}
+		}
+	case strings.TrimSpace(req.Branch) != "" && strings.TrimSpace(req.YM) != "":
+		types := []string{"monthly_sync", "yearly_init"}
+		if t := strings.TrimSpace(req.SyncType); t != "" {
+			types = []string{t}
+		}
+		for _, t := range types {
+			keys = append(keys, syncsvc.JobKey(t, strings.TrimSpace(req.Branch), strings.TrimSpace(req.YM)))
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "log_id or branch and ym are required"})
 		return
 	}
 
-	ym := strings.TrimSpace(req.YM)
-	if len(ym) != 6 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ym is required (YYYYMM)"})
+	canceled := s.syncSvc.Jobs.Cancel(keys...)
+	if len(canceled) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no matching sync running in this process", "keys": keys})
 		return
 	}
-	if _, err := strconv.Atoi(ym[:4]); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ym year"})
+	log.Printf("sync cancel: canceled %s", strings.Join(canceled, ", "))
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Cancellation requested; the sync log is set to cancelled once the job stops",
+		"canceled": canceled,
+	})
+}
+
+// gSyncStatus lists the syncs running right now: runs in this API process (live batch
+// progress) plus in_progress log rows written by other processes such as the scheduler.
+func (s *Server) gSyncStatus(c *gin.Context) {
+	if s.syncSvc == nil || s.syncSvc.LogRepo == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sync service not available"})
 		return
 	}
-	if m, err := strconv.Atoi(ym[4:]); err != nil || m < 1 || m > 12 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ym month"})
-		return
+	running := s.syncSvc.Status.Snapshot()
+	local := make(map[int64]bool, len(running))
+	for _, r := range running {
+		if r.LogID != nil {
+			local[*r.LogID] = true
+		}
 	}
 
-	batchSize := req.BatchSize
-	if batchSize <= 0 {
-		batchSize = 100 // default
+	logs, err := s.syncSvc.LogRepo.ListInProgress(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-
-	started := time.Now()
-
-	// Run sync in background to avoid HTTP timeout issues
-	// User can monitor progress via sync logs table
-	go func() {
-		// Use background context instead of request context
-		ctx := context.Background()
-
-		log.Printf("monthly sync: starting background sync for %d branches (ym=%s)", len(branches), ym)
-		totalUpserted := 0
-		totalZeroed := 0
-		failedCount := 0
-
-		// Execute sync for each branch sequentially (one at a time)
-		// This avoids Oracle connection pool exhaustion from concurrent queries
-		for _, branch := range branches {
-			b := strings.TrimSpace(branch)
-			log.Printf("monthly sync: processing branch=%s ym=%s", b, ym)
-			upserted, zeroed, err := s.syncSvc.MonthlyDetails(ctx, ym, b, batchSize, "api")
-			if err != nil {
-				log.Printf("monthly sync: branch=%s ym=%s failed: %v", b, ym, err)
-				failedCount++
-				// Continue with other branches even if one fails
-			} else {
-				log.Printf("monthly sync: branch=%s ym=%s completed (upserted=%d, zeroed=%d)", b, ym, upserted, zeroed)
-				totalUpserted += upserted
-				totalZeroed += zeroed
-			}
+	for _, l := range logs {
+		if local[l.ID] {
+			continue
 		}
+		r := syncsvc.RunStatus{
+			SyncType:    l.SyncType,
+			Branch:      l.BranchCode,
+			TriggeredBy: l.TriggeredBy,
+			LogID:       &l.ID,
+			StartedAt:   l.StartedAt,
+			Batches:     l.ProcessedBatches,
+			Source:      "sync_log",
+		}
+		if l.SyncType == "yearly_init" && l.DebtYM != nil {
+			r.YM = *l.DebtYM
+		} else if l.YearMonth != nil {
+			r.YM = *l.YearMonth
+		}
+		if l.FiscalYear != nil {
+			r.FiscalYear = *l.FiscalYear
+		}
+		if l.RecordsUpserted != nil {
+			r.Upserted = *l.RecordsUpserted
+		}
+		if l.RecordsZeroed != nil {
+			r.Zeroed = *l.RecordsZeroed
+		}
+		running = append(running, r)
+	}
+	sort.Slice(running, func(i, j int) bool { return running[i].StartedAt.Before(running[j].StartedAt) })
 
-		elapsed := time.Since(started)
-		log.Printf("monthly sync: background sync completed (total branches=%d, failed=%d, upserted=%d, zeroed=%d, elapsed=%v)",
-			len(branches), failedCount, totalUpserted, totalZeroed, elapsed)
-	}()
-
-	// Return immediately with 202 Accepted
-	c.JSON(http.StatusAccepted, gin.H{
-		"message":    "Monthly sync started in background",
-		"ym":         ym,
-		"branches":   branches,
-		"started_at": started.Format(time.RFC3339),
-		"note":       "Monitor progress via sync logs table",
-	})
+	c.JSON(http.StatusOK, gin.H{"running": running, "total": len(running)})
 }
 
 // gSyncLogs returns sync operation logs with optional filtering
@@ -653,18 +2013,9 @@ func (s *Server) gSyncLogs(c *gin.Context) {
 	syncType := c.Query("sync_type")
 	status := c.Query("status")
 
-	limit := 50
-	if v := c.Query("limit"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 500 {
-			limit = n
-		}
-	}
-
-	offset := 0
-	if v := c.Query("offset"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
-			offset = n
-		}
+	limit, offset, ok := listLimit(c, s.cfg.Limits.SyncLogs)
+	if !ok {
+		return
 	}
 
 	// Build filter
@@ -687,6 +2038,9 @@ func (s *Server) gSyncLogs(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for i := range logs {
+		setDurationHuman(&logs[i])
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"items":  logs,
@@ -696,14 +2050,40 @@ func (s *Server) gSyncLogs(c *gin.Context) {
 	})
 }
 
-// gConfig returns a read-only snapshot of key configuration values.
+// gSyncLogFacets returns the distinct sync types, statuses, and branches present in sync logs
+// so filter dropdowns can be populated from real data.
+func (s *Server) gSyncLogFacets(c *gin.Context) {
+	if s.syncSvc == nil || s.syncSvc.LogRepo == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sync logs not available"})
+		return
+	}
+
+	facets, err := s.syncSvc.LogRepo.GetSyncLogFacets(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, facets)
+}
+
+// gConfig returns a read-only snapshot of key configuration values and feature flags.
+// Secrets (bot token, DSNs, API key, SMTP password) are never included.
 func (s *Server) gConfig(c *gin.Context) {
-    c.JSON(http.StatusOK, gin.H{
-        "timezone":      s.cfg.Timezone,
-        "cron_yearly":   s.cfg.YearlySpec,
-        "cron_monthly":  s.cfg.MonthlySpec,
-        "branches_count": len(s.cfg.Branches),
-    })
+	c.JSON(http.StatusOK, gin.H{
+		"timezone":            s.cfg.Timezone,
+		"cron_yearly":         s.cfg.YearlySpec,
+		"cron_monthly":        s.cfg.MonthlySpec,
+		"branches_count":      len(s.cfg.Branches),
+		"enable_yearly_init":  s.cfg.EnableYearlyInit,
+		"enable_monthly_sync": s.cfg.EnableMonthlySync,
+		"telegram_enabled":    s.cfg.Telegram.Enabled,
+		// the alert digest is only sent when the job is scheduled and the alert chat is on
+		"alert_enabled":   s.cfg.EnableAlert && s.cfg.Alert.Enabled,
+		"alert_threshold": s.cfg.Alert.Threshold,
+		"cohort_size":     s.cfg.Sync.CohortSize,
+		"backfill_months": s.cfg.Sync.BackfillMonths,
+	})
 }
 
 // pTelegramTest sends a test notification to verify Telegram integration
@@ -728,6 +2108,8 @@ func (s *Server) pTelegramTest(c *gin.Context) {
 		YearlyFailureMsg:  s.cfg.Telegram.YearlyFailureMsg,
 		MonthlySuccessMsg: s.cfg.Telegram.MonthlySuccessMsg,
 		MonthlyFailureMsg: s.cfg.Telegram.MonthlyFailureMsg,
+		SendAttempts:      s.cfg.Telegram.SendAttempts,
+		RetryDelay:        s.cfg.Telegram.RetryDelay,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -735,6 +2117,7 @@ func (s *Server) pTelegramTest(c *gin.Context) {
 		})
 		return
 	}
+	notifier.SetMuteStore(notify.NewMuteStore(s.pg.Pool))
 
 	// Send test message
 	if err := notifier.SendTestMessage(); err != nil {
@@ -756,12 +2139,31 @@ func (s *Server) pAlertTest(c *gin.Context) {
 	var req struct {
 		YM        string  `json:"ym"`
 		Threshold float64 `json:"threshold"`
+		// ThresholdIsFraction treats threshold as a fraction (0.2 = 20%)
+		ThresholdIsFraction bool   `json:"threshold_is_fraction"`
+		Branch              string `json:"branch"`
+		// Direction is decrease (default: ALERT_DIRECTION), increase or both
+		Direction string `json:"direction"`
+		// MinUsage overrides ALERT_MIN_USAGE, the previous-usage floor
+		MinUsage *float64 `json:"min_usage"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		// Allow empty body, use defaults
 		req.YM = ""
 		req.Threshold = 0
+		req.ThresholdIsFraction = false
+		req.Branch = ""
+		req.Direction = ""
+		req.MinUsage = nil
+	}
+	// branch may also be given as a query param
+	branch := strings.TrimSpace(req.Branch)
+	if branch == "" {
+		branch = strings.TrimSpace(c.Query("branch"))
+	}
+	if branch != "" && s.rejectInvalidBranches(c, []string{branch}) {
+		return
 	}
 
 	// Default to current month if not specified
@@ -776,11 +2178,38 @@ func (s *Server) pAlertTest(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ym format, expect YYYYMM"})
 		return
 	}
+	if s.rejectFutureYM(c, ym) {
+		return
+	}
+
+	direction, err := alert.ParseDirection(strings.TrimSpace(req.Direction), s.cfg.Alert.Direction)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Default to config threshold if not specified
+	// Default to config threshold (always a percent) if not specified
 	threshold := req.Threshold
 	if threshold <= 0 {
 		threshold = s.cfg.Alert.Threshold
+	} else {
+		if threshold, err = alert.NormalizeThreshold(threshold, req.ThresholdIsFraction); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	opts := s.alertOptions()
+	if req.MinUsage != nil {
+		if *req.MinUsage < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_usage must be >= 0"})
+			return
+		}
+		if opts.Mode == alert.ModeCohortMedian {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_usage applies to ALERT_MODE=pct_drop only"})
+			return
+		}
+		opts.MinUsage = *req.MinUsage
 	}
 
 	// Create alert service
@@ -790,14 +2219,24 @@ func (s *Server) pAlertTest(c *gin.Context) {
 		s.cfg.Alert.ChatID,
 		threshold,
 		s.cfg.Alert.Link,
+		opts,
 	)
 
-	// Calculate alerts
-	stats, err := alertService.CalculateAlerts(c.Request.Context(), ym, threshold)
+	// Calculate alerts (single branch when requested)
+	var stats *alert.AlertStats
+	if branch != "" {
+		stats, err = alertService.CalculateBranchAlerts(c.Request.Context(), ym, threshold, direction, branch)
+	} else {
+		stats, err = alertService.CalculateAlerts(c.Request.Context(), ym, threshold, direction)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// Only all-branch runs go into the alert history; a single-branch run would skew the totals
+	if branch == "" {
+		alertService.RecordRun(c.Request.Context(), stats)
+	}
 
 	// Send notification if enabled
 	if s.cfg.Alert.Enabled {
@@ -809,16 +2248,24 @@ func (s *Server) pAlertTest(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"message":               "Alert calculated and sent successfully",
 		"ym":                    stats.YM,
 		"prev_ym":               stats.PrevYM,
 		"threshold":             stats.Threshold,
+		"threshold_unit":        "percent",
+		"direction":             stats.Direction,
 		"total_branches":        stats.TotalBranches,
 		"branches_with_alerts":  stats.BranchesWithAlerts,
 		"total_customers":       stats.TotalCustomers,
+		"branch":                branch,
 		"notification_enabled":  s.cfg.Alert.Enabled,
-	})
+	}
+	// cohort_median ignores the usage floor, so only report it when it was applied
+	if stats.Mode != alert.ModeCohortMedian {
+		resp["min_usage"] = stats.MinUsage
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // helpers
@@ -865,13 +2312,21 @@ func parseFiscalOrYM(fiscal string, ym string) (int, error) {
 	return y, nil
 }
 
-func parseLimitOffset(limStr, offStr string) (int, int) {
+// defaultMaxLimit caps list endpoints without their own *_MAX_LIMIT setting
+const defaultMaxLimit = 500
+
+// limitAll is the ?limit sentinel export endpoints accept for every row
+const limitAll = "all"
+
+// parseLimitOffset reads limit (default 50, capped at maxLimit) and offset; invalid
+// values fall back to the defaults.
+func parseLimitOffset(limStr, offStr string, maxLimit int) (int, int) {
 	limit := 50
 	offset := 0
 	if limStr != "" {
 		if n, err := strconv.Atoi(limStr); err == nil && n > 0 {
-			if n > 500 {
-				n = 500
+			if n > maxLimit {
+				n = maxLimit
 			}
 			limit = n
 		}
@@ -884,6 +2339,94 @@ func parseLimitOffset(limStr, offStr string) (int, int) {
 	return limit, offset
 }
 
+// listLimit parses ?limit/?offset of an interactive list capped at maxLimit. limit=all
+// is reserved for exports; it writes 400 and returns false.
+func listLimit(c *gin.Context, maxLimit int) (int, int, bool) {
+	if strings.EqualFold(strings.TrimSpace(c.Query("limit")), limitAll) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit=all is only supported on export endpoints"})
+		return 0, 0, false
+	}
+	limit, offset := parseLimitOffset(c.Query("limit"), c.Query("offset"), maxLimit)
+	return limit, offset, true
+}
+
+// exportLimit parses the optional ?limit/?offset of an export. No limit or limit=all
+// exports every row (limit 0) unless maxLimit > 0 (EXPORT_MAX_LIMIT) caps it.
+func exportLimit(c *gin.Context, maxLimit int) (int, int) {
+	_, offset := parseLimitOffset("", c.Query("offset"), defaultMaxLimit)
+	limit := 0
+	if l := strings.TrimSpace(c.Query("limit")); l != "" && !strings.EqualFold(l, limitAll) {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	if maxLimit > 0 && (limit == 0 || limit > maxLimit) {
+		limit = maxLimit
+	}
+	return limit, offset
+}
+
+// limitOffsetSQL renders the LIMIT/OFFSET of an export; limit 0 means every row
+func limitOffsetSQL(limit, offset int) string {
+	if limit <= 0 {
+		return fmt.Sprintf(" OFFSET %d", offset)
+	}
+	return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+}
+
+// maxMonthRange bounds gap-filled series so a typo in from/to cannot build a huge response.
+const maxMonthRange = 240
+
+// monthRange lists every YYYYMM from..to inclusive.
+func monthRange(from, to string) ([]string, error) {
+	fy, fm, err := parseYM(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from: %w", err)
+	}
+	ty, tm, err := parseYM(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to: %w", err)
+	}
+	start, end := fy*12+fm-1, ty*12+tm-1
+	if end < start {
+		return nil, fmt.Errorf("from must not be after to")
+	}
+	if end-start+1 > maxMonthRange {
+		return nil, fmt.Errorf("range too large (max %d months)", maxMonthRange)
+	}
+	out := make([]string, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		out = append(out, fmt.Sprintf("%04d%02d", i/12, i%12+1))
+	}
+	return out, nil
+}
+
+// parseYM splits a YYYYMM string into year and month.
+func parseYM(ym string) (int, int, error) {
+	if len(ym) != 6 {
+		return 0, 0, fmt.Errorf("expect YYYYMM")
+	}
+	y, err := strconv.Atoi(ym[:4])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid year")
+	}
+	m, err := strconv.Atoi(ym[4:])
+	if err != nil || m < 1 || m > 12 {
+		return 0, 0, fmt.Errorf("invalid month")
+	}
+	return y, m, nil
+}
+
+// addMonths shifts a YYYYMM value by n months (negative goes back).
+func addMonths(ym string, n int) (string, error) {
+	y, m, err := parseYM(ym)
+	if err != nil {
+		return "", err
+	}
+	i := y*12 + m - 1 + n
+	return fmt.Sprintf("%04d%02d", i/12, i%12+1), nil
+}
+
 func fiscalYearFromYM(ym string) int {
 	// ym format: YYYYMM (e.g., "202410" for October 2024)
 	// Fiscal year: Oct-Dec (months 10-12) = year+1, Jan-Sep (months 1-9) = year
@@ -928,25 +2471,6 @@ func multiValues(q map[string][]string, key string) []string {
 
 // Helper functions for date conversion (from cmd/sync/main.go)
 
-// normalizeGregorianYM converts a YYYYMM to Gregorian if it's Thai Buddhist calendar
-func normalizeGregorianYM(ym string) (string, error) {
-	if len(ym) != 6 {
-		return "", fmt.Errorf("invalid ym; expect YYYYMM")
-	}
-	y, err := strconv.Atoi(ym[:4])
-	if err != nil {
-		return "", fmt.Errorf("invalid ym year")
-	}
-	m, err := strconv.Atoi(ym[4:])
-	if err != nil || m < 1 || m > 12 {
-		return "", fmt.Errorf("invalid ym month")
-	}
-	if y >= 2400 { // Thai -> convert to Gregorian
-		y -= 543
-	}
-	return fmt.Sprintf("%04d%02d", y, m), nil
-}
-
 // toThaiYM converts a Gregorian YYYYMM to Thai (Buddhist) YYYYMM by adding 543 to the year
 func toThaiYM(ym string) (string, error) {
 	if len(ym) != 6 {
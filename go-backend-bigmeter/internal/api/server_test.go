@@ -0,0 +1,450 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go-backend-bigmeter/internal/config"
+	dbpkg "go-backend-bigmeter/internal/database"
+	"go-backend-bigmeter/internal/database/dbtest"
+	syncsvc "go-backend-bigmeter/internal/sync"
+)
+
+// testAPIKey is the API_KEY of testConfig; serve sends it on every request
+const testAPIKey = "test-key"
+
+// testConfig is a config with the defaults Load would give for the settings the
+// handlers read
+func testConfig() config.Config {
+	return config.Config{
+		Timezone:        "Asia/Bangkok",
+		APIKey:          testAPIKey,
+		JSONNulls:       "omit",
+		MaxFutureMonths: 1,
+		BranchNameOrder: []string{"alias", "name", "code"},
+		Limits:          config.LimitsConfig{Details: 500, Custcodes: 500, SyncLogs: 500},
+		Sync:            config.SyncConfig{CohortSize: 200},
+	}
+}
+
+// newTestServer returns a server on a fresh test database (see dbtest.Postgres); the
+// Oracle handle is a stub, enough for the sync service's log and job registry.
+func newTestServer(t *testing.T, cfg config.Config) (*Server, *dbpkg.Postgres) {
+	t.Helper()
+	pg := dbtest.Postgres(t)
+	return NewServer(cfg, pg, &dbpkg.Oracle{}), pg
+}
+
+// newSyncTestServer is newTestServer with a fake Oracle that answers every query with no
+// rows, for handlers that start a sync in the background. The working directory is the
+// module root, where the sqls/ templates are read.
+func newSyncTestServer(t *testing.T, cfg config.Config) (*Server, *dbpkg.Postgres) {
+	t.Helper()
+	pg := dbtest.Postgres(t)
+	t.Chdir(dbtest.ModuleRoot(t))
+	ora, _ := dbtest.Oracle(t, nil)
+	return NewServer(cfg, pg, ora), pg
+}
+
+// waitJobs blocks until the background jobs holding keys have released them
+func waitJobs(t *testing.T, s *Server, keys ...string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for len(s.syncSvc.Jobs.TryAcquire(keys...)) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("jobs %v still running", keys)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.syncSvc.Jobs.Release(keys...)
+}
+
+// seed runs setup statements against the test database
+func seed(t *testing.T, pg *dbpkg.Postgres, stmts ...string) {
+	t.Helper()
+	for _, stmt := range stmts {
+		if _, err := pg.Pool.Exec(context.Background(), stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+}
+
+// serve sends a request through the router with the test API key; body, when not nil,
+// is sent as JSON
+func serve(t *testing.T, s *Server, method, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-API-Key", testAPIKey)
+	w := httptest.NewRecorder()
+	s.Router().ServeHTTP(w, req)
+	return w
+}
+
+// decode unmarshals a JSON response, failing the test on a non-200 status
+func decode(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+}
+
+func TestSyncLogFacets(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+		want map[string][]string
+	}{
+		{
+			name: "empty",
+			want: map[string][]string{"sync_types": {}, "statuses": {}, "branches": {}},
+		},
+		{
+			name: "seeded",
+			rows: []string{
+				`('yearly_init', 'BA02', 'success', now())`,
+				`('monthly_sync', 'BA01', 'error', now())`,
+				`('monthly_sync', 'BA01', 'success', now())`,
+				`('monthly_sync', 'BA03', 'in_progress', now())`,
+			},
+			want: map[string][]string{
+				"sync_types": {"monthly_sync", "yearly_init"},
+				"statuses":   {"error", "in_progress", "success"},
+				"branches":   {"BA01", "BA02", "BA03"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestServer(t, testConfig())
+			for _, r := range tt.rows {
+				seed(t, pg, `INSERT INTO bm_sync_logs (sync_type, branch_code, status, started_at) VALUES `+r)
+			}
+			var got map[string][]string
+			decode(t, serve(t, s, http.MethodGet, "/api/v1/sync/logs/facets", nil), &got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("facets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustcodeSeriesFillGaps(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantYMs     []string
+		wantMissing []bool
+	}{
+		{name: "sparse", query: "", wantYMs: []string{"202410", "202412"}, wantMissing: []bool{false, false}},
+		{name: "gap filled", query: "&fill_gaps=1", wantYMs: []string{"202410", "202411", "202412"}, wantMissing: []bool{false, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestServer(t, testConfig())
+			seed(t, pg, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg, present_meter_count)
+			             VALUES (2025, '202410', 'BA01', 'C001', 10, 100), (2025, '202412', 'BA01', 'C001', 12, 122)`)
+			var resp struct {
+				Series []struct {
+					YM              string   `json:"ym"`
+					PresentWaterUsg *float64 `json:"present_water_usg"`
+					Missing         bool     `json:"missing"`
+				} `json:"series"`
+			}
+			decode(t, serve(t, s, http.MethodGet, "/api/v1/custcodes/C001/details?branch=BA01&from=202410&to=202412"+tt.query, nil), &resp)
+			if len(resp.Series) != len(tt.wantYMs) {
+				t.Fatalf("got %d months, want %d: %+v", len(resp.Series), len(tt.wantYMs), resp.Series)
+			}
+			for i, p := range resp.Series {
+				if p.YM != tt.wantYMs[i] || p.Missing != tt.wantMissing[i] {
+					t.Errorf("month %d = %s missing=%t, want %s missing=%t", i, p.YM, p.Missing, tt.wantYMs[i], tt.wantMissing[i])
+				}
+				if p.Missing != (p.PresentWaterUsg == nil) {
+					t.Errorf("month %s: missing=%t but present_water_usg=%v", p.YM, p.Missing, p.PresentWaterUsg)
+				}
+			}
+		})
+	}
+}
+
+func TestMonthRange(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     []string
+		wantErr  bool
+	}{
+		{from: "202410", to: "202410", want: []string{"202410"}},
+		{from: "202411", to: "202502", want: []string{"202411", "202412", "202501", "202502"}},
+		{from: "202502", to: "202410", wantErr: true},
+		{from: "2024", to: "202410", wantErr: true},
+		{from: "200001", to: "202501", wantErr: true}, // over maxMonthRange
+	}
+	for _, tt := range tests {
+		got, err := monthRange(tt.from, tt.to)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("monthRange(%s, %s) error = %v, wantErr %t", tt.from, tt.to, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("monthRange(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPBasePath(t *testing.T) {
+	tests := []struct {
+		basePath string
+		target   string
+		want     int
+	}{
+		{basePath: "", target: "/api/v1/livez", want: http.StatusOK},
+		{basePath: "", target: "/metrics", want: http.StatusOK},
+		{basePath: "/bigmeter", target: "/bigmeter/api/v1/livez", want: http.StatusOK},
+		{basePath: "/bigmeter", target: "/bigmeter/api/v1/version", want: http.StatusOK},
+		{basePath: "/bigmeter", target: "/bigmeter/metrics", want: http.StatusOK},
+		{basePath: "/bigmeter", target: "/api/v1/livez", want: http.StatusNotFound},
+		{basePath: "/bigmeter", target: "/metrics", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.HTTPBasePath = tt.basePath
+		s := NewServer(cfg, nil, nil)
+		if w := serve(t, s, http.MethodGet, tt.target, nil); w.Code != tt.want {
+			t.Errorf("base %q GET %s: status %d, want %d", tt.basePath, tt.target, w.Code, tt.want)
+		}
+	}
+}
+
+// flakyReadPool returns a pool on the same database as pg whose first dial fails with
+// a connection error, like a read during a Postgres restart
+func flakyReadPool(t *testing.T, pg *dbpkg.Postgres, retries int) *dbpkg.Postgres {
+	t.Helper()
+	cfg := pg.Pool.Config()
+	var dialed atomic.Int32
+	var d net.Dialer
+	cfg.ConnConfig.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if dialed.Add(1) == 1 {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("connection refused")}
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return &dbpkg.Postgres{Pool: pool, ReadRetries: retries}
+}
+
+func TestReadRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		retries int
+		want    int
+	}{
+		{name: "retried", retries: 2, want: http.StatusOK},
+		{name: "retries disabled", retries: 0, want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestServer(t, testConfig())
+			s.UseReadReplica(flakyReadPool(t, pg, tt.retries))
+			if w := serve(t, s, http.MethodGet, "/api/v1/reconcile?ym=202410", nil); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTriggerLimiter(t *testing.T) {
+	tests := []struct {
+		name     string
+		cooldown time.Duration
+		record   []string
+		check    []string
+		wantWait bool
+	}{
+		{name: "not recorded", cooldown: time.Minute, check: []string{"BA01"}},
+		{name: "same branches", cooldown: time.Minute, record: []string{"BA01", "BA02"}, check: []string{"BA01", "BA02"}, wantWait: true},
+		{name: "order and spaces ignored", cooldown: time.Minute, record: []string{"BA01", "BA02"}, check: []string{" BA02", "BA01"}, wantWait: true},
+		{name: "other branch set", cooldown: time.Minute, record: []string{"BA01", "BA02"}, check: []string{"BA01"}},
+		{name: "cooldown disabled", cooldown: 0, record: []string{"BA01"}, check: []string{"BA01"}},
+	}
+	for _, tt := range tests {
+		l := newTriggerLimiter(tt.cooldown)
+		if tt.record != nil {
+			l.record("sync/monthly", tt.record)
+		}
+		wait := l.wait("sync/monthly", tt.check)
+		if (wait > 0) != tt.wantWait || wait > tt.cooldown {
+			t.Errorf("%s: wait = %v, want waiting=%t within %v", tt.name, wait, tt.wantWait, tt.cooldown)
+		}
+		if got := l.wait("sync/init", tt.check); got != 0 {
+			t.Errorf("%s: other endpoint wait = %v, want 0", tt.name, got)
+		}
+	}
+}
+
+func TestSyncTriggerCooldown(t *testing.T) {
+	tests := []struct {
+		name     string
+		busy     bool // BA01's job is already held when the first trigger arrives
+		wantCode []int
+	}{
+		{name: "repeat within cooldown", wantCode: []int{http.StatusAccepted, http.StatusTooManyRequests}},
+		{name: "rejected trigger does not start the cooldown", busy: true, wantCode: []int{http.StatusConflict, http.StatusAccepted}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.SyncTriggerCooldown = time.Minute
+			s, _ := newSyncTestServer(t, cfg)
+			key := syncsvc.JobKey("monthly_sync", "BA01", "202410")
+			if tt.busy {
+				s.syncSvc.Jobs.TryAcquire(key)
+			}
+			body := map[string]any{"branches": []string{"BA01"}, "ym": "202410", "force": true}
+
+			for i, want := range tt.wantCode {
+				w := serve(t, s, http.MethodPost, "/api/v1/sync/monthly", body)
+				if w.Code != want {
+					t.Fatalf("trigger %d: status %d, want %d: %s", i+1, w.Code, want, w.Body.String())
+				}
+				if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+					t.Errorf("trigger %d: 429 without Retry-After", i+1)
+				}
+				if tt.busy && i == 0 {
+					s.syncSvc.Jobs.Release(key)
+				}
+				if want == http.StatusAccepted {
+					waitJobs(t, s, key)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncBranchCodePattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		branch   string
+		wantCode int
+	}{
+		{name: "conforming", branch: "BA01", wantCode: http.StatusAccepted},
+		{name: "wrong length", branch: "BA001", wantCode: http.StatusBadRequest},
+		{name: "inner space", branch: "BA 1", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.BranchCodePattern = regexp.MustCompile(`^(?:BA\d{2})$`)
+			s, _ := newSyncTestServer(t, cfg)
+			body := map[string]any{"branches": []string{tt.branch}, "ym": "202410", "force": true}
+
+			w := serve(t, s, http.MethodPost, "/api/v1/sync/monthly", body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode == http.StatusAccepted {
+				waitJobs(t, s, syncsvc.JobKey("monthly_sync", "BA01", "202410"))
+			} else if !strings.Contains(w.Body.String(), "BRANCH_CODE_PATTERN") {
+				t.Errorf("error does not name BRANCH_CODE_PATTERN: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestReadReplica(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{name: "branches", target: "/api/v1/branches"},
+		{name: "details", target: "/api/v1/details?ym=202410&branch=BA01"},
+		{name: "custcodes", target: "/api/v1/custcodes?ym=202410&branch=BA01"},
+		{name: "details summary", target: "/api/v1/details/summary?ym=202410&branch=BA01"},
+	}
+	// the primary is left empty, so any row in a response came from the replica
+	s, primary := newTestServer(t, testConfig())
+	replica := dbtest.Postgres(t)
+	seed(t, replica,
+		`INSERT INTO bm_branches (code, name) VALUES ('BA01', 'Replica branch')`,
+		`INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code, debt_ym) VALUES (2025, 'BA01', 'R001', '256710')`,
+		`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, present_water_usg, present_meter_count)
+		 VALUES (2025, '202410', 'BA01', 'R001', 10, 100)`)
+	s.UseReadReplica(replica)
+	if s.syncSvc.Postgres != primary {
+		t.Error("sync service does not write to the primary")
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Items []map[string]any `json:"items"`
+				Total int              `json:"total"`
+			}
+			decode(t, serve(t, s, http.MethodGet, tt.target, nil), &resp)
+			if resp.Total != 1 {
+				t.Errorf("total = %d, want 1 from the replica", resp.Total)
+			}
+		})
+	}
+}
+
+func TestSyncMonthlyFutureYM(t *testing.T) {
+	now := time.Now().In(time.FixedZone("ICT", 7*3600))
+	current := now.Format("200601")
+	next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()).Format("200601")
+	tests := []struct {
+		name  string
+		ym    string
+		query string
+		body  map[string]any
+		want  int
+	}{
+		{name: "current month", ym: current, want: http.StatusAccepted},
+		{name: "next month rejected", ym: next, want: http.StatusBadRequest},
+		{name: "next month with allow_future body", ym: next, body: map[string]any{"allow_future": true}, want: http.StatusAccepted},
+		{name: "next month with allow_future query", ym: next, query: "?allow_future=true", want: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newSyncTestServer(t, testConfig())
+			body := map[string]any{"branches": []string{"BA01"}, "ym": tt.ym, "force": true}
+			for k, v := range tt.body {
+				body[k] = v
+			}
+			w := serve(t, s, http.MethodPost, "/api/v1/sync/monthly"+tt.query, body)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if w.Code == http.StatusAccepted {
+				waitJobs(t, s, syncsvc.JobKey("monthly_sync", "BA01", tt.ym))
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// summaryCacheMaxEntries bounds the cache; at the cap, expired entries are swept and
+// then the entry closest to expiry is evicted.
+const summaryCacheMaxEntries = 1000
+
+// summaryCache keeps summary/overview responses for past months in memory for
+// SUMMARY_CACHE_TTL. Historical months only change when a sync rewrites them, so
+// API-triggered syncs invalidate the branch+ym they touch, and a hit is dropped when
+// bm_sync_logs shows a sync of its branch finished since it was computed (scheduler
+// runs happen in a separate process).
+type summaryCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]summaryCacheEntry
+}
+
+type summaryCacheEntry struct {
+	body     any
+	branch   string // "" for all-branch responses
+	from, to string // YYYYMM range the response covers
+	// asOf is when the request that computed the response started
+	asOf    time.Time
+	expires time.Time
+}
+
+func newSummaryCache(ttl time.Duration) *summaryCache {
+	return &summaryCache{ttl: ttl, entries: map[string]summaryCacheEntry{}}
+}
+
+func (sc *summaryCache) get(key string) (summaryCacheEntry, bool) {
+	if sc == nil || sc.ttl <= 0 {
+		return summaryCacheEntry{}, false
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	e, ok := sc.entries[key]
+	if !ok {
+		return summaryCacheEntry{}, false
+	}
+	if time.Now().After(e.expires) {
+		delete(sc.entries, key)
+		return summaryCacheEntry{}, false
+	}
+	return e, true
+}
+
+// drop removes the entry cached under key
+func (sc *summaryCache) drop(key string) {
+	if sc == nil {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.entries, key)
+}
+
+// set caches body under key; asOf is when its computation started (zero means now).
+func (sc *summaryCache) set(key, branch, from, to string, asOf time.Time, body any) {
+	if sc == nil || sc.ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if _, ok := sc.entries[key]; !ok && len(sc.entries) >= summaryCacheMaxEntries {
+		sc.evict(now)
+	}
+	if asOf.IsZero() {
+		asOf = now
+	}
+	sc.entries[key] = summaryCacheEntry{body: body, branch: branch, from: from, to: to, asOf: asOf, expires: now.Add(sc.ttl)}
+}
+
+// evict drops the expired entries, or the one closest to expiry when none has
+// expired; sc.mu must be held.
+func (sc *summaryCache) evict(now time.Time) {
+	var oldest string
+	var oldestAt time.Time
+	for key, e := range sc.entries {
+		if now.After(e.expires) {
+			delete(sc.entries, key)
+			continue
+		}
+		if oldest == "" || e.expires.Before(oldestAt) {
+			oldest, oldestAt = key, e.expires
+		}
+	}
+	if len(sc.entries) >= summaryCacheMaxEntries {
+		delete(sc.entries, oldest)
+	}
+}
+
+// invalidate drops every response covering ym for branch, including all-branch
+// responses. An empty ym drops every month of the branch (e.g. after a yearly init).
+func (sc *summaryCache) invalidate(branch, ym string) {
+	if sc == nil {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for key, e := range sc.entries {
+		if e.branch != "" && e.branch != branch {
+			continue
+		}
+		if ym == "" || (e.from <= ym && ym <= e.to) {
+			delete(sc.entries, key)
+		}
+	}
+}
+
+// summaryCacheKey identifies a response by endpoint and the parsed parameters it was
+// computed from, so unrelated or reordered query parameters share one entry and
+// cannot grow the cache.
+func summaryCacheKey(endpoint string, params ...string) string {
+	return endpoint + "|" + strings.Join(params, "|")
+}
+
+// summaryAsOfKey holds, on a cache miss, when the handler started computing the
+// response (see respondSummary)
+const summaryAsOfKey = "summary_as_of"
+
+// serveCachedSummary writes the response cached under key and returns true on a hit.
+// An entry whose branch (any branch for an all-branch response) finished a sync since
+// it was computed is dropped instead: syncs of the scheduler process do not reach
+// invalidate, and yearly inits and backfills rewrite exactly the cached past months.
+func (s *Server) serveCachedSummary(c *gin.Context, key string) bool {
+	c.Set(summaryAsOfKey, time.Now())
+	e, ok := s.summaries.get(key)
+	if !ok {
+		return false
+	}
+	if s.syncedSince(c.Request.Context(), e.branch, e.asOf) {
+		s.summaries.drop(key)
+		return false
+	}
+	c.Header("X-Cache", "HIT")
+	c.JSON(http.StatusOK, e.body)
+	return true
+}
+
+// syncedSince reports whether bm_sync_logs has a sync of branch ("" for any) that
+// finished at or after t. A failed lookup counts as a sync, so the response is
+// recomputed rather than served stale.
+func (s *Server) syncedSince(ctx context.Context, branch string, t time.Time) bool {
+	var synced bool
+	if err := s.pg.Pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM bm_sync_logs WHERE finished_at >= $1 AND ($2 = '' OR branch_code = $2))`,
+		t, branch).Scan(&synced); err != nil {
+		log.Printf("summary cache: sync log lookup failed, recomputing: %v", err)
+		return true
+	}
+	return synced
+}
+
+// respondSummary sends a 200 response and caches it under key, unless its months
+// reach the current month (in TIMEZONE), whose data still changes.
+func (s *Server) respondSummary(c *gin.Context, key, branch, from, to string, body any) {
+	if to < s.currentYM() {
+		s.summaries.set(key, branch, from, to, c.GetTime(summaryAsOfKey), body)
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// currentYM is the current Gregorian YYYYMM in TIMEZONE.
+func (s *Server) currentYM() string {
+	loc, err := time.LoadLocation(s.cfg.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	now := time.Now().In(loc)
+	return fmt.Sprintf("%04d%02d", now.Year(), int(now.Month()))
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSummaryCacheEvict(t *testing.T) {
+	sc := newSummaryCache(time.Hour)
+	for i := 0; i < summaryCacheMaxEntries; i++ {
+		sc.set(summaryCacheKey("summary", fmt.Sprint(i)), "", "202401", "202401", time.Time{}, i)
+	}
+	// entry i expires i seconds after entry 0; entry 5 has already expired
+	base := time.Now().Add(time.Hour - time.Minute)
+	sc.mu.Lock()
+	for i := 0; i < summaryCacheMaxEntries; i++ {
+		key := summaryCacheKey("summary", fmt.Sprint(i))
+		e := sc.entries[key]
+		e.expires = base.Add(time.Duration(i) * time.Second)
+		if i == 5 {
+			e.expires = time.Now().Add(-time.Second)
+		}
+		sc.entries[key] = e
+	}
+	sc.mu.Unlock()
+
+	// at the cap, the expired entry makes room
+	sc.set(summaryCacheKey("summary", "new"), "", "202401", "202401", time.Time{}, "new")
+	if _, ok := sc.get(summaryCacheKey("summary", "new")); !ok {
+		t.Error("new entry not cached")
+	}
+	if _, ok := sc.get(summaryCacheKey("summary", "0")); !ok {
+		t.Error("live entry evicted while an expired one was available")
+	}
+	// with nothing expired, the oldest entry goes
+	sc.set(summaryCacheKey("summary", "newer"), "", "202401", "202401", time.Time{}, "newer")
+	if _, ok := sc.get(summaryCacheKey("summary", "0")); ok {
+		t.Error("oldest entry kept past the cap")
+	}
+	if n := len(sc.entries); n != summaryCacheMaxEntries {
+		t.Errorf("entries = %d, want %d", n, summaryCacheMaxEntries)
+	}
+}
+
+func TestSummaryCache(t *testing.T) {
+	current := time.Now().In(time.FixedZone("ICT", 7*3600)).Format("200601")
+	tests := []struct {
+		name      string
+		ym        string
+		second    string // query of the repeated request
+		wantCache bool
+	}{
+		{name: "past month", ym: "202410", second: "branch=BA01&ym=202410", wantCache: true},
+		{name: "other params share the entry", ym: "202410", second: "ym=202410&branch=BA01&page=2", wantCache: true},
+		{name: "current month", ym: current, second: "branch=BA01&ym=" + current},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.SummaryCacheTTL = time.Minute
+			s, pg := newTestServer(t, cfg)
+			row := func(cust string) string {
+				return fmt.Sprintf(`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, org_name, present_water_usg, present_meter_count)
+				                    VALUES (2025, '%s', 'BA01', '%s', 'Org', 10, 100)`, tt.ym, cust)
+			}
+			seed(t, pg, row("C001"))
+			type summary struct {
+				Total int `json:"total"`
+			}
+			var first summary
+			decode(t, serve(t, s, http.MethodGet, "/api/v1/details/summary?ym="+tt.ym+"&branch=BA01", nil), &first)
+
+			// a cached response does not see the new row: no query was made
+			seed(t, pg, row("C002"))
+			w := serve(t, s, http.MethodGet, "/api/v1/details/summary?"+tt.second, nil)
+			var second summary
+			decode(t, w, &second)
+			if hit := w.Header().Get("X-Cache") == "HIT"; hit != tt.wantCache {
+				t.Errorf("X-Cache HIT = %t, want %t", hit, tt.wantCache)
+			}
+			wantTotal := 2
+			if tt.wantCache {
+				wantTotal = first.Total
+			}
+			if first.Total != 1 || second.Total != wantTotal {
+				t.Errorf("totals %d then %d, want 1 then %d", first.Total, second.Total, wantTotal)
+			}
+		})
+	}
+}
+
+// TestSummaryCacheSyncedSince: a sync finished by another process (the scheduler never
+// calls invalidate) drops the cached responses of its branch and the all-branch ones
+func TestSummaryCacheSyncedSince(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		logBranch string // branch of the sync log finished after caching; "" none
+		wantCache bool
+	}{
+		{name: "no sync", target: "/api/v1/details/summary?ym=202410&branch=BA01", wantCache: true},
+		{name: "branch synced", target: "/api/v1/details/summary?ym=202410&branch=BA01", logBranch: "BA01"},
+		{name: "other branch synced", target: "/api/v1/details/summary?ym=202410&branch=BA01", logBranch: "BA02", wantCache: true},
+		{name: "all branches, one synced", target: "/api/v1/summary?ym=202410", logBranch: "BA02"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.SummaryCacheTTL = time.Hour
+			s, pg := newTestServer(t, cfg)
+			seed(t, pg,
+				`INSERT INTO bm_sync_logs (sync_type, branch_code, status, started_at, finished_at)
+				 VALUES ('monthly_sync', 'BA01', 'success', now() - interval '1 hour', now() - interval '50 minutes')`,
+				`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, org_name, present_water_usg)
+				 VALUES (2025, '202410', 'BA01', 'C001', 'Org', 10)`)
+			// /details/summary has total, /summary grand_total.total
+			type summary struct {
+				Total      int `json:"total"`
+				GrandTotal struct {
+					Total int `json:"total"`
+				} `json:"grand_total"`
+			}
+			var first summary
+			decode(t, serve(t, s, http.MethodGet, tt.target, nil), &first)
+
+			// the scheduler's backfill rewrites the month and logs its run
+			seed(t, pg, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, org_name, present_water_usg)
+			             VALUES (2025, '202410', 'BA01', 'C002', 'Org', 10)`)
+			if tt.logBranch != "" {
+				seed(t, pg, fmt.Sprintf(`INSERT INTO bm_sync_logs (sync_type, branch_code, status, started_at, finished_at, triggered_by)
+				                         VALUES ('monthly_sync', '%s', 'success', now(), now(), 'scheduler')`, tt.logBranch))
+			}
+			w := serve(t, s, http.MethodGet, tt.target, nil)
+			if hit := w.Header().Get("X-Cache") == "HIT"; hit != tt.wantCache {
+				t.Errorf("X-Cache HIT = %t, want %t", hit, tt.wantCache)
+			}
+			if !tt.wantCache {
+				var second summary
+				decode(t, w, &second)
+				before, after := first.Total+first.GrandTotal.Total, second.Total+second.GrandTotal.Total
+				if after <= before {
+					t.Errorf("total %d after the sync, want more than %d", after, before)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	syncsvc "go-backend-bigmeter/internal/sync"
+)
+
+// A yearly init acquired under debt_ym 256710 can still be cancelled by log id after
+// DEBT_YM_FALLBACK_STEPS rewrote the log's debt_ym to 256709
+func TestSyncCancelByLogID(t *testing.T) {
+	tests := []struct {
+		name       string
+		bind       bool
+		rewrite    bool
+		wantStatus int
+	}{
+		{name: "derived from the log", wantStatus: http.StatusAccepted},
+		{name: "bound, debt_ym rewritten", bind: true, rewrite: true, wantStatus: http.StatusAccepted},
+		{name: "unbound, debt_ym rewritten", rewrite: true, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, testConfig())
+			ctx := context.Background()
+			key := syncsvc.JobKey("yearly_init", "BA01", "256710")
+			if busy := s.syncSvc.Jobs.TryAcquire(key); len(busy) != 0 {
+				t.Fatalf("acquire: busy %v", busy)
+			}
+			t.Cleanup(func() { s.syncSvc.Jobs.Release(key) })
+
+			debtYM, fiscal := "256710", 2025
+			id, err := s.syncSvc.LogRepo.RecordSyncStart(ctx, "yearly_init", "BA01", "api", nil, &debtYM, &fiscal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.bind {
+				s.syncSvc.Jobs.BindLog(key, id)
+			}
+			if tt.rewrite {
+				if err := s.syncSvc.LogRepo.UpdateSyncDebtYM(ctx, id, "256709"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := serve(t, s, http.MethodPost, "/api/v1/sync/cancel", map[string]any{"log_id": id})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusAccepted {
+				return
+			}
+			var body struct {
+				Canceled []string `json:"canceled"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Canceled) != 1 || body.Canceled[0] != key {
+				t.Errorf("canceled = %v, want [%s]", body.Canceled, key)
+			}
+		})
+	}
+}
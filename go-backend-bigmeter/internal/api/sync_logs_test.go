@@ -0,0 +1,32 @@
+package api
+
+import (
+	"testing"
+
+	syncsvc "go-backend-bigmeter/internal/sync"
+)
+
+func TestSetDurationHuman(t *testing.T) {
+	ms := func(v int) *int { return &v }
+	tests := []struct {
+		durationMs *int
+		want       string
+	}{
+		{durationMs: nil, want: ""},
+		{durationMs: ms(850), want: "850ms"},
+		{durationMs: ms(12400), want: "12.4s"},
+		{durationMs: ms(78000), want: "1.3m"},
+		{durationMs: ms(7200000), want: "2.0h"},
+	}
+	for _, tt := range tests {
+		l := &syncsvc.SyncLog{DurationMs: tt.durationMs}
+		setDurationHuman(l)
+		if l.DurationHuman != tt.want {
+			var in any
+			if tt.durationMs != nil {
+				in = *tt.durationMs
+			}
+			t.Errorf("duration_ms %v: duration_human = %q, want %q", in, l.DurationHuman, tt.want)
+		}
+	}
+}
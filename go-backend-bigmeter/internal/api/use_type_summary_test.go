@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDetailsSummaryByUseType(t *testing.T) {
+	s, pg := newTestServer(t, testConfig())
+	seed(t, pg,
+		`INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code, use_type, debt_ym) VALUES
+		 (2025, 'BA01', 'C003', '21', '256710')`,
+		`INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code, use_type, org_name, present_water_usg, present_meter_count) VALUES
+		 (2025, '202410', 'BA01', 'C001', '11', 'Org', 10, 100),
+		 (2025, '202410', 'BA01', 'C002', '11', '', 0, 0),
+		 (2025, '202410', 'BA01', 'C003', '', 'Org', 5, 50),
+		 (2025, '202410', 'BA01', 'C004', NULL, '', 0, 0),
+		 (2025, '202410', 'BA02', 'C005', '11', 'Org', 100, 100),
+		 (2024, '202409', 'BA01', 'C001', '11', 'Org', 100, 100)`)
+
+	var resp struct {
+		Items []struct {
+			UseType string  `json:"use_type"`
+			Total   int     `json:"total"`
+			Zeroed  int     `json:"zeroed"`
+			Active  int     `json:"active"`
+			Sum     float64 `json:"sum_present_water_usg"`
+		} `json:"items"`
+	}
+	decode(t, serve(t, s, http.MethodGet, "/api/v1/details/summary/by-use-type?branch=BA01&ym=202410", nil), &resp)
+
+	tests := []struct {
+		name                  string
+		useType               string
+		total, zeroed, active int
+		sum                   float64
+	}{
+		// no use_type on the row or in the cohort
+		{name: "unknown", useType: "", total: 1, zeroed: 1},
+		{name: "stored on the row", useType: "11", total: 2, zeroed: 1, active: 1, sum: 10},
+		// an empty row use_type falls back to the cohort's
+		{name: "from the cohort", useType: "21", total: 1, active: 1, sum: 5},
+	}
+	if len(resp.Items) != len(tests) {
+		t.Fatalf("got %d use_types %+v, want %d", len(resp.Items), resp.Items, len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := resp.Items[i]
+			if it.UseType != tt.useType || it.Total != tt.total || it.Zeroed != tt.zeroed || it.Active != tt.active || it.Sum != tt.sum {
+				t.Errorf("item %d = %+v, want use_type=%q total=%d zeroed=%d active=%d sum=%g",
+					i, it, tt.useType, tt.total, tt.zeroed, tt.active, tt.sum)
+			}
+		})
+	}
+}
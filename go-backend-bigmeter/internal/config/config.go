@@ -3,12 +3,16 @@ package config
 import (
 	"encoding/csv"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/robfig/cron/v3"
 )
 
 // Config holds runtime configuration loaded from env vars.
@@ -16,7 +20,37 @@ type Config struct {
 	Timezone    string
 	OracleDSN   string
 	PostgresDSN string
-	Branches    []string
+	// PostgresReadDSN optionally points API read handlers at a read replica; empty uses PostgresDSN
+	PostgresReadDSN string
+	// PostgresReadRetries is how many times API reads retry a transient Postgres connection error
+	PostgresReadRetries int
+	// OracleSessionParams are applied with ALTER SESSION SET on every new Oracle connection
+	OracleSessionParams map[string]string
+	// APIKey guards admin endpoints (X-API-Key header); empty disables them
+	APIKey string
+	// HTTPBasePath is an optional prefix (e.g. /bigmeter) in front of /api/v1
+	HTTPBasePath string
+	// LogFormat is the API request log format: "text" (default) or "json", one line per request
+	LogFormat string
+	// JSONNulls controls nullable fields in list responses: "omit" (default) or "explicit"
+	JSONNulls string
+	// SummaryCacheTTL caches past-month summary/overview responses in memory; 0 disables
+	SummaryCacheTTL time.Duration
+	// MaxFutureMonths is how far past the current month (in Timezone) a requested ym may
+	// be before read/alert endpoints reject it with 400
+	MaxFutureMonths int
+	// SearchTrigram matches the q search of /details and /custcodes against the pg_trgm
+	// GIN indexes of migration 0014 (falls back to per-column ILIKE when they are missing)
+	SearchTrigram bool
+	// DecimalAsString serializes usage/meter-count fields of detail endpoints as JSON strings
+	DecimalAsString bool
+	Branches        []string
+	// BranchCodePattern (BRANCH_CODE_PATTERN) must fully match every branch code taken
+	// from BRANCHES/CSV, API bodies and the CLI; nil accepts any code
+	BranchCodePattern *regexp.Regexp
+	// BranchNameOrder (BRANCH_NAME_ORDER) is the order of bm_branches fields ("alias",
+	// "name", "code") tried when a branch name is rendered; the first non-empty wins
+	BranchNameOrder []string
 	// Schedules use cron spec; timezone applied from Timezone.
 	YearlySpec        string
 	MonthlySpec       string
@@ -24,10 +58,85 @@ type Config struct {
 	EnableYearlyInit  bool
 	EnableMonthlySync bool
 	EnableAlert       bool
+	// NotifyProvider selects where sync results and alerts go: telegram (default), slack or none
+	NotifyProvider string
 	// Telegram notification settings
 	Telegram TelegramConfig
+	// Slack incoming webhook, used when NotifyProvider is slack
+	Slack SlackConfig
+	// Email sends yearly/monthly sync failures over SMTP in addition to NotifyProvider
+	Email EmailConfig
 	// Alert notification settings
 	Alert AlertConfig
+	// Sync job behaviour settings
+	Sync SyncConfig
+	// RequireDebtYM makes POST /sync/init reject a missing debt_ym instead of
+	// defaulting it to October of the current year
+	RequireDebtYM bool
+	// SyncTriggerCooldown rejects a repeated POST /sync/* for the same branches within this window
+	SyncTriggerCooldown time.Duration
+	// Webhook posts scheduled sync results to an external URL
+	Webhook WebhookConfig
+	// Heartbeat is the scheduler's dead-man's switch, checked by GET /healthz/heartbeat
+	Heartbeat HeartbeatConfig
+	// Limits caps the page size of list endpoints and the rows of exports
+	Limits LimitsConfig
+	// ExportBufferRows is how many /details.csv rows may be read ahead of the client;
+	// 0 streams in step with the response
+	ExportBufferRows int
+}
+
+// HeartbeatConfig holds the scheduler heartbeat settings
+type HeartbeatConfig struct {
+	// Interval is how often the scheduler stamps its heartbeat
+	Interval time.Duration
+	// MaxAge is how old the last heartbeat may be before the scheduler counts as down
+	MaxAge time.Duration
+	// RunGrace is how long after its cron time a monthly run may take to show up in
+	// bm_sync_logs before it counts as missed
+	RunGrace time.Duration
+}
+
+// LimitsConfig holds the maximum ?limit per endpoint. Interactive lists stay bounded;
+// exports are unbounded by default and accept limit=all.
+type LimitsConfig struct {
+	// Details caps GET /details
+	Details int
+	// Custcodes caps GET /custcodes
+	Custcodes int
+	// SyncLogs caps GET /sync/logs
+	SyncLogs int
+	// Export caps /details.csv and /custcodes.xlsx; 0 exports every row
+	Export int
+}
+
+// WebhookConfig holds the sync-completion webhook settings
+type WebhookConfig struct {
+	// URL receives a JSON POST after each scheduled yearly/monthly run; empty disables
+	URL string
+	// Retries is how many extra attempts follow a failed POST before dead-lettering
+	Retries int
+	// RetryBackoff is the delay before the first retry, growing linearly per attempt
+	RetryBackoff time.Duration
+}
+
+// SlackConfig holds Slack notification settings. Message templates, quiet hours and
+// retry settings are shared with TelegramConfig.
+type SlackConfig struct {
+	WebhookURL string
+	// PerBranchWebhookURL receives the NOTIFY_PER_BRANCH messages; empty uses WebhookURL
+	PerBranchWebhookURL string
+}
+
+// EmailConfig holds SMTP settings for sync failure emails
+type EmailConfig struct {
+	Enabled  bool
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
 }
 
 // TelegramConfig holds Telegram notification settings
@@ -41,6 +150,21 @@ type TelegramConfig struct {
 	YearlyFailureMsg  string
 	MonthlySuccessMsg string
 	MonthlyFailureMsg string
+	// QuietHours defers non-critical notifications, e.g. "22:00-06:00" (in Timezone)
+	QuietHours string
+	// CriticalBranches always notify on failure, even during quiet hours
+	CriticalBranches []string
+	// NotifyOnSuccess sends yearly/monthly success messages; failures always send
+	NotifyOnSuccess bool
+	// SendAttempts is how many times a failed Telegram send is tried (1 = no retry)
+	SendAttempts int
+	// RetryDelay is the wait before the second attempt; it doubles per failure
+	RetryDelay time.Duration
+	// PerBranch sends a short message for every finished branch init/monthly sync
+	// (NOTIFY_PER_BRANCH), apart from the run summary
+	PerBranch bool
+	// PerBranchChatID is the Telegram chat of the per-branch messages; 0 uses ChatID
+	PerBranchChatID int64
 }
 
 // AlertConfig holds alert notification settings
@@ -49,31 +173,281 @@ type AlertConfig struct {
 	ChatID    int64
 	Threshold float64
 	Link      string
+	// Concurrency bounds parallel per-branch alert computation
+	Concurrency int
+	// NotifyEmpty sends the scheduled digest even when no customer meets the threshold
+	NotifyEmpty bool
+	// Mode is pct_drop (default) or cohort_median
+	Mode string
+	// MADThreshold is the cohort_median cut-off in median-absolute-deviations
+	MADThreshold float64
+	// Direction is which pct_drop changes alert: decrease (default), increase or both
+	Direction string
+	// MinUsage is the previous-month usage a customer needs before pct_drop counts it
+	MinUsage float64
+	// InactiveStates are the meter_state values reported when a customer moves into
+	// one between months (empty disables the meter_state digest)
+	InactiveStates []string
+}
+
+// MaxBackfillMonths caps the yearly init backfill (BACKFILL_MONTHS or a per-request override)
+const MaxBackfillMonths = 24
+
+// SyncConfig holds settings that change how sync jobs write data
+type SyncConfig struct {
+	// ClampNegativeUsage clamps negative Oracle usage/meter counts to zero and flags the row
+	ClampNegativeUsage bool
+	// MonthlyBranchTimeout bounds a whole MonthlyDetails run for one branch; 0 disables
+	MonthlyBranchTimeout time.Duration
+	// JobTimeout bounds each branch job started through the API (init, monthly, retry);
+	// a job that runs out is logged with status 'timeout'. 0 disables
+	JobTimeout time.Duration
+	// InitMode is "full" (default: upsert + prune members missing from Oracle's result)
+	// or "refresh" (upsert only, never deletes cohort members)
+	InitMode string
+	// OracleMaxConns caps concurrent Oracle queries across branches; set it to the
+	// Oracle pool size. 0 disables the cap
+	OracleMaxConns int
+	// BackfillGrace skips a scheduled monthly run for a branch+ym whose init backfill
+	// completed within this window; 0 disables
+	BackfillGrace time.Duration
+	// DebtYMFallbackSteps is how many earlier months init tries when the configured
+	// debt_ym returns no Oracle rows (source not loaded yet); 0 disables the fallback
+	DebtYMFallbackSteps int
+	// CohortSize is how many top-usage customers per branch the yearly init captures
+	CohortSize int
+	// ComputePctChange refreshes bm_meter_details.pct_change after each monthly sync
+	ComputePctChange bool
+	// BatchConcurrency is how many monthly detail batches of one branch query Oracle at
+	// once; Postgres writes stay serialized. 1 (default) runs batches sequentially
+	BatchConcurrency int
+	// BackfillMonths is how many months of details the yearly init syncs for the new
+	// cohort, counting back from debt_ym; 0 disables the backfill
+	BackfillMonths int
+	// BackfillMode is "inline" (default: each branch backfills right after its init) or
+	// "deferred" (scheduled yearly runs backfill all branches after every init finished,
+	// through the SYNC_CONCURRENCY pool)
+	BackfillMode string
+	// CohortTiebreak orders usage ties at the cohort boundary: cust_code (default),
+	// cust_id, or none (Oracle's arbitrary order)
+	CohortTiebreak string
+	// SkipDetailsPrune keeps monthly runs for months before the current one from deleting
+	// detail rows that are not in the cohort (historical backfills/re-runs)
+	SkipDetailsPrune bool
+	// Timezone is TIMEZONE, in which SKIP_DETAILS_PRUNE takes the current month
+	Timezone string
+	// DetailsRatioMin/Max bound (upserted + zeroed) / cohort size of a monthly run; a run
+	// outside the band raises an alarm. 0 disables that side
+	DetailsRatioMin float64
+	DetailsRatioMax float64
+	// DetailsRatioNotify also sends ratio alarms through the scheduler's notifier
+	DetailsRatioNotify bool
 }
 
 // Load loads configuration from environment variables. It will read a local
-// .env file if present, and applies sensible defaults for schedules.
+// .env file if present, then the optional CONFIG_FILE (YAML or JSON) for variables
+// still unset, and applies sensible defaults for schedules.
 func Load() (Config, error) {
 	_ = godotenv.Load()
+	if err := applyConfigFile(); err != nil {
+		return Config{}, err
+	}
+	return load()
+}
+
+// Reload loads the configuration again in a running process (scheduler SIGHUP).
+// Unlike Load, values in the .env file override the process environment, so edits
+// to the file take effect; a key removed from the file keeps its previous value.
+func Reload() (Config, error) {
+	_ = godotenv.Overload()
+	if err := applyConfigFile(); err != nil {
+		return Config{}, err
+	}
+	return load()
+}
 
+func load() (Config, error) {
 	tz := getEnv("TIMEZONE", "Asia/Bangkok")
 	// validate timezone
 	if _, err := time.LoadLocation(tz); err != nil {
 		return Config{}, fmt.Errorf("invalid TIMEZONE %q: %w", tz, err)
 	}
 
+	logFormat := getEnv("LOG_FORMAT", "text")
+	if logFormat != "text" && logFormat != "json" {
+		return Config{}, fmt.Errorf("invalid LOG_FORMAT %q: expect text or json", logFormat)
+	}
+
+	jsonNulls := getEnv("JSON_NULLS", "omit")
+	if jsonNulls != "omit" && jsonNulls != "explicit" {
+		return Config{}, fmt.Errorf("invalid JSON_NULLS %q: expect omit or explicit", jsonNulls)
+	}
+
+	if m := getEnv("INIT_MODE", "full"); m != "full" && m != "refresh" {
+		return Config{}, fmt.Errorf("invalid INIT_MODE %q: expect full or refresh", m)
+	}
+
+	if m := getEnv("ALERT_MODE", "pct_drop"); m != "pct_drop" && m != "cohort_median" {
+		return Config{}, fmt.Errorf("invalid ALERT_MODE %q: expect pct_drop or cohort_median", m)
+	}
+
+	switch d := getEnv("ALERT_DIRECTION", "decrease"); d {
+	case "decrease", "increase", "both":
+	default:
+		return Config{}, fmt.Errorf("invalid ALERT_DIRECTION %q: expect decrease, increase or both", d)
+	}
+
+	if v := getFloat64Env("ALERT_MIN_USAGE", 0); v < 0 {
+		return Config{}, fmt.Errorf("invalid ALERT_MIN_USAGE %v: must be >= 0", v)
+	}
+
+	if d := getDurationEnv("HEARTBEAT_INTERVAL", time.Minute); d <= 0 {
+		return Config{}, fmt.Errorf("invalid HEARTBEAT_INTERVAL %s: must be > 0", d)
+	}
+
+	for _, key := range []string{"DETAILS_MAX_LIMIT", "CUSTCODES_MAX_LIMIT", "LOGS_MAX_LIMIT"} {
+		if n := getInt64Env(key, 500); n < 1 {
+			return Config{}, fmt.Errorf("invalid %s %d: must be at least 1", key, n)
+		}
+	}
+	if n := getInt64Env("EXPORT_MAX_LIMIT", 0); n < 0 {
+		return Config{}, fmt.Errorf("invalid EXPORT_MAX_LIMIT %d: must be >= 0", n)
+	}
+	if n := getInt64Env("EXPORT_BUFFER_ROWS", 0); n < 0 {
+		return Config{}, fmt.Errorf("invalid EXPORT_BUFFER_ROWS %d: must be >= 0", n)
+	}
+
+	if n := getInt64Env("COHORT_SIZE", 200); n < 1 {
+		return Config{}, fmt.Errorf("invalid COHORT_SIZE %d: must be at least 1", n)
+	}
+
+	if n := getInt64Env("BATCH_CONCURRENCY", 1); n < 1 {
+		return Config{}, fmt.Errorf("invalid BATCH_CONCURRENCY %d: must be at least 1", n)
+	}
+
+	ratioMin, ratioMax := getFloat64Env("DETAILS_RATIO_MIN", 0.5), getFloat64Env("DETAILS_RATIO_MAX", 1.5)
+	if ratioMin < 0 || ratioMax < 0 || (ratioMax > 0 && ratioMin > ratioMax) {
+		return Config{}, fmt.Errorf("invalid DETAILS_RATIO_MIN/MAX %v/%v: must be >= 0 with min <= max", ratioMin, ratioMax)
+	}
+
+	if m := getEnv("BACKFILL_MODE", "inline"); m != "inline" && m != "deferred" {
+		return Config{}, fmt.Errorf("invalid BACKFILL_MODE %q: expect inline or deferred", m)
+	}
+
+	if n := getInt64Env("BACKFILL_MONTHS", 3); n < 0 || n > MaxBackfillMonths {
+		return Config{}, fmt.Errorf("invalid BACKFILL_MONTHS %d: must be between 0 and %d", n, MaxBackfillMonths)
+	}
+
+	notifyProvider := getEnv("NOTIFY_PROVIDER", "telegram")
+	switch notifyProvider {
+	case "telegram", "none":
+	case "slack":
+		if os.Getenv("SLACK_WEBHOOK_URL") == "" {
+			return Config{}, fmt.Errorf("NOTIFY_PROVIDER=slack requires SLACK_WEBHOOK_URL")
+		}
+	default:
+		return Config{}, fmt.Errorf("invalid NOTIFY_PROVIDER %q: expect telegram, slack or none", notifyProvider)
+	}
+
+	email := loadEmailConfig()
+	if email.Enabled && (email.Host == "" || email.From == "" || len(email.To) == 0) {
+		return Config{}, fmt.Errorf("EMAIL_ENABLED=true requires SMTP_HOST, EMAIL_FROM and EMAIL_TO")
+	}
+
+	switch t := getEnv("COHORT_TIEBREAK", "cust_code"); t {
+	case "cust_code", "cust_id", "none":
+	default:
+		return Config{}, fmt.Errorf("invalid COHORT_TIEBREAK %q: expect cust_code, cust_id or none", t)
+	}
+
+	if n := getInt64Env("YM_MAX_FUTURE_MONTHS", 1); n < 0 {
+		return Config{}, fmt.Errorf("invalid YM_MAX_FUTURE_MONTHS %d: must be >= 0", n)
+	}
+
+	var branchPattern *regexp.Regexp
+	if p := os.Getenv("BRANCH_CODE_PATTERN"); p != "" {
+		re, err := regexp.Compile(`^(?:` + p + `)$`)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid BRANCH_CODE_PATTERN %q: %w", p, err)
+		}
+		branchPattern = re
+	}
+
+	branchNameOrder, err := parseBranchNameOrder(getEnv("BRANCH_NAME_ORDER", "alias,name,code"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid BRANCH_NAME_ORDER: %w", err)
+	}
+
+	enableYearly := getBoolEnv("ENABLE_YEARLY_INIT", true)
+	enableMonthly := getBoolEnv("ENABLE_MONTHLY_SYNC", true)
+	enableAlert := getBoolEnv("ENABLE_ALERT", true)
+	// 01:30 Oct 16 every year, 08:00 on the 16th monthly, 09:10 on day 16 and 30 monthly
+	yearlySpec, err := cronSpec("CRON_YEARLY", "0 30 1 16 10 *", enableYearly)
+	if err != nil {
+		return Config{}, err
+	}
+	monthlySpec, err := cronSpec("CRON_MONTHLY", "0 0 8 16 * *", enableMonthly)
+	if err != nil {
+		return Config{}, err
+	}
+	alertSpec, err := cronSpec("CRON_ALERT", "0 10 9 16,30 * *", enableAlert)
+	if err != nil {
+		return Config{}, err
+	}
+
+	sessionParams, err := parseSessionParams(os.Getenv("ORACLE_SESSION_PARAMS"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid ORACLE_SESSION_PARAMS: %w", err)
+	}
+
 	cfg := Config{
-		Timezone:          tz,
-		OracleDSN:         os.Getenv("ORACLE_DSN"),
-		PostgresDSN:       os.Getenv("POSTGRES_DSN"),
-		YearlySpec:        getEnv("CRON_YEARLY", "0 30 1 16 10 *"), // 01:30 Oct 16 every year
-		MonthlySpec:       getEnv("CRON_MONTHLY", "0 0 8 16 * *"),  // 08:00 on the 16th monthly
-		AlertSpec:         getEnv("CRON_ALERT", "0 10 9 16,30 * *"), // 09:10 on day 16 and 30 monthly
-		EnableYearlyInit:  getBoolEnv("ENABLE_YEARLY_INIT", true),
-		EnableMonthlySync: getBoolEnv("ENABLE_MONTHLY_SYNC", true),
-		EnableAlert:       getBoolEnv("ENABLE_ALERT", true),
-		Telegram:          loadTelegramConfig(),
-		Alert:             loadAlertConfig(),
+		Timezone:            tz,
+		OracleDSN:           os.Getenv("ORACLE_DSN"),
+		PostgresDSN:         os.Getenv("POSTGRES_DSN"),
+		PostgresReadDSN:     os.Getenv("POSTGRES_READ_DSN"),
+		SummaryCacheTTL:     getDurationEnv("SUMMARY_CACHE_TTL", 0),
+		PostgresReadRetries: int(getInt64Env("POSTGRES_READ_RETRIES", 2)),
+		OracleSessionParams: sessionParams,
+		APIKey:              os.Getenv("API_KEY"),
+		HTTPBasePath:        normalizeBasePath(os.Getenv("HTTP_BASE_PATH")),
+		LogFormat:           logFormat,
+		JSONNulls:           jsonNulls,
+		MaxFutureMonths:     int(getInt64Env("YM_MAX_FUTURE_MONTHS", 1)),
+		DecimalAsString:     getBoolEnv("DECIMAL_AS_STRING", false),
+		SyncTriggerCooldown: getDurationEnv("SYNC_TRIGGER_COOLDOWN", 30*time.Second),
+		BranchCodePattern:   branchPattern,
+		BranchNameOrder:     branchNameOrder,
+		SearchTrigram:       getBoolEnv("SEARCH_TRGM", false),
+		YearlySpec:          yearlySpec,
+		MonthlySpec:         monthlySpec,
+		AlertSpec:           alertSpec,
+		EnableYearlyInit:    enableYearly,
+		EnableMonthlySync:   enableMonthly,
+		EnableAlert:         enableAlert,
+		NotifyProvider:      notifyProvider,
+		Telegram:            loadTelegramConfig(),
+		Slack:               loadSlackConfig(),
+		Email:               email,
+		Alert:               loadAlertConfig(),
+		RequireDebtYM:       getBoolEnv("INIT_REQUIRE_DEBT_YM", false),
+		Sync:                loadSyncConfig(),
+		Webhook: WebhookConfig{
+			URL:          getEnv("SYNC_WEBHOOK_URL", ""),
+			Retries:      int(getInt64Env("SYNC_WEBHOOK_RETRIES", 3)),
+			RetryBackoff: getDurationEnv("SYNC_WEBHOOK_BACKOFF", 2*time.Second),
+		},
+		Heartbeat: HeartbeatConfig{
+			Interval: getDurationEnv("HEARTBEAT_INTERVAL", time.Minute),
+			MaxAge:   getDurationEnv("HEARTBEAT_MAX_AGE", 5*time.Minute),
+			RunGrace: getDurationEnv("HEARTBEAT_RUN_GRACE", time.Hour),
+		},
+		Limits: LimitsConfig{
+			Details:   int(getInt64Env("DETAILS_MAX_LIMIT", 500)),
+			Custcodes: int(getInt64Env("CUSTCODES_MAX_LIMIT", 500)),
+			SyncLogs:  int(getInt64Env("LOGS_MAX_LIMIT", 500)),
+			Export:    int(getInt64Env("EXPORT_MAX_LIMIT", 0)),
+		},
+		ExportBufferRows: int(getInt64Env("EXPORT_BUFFER_ROWS", 0)),
 	}
 
 	// Branch list as comma-separated codes, e.g. BA01,BA02,...
@@ -82,10 +456,31 @@ func Load() (Config, error) {
 	} else {
 		cfg.Branches = parseBranchesFromCSV()
 	}
+	if err := cfg.CheckBranchCodes(cfg.Branches); err != nil {
+		return Config{}, fmt.Errorf("invalid BRANCHES: %w", err)
+	}
 
 	return cfg, nil
 }
 
+// CheckBranchCodes returns an error naming every code that does not match
+// BranchCodePattern. Codes are checked as given; callers trim them first.
+func (c Config) CheckBranchCodes(codes []string) error {
+	if c.BranchCodePattern == nil {
+		return nil
+	}
+	var bad []string
+	for _, code := range codes {
+		if !c.BranchCodePattern.MatchString(code) {
+			bad = append(bad, fmt.Sprintf("%q", code))
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("branch code(s) %s do not match BRANCH_CODE_PATTERN %s", strings.Join(bad, ", "), c.BranchCodePattern)
+	}
+	return nil
+}
+
 func getEnv(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -125,6 +520,18 @@ func getFloat64Env(key string, def float64) float64 {
 	return n
 }
 
+func getDurationEnv(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return def
+	}
+	return d
+}
+
 func loadTelegramConfig() TelegramConfig {
 	return TelegramConfig{
 		Enabled:  getBoolEnv("TELEGRAM_ENABLED", false),
@@ -158,18 +565,90 @@ func loadTelegramConfig() TelegramConfig {
 				"Failed Branches: {failed_branches}\n"+
 				"Error: {error}\n"+
 				"Time: {timestamp}"),
+		QuietHours:       os.Getenv("NOTIFY_QUIET_HOURS"),
+		CriticalBranches: splitAndTrim(os.Getenv("NOTIFY_CRITICAL_BRANCHES"), ","),
+		NotifyOnSuccess:  getBoolEnv("NOTIFY_ON_SUCCESS", true),
+		SendAttempts:     int(getInt64Env("TELEGRAM_SEND_ATTEMPTS", 3)),
+		RetryDelay:       getDurationEnv("TELEGRAM_RETRY_DELAY", time.Second),
+		PerBranch:        getBoolEnv("NOTIFY_PER_BRANCH", false),
+		PerBranchChatID:  getInt64Env("NOTIFY_PER_BRANCH_CHAT_ID", 0),
+	}
+}
+
+func loadSlackConfig() SlackConfig {
+	return SlackConfig{
+		WebhookURL:          os.Getenv("SLACK_WEBHOOK_URL"),
+		PerBranchWebhookURL: os.Getenv("NOTIFY_PER_BRANCH_SLACK_WEBHOOK"),
+	}
+}
+
+func loadEmailConfig() EmailConfig {
+	return EmailConfig{
+		Enabled:  getBoolEnv("EMAIL_ENABLED", false),
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     int(getInt64Env("SMTP_PORT", 587)),
+		Username: os.Getenv("SMTP_USER"),
+		Password: os.Getenv("SMTP_PASS"),
+		From:     os.Getenv("EMAIL_FROM"),
+		To:       splitAndTrim(os.Getenv("EMAIL_TO"), ","),
 	}
 }
 
 func loadAlertConfig() AlertConfig {
 	return AlertConfig{
-		Enabled:   getBoolEnv("TELEGRAM_ALERT_ENABLED", false),
-		ChatID:    getInt64Env("TELEGRAM_ALERT_CHAT_ID", 0),
-		Threshold: getFloat64Env("TELEGRAM_ALERT_THRESHOLD", 20.0),
-		Link:      getEnv("TELEGRAM_ALERT_LINK", ""),
+		Enabled:        getBoolEnv("TELEGRAM_ALERT_ENABLED", false),
+		ChatID:         getInt64Env("TELEGRAM_ALERT_CHAT_ID", 0),
+		Threshold:      getFloat64Env("TELEGRAM_ALERT_THRESHOLD", 20.0),
+		Link:           getEnv("TELEGRAM_ALERT_LINK", ""),
+		Concurrency:    int(getInt64Env("ALERT_CONCURRENCY", 4)),
+		NotifyEmpty:    getBoolEnv("ALERT_NOTIFY_EMPTY", true),
+		Mode:           getEnv("ALERT_MODE", "pct_drop"),
+		MADThreshold:   getFloat64Env("ALERT_MAD_THRESHOLD", 3.0),
+		Direction:      getEnv("ALERT_DIRECTION", "decrease"),
+		MinUsage:       getFloat64Env("ALERT_MIN_USAGE", 0),
+		InactiveStates: splitAndTrim(os.Getenv("ALERT_INACTIVE_STATES"), ","),
 	}
 }
 
+func loadSyncConfig() SyncConfig {
+	return SyncConfig{
+		ClampNegativeUsage:   getBoolEnv("CLAMP_NEGATIVE_USAGE", false),
+		MonthlyBranchTimeout: getDurationEnv("MONTHLY_SYNC_BRANCH_TIMEOUT", 0),
+		JobTimeout:           getDurationEnv("SYNC_JOB_TIMEOUT", 0),
+		BackfillGrace:        getDurationEnv("BACKFILL_GRACE", 0),
+		OracleMaxConns:       int(getInt64Env("ORACLE_MAX_CONNS", 4)),
+		InitMode:             getEnv("INIT_MODE", "full"),
+		DebtYMFallbackSteps:  int(getInt64Env("DEBT_YM_FALLBACK_STEPS", 0)),
+		CohortTiebreak:       getEnv("COHORT_TIEBREAK", "cust_code"),
+		CohortSize:           int(getInt64Env("COHORT_SIZE", 200)),
+		BackfillMonths:       int(getInt64Env("BACKFILL_MONTHS", 3)),
+		BackfillMode:         getEnv("BACKFILL_MODE", "inline"),
+		BatchConcurrency:     int(getInt64Env("BATCH_CONCURRENCY", 1)),
+		ComputePctChange:     getBoolEnv("COMPUTE_PCT_CHANGE", true),
+		SkipDetailsPrune:     getBoolEnv("SKIP_DETAILS_PRUNE", false),
+		Timezone:             getEnv("TIMEZONE", "Asia/Bangkok"),
+		DetailsRatioMin:      getFloat64Env("DETAILS_RATIO_MIN", 0.5),
+		DetailsRatioMax:      getFloat64Env("DETAILS_RATIO_MAX", 1.5),
+		DetailsRatioNotify:   getBoolEnv("DETAILS_RATIO_NOTIFY", false),
+	}
+}
+
+// normalizeBasePath turns "bigmeter/", "/bigmeter" or "/bigmeter/" into "/bigmeter";
+// empty or "/" yields "" (routes mounted at root).
+func normalizeBasePath(p string) string {
+	p = trimSpace(p)
+	for len(p) > 0 && p[len(p)-1] == '/' {
+		p = p[:len(p)-1]
+	}
+	if p == "" {
+		return ""
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	return p
+}
+
 func splitAndTrim(s, sep string) []string {
 	var out []string
 	cur := ""
@@ -189,6 +668,126 @@ func splitAndTrim(s, sep string) []string {
 	return out
 }
 
+// cronParser is the scheduler's parser (cron.WithSeconds): six fields or a descriptor
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// cronSpec reads the schedule of a job from env var name (def when unset) through
+// normalizeCronSpec. A disabled job's spec is returned as set and not validated, so a
+// stale value does not stop the API or a scheduler that never registers it.
+func cronSpec(name, def string, enabled bool) (string, error) {
+	spec := getEnv(name, def)
+	if !enabled {
+		return spec, nil
+	}
+	return normalizeCronSpec(name, spec)
+}
+
+// normalizeCronSpec turns a standard 5-field spec (e.g. "0 8 16 * *") into the
+// 6-field form the scheduler expects by prepending a "0" seconds field, logging the
+// change. A leading CRON_TZ=/TZ= prefix is kept. The result must parse.
+func normalizeCronSpec(name, spec string) (string, error) {
+	fields := strings.Fields(spec)
+	prefix := ""
+	if len(fields) > 0 && (strings.HasPrefix(fields[0], "CRON_TZ=") || strings.HasPrefix(fields[0], "TZ=")) {
+		prefix, fields = fields[0]+" ", fields[1:]
+	}
+	if len(fields) == 5 {
+		normalized := prefix + "0 " + strings.Join(fields, " ")
+		log.Printf("config: %s %q has 5 fields, using %q", name, spec, normalized)
+		spec = normalized
+	}
+	if _, err := cronParser.Parse(spec); err != nil {
+		return "", fmt.Errorf("invalid %s %q: %w", name, spec, err)
+	}
+	return spec, nil
+}
+
+// parseBranchNameOrder parses a comma list of the branch fields alias, name and code,
+// each at most once
+func parseBranchNameOrder(s string) ([]string, error) {
+	order := splitAndTrim(s, ",")
+	if len(order) == 0 {
+		return nil, fmt.Errorf("expect a comma list of alias, name and code")
+	}
+	seen := make(map[string]bool, len(order))
+	for _, field := range order {
+		switch field {
+		case "alias", "name", "code":
+		default:
+			return nil, fmt.Errorf("unknown field %q: expect alias, name or code", field)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("field %q listed twice", field)
+		}
+		seen[field] = true
+	}
+	return order, nil
+}
+
+// parseSessionParams parses "K1=V1,K2=V2" into a map. A segment without "=" is
+// treated as part of the previous value, so values containing commas work,
+// e.g. "NLS_NUMERIC_CHARACTERS=.," yields ".,".
+func parseSessionParams(s string) (map[string]string, error) {
+	if trimSpace(s) == "" {
+		return nil, nil
+	}
+	out := map[string]string{}
+	last := ""
+	seg := ""
+	flush := func() error {
+		eq := -1
+		for i := 0; i < len(seg); i++ {
+			if seg[i] == '=' {
+				eq = i
+				break
+			}
+		}
+		if eq < 0 {
+			if last == "" {
+				return fmt.Errorf("expect KEY=VALUE, got %q", seg)
+			}
+			out[last] += "," + seg
+			return nil
+		}
+		key := trimSpace(seg[:eq])
+		if !isSessionParamKey(key) {
+			return fmt.Errorf("invalid parameter name %q", key)
+		}
+		out[key] = trimSpace(seg[eq+1:])
+		last = key
+		return nil
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == ',' {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			seg = ""
+			continue
+		}
+		seg += string(s[i])
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// isSessionParamKey allows only identifier characters since the key is
+// interpolated into the ALTER SESSION statement.
+func isSessionParamKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		c := k[i]
+		if !(c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
 func trimSpace(s string) string {
 	// simple trim without importing strings to keep deps minimal in this file
 	start := 0
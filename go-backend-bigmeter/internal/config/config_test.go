@@ -0,0 +1,156 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeBasePath(t *testing.T) {
+	tests := map[string]string{
+		"":           "",
+		"/":          "",
+		"bigmeter":   "/bigmeter",
+		"/bigmeter":  "/bigmeter",
+		"bigmeter/":  "/bigmeter",
+		" /a/b/ ":    "/a/b",
+		"/bigmeter/": "/bigmeter",
+	}
+	for in, want := range tests {
+		if got := normalizeBasePath(in); got != want {
+			t.Errorf("normalizeBasePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBranchCodePattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		branches string
+		wantErr  bool
+	}{
+		{name: "default accepts any code", branches: "BA01,ba 1"},
+		{name: "conforming", pattern: `BA\d{2}`, branches: "BA01,BA02"},
+		{name: "wrong length", pattern: `BA\d{2}`, branches: "BA01,BA001", wantErr: true},
+		{name: "inner space", pattern: `BA\d{2}`, branches: "BA 1", wantErr: true},
+		{name: "pattern is anchored", pattern: `BA\d`, branches: "BA01", wantErr: true},
+		{name: "invalid pattern", pattern: `BA(`, branches: "BA01", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BRANCH_CODE_PATTERN", tt.pattern)
+			t.Setenv("BRANCHES", tt.branches)
+			_, err := load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("load() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBranchNameOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "default", want: []string{"alias", "name", "code"}},
+		{name: "custom", env: " name , code ", want: []string{"name", "code"}},
+		{name: "unknown field", env: "alias,short", wantErr: true},
+		{name: "repeated field", env: "alias,name,alias", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BRANCH_NAME_ORDER", tt.env)
+			cfg, err := load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("load() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err == nil && strings.Join(cfg.BranchNameOrder, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("BranchNameOrder = %v, want %v", cfg.BranchNameOrder, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCronSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		same     string // 6-field spec with the same schedule
+		wantSpec string
+		wantErr  bool
+	}{
+		{name: "5 fields", spec: "0 8 16 * *", same: "0 0 8 16 * *", wantSpec: "0 0 8 16 * *"},
+		{name: "6 fields kept", spec: "0 0 8 16 * *", same: "0 0 8 16 * *", wantSpec: "0 0 8 16 * *"},
+		{name: "5 fields with time zone", spec: "CRON_TZ=Asia/Bangkok 30 1 16 10 *",
+			same: "CRON_TZ=Asia/Bangkok 0 30 1 16 10 *", wantSpec: "CRON_TZ=Asia/Bangkok 0 30 1 16 10 *"},
+		{name: "list field", spec: "10 9 16,30 * *", same: "0 10 9 16,30 * *", wantSpec: "0 10 9 16,30 * *"},
+		{name: "descriptor", spec: "@daily", same: "0 0 0 * * *", wantSpec: "@daily"},
+		{name: "4 fields", spec: "8 16 * *", wantErr: true},
+		{name: "out of range", spec: "0 25 16 * *", wantErr: true},
+	}
+	starts := []time.Time{
+		time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, time.October, 16, 1, 29, 59, 0, time.UTC),
+		time.Date(2024, time.December, 31, 23, 59, 59, 0, time.UTC),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeCronSpec("CRON_TEST", tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeCronSpec(%q) error = %v, wantErr %t", tt.spec, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got != tt.wantSpec {
+				t.Errorf("normalizeCronSpec(%q) = %q, want %q", tt.spec, got, tt.wantSpec)
+			}
+			sched, err := cronParser.Parse(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := cronParser.Parse(tt.same)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, start := range starts {
+				next, wantNext := start, start
+				for i := 0; i < 3; i++ {
+					next, wantNext = sched.Next(next), want.Next(wantNext)
+					if !next.Equal(wantNext) {
+						t.Fatalf("from %s run %d at %s, want %s", start, i, next, wantNext)
+					}
+				}
+			}
+		})
+	}
+}
+
+// Only the schedules of enabled jobs are validated
+func TestCronSpecEnabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled string
+		wantErr bool
+	}{
+		{name: "enabled", enabled: "true", wantErr: true},
+		{name: "disabled", enabled: "false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENABLE_MONTHLY_SYNC", tt.enabled)
+			t.Setenv("CRON_MONTHLY", "not a spec")
+			cfg, err := load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("load() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err == nil && cfg.EnableMonthlySync {
+				t.Error("EnableMonthlySync = true, want false")
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileKeys are the settings CONFIG_FILE may set: every variable read by Load plus the
+// ones the binaries read directly. A new env var must be listed here to be settable
+// from the file.
+var fileKeys = map[string]bool{
+	// Load
+	"ALERT_CONCURRENCY": true, "ALERT_DIRECTION": true, "ALERT_INACTIVE_STATES": true,
+	"ALERT_MAD_THRESHOLD": true, "ALERT_MIN_USAGE": true, "ALERT_MODE": true,
+	"ALERT_NOTIFY_EMPTY": true, "API_KEY": true, "BACKFILL_GRACE": true,
+	"BACKFILL_MODE": true, "BACKFILL_MONTHS": true, "BATCH_CONCURRENCY": true,
+	"BRANCHES": true, "BRANCH_CODE_PATTERN": true, "BRANCH_NAME_ORDER": true,
+	"CLAMP_NEGATIVE_USAGE": true, "COHORT_SIZE": true, "COHORT_TIEBREAK": true,
+	"COMPUTE_PCT_CHANGE": true, "CRON_ALERT": true, "CRON_MONTHLY": true,
+	"CRON_YEARLY": true, "CUSTCODES_MAX_LIMIT": true, "DEBT_YM_FALLBACK_STEPS": true,
+	"DECIMAL_AS_STRING": true, "DETAILS_MAX_LIMIT": true, "DETAILS_RATIO_MAX": true,
+	"DETAILS_RATIO_MIN": true, "DETAILS_RATIO_NOTIFY": true, "EMAIL_ENABLED": true,
+	"EMAIL_FROM": true, "EMAIL_TO": true, "ENABLE_ALERT": true,
+	"ENABLE_MONTHLY_SYNC": true, "ENABLE_YEARLY_INIT": true, "EXPORT_BUFFER_ROWS": true,
+	"EXPORT_MAX_LIMIT": true, "HEARTBEAT_INTERVAL": true, "HEARTBEAT_MAX_AGE": true,
+	"HEARTBEAT_RUN_GRACE": true, "HTTP_BASE_PATH": true, "INIT_MODE": true,
+	"INIT_REQUIRE_DEBT_YM": true, "JSON_NULLS": true, "LOGS_MAX_LIMIT": true,
+	"LOG_FORMAT": true, "MONTHLY_SYNC_BRANCH_TIMEOUT": true, "NOTIFY_CRITICAL_BRANCHES": true,
+	"NOTIFY_ON_SUCCESS": true, "NOTIFY_PER_BRANCH": true, "NOTIFY_PER_BRANCH_CHAT_ID": true,
+	"NOTIFY_PER_BRANCH_SLACK_WEBHOOK": true, "NOTIFY_PROVIDER": true, "NOTIFY_QUIET_HOURS": true,
+	"ORACLE_DSN": true, "ORACLE_MAX_CONNS": true, "ORACLE_SESSION_PARAMS": true,
+	"POSTGRES_DSN": true, "POSTGRES_READ_DSN": true, "POSTGRES_READ_RETRIES": true,
+	"SEARCH_TRGM": true, "SKIP_DETAILS_PRUNE": true, "SLACK_WEBHOOK_URL": true,
+	"SMTP_HOST": true, "SMTP_PASS": true, "SMTP_PORT": true, "SMTP_USER": true,
+	"SUMMARY_CACHE_TTL": true, "SYNC_JOB_TIMEOUT": true, "SYNC_TRIGGER_COOLDOWN": true,
+	"SYNC_WEBHOOK_BACKOFF": true, "SYNC_WEBHOOK_RETRIES": true, "SYNC_WEBHOOK_URL": true,
+	"TELEGRAM_ALERT_CHAT_ID": true, "TELEGRAM_ALERT_ENABLED": true, "TELEGRAM_ALERT_LINK": true,
+	"TELEGRAM_ALERT_THRESHOLD": true, "TELEGRAM_BOT_TOKEN": true, "TELEGRAM_CHAT_ID": true,
+	"TELEGRAM_ENABLED": true, "TELEGRAM_MONTHLY_FAILURE": true, "TELEGRAM_MONTHLY_PREFIX": true,
+	"TELEGRAM_MONTHLY_SUCCESS": true, "TELEGRAM_RETRY_DELAY": true, "TELEGRAM_SEND_ATTEMPTS": true,
+	"TELEGRAM_YEARLY_FAILURE": true, "TELEGRAM_YEARLY_PREFIX": true, "TELEGRAM_YEARLY_SUCCESS": true,
+	"TIMEZONE": true, "YM_MAX_FUTURE_MONTHS": true,
+	// cmd/api and cmd/sync
+	"PORT": true, "VERSION": true, "GIT_SHA": true, "METRICS_ADDR": true, "MODE": true,
+	"YM": true, "DEBT_YM": true, "ALLOW_FUTURE": true, "BATCH_SIZE": true,
+	"SYNC_CONCURRENCY": true, "SYNC_RETRIES": true, "SYNC_RETRY_DELAY": true,
+	"SHUTDOWN_TIMEOUT": true,
+}
+
+// fromFile holds the variables applyConfigFile set and their values, so a reload can
+// replace them while values from the environment or .env still win.
+var fromFile = map[string]string{}
+
+// applyConfigFile reads the YAML or JSON file named by CONFIG_FILE (if any) and sets
+// its values as environment variables, so Load sees them like any other setting.
+// Variables already in the environment (including .env) are left alone. Nested keys
+// are joined with "_" and upper-cased (telegram: {bot_token: x} is TELEGRAM_BOT_TOKEN);
+// lists become comma-separated values. Unknown keys are an error.
+func applyConfigFile() error {
+	path := strings.TrimSpace(os.Getenv("CONFIG_FILE"))
+	if path == "" {
+		return nil
+	}
+	vars, err := readConfigFile(path)
+	if err != nil {
+		return fmt.Errorf("CONFIG_FILE %s: %w", path, err)
+	}
+	var unknown []string
+	for key, v := range vars {
+		if !fileKeys[key] {
+			unknown = append(unknown, fmt.Sprintf("%s (%s)", v.path, key))
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("CONFIG_FILE %s: unknown key(s): %s", path, strings.Join(unknown, ", "))
+	}
+	for key, v := range vars {
+		if cur, set := os.LookupEnv(key); set {
+			if prev, ok := fromFile[key]; !ok || cur != prev {
+				continue
+			}
+		}
+		if err := os.Setenv(key, v.value); err != nil {
+			return fmt.Errorf("CONFIG_FILE %s: set %s: %w", path, key, err)
+		}
+		fromFile[key] = v.value
+	}
+	return nil
+}
+
+type fileValue struct {
+	path  string // dotted key as written in the file, for error messages
+	value string
+}
+
+// readConfigFile parses path as JSON (.json) or YAML (anything else) into env vars
+func readConfigFile(path string) (map[string]fileValue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	vars := map[string]fileValue{}
+	if err := flattenConfig("", "", doc, vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+func flattenConfig(key, path string, doc map[string]any, vars map[string]fileValue) error {
+	for k, v := range doc {
+		name := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(k), "-", "_"))
+		p := k
+		if key != "" {
+			name, p = key+"_"+name, path+"."+k
+		}
+		if m, ok := v.(map[string]any); ok {
+			if err := flattenConfig(name, p, m, vars); err != nil {
+				return err
+			}
+			continue
+		}
+		value, err := fileScalar(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		if prev, dup := vars[name]; dup {
+			return fmt.Errorf("%s and %s both set %s", prev.path, p, name)
+		}
+		vars[name] = fileValue{path: p, value: value}
+	}
+	return nil
+}
+
+// fileScalar renders a file value the way it would be written in the environment
+func fileScalar(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			if _, nested := item.([]any); nested {
+				return "", fmt.Errorf("nested lists are not supported")
+			}
+			if _, nested := item.(map[string]any); nested {
+				return "", fmt.Errorf("lists of objects are not supported")
+			}
+			s, err := fileScalar(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
@@ -0,0 +1,126 @@
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	dbpkg "go-backend-bigmeter/internal/database"
+)
+
+// Result is what the fake Oracle returns for one query
+type Result struct {
+	Columns []string
+	Rows    [][]driver.Value
+}
+
+// QueryFunc answers a query sent to the fake Oracle. args carry the bind names
+// (sql.Named) without the leading colon.
+type QueryFunc func(query string, args []driver.NamedValue) (Result, error)
+
+// FakeOracle is a database/sql driver whose queries are answered by a QueryFunc. It
+// records every statement, so tests can also assert what was sent.
+type FakeOracle struct {
+	fn QueryFunc
+
+	mu    sync.Mutex
+	stmts []string
+}
+
+// Oracle returns an Oracle backed by a FakeOracle answering with fn; the pool is closed
+// when the test ends.
+func Oracle(t testing.TB, fn QueryFunc) (*dbpkg.Oracle, *FakeOracle) {
+	t.Helper()
+	f := &FakeOracle{fn: fn}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { _ = db.Close() })
+	return &dbpkg.Oracle{DB: db}, f
+}
+
+// Statements returns the queries and execs sent so far, in order
+func (f *FakeOracle) Statements() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.stmts...)
+}
+
+func (f *FakeOracle) record(query string) {
+	f.mu.Lock()
+	f.stmts = append(f.stmts, query)
+	f.mu.Unlock()
+}
+
+// Connect implements driver.Connector
+func (f *FakeOracle) Connect(context.Context) (driver.Conn, error) { return &fakeConn{f: f}, nil }
+
+// Driver implements driver.Connector
+func (f *FakeOracle) Driver() driver.Driver { return fakeDriver{f} }
+
+type fakeDriver struct{ f *FakeOracle }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{f: d.f}, nil }
+
+type fakeConn struct{ f *FakeOracle }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("dbtest: prepared statements are not supported")
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("dbtest: transactions are not supported")
+}
+
+// CheckNamedValue accepts any argument as is, including sql.Named binds
+func (c *fakeConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.f.record(query)
+	if c.f.fn == nil {
+		return &fakeRows{}, nil
+	}
+	res, err := c.f.fn(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{res: res}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.f.record(query)
+	if c.f.fn != nil {
+		if _, err := c.f.fn(query, args); err != nil {
+			return nil, err
+		}
+	}
+	return driver.RowsAffected(0), nil
+}
+
+type fakeRows struct {
+	res Result
+	i   int
+}
+
+func (r *fakeRows) Columns() []string { return r.res.Columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.res.Rows) {
+		return io.EOF
+	}
+	copy(dest, r.res.Rows[r.i])
+	r.i++
+	return nil
+}
+
+// Arg returns the value bound to name, or nil
+func Arg(args []driver.NamedValue, name string) any {
+	for _, a := range args {
+		if a.Name == name {
+			return a.Value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Package dbtest provides databases for tests: a throwaway Postgres schema with the
+// migrations applied (when TEST_POSTGRES_DSN is set) and a scripted fake Oracle.
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	dbpkg "go-backend-bigmeter/internal/database"
+)
+
+// migrationFile matches the numbered migrations (init_complete.sql and reset_data.sql
+// are not part of the sequence)
+var migrationFile = regexp.MustCompile(`^\d{4}_.*\.sql$`)
+
+// optionalMigrations may fail as a whole, e.g. 0014 without the right to create pg_trgm;
+// the API falls back to ILIKE without them
+var optionalMigrations = map[string]bool{"0014_search_trgm.sql": true}
+
+// Postgres returns a pool on a new schema of the TEST_POSTGRES_DSN database with every
+// migration applied; the schema is dropped when the test ends. Without
+// TEST_POSTGRES_DSN the test is skipped.
+func Postgres(t testing.TB) *dbpkg.Postgres {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+	ctx := context.Background()
+
+	schema := fmt.Sprintf("bm_test_%d", time.Now().UnixNano())
+	admin, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer admin.Close()
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		pool, err := pgxpool.New(context.Background(), dsn)
+		if err != nil {
+			return
+		}
+		defer pool.Close()
+		_, _ = pool.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+	})
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("parse dsn: %v", err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema + ",public"
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	if err := migrate(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	return &dbpkg.Postgres{Pool: pool}
+}
+
+// migrate applies migrations/NNNN_*.sql in order, one statement at a time like psql
+// without ON_ERROR_STOP: objects an earlier migration already created are not errors.
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	dir, err := migrationsDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, e := range entries {
+		if migrationFile.MatchString(e.Name()) {
+			files = append(files, e.Name())
+		}
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		for _, stmt := range statements(string(b)) {
+			if _, err := pool.Exec(ctx, stmt); err != nil && !alreadyExists(err) {
+				if optionalMigrations[name] {
+					break
+				}
+				return fmt.Errorf("migration %s: %w\n%s", name, err, stmt)
+			}
+		}
+	}
+	return nil
+}
+
+// statements splits a migration into statements, dropping psql meta-commands,
+// comments and the BEGIN/COMMIT wrapper
+func statements(script string) []string {
+	var lines []string
+	for _, l := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(l)
+		if strings.HasPrefix(trimmed, `\`) || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	var out []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";\n") {
+		stmt = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(stmt), ";"))
+		switch strings.ToUpper(stmt) {
+		case "", "BEGIN", "COMMIT":
+			continue
+		}
+		out = append(out, stmt)
+	}
+	return out
+}
+
+func alreadyExists(err error) bool {
+	var pgErr *pgconn.PgError
+	// duplicate_table, duplicate_object
+	return errors.As(err, &pgErr) && (pgErr.Code == "42P07" || pgErr.Code == "42710")
+}
+
+// migrationsDir finds migrations/ next to go.mod, above the test's package directory
+func migrationsDir() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return filepath.Join(dir, "migrations"), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("dbtest: go.mod not found")
+		}
+		dir = parent
+	}
+}
+
+// ModuleRoot returns the directory holding go.mod, for tests that read sqls/ the way
+// the binaries do (relative to the working directory)
+func ModuleRoot(t testing.TB) string {
+	t.Helper()
+	dir, err := migrationsDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Dir(dir)
+}
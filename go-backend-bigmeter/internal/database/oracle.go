@@ -8,20 +8,31 @@ import (
 	"database/sql"
 	"fmt"
 
-	_ "github.com/godror/godror"
+	"github.com/godror/godror"
 )
 
 type Oracle struct {
 	DB *sql.DB
 }
 
-func NewOracle(dsn string) (*Oracle, error) {
+// NewOracle opens a godror pool. sessionParams (e.g. NLS_DATE_FORMAT) are applied
+// with ALTER SESSION SET on every new connection via godror's OnInit hook (see
+// sessionStatements).
+func NewOracle(dsn string, sessionParams map[string]string) (*Oracle, error) {
 	// godror thick driver accepts EZCONNECT (USER/PASS@host:1521/SERVICE) or oracle:// URL.
-	db, err := sql.Open("godror", dsn)
+	if len(sessionParams) == 0 {
+		db, err := sql.Open("godror", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("open oracle (godror): %w", err)
+		}
+		return &Oracle{DB: db}, nil
+	}
+	params, err := godror.ParseDSN(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("open oracle (godror): %w", err)
+		return nil, fmt.Errorf("parse oracle dsn: %w", err)
 	}
-	return &Oracle{DB: db}, nil
+	params.OnInit = sessionIniter(sessionStatements(sessionParams))
+	return &Oracle{DB: sql.OpenDB(godror.NewConnector(params))}, nil
 }
 
 func (o *Oracle) Ping(ctx context.Context) error { return o.DB.PingContext(ctx) }
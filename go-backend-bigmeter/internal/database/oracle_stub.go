@@ -14,7 +14,7 @@ type Oracle struct {
 	DB *sql.DB
 }
 
-func NewOracle(dsn string) (*Oracle, error) {
+func NewOracle(dsn string, sessionParams map[string]string) (*Oracle, error) {
 	return nil, fmt.Errorf("oracle support not compiled (build with -tags oracle)")
 }
 
@@ -9,6 +9,8 @@ import (
 
 type Postgres struct {
 	Pool *pgxpool.Pool
+	// ReadRetries is how many times Query/QueryRow retry a transient connection error
+	ReadRetries int
 }
 
 func NewPostgres(ctx context.Context, dsn string) (*Postgres, error) {
@@ -16,7 +18,15 @@ func NewPostgres(ctx context.Context, dsn string) (*Postgres, error) {
 	if err != nil {
 		return nil, fmt.Errorf("connect postgres: %w", err)
 	}
-	return &Postgres{Pool: pool}, nil
+	return &Postgres{Pool: pool, ReadRetries: 2}, nil
+}
+
+// Ping verifies the pool can reach the server
+func (p *Postgres) Ping(ctx context.Context) error {
+	if err := p.Pool.Ping(ctx); err != nil {
+		return fmt.Errorf("ping postgres: %w", err)
+	}
+	return nil
 }
 
 func (p *Postgres) Close() {
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// readRetryBackoff is the base delay between read attempts (multiplied by attempt).
+const readRetryBackoff = 100 * time.Millisecond
+
+// IsTransient reports whether err is a connection-level failure (pool reconnect,
+// server restart, dropped socket) that is worth retrying, as opposed to a query error.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 08xxx connection exception, 57P01-03 admin/crash shutdown, cannot connect now
+		if len(pgErr.Code) == 5 && pgErr.Code[:2] == "08" {
+			return true
+		}
+		switch pgErr.Code {
+		case "57P01", "57P02", "57P03":
+			return true
+		}
+		return false
+	}
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) {
+		return true
+	}
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retry runs fn up to ReadRetries extra times while it fails with a transient error.
+func (p *Postgres) retry(ctx context.Context, fn func() error) error {
+	err := fn()
+	for attempt := 1; attempt <= p.ReadRetries && IsTransient(err); attempt++ {
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * readRetryBackoff):
+		}
+		err = fn()
+	}
+	return err
+}
+
+// Query is Pool.Query with a short retry on transient connection errors.
+// Use it for read-only statements only; writes must not be replayed blindly.
+func (p *Postgres) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	var rows pgx.Rows
+	err := p.retry(ctx, func() error {
+		var err error
+		rows, err = p.Pool.Query(ctx, sql, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRow is Pool.QueryRow with the same transient retry as Query, applied at Scan.
+func (p *Postgres) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return retryRow{p: p, ctx: ctx, sql: sql, args: args}
+}
+
+type retryRow struct {
+	p    *Postgres
+	ctx  context.Context
+	sql  string
+	args []any
+}
+
+func (r retryRow) Scan(dest ...any) error {
+	return r.p.retry(r.ctx, func() error {
+		return r.p.Pool.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+	})
+}
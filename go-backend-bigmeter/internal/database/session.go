@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sessionStatements returns the ALTER SESSION statements for ORACLE_SESSION_PARAMS,
+// one per parameter in key order so a rejected value names its parameter. Keys are
+// validated by the config loader; values are quoted.
+func sessionStatements(params map[string]string) []string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	stmts := make([]string, len(keys))
+	for i, k := range keys {
+		stmts[i] = fmt.Sprintf("ALTER SESSION SET %s='%s'", k, strings.ReplaceAll(params[k], "'", "''"))
+	}
+	return stmts
+}
+
+// sessionIniter executes stmts on a new connection; it is the driver's on-connect hook
+func sessionIniter(stmts []string) func(context.Context, driver.ConnPrepareContext) error {
+	return func(ctx context.Context, conn driver.ConnPrepareContext) error {
+		for _, q := range stmts {
+			st, err := conn.PrepareContext(ctx, q)
+			if err != nil {
+				return fmt.Errorf("%s: %w", q, err)
+			}
+			ex, ok := st.(driver.StmtExecContext)
+			if !ok {
+				st.Close()
+				return fmt.Errorf("%s: statement does not support ExecContext", q)
+			}
+			_, err = ex.ExecContext(ctx, nil)
+			st.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", q, err)
+			}
+		}
+		return nil
+	}
+}
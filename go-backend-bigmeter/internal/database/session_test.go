@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// initConn records the statements an on-connect hook executes
+type initConn struct {
+	executed []string
+	fail     string
+}
+
+func (c *initConn) PrepareContext(_ context.Context, query string) (driver.Stmt, error) {
+	return &initStmt{c: c, query: query}, nil
+}
+
+type initStmt struct {
+	c     *initConn
+	query string
+}
+
+func (s *initStmt) Close() error                               { return nil }
+func (s *initStmt) NumInput() int                              { return 0 }
+func (s *initStmt) Exec([]driver.Value) (driver.Result, error) { return nil, errors.New("not used") }
+func (s *initStmt) Query([]driver.Value) (driver.Rows, error)  { return nil, errors.New("not used") }
+func (s *initStmt) ExecContext(context.Context, []driver.NamedValue) (driver.Result, error) {
+	if s.query == s.c.fail {
+		return nil, errors.New("ORA-12705: invalid NLS parameter")
+	}
+	s.c.executed = append(s.c.executed, s.query)
+	return driver.RowsAffected(0), nil
+}
+
+func TestSessionIniter(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		fail    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "none", params: nil, want: nil},
+		{
+			name:   "sorted and quoted",
+			params: map[string]string{"NLS_NUMERIC_CHARACTERS": ".,", "NLS_DATE_FORMAT": "YYYY-MM-DD"},
+			want: []string{
+				"ALTER SESSION SET NLS_DATE_FORMAT='YYYY-MM-DD'",
+				"ALTER SESSION SET NLS_NUMERIC_CHARACTERS='.,'",
+			},
+		},
+		{
+			name:   "quote escaped",
+			params: map[string]string{"NLS_DATE_FORMAT": `DD "of" MM 'x'`},
+			want:   []string{`ALTER SESSION SET NLS_DATE_FORMAT='DD "of" MM ''x'''`},
+		},
+		{
+			name:    "rejected statement stops the connect",
+			params:  map[string]string{"NLS_DATE_FORMAT": "YYYY-MM-DD", "NLS_LANGUAGE": "NOPE"},
+			fail:    "ALTER SESSION SET NLS_DATE_FORMAT='YYYY-MM-DD'",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &initConn{fail: tt.fail}
+			err := sessionIniter(sessionStatements(tt.params))(context.Background(), conn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(conn.executed, tt.want) {
+				t.Errorf("executed %q, want %q", conn.executed, tt.want)
+			}
+		})
+	}
+}
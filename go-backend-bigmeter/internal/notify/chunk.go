@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// telegramMaxMessageLen is Telegram's limit on a single message's text
+const telegramMaxMessageLen = 4096
+
+// chunkTagReserve leaves room in each chunk for closing/re-opening HTML tags that
+// span a chunk boundary
+const chunkTagReserve = 128
+
+var htmlTagRe = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9-]*)[^>]*>`)
+
+// splitMessage breaks an HTML (ParseMode "HTML") message into chunks of at most limit
+// characters. It cuts at newline boundaries, falling back to a space or any rune
+// outside a tag for a single over-long line, so a tag is never cut in half. Elements
+// still open at a cut are closed at the end of the chunk and re-opened at the start
+// of the next, keeping every chunk valid HTML.
+func splitMessage(text string, limit int) []string {
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	budget := limit - chunkTagReserve
+	if budget < 1 {
+		budget = limit
+	}
+
+	var (
+		chunks []string
+		cur    strings.Builder
+		curLen int
+		open   []string // opening tags still open at the end of cur
+		reopen string   // tags to re-open at the start of the next chunk
+	)
+	flush := func() {
+		body := cur.String()
+		if strings.TrimSpace(stripTags(body)) != "" {
+			var closing strings.Builder
+			for i := len(open) - 1; i >= 0; i-- {
+				closing.WriteString("</" + tagName(open[i]) + ">")
+			}
+			chunks = append(chunks, strings.TrimRight(body, "\n")+closing.String())
+		}
+		reopen = strings.Join(open, "")
+		cur.Reset()
+		cur.WriteString(reopen)
+		curLen = utf8.RuneCountInString(reopen)
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		for _, seg := range cutLine(line, budget-utf8.RuneCountInString(reopen)) {
+			n := utf8.RuneCountInString(seg)
+			if curLen+n > budget && curLen > utf8.RuneCountInString(reopen) {
+				flush()
+			}
+			cur.WriteString(seg)
+			curLen += n
+			open = trackTags(open, seg)
+		}
+	}
+	if curLen > utf8.RuneCountInString(reopen) {
+		flush()
+	}
+	return chunks
+}
+
+// cutLine splits s into segments of at most max runes, preferring the last space and
+// never cutting inside a <...> tag.
+func cutLine(s string, max int) []string {
+	if max < 1 {
+		max = 1
+	}
+	var out []string
+	for utf8.RuneCountInString(s) > max {
+		runes := []rune(s)
+		cut, space, inTag := 0, 0, false
+		for i := 0; i < max; i++ {
+			switch runes[i] {
+			case '<':
+				inTag = true
+			case '>':
+				inTag = false
+				cut = i + 1
+				continue
+			case ' ':
+				if !inTag {
+					space = i + 1
+				}
+			}
+			if !inTag {
+				cut = i + 1
+			}
+		}
+		if space > 0 {
+			cut = space
+		}
+		if cut == 0 { // a single tag longer than max; keep it whole
+			cut = strings.IndexRune(string(runes), '>') + 1
+			if cut == 0 {
+				cut = len(runes)
+			}
+			cut = utf8.RuneCountInString(string(runes)[:cut])
+		}
+		out = append(out, string(runes[:cut]))
+		s = string(runes[cut:])
+	}
+	if s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// trackTags updates the stack of open element tags after the HTML in s.
+func trackTags(open []string, s string) []string {
+	for _, m := range htmlTagRe.FindAllStringSubmatch(s, -1) {
+		if m[1] == "" {
+			open = append(open, m[0])
+			continue
+		}
+		for i := len(open) - 1; i >= 0; i-- {
+			if tagName(open[i]) == m[2] {
+				open = append(open[:i], open[i+1:]...)
+				break
+			}
+		}
+	}
+	return open
+}
+
+func tagName(tag string) string {
+	if m := htmlTagRe.FindStringSubmatch(tag); m != nil {
+		return m[2]
+	}
+	return ""
+}
+
+func stripTags(s string) string {
+	return htmlTagRe.ReplaceAllString(s, "")
+}
@@ -0,0 +1,21 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// FormatDuration formats a duration in a human-readable way ("850ms", "12.4s",
+// "1.3m", "2.0h"). Notifications and the sync-log API share it.
+func FormatDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	if d < time.Hour {
+		return fmt.Sprintf("%.1fm", d.Minutes())
+	}
+	return fmt.Sprintf("%.1fh", d.Hours())
+}
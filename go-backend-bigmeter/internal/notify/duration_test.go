@@ -0,0 +1,24 @@
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                               "0ms",
+		850 * time.Millisecond:          "850ms",
+		time.Second:                     "1.0s",
+		12400 * time.Millisecond:        "12.4s",
+		78 * time.Second:                "1.3m",
+		59*time.Minute + 57*time.Second: "60.0m",
+		time.Hour:                       "1.0h",
+		150 * time.Minute:               "2.5h",
+	}
+	for d, want := range tests {
+		if got := FormatDuration(d); got != want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
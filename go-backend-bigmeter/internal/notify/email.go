@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailConfig holds SMTP settings for failure emails
+type EmailConfig struct {
+	Host     string
+	Port     int
+	Username string // empty: send without SMTP AUTH
+	Password string
+	From     string
+	To       []string
+}
+
+// EmailNotifier emails yearly/monthly sync failures for the audit trail. Success
+// messages and alert digests stay on the chat channels, and the runtime mute does
+// not apply: every failure is mailed.
+type EmailNotifier struct {
+	config EmailConfig
+}
+
+// NewEmailNotifier creates an email notifier; host, from and at least one recipient are required
+func NewEmailNotifier(config EmailConfig) (*EmailNotifier, error) {
+	if config.Host == "" || config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("email notifier requires SMTP host, from and to addresses")
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	return &EmailNotifier{config: config}, nil
+}
+
+// NotifyYearlySuccess is a no-op; only failures are emailed
+func (en *EmailNotifier) NotifyYearlySuccess(int, []string, time.Duration) {}
+
+// NotifyYearlyFailure emails the failed branches and error of a yearly init
+func (en *EmailNotifier) NotifyYearlyFailure(fiscalYear int, branches []string, failedBranches []string, err error) {
+	subject := fmt.Sprintf("[Big Meter] Yearly cohort init failed: fiscal year %d", fiscalYear)
+	en.sendFailure(subject, fmt.Sprintf("Fiscal Year: %d", fiscalYear), branches, failedBranches, err)
+}
+
+// NotifyMonthlySuccess is a no-op; only failures are emailed
+func (en *EmailNotifier) NotifyMonthlySuccess(string, []string, time.Duration) {}
+
+// NotifyMonthlyFailure emails the failed branches and error of a monthly sync
+func (en *EmailNotifier) NotifyMonthlyFailure(yearMonth string, branches []string, failedBranches []string, err error) {
+	subject := fmt.Sprintf("[Big Meter] Monthly sync failed: %s", yearMonth)
+	en.sendFailure(subject, "Year-Month: "+yearMonth, branches, failedBranches, err)
+}
+
+// SendAlertMessage is a no-op; alert digests are not emailed
+func (en *EmailNotifier) SendAlertMessage(string) error { return nil }
+
+// Flush is a no-op; emails are never deferred
+func (en *EmailNotifier) Flush() {}
+
+func (en *EmailNotifier) sendFailure(subject, period string, branches, failedBranches []string, err error) {
+	var body strings.Builder
+	body.WriteString(period + "\n")
+	body.WriteString(fmt.Sprintf("Failed Branches (%d of %d):\n", len(failedBranches), len(branches)))
+	for _, b := range failedBranches {
+		body.WriteString("  - " + b + "\n")
+	}
+	if err != nil {
+		body.WriteString("\nError: " + err.Error() + "\n")
+	}
+	body.WriteString("Time: " + time.Now().Format("2006-01-02 15:04:05") + "\n")
+
+	if err := en.send(subject, body.String()); err != nil {
+		log.Printf("email: failed to send %q: %v", subject, err)
+	} else {
+		log.Printf("email: failure notification sent to %d recipient(s)", len(en.config.To))
+	}
+}
+
+func (en *EmailNotifier) send(subject, body string) error {
+	var msg strings.Builder
+	msg.WriteString("From: " + en.config.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(en.config.To, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if en.config.Username != "" {
+		auth = smtp.PlainAuth("", en.config.Username, en.config.Password, en.config.Host)
+	}
+	addr := en.config.Host + ":" + strconv.Itoa(en.config.Port)
+	return smtp.SendMail(addr, auth, en.config.From, en.config.To, []byte(msg.String()))
+}
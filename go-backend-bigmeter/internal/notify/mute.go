@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const muteSettingKey = "notifications_muted_until"
+
+// MuteStore persists a runtime notification mute in bm_settings so that both the
+// API and the sync scheduler observe it without a redeploy.
+type MuteStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewMuteStore creates a mute store backed by Postgres
+func NewMuteStore(pool *pgxpool.Pool) *MuteStore {
+	return &MuteStore{pool: pool}
+}
+
+// Mute suppresses notifications until the given time
+func (m *MuteStore) Mute(ctx context.Context, until time.Time) error {
+	query := `INSERT INTO bm_settings (key, value, updated_at) VALUES ($1, $2, now())
+	          ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = now()`
+	if _, err := m.pool.Exec(ctx, query, muteSettingKey, until.UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("save notification mute: %w", err)
+	}
+	return nil
+}
+
+// Unmute clears any active mute
+func (m *MuteStore) Unmute(ctx context.Context) error {
+	if _, err := m.pool.Exec(ctx, `DELETE FROM bm_settings WHERE key = $1`, muteSettingKey); err != nil {
+		return fmt.Errorf("clear notification mute: %w", err)
+	}
+	return nil
+}
+
+// MutedUntil returns the mute expiry, or the zero time when no mute is set
+func (m *MuteStore) MutedUntil(ctx context.Context) (time.Time, error) {
+	var v string
+	err := m.pool.QueryRow(ctx, `SELECT value FROM bm_settings WHERE key = $1`, muteSettingKey).Scan(&v)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("load notification mute: %w", err)
+	}
+	until, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse notification mute: %w", err)
+	}
+	return until, nil
+}
+
+// activeMute reports whether notifications are muted right now. Lookup errors
+// are treated as "not muted" so a settings problem never silences failures.
+func (m *MuteStore) activeMute() (time.Time, bool) {
+	if m == nil || m.pool == nil {
+		return time.Time{}, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	until, err := m.MutedUntil(ctx)
+	if err != nil {
+		log.Printf("notify: mute lookup failed, delivering anyway: %v", err)
+		return time.Time{}, false
+	}
+	return until, time.Now().Before(until)
+}
@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-backend-bigmeter/internal/database/dbtest"
+)
+
+// slackSink is a fake Slack webhook recording the text of every post
+type slackSink struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func newSlackSink(t *testing.T) (*slackSink, string) {
+	t.Helper()
+	sink := &slackSink{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		sink.mu.Lock()
+		sink.texts = append(sink.texts, body.Text)
+		sink.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	return sink, srv.URL
+}
+
+func (s *slackSink) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.texts...)
+}
+
+func TestMuteSuppressesSends(t *testing.T) {
+	tests := []struct {
+		name      string
+		mute      func(ctx context.Context, m *MuteStore) error
+		delivered bool
+	}{
+		{name: "no mute", mute: func(context.Context, *MuteStore) error { return nil }, delivered: true},
+		{
+			name:      "inside mute window",
+			mute:      func(ctx context.Context, m *MuteStore) error { return m.Mute(ctx, time.Now().Add(time.Hour)) },
+			delivered: false,
+		},
+		{
+			name:      "mute expired",
+			mute:      func(ctx context.Context, m *MuteStore) error { return m.Mute(ctx, time.Now().Add(-time.Minute)) },
+			delivered: true,
+		},
+		{
+			name: "unmuted",
+			mute: func(ctx context.Context, m *MuteStore) error {
+				if err := m.Mute(ctx, time.Now().Add(time.Hour)); err != nil {
+					return err
+				}
+				return m.Unmute(ctx)
+			},
+			delivered: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := dbtest.Postgres(t)
+			mute := NewMuteStore(pg.Pool)
+			if err := tt.mute(context.Background(), mute); err != nil {
+				t.Fatal(err)
+			}
+			sink, url := newSlackSink(t)
+			sn, err := NewSlackNotifier(SlackConfig{WebhookURL: url})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sn.SetMuteStore(mute)
+
+			sn.NotifyMonthlySuccess("202410", []string{"BA01"}, time.Minute)
+			if err := sn.SendAlertMessage("digest"); err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			if tt.delivered {
+				want = 2
+			}
+			if got := sink.received(); len(got) != want {
+				t.Errorf("delivered %d messages, want %d: %q", len(got), want, got)
+			}
+		})
+	}
+}
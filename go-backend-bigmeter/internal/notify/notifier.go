@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Notification providers (NOTIFY_PROVIDER)
+const (
+	ProviderTelegram = "telegram"
+	ProviderSlack    = "slack"
+	ProviderNone     = "none"
+)
+
+// Notifier delivers sync results and alert digests. Messages are written in the
+// Telegram HTML subset used by the templates; each provider renders them in its own
+// markup (Slack converts to mrkdwn).
+type Notifier interface {
+	NotifyYearlySuccess(fiscalYear int, branches []string, duration time.Duration)
+	NotifyYearlyFailure(fiscalYear int, branches []string, failedBranches []string, err error)
+	NotifyMonthlySuccess(yearMonth string, branches []string, duration time.Duration)
+	NotifyMonthlyFailure(yearMonth string, branches []string, failedBranches []string, err error)
+	SendAlertMessage(message string) error
+	// Flush sends notifications held back for quiet hours right away; call it before
+	// the process exits, as they are only kept in memory
+	Flush()
+}
+
+// NewNotifier builds the notifier for provider. Both Telegram and Slack take their
+// message templates, quiet hours and retry settings from tg; mute is applied to either.
+func NewNotifier(provider string, tg TelegramConfig, slack SlackConfig, mute *MuteStore) (Notifier, error) {
+	switch provider {
+	case ProviderTelegram, "":
+		tn, err := NewTelegramNotifier(tg)
+		if err != nil {
+			return nil, err
+		}
+		tn.SetMuteStore(mute)
+		return tn, nil
+	case ProviderSlack:
+		slack.YearlyPrefix, slack.MonthlyPrefix = tg.YearlyPrefix, tg.MonthlyPrefix
+		slack.YearlySuccessMsg, slack.YearlyFailureMsg = tg.YearlySuccessMsg, tg.YearlyFailureMsg
+		slack.MonthlySuccessMsg, slack.MonthlyFailureMsg = tg.MonthlySuccessMsg, tg.MonthlyFailureMsg
+		slack.QuietHours, slack.CriticalBranches, slack.Location = tg.QuietHours, tg.CriticalBranches, tg.Location
+		slack.SuppressSuccess = tg.SuppressSuccess
+		slack.SendAttempts, slack.RetryDelay = tg.SendAttempts, tg.RetryDelay
+		sn, err := NewSlackNotifier(slack)
+		if err != nil {
+			return nil, err
+		}
+		sn.SetMuteStore(mute)
+		return sn, nil
+	case ProviderNone:
+		return NoopNotifier{}, nil
+	default:
+		return nil, fmt.Errorf("unknown notify provider %q", provider)
+	}
+}
+
+// NoopNotifier discards every notification (NOTIFY_PROVIDER=none)
+type NoopNotifier struct{}
+
+func (NoopNotifier) NotifyYearlySuccess(int, []string, time.Duration)       {}
+func (NoopNotifier) NotifyYearlyFailure(int, []string, []string, error)     {}
+func (NoopNotifier) NotifyMonthlySuccess(string, []string, time.Duration)   {}
+func (NoopNotifier) NotifyMonthlyFailure(string, []string, []string, error) {}
+func (NoopNotifier) SendAlertMessage(string) error                          { return nil }
+func (NoopNotifier) Flush()                                                 {}
+
+// MultiNotifier fans every notification out to all enabled channels in order
+type MultiNotifier []Notifier
+
+func (m MultiNotifier) NotifyYearlySuccess(fiscalYear int, branches []string, duration time.Duration) {
+	for _, n := range m {
+		n.NotifyYearlySuccess(fiscalYear, branches, duration)
+	}
+}
+
+func (m MultiNotifier) NotifyYearlyFailure(fiscalYear int, branches []string, failedBranches []string, err error) {
+	for _, n := range m {
+		n.NotifyYearlyFailure(fiscalYear, branches, failedBranches, err)
+	}
+}
+
+func (m MultiNotifier) NotifyMonthlySuccess(yearMonth string, branches []string, duration time.Duration) {
+	for _, n := range m {
+		n.NotifyMonthlySuccess(yearMonth, branches, duration)
+	}
+}
+
+func (m MultiNotifier) NotifyMonthlyFailure(yearMonth string, branches []string, failedBranches []string, err error) {
+	for _, n := range m {
+		n.NotifyMonthlyFailure(yearMonth, branches, failedBranches, err)
+	}
+}
+
+// Flush flushes every channel
+func (m MultiNotifier) Flush() {
+	for _, n := range m {
+		n.Flush()
+	}
+}
+
+// SendAlertMessage sends to every channel, returning the joined errors of those that failed
+func (m MultiNotifier) SendAlertMessage(message string) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.SendAlertMessage(message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func yearlySuccessMessage(prefix, template string, fiscalYear int, branches []string, duration time.Duration) string {
+	return buildMessage(prefix, template, map[string]string{
+		"{fiscal_year}": fmt.Sprintf("%d", fiscalYear),
+		"{branches}":    strings.Join(branches, ", "),
+		"{count}":       fmt.Sprintf("%d", len(branches)),
+		"{duration}":    FormatDuration(duration),
+		"{timestamp}":   time.Now().Format("2006-01-02 15:04:05"),
+	})
+}
+
+func yearlyFailureMessage(prefix, template string, fiscalYear int, branches, failedBranches []string, err error) string {
+	return buildMessage(prefix, template, map[string]string{
+		"{fiscal_year}":     fmt.Sprintf("%d", fiscalYear),
+		"{branches}":        strings.Join(branches, ", "),
+		"{failed_branches}": strings.Join(failedBranches, ", "),
+		"{error}":           err.Error(),
+		"{timestamp}":       time.Now().Format("2006-01-02 15:04:05"),
+	})
+}
+
+func monthlySuccessMessage(prefix, template, yearMonth string, branches []string, duration time.Duration) string {
+	return buildMessage(prefix, template, map[string]string{
+		"{year_month}": yearMonth,
+		"{branches}":   strings.Join(branches, ", "),
+		"{count}":      fmt.Sprintf("%d", len(branches)),
+		"{duration}":   FormatDuration(duration),
+		"{timestamp}":  time.Now().Format("2006-01-02 15:04:05"),
+	})
+}
+
+func monthlyFailureMessage(prefix, template, yearMonth string, branches, failedBranches []string, err error) string {
+	return buildMessage(prefix, template, map[string]string{
+		"{year_month}":      yearMonth,
+		"{branches}":        strings.Join(branches, ", "),
+		"{failed_branches}": strings.Join(failedBranches, ", "),
+		"{error}":           err.Error(),
+		"{timestamp}":       time.Now().Format("2006-01-02 15:04:05"),
+	})
+}
+
+// buildMessage constructs the final message by replacing placeholders
+func buildMessage(prefix, template string, replacements map[string]string) string {
+	message := template
+	for key, value := range replacements {
+		message = strings.ReplaceAll(message, key, value)
+	}
+
+	if prefix != "" {
+		return prefix + "\n" + message
+	}
+	return message
+}
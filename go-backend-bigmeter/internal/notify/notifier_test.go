@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSuppressSuccess(t *testing.T) {
+	failure := errors.New("boom")
+	tests := []struct {
+		name     string
+		suppress bool
+		notify   func(n Notifier)
+		wantSent bool
+	}{
+		{name: "monthly success", notify: func(n Notifier) { n.NotifyMonthlySuccess("202410", []string{"BA01"}, time.Minute) }, wantSent: true},
+		{name: "yearly success", notify: func(n Notifier) { n.NotifyYearlySuccess(2025, []string{"BA01"}, time.Minute) }, wantSent: true},
+		{name: "monthly success suppressed", suppress: true, notify: func(n Notifier) { n.NotifyMonthlySuccess("202410", []string{"BA01"}, time.Minute) }},
+		{name: "yearly success suppressed", suppress: true, notify: func(n Notifier) { n.NotifyYearlySuccess(2025, []string{"BA01"}, time.Minute) }},
+		{
+			name: "monthly failure still sent", suppress: true, wantSent: true,
+			notify: func(n Notifier) { n.NotifyMonthlyFailure("202410", []string{"BA01"}, []string{"BA01"}, failure) },
+		},
+		{
+			name: "yearly failure still sent", suppress: true, wantSent: true,
+			notify: func(n Notifier) { n.NotifyYearlyFailure(2025, []string{"BA01"}, []string{"BA01"}, failure) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, url := newSlackSink(t)
+			n, err := NewNotifier(ProviderSlack, TelegramConfig{SuppressSuccess: tt.suppress}, SlackConfig{WebhookURL: url}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.notify(n)
+			if sent := len(sink.received()) == 1; sent != tt.wantSent {
+				t.Errorf("sent = %t, want %t", sent, tt.wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuietHours is a daily window (in a given location) during which non-critical
+// notifications are held back. The window may wrap midnight, e.g. 22:00-06:00.
+type QuietHours struct {
+	start int // minutes after midnight
+	end   int
+	loc   *time.Location
+}
+
+// ParseQuietHours parses "HH:MM-HH:MM". An empty spec returns nil (no quiet hours).
+func ParseQuietHours(spec string, loc *time.Location) (*QuietHours, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	parts := strings.Split(spec, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid quiet hours %q; expect HH:MM-HH:MM", spec)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours start: %w", err)
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours end: %w", err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid quiet hours %q; start and end must differ", spec)
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	return &QuietHours{start: start, end: end, loc: loc}, nil
+}
+
+func parseClock(s string) (int, error) {
+	hm := strings.Split(strings.TrimSpace(s), ":")
+	if len(hm) != 2 {
+		return 0, fmt.Errorf("expect HH:MM, got %q", s)
+	}
+	h, err := strconv.Atoi(hm[0])
+	if err != nil || h < 0 || h > 23 {
+		return 0, fmt.Errorf("invalid hour in %q", s)
+	}
+	m, err := strconv.Atoi(hm[1])
+	if err != nil || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid minute in %q", s)
+	}
+	return h*60 + m, nil
+}
+
+// Contains reports whether t falls inside the quiet window.
+func (q *QuietHours) Contains(t time.Time) bool {
+	if q == nil {
+		return false
+	}
+	lt := t.In(q.loc)
+	m := lt.Hour()*60 + lt.Minute()
+	if q.start < q.end {
+		return m >= q.start && m < q.end
+	}
+	return m >= q.start || m < q.end
+}
+
+// NextActive returns the first moment at or after t that is outside the quiet window.
+func (q *QuietHours) NextActive(t time.Time) time.Time {
+	if !q.Contains(t) {
+		return t
+	}
+	lt := t.In(q.loc)
+	end := time.Date(lt.Year(), lt.Month(), lt.Day(), q.end/60, q.end%60, 0, 0, q.loc)
+	if !end.After(lt) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+// quietQueue holds deferred messages and flushes them once quiet hours end. The
+// queue lives in memory only: flush it before the process exits or it is lost.
+type quietQueue struct {
+	mu      sync.Mutex
+	pending []string
+	timer   *time.Timer
+	send    func(string)
+}
+
+// hold queues text and schedules a single flush at the next active time.
+func (qq *quietQueue) hold(text string, at time.Time, send func(string)) {
+	qq.mu.Lock()
+	defer qq.mu.Unlock()
+	qq.pending = append(qq.pending, text)
+	qq.send = send
+	if qq.timer != nil {
+		return
+	}
+	qq.timer = time.AfterFunc(time.Until(at), func() {
+		qq.flush("quiet hours ended")
+	})
+}
+
+// flush sends every held message now and cancels the scheduled flush
+func (qq *quietQueue) flush(reason string) {
+	qq.mu.Lock()
+	msgs, send := qq.pending, qq.send
+	qq.pending = nil
+	if qq.timer != nil {
+		qq.timer.Stop()
+		qq.timer = nil
+	}
+	qq.mu.Unlock()
+	if len(msgs) == 0 {
+		return
+	}
+	log.Printf("notify: %s, sending %d deferred notification(s)", reason, len(msgs))
+	for _, m := range msgs {
+		send(m)
+	}
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuietHoursContains(t *testing.T) {
+	tests := []struct {
+		spec  string
+		clock string
+		want  bool
+	}{
+		{spec: "22:00-06:00", clock: "23:30", want: true},
+		{spec: "22:00-06:00", clock: "03:00", want: true},
+		{spec: "22:00-06:00", clock: "06:00", want: false},
+		{spec: "22:00-06:00", clock: "12:00", want: false},
+		{spec: "12:00-13:00", clock: "12:30", want: true},
+		{spec: "12:00-13:00", clock: "13:00", want: false},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuietHours(tt.spec, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		at, _ := time.Parse("15:04", tt.clock)
+		if got := q.Contains(at); got != tt.want {
+			t.Errorf("%s contains %s = %t, want %t", tt.spec, tt.clock, got, tt.want)
+		}
+	}
+}
+
+func TestQuietHoursDefer(t *testing.T) {
+	// a window around now, so dispatch always sees quiet hours
+	now := time.Now().UTC()
+	spec := now.Add(-time.Hour).Format("15:04") + "-" + now.Add(time.Hour).Format("15:04")
+	tests := []struct {
+		name      string
+		notify    func(sn *SlackNotifier)
+		immediate bool
+	}{
+		{
+			name:   "non-critical success deferred",
+			notify: func(sn *SlackNotifier) { sn.NotifyMonthlySuccess("202410", []string{"BA01"}, time.Minute) },
+		},
+		{
+			name: "non-critical failure deferred",
+			notify: func(sn *SlackNotifier) {
+				sn.NotifyMonthlyFailure("202410", []string{"BA01", "BA02"}, []string{"BA02"}, errors.New("boom"))
+			},
+		},
+		{
+			name: "critical failure sent",
+			notify: func(sn *SlackNotifier) {
+				sn.NotifyMonthlyFailure("202410", []string{"BA01", "BA02"}, []string{"BA01"}, errors.New("boom"))
+			},
+			immediate: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, url := newSlackSink(t)
+			sn, err := NewSlackNotifier(SlackConfig{
+				WebhookURL:       url,
+				QuietHours:       spec,
+				CriticalBranches: []string{"BA01"},
+				Location:         time.UTC,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.notify(sn)
+			want := 0
+			if tt.immediate {
+				want = 1
+			}
+			if got := len(sink.received()); got != want {
+				t.Fatalf("sent %d before flush, want %d", got, want)
+			}
+			// deferred messages go out when the process flushes before exit
+			sn.Flush()
+			if got := len(sink.received()); got != 1 {
+				t.Errorf("sent %d after flush, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SlackConfig holds Slack incoming-webhook settings. Templates use the same HTML
+// subset as Telegram and are converted to mrkdwn before posting.
+type SlackConfig struct {
+	WebhookURL        string
+	Timeout           time.Duration
+	YearlyPrefix      string
+	MonthlyPrefix     string
+	YearlySuccessMsg  string
+	YearlyFailureMsg  string
+	MonthlySuccessMsg string
+	MonthlyFailureMsg string
+	QuietHours        string
+	CriticalBranches  []string
+	Location          *time.Location
+	SuppressSuccess   bool
+	// SendAttempts and RetryDelay work as in TelegramConfig (default 3 and 1s)
+	SendAttempts int
+	RetryDelay   time.Duration
+}
+
+// SlackNotifier posts notifications to a Slack incoming webhook
+type SlackNotifier struct {
+	config   SlackConfig
+	client   *http.Client
+	mute     *MuteStore
+	quiet    *QuietHours
+	queue    quietQueue
+	critical map[string]bool
+}
+
+// NewSlackNotifier creates a Slack notifier; the webhook URL is required
+func NewSlackNotifier(config SlackConfig) (*SlackNotifier, error) {
+	if config.WebhookURL == "" {
+		return nil, fmt.Errorf("slack webhook URL is required")
+	}
+	if config.SendAttempts <= 0 {
+		config.SendAttempts = 3
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	quiet, err := ParseQuietHours(config.QuietHours, config.Location)
+	if err != nil {
+		return nil, err
+	}
+	critical := make(map[string]bool, len(config.CriticalBranches))
+	for _, b := range config.CriticalBranches {
+		critical[strings.TrimSpace(b)] = true
+	}
+	return &SlackNotifier{
+		config:   config,
+		client:   &http.Client{Timeout: config.Timeout},
+		quiet:    quiet,
+		critical: critical,
+	}, nil
+}
+
+// SetMuteStore enables the runtime mute check on every send path
+func (sn *SlackNotifier) SetMuteStore(m *MuteStore) {
+	sn.mute = m
+}
+
+// NotifyYearlySuccess posts a notification for successful yearly sync
+func (sn *SlackNotifier) NotifyYearlySuccess(fiscalYear int, branches []string, duration time.Duration) {
+	if sn.config.SuppressSuccess {
+		return
+	}
+	sn.dispatch(yearlySuccessMessage(sn.config.YearlyPrefix, sn.config.YearlySuccessMsg, fiscalYear, branches, duration), false)
+}
+
+// NotifyYearlyFailure posts a notification for failed yearly sync
+func (sn *SlackNotifier) NotifyYearlyFailure(fiscalYear int, branches []string, failedBranches []string, err error) {
+	sn.dispatch(yearlyFailureMessage(sn.config.YearlyPrefix, sn.config.YearlyFailureMsg, fiscalYear, branches, failedBranches, err), sn.anyCritical(failedBranches))
+}
+
+// NotifyMonthlySuccess posts a notification for successful monthly sync
+func (sn *SlackNotifier) NotifyMonthlySuccess(yearMonth string, branches []string, duration time.Duration) {
+	if sn.config.SuppressSuccess {
+		return
+	}
+	sn.dispatch(monthlySuccessMessage(sn.config.MonthlyPrefix, sn.config.MonthlySuccessMsg, yearMonth, branches, duration), false)
+}
+
+// NotifyMonthlyFailure posts a notification for failed monthly sync
+func (sn *SlackNotifier) NotifyMonthlyFailure(yearMonth string, branches []string, failedBranches []string, err error) {
+	sn.dispatch(monthlyFailureMessage(sn.config.MonthlyPrefix, sn.config.MonthlyFailureMsg, yearMonth, branches, failedBranches, err), sn.anyCritical(failedBranches))
+}
+
+// SendAlertMessage posts an alert digest
+func (sn *SlackNotifier) SendAlertMessage(message string) error {
+	if until, muted := sn.mute.activeMute(); muted {
+		log.Printf("slack: notifications muted until %s, alert not delivered: %q", until.Format(time.RFC3339), message)
+		return nil
+	}
+	if err := sn.send(message); err != nil {
+		return fmt.Errorf("failed to send alert message: %w", err)
+	}
+	log.Printf("slack: alert notification sent successfully")
+	return nil
+}
+
+func (sn *SlackNotifier) anyCritical(branches []string) bool {
+	for _, b := range branches {
+		if sn.critical[strings.TrimSpace(b)] {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch posts immediately, or defers non-critical messages until quiet hours end
+func (sn *SlackNotifier) dispatch(text string, critical bool) {
+	now := time.Now()
+	if !critical && sn.quiet.Contains(now) {
+		at := sn.quiet.NextActive(now)
+		log.Printf("slack: quiet hours, deferring notification until %s", at.Format(time.RFC3339))
+		sn.queue.hold(text, at, sn.sendMessage)
+		return
+	}
+	sn.sendMessage(text)
+}
+
+// Flush posts the notifications deferred by quiet hours now
+func (sn *SlackNotifier) Flush() {
+	sn.queue.flush("flushing before exit")
+}
+
+func (sn *SlackNotifier) sendMessage(text string) {
+	if until, muted := sn.mute.activeMute(); muted {
+		log.Printf("slack: notifications muted until %s, not delivering: %q", until.Format(time.RFC3339), text)
+		return
+	}
+	if err := sn.send(text); err != nil {
+		log.Printf("slack: failed to send message: %v", err)
+	} else {
+		log.Printf("slack: notification sent successfully")
+	}
+}
+
+// send converts text to mrkdwn and posts it, retrying failures with exponential
+// backoff. A 429 waits the Retry-After Slack asks for instead.
+func (sn *SlackNotifier) send(text string) error {
+	body, err := json.Marshal(map[string]any{"text": htmlToMrkdwn(text), "mrkdwn": true})
+	if err != nil {
+		return err
+	}
+	attempts := sn.config.SendAttempts
+	delay := sn.config.RetryDelay
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var retryAfter time.Duration
+		if retryAfter, err = sn.post(body); err == nil {
+			return nil
+		}
+		log.Printf("slack: send attempt %d/%d failed: %v", attempt, attempts, err)
+		if attempt == attempts {
+			break
+		}
+		wait := delay
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		time.Sleep(wait)
+		delay *= 2
+	}
+	return err
+}
+
+// post sends one webhook request; on a 429 it also returns the Retry-After delay
+func (sn *SlackNotifier) post(body []byte) (time.Duration, error) {
+	resp, err := sn.client.Post(sn.config.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return time.Duration(secs) * time.Second, fmt.Errorf("rate limited: %s", resp.Status)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return 0, nil
+}
+
+var hrefRe = regexp.MustCompile(`href\s*=\s*"([^"]*)"`)
+
+// htmlToMrkdwn renders the Telegram HTML subset as Slack mrkdwn: <b> → *bold*,
+// <i> → _italic_, <s> → ~strike~, <code>/<pre> → backticks and <a href> → <url|text>.
+// Other tags are dropped; text is unescaped from HTML and re-escaped for Slack.
+func htmlToMrkdwn(s string) string {
+	var out strings.Builder
+	last, inLink := 0, false
+	for _, m := range htmlTagRe.FindAllStringSubmatchIndex(s, -1) {
+		out.WriteString(slackEscape(html.UnescapeString(s[last:m[0]])))
+		last = m[1]
+		closing := s[m[2]:m[3]] == "/"
+		switch strings.ToLower(s[m[4]:m[5]]) {
+		case "b", "strong":
+			out.WriteString("*")
+		case "i", "em":
+			out.WriteString("_")
+		case "s", "strike", "del":
+			out.WriteString("~")
+		case "code":
+			out.WriteString("`")
+		case "pre":
+			out.WriteString("```")
+		case "a":
+			if closing && inLink {
+				out.WriteString(">")
+				inLink = false
+			} else if href := hrefRe.FindStringSubmatch(s[m[0]:m[1]]); !closing && href != nil {
+				out.WriteString("<" + html.UnescapeString(href[1]) + "|")
+				inLink = true
+			}
+		}
+	}
+	out.WriteString(slackEscape(html.UnescapeString(s[last:])))
+	return out.String()
+}
+
+// slackEscape escapes the three characters Slack treats as control sequences
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
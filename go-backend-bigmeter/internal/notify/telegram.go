@@ -1,6 +1,7 @@
 package notify
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -20,16 +21,37 @@ type TelegramConfig struct {
 	YearlyFailureMsg  string
 	MonthlySuccessMsg string
 	MonthlyFailureMsg string
+	// QuietHours ("HH:MM-HH:MM" in Location) defers non-critical notifications
+	QuietHours string
+	// CriticalBranches bypass quiet hours when they appear in a failure
+	CriticalBranches []string
+	Location         *time.Location
+	// SuppressSuccess skips yearly/monthly success messages (failures still send)
+	SuppressSuccess bool
+	// SendAttempts is how many times a failed send is tried (default 3; 1 = no retry)
+	SendAttempts int
+	// RetryDelay is the wait before the second attempt, doubling after each failure (default 1s)
+	RetryDelay time.Duration
 }
 
 // TelegramNotifier sends notifications to Telegram
 type TelegramNotifier struct {
-	bot    *tgbotapi.BotAPI
-	config TelegramConfig
+	bot      *tgbotapi.BotAPI
+	config   TelegramConfig
+	mute     *MuteStore
+	quiet    *QuietHours
+	queue    quietQueue
+	critical map[string]bool
 }
 
 // NewTelegramNotifier creates a new Telegram notifier
 func NewTelegramNotifier(config TelegramConfig) (*TelegramNotifier, error) {
+	if config.SendAttempts <= 0 {
+		config.SendAttempts = 3
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = time.Second
+	}
 	if !config.Enabled {
 		return &TelegramNotifier{config: config}, nil
 	}
@@ -42,36 +64,42 @@ func NewTelegramNotifier(config TelegramConfig) (*TelegramNotifier, error) {
 		return nil, fmt.Errorf("telegram chat ID is required when enabled")
 	}
 
+	quiet, err := ParseQuietHours(config.QuietHours, config.Location)
+	if err != nil {
+		return nil, err
+	}
+	critical := make(map[string]bool, len(config.CriticalBranches))
+	for _, b := range config.CriticalBranches {
+		critical[strings.TrimSpace(b)] = true
+	}
+
 	bot, err := tgbotapi.NewBotAPI(config.BotToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create telegram bot: %w", err)
 	}
 
 	return &TelegramNotifier{
-		bot:    bot,
-		config: config,
+		bot:      bot,
+		config:   config,
+		quiet:    quiet,
+		critical: critical,
 	}, nil
 }
 
+// SetMuteStore enables the runtime mute check on every send path
+func (tn *TelegramNotifier) SetMuteStore(m *MuteStore) {
+	tn.mute = m
+}
+
 // NotifyYearlySuccess sends a notification for successful yearly sync
 func (tn *TelegramNotifier) NotifyYearlySuccess(fiscalYear int, branches []string, duration time.Duration) {
-	if !tn.config.Enabled {
+	if !tn.config.Enabled || tn.config.SuppressSuccess {
 		return
 	}
 
-	message := tn.buildMessage(
-		tn.config.YearlyPrefix,
-		tn.config.YearlySuccessMsg,
-		map[string]string{
-			"{fiscal_year}": fmt.Sprintf("%d", fiscalYear),
-			"{branches}":    strings.Join(branches, ", "),
-			"{count}":       fmt.Sprintf("%d", len(branches)),
-			"{duration}":    formatDuration(duration),
-			"{timestamp}":   time.Now().Format("2006-01-02 15:04:05"),
-		},
-	)
+	message := yearlySuccessMessage(tn.config.YearlyPrefix, tn.config.YearlySuccessMsg, fiscalYear, branches, duration)
 
-	tn.sendMessage(message)
+	tn.dispatch(message, false)
 }
 
 // NotifyYearlyFailure sends a notification for failed yearly sync
@@ -80,40 +108,20 @@ func (tn *TelegramNotifier) NotifyYearlyFailure(fiscalYear int, branches []strin
 		return
 	}
 
-	message := tn.buildMessage(
-		tn.config.YearlyPrefix,
-		tn.config.YearlyFailureMsg,
-		map[string]string{
-			"{fiscal_year}":     fmt.Sprintf("%d", fiscalYear),
-			"{branches}":        strings.Join(branches, ", "),
-			"{failed_branches}": strings.Join(failedBranches, ", "),
-			"{error}":           err.Error(),
-			"{timestamp}":       time.Now().Format("2006-01-02 15:04:05"),
-		},
-	)
+	message := yearlyFailureMessage(tn.config.YearlyPrefix, tn.config.YearlyFailureMsg, fiscalYear, branches, failedBranches, err)
 
-	tn.sendMessage(message)
+	tn.dispatch(message, tn.anyCritical(failedBranches))
 }
 
 // NotifyMonthlySuccess sends a notification for successful monthly sync
 func (tn *TelegramNotifier) NotifyMonthlySuccess(yearMonth string, branches []string, duration time.Duration) {
-	if !tn.config.Enabled {
+	if !tn.config.Enabled || tn.config.SuppressSuccess {
 		return
 	}
 
-	message := tn.buildMessage(
-		tn.config.MonthlyPrefix,
-		tn.config.MonthlySuccessMsg,
-		map[string]string{
-			"{year_month}": yearMonth,
-			"{branches}":   strings.Join(branches, ", "),
-			"{count}":      fmt.Sprintf("%d", len(branches)),
-			"{duration}":   formatDuration(duration),
-			"{timestamp}":  time.Now().Format("2006-01-02 15:04:05"),
-		},
-	)
+	message := monthlySuccessMessage(tn.config.MonthlyPrefix, tn.config.MonthlySuccessMsg, yearMonth, branches, duration)
 
-	tn.sendMessage(message)
+	tn.dispatch(message, false)
 }
 
 // NotifyMonthlyFailure sends a notification for failed monthly sync
@@ -122,32 +130,36 @@ func (tn *TelegramNotifier) NotifyMonthlyFailure(yearMonth string, branches []st
 		return
 	}
 
-	message := tn.buildMessage(
-		tn.config.MonthlyPrefix,
-		tn.config.MonthlyFailureMsg,
-		map[string]string{
-			"{year_month}":      yearMonth,
-			"{branches}":        strings.Join(branches, ", "),
-			"{failed_branches}": strings.Join(failedBranches, ", "),
-			"{error}":           err.Error(),
-			"{timestamp}":       time.Now().Format("2006-01-02 15:04:05"),
-		},
-	)
+	message := monthlyFailureMessage(tn.config.MonthlyPrefix, tn.config.MonthlyFailureMsg, yearMonth, branches, failedBranches, err)
 
-	tn.sendMessage(message)
+	tn.dispatch(message, tn.anyCritical(failedBranches))
 }
 
-// buildMessage constructs the final message by replacing placeholders
-func (tn *TelegramNotifier) buildMessage(prefix, template string, replacements map[string]string) string {
-	message := template
-	for key, value := range replacements {
-		message = strings.ReplaceAll(message, key, value)
+// anyCritical reports whether any of the branches is configured as critical
+func (tn *TelegramNotifier) anyCritical(branches []string) bool {
+	for _, b := range branches {
+		if tn.critical[strings.TrimSpace(b)] {
+			return true
+		}
 	}
+	return false
+}
 
-	if prefix != "" {
-		return prefix + "\n" + message
+// dispatch sends immediately, or defers non-critical messages until quiet hours end
+func (tn *TelegramNotifier) dispatch(text string, critical bool) {
+	now := time.Now()
+	if !critical && tn.quiet.Contains(now) {
+		at := tn.quiet.NextActive(now)
+		log.Printf("telegram: quiet hours, deferring notification until %s", at.Format(time.RFC3339))
+		tn.queue.hold(text, at, tn.sendMessage)
+		return
 	}
-	return message
+	tn.sendMessage(text)
+}
+
+// Flush sends the notifications deferred by quiet hours now
+func (tn *TelegramNotifier) Flush() {
+	tn.queue.flush("flushing before exit")
 }
 
 // sendMessage sends a message to Telegram
@@ -156,12 +168,15 @@ func (tn *TelegramNotifier) sendMessage(text string) {
 		log.Printf("telegram: bot not initialized, skipping notification")
 		return
 	}
+	if until, muted := tn.mute.activeMute(); muted {
+		log.Printf("telegram: notifications muted until %s, not delivering: %q", until.Format(time.RFC3339), text)
+		return
+	}
 
 	msg := tgbotapi.NewMessage(tn.config.ChatID, text)
 	msg.ParseMode = "HTML"
 
-	_, err := tn.bot.Send(msg)
-	if err != nil {
+	if err := tn.send(msg); err != nil {
 		log.Printf("telegram: failed to send message: %v", err)
 	} else {
 		log.Printf("telegram: notification sent successfully")
@@ -178,6 +193,11 @@ func (tn *TelegramNotifier) SendTestMessage() error {
 		return fmt.Errorf("telegram bot not initialized")
 	}
 
+	if until, muted := tn.mute.activeMute(); muted {
+		log.Printf("telegram: notifications muted until %s, test message not delivered", until.Format(time.RFC3339))
+		return fmt.Errorf("telegram notifications are muted until %s", until.Format(time.RFC3339))
+	}
+
 	message := fmt.Sprintf("🧪 <b>Big Meter - Test Notification</b>\n\n"+
 		"✅ Telegram integration is working correctly!\n"+
 		"Time: %s", time.Now().Format("2006-01-02 15:04:05"))
@@ -185,8 +205,7 @@ func (tn *TelegramNotifier) SendTestMessage() error {
 	msg := tgbotapi.NewMessage(tn.config.ChatID, message)
 	msg.ParseMode = "HTML"
 
-	_, err := tn.bot.Send(msg)
-	if err != nil {
+	if err := tn.send(msg); err != nil {
 		return fmt.Errorf("failed to send test message: %w", err)
 	}
 
@@ -204,28 +223,49 @@ func (tn *TelegramNotifier) SendAlertMessage(message string) error {
 		return fmt.Errorf("telegram bot not initialized")
 	}
 
-	msg := tgbotapi.NewMessage(tn.config.ChatID, message)
-	msg.ParseMode = "HTML"
+	if until, muted := tn.mute.activeMute(); muted {
+		log.Printf("telegram: notifications muted until %s, alert not delivered: %q", until.Format(time.RFC3339), message)
+		return nil
+	}
 
-	_, err := tn.bot.Send(msg)
-	if err != nil {
-		return fmt.Errorf("failed to send alert message: %w", err)
+	// A digest with many branches can exceed Telegram's 4096-character limit; send it
+	// as consecutive messages instead of failing the whole send
+	chunks := splitMessage(message, telegramMaxMessageLen)
+	for i, chunk := range chunks {
+		msg := tgbotapi.NewMessage(tn.config.ChatID, chunk)
+		msg.ParseMode = "HTML"
+
+		if err := tn.send(msg); err != nil {
+			return fmt.Errorf("failed to send alert message (part %d/%d): %w", i+1, len(chunks), err)
+		}
 	}
 
-	log.Printf("telegram: alert notification sent successfully")
+	log.Printf("telegram: alert notification sent successfully (%d message(s))", len(chunks))
 	return nil
 }
 
-// formatDuration formats a duration in a human-readable way
-func formatDuration(d time.Duration) string {
-	if d < time.Second {
-		return fmt.Sprintf("%dms", d.Milliseconds())
-	}
-	if d < time.Minute {
-		return fmt.Sprintf("%.1fs", d.Seconds())
-	}
-	if d < time.Hour {
-		return fmt.Sprintf("%.1fm", d.Minutes())
+// send delivers msg, retrying failures with exponential backoff (RetryDelay, 2×, 4×...).
+// A 429 from Telegram waits the retry_after it asks for instead. Each failed attempt
+// is logged so rate limiting can be told apart from connectivity problems.
+func (tn *TelegramNotifier) send(msg tgbotapi.MessageConfig) error {
+	attempts := tn.config.SendAttempts
+	delay := tn.config.RetryDelay
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if _, err = tn.bot.Send(msg); err == nil {
+			return nil
+		}
+		log.Printf("telegram: send attempt %d/%d failed: %v", attempt, attempts, err)
+		if attempt == attempts {
+			break
+		}
+		wait := delay
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			wait = time.Duration(apiErr.RetryAfter) * time.Second
+		}
+		time.Sleep(wait)
+		delay *= 2
 	}
-	return fmt.Sprintf("%.1fh", d.Hours())
+	return err
 }
@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WebhookConfig holds the sync-completion webhook settings
+type WebhookConfig struct {
+	URL string
+	// Retries is how many extra attempts follow a failed POST (0 = single attempt)
+	Retries int
+	// Backoff is the delay before the first retry; it grows linearly per attempt
+	Backoff time.Duration
+	Timeout time.Duration
+}
+
+// SyncEvent is the JSON body POSTed when a scheduled sync run finishes
+type SyncEvent struct {
+	Event          string   `json:"event"` // yearly_init | monthly_sync
+	Status         string   `json:"status"`
+	FiscalYear     int      `json:"fiscal_year,omitempty"`
+	YearMonth      string   `json:"year_month,omitempty"`
+	Branches       []string `json:"branches"`
+	FailedBranches []string `json:"failed_branches,omitempty"`
+	Error          string   `json:"error,omitempty"`
+	DurationMs     int64    `json:"duration_ms"`
+	FinishedAt     string   `json:"finished_at"`
+}
+
+// WebhookNotifier POSTs sync events to a URL, retrying with backoff; a callback that
+// still fails is written to bm_webhook_failures for manual inspection.
+type WebhookNotifier struct {
+	config WebhookConfig
+	client *http.Client
+	dead   *WebhookFailureStore
+}
+
+// NewWebhookNotifier returns nil when no URL is configured
+func NewWebhookNotifier(config WebhookConfig, dead *WebhookFailureStore) *WebhookNotifier {
+	if config.URL == "" {
+		return nil
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &WebhookNotifier{config: config, client: &http.Client{Timeout: config.Timeout}, dead: dead}
+}
+
+// NotifySync delivers ev; safe to call on a nil notifier (webhook disabled)
+func (wn *WebhookNotifier) NotifySync(ctx context.Context, ev SyncEvent) {
+	if wn == nil {
+		return
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("webhook: marshal %s event: %v", ev.Event, err)
+		return
+	}
+	attempts, err := wn.deliver(ctx, body)
+	if err == nil {
+		return
+	}
+	log.Printf("webhook: %s event undelivered after %d attempts: %v", ev.Event, attempts, err)
+	if wn.dead != nil {
+		if derr := wn.dead.Record(ctx, wn.config.URL, body, attempts, err.Error()); derr != nil {
+			log.Printf("webhook: %v", derr)
+		}
+	}
+}
+
+// deliver POSTs body until it gets a 2xx or runs out of retries; it returns the
+// number of attempts made and the last error
+func (wn *WebhookNotifier) deliver(ctx context.Context, body []byte) (int, error) {
+	var lastErr error
+	for attempt := 0; attempt <= wn.config.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(wn.config.Backoff * time.Duration(attempt)):
+			case <-ctx.Done():
+				return attempt, ctx.Err()
+			}
+		}
+		if lastErr = wn.post(ctx, body); lastErr == nil {
+			return attempt + 1, nil
+		}
+		log.Printf("webhook: attempt %d failed: %v", attempt+1, lastErr)
+	}
+	return wn.config.Retries + 1, lastErr
+}
+
+func (wn *WebhookNotifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wn.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// WebhookFailure is an undelivered callback kept in bm_webhook_failures
+type WebhookFailure struct {
+	ID        int64           `json:"id"`
+	URL       string          `json:"url"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// WebhookFailureStore is the dead-letter table for webhook callbacks
+type WebhookFailureStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewWebhookFailureStore creates a dead-letter store backed by Postgres
+func NewWebhookFailureStore(pool *pgxpool.Pool) *WebhookFailureStore {
+	return &WebhookFailureStore{pool: pool}
+}
+
+// Record stores an undelivered callback
+func (s *WebhookFailureStore) Record(ctx context.Context, url string, payload []byte, attempts int, lastError string) error {
+	query := `INSERT INTO bm_webhook_failures (url, payload, attempts, last_error) VALUES ($1, $2, $3, $4)`
+	if _, err := s.pool.Exec(ctx, query, url, payload, attempts, lastError); err != nil {
+		return fmt.Errorf("record webhook failure: %w", err)
+	}
+	return nil
+}
+
+// List returns undelivered callbacks, newest first, with the total count
+func (s *WebhookFailureStore) List(ctx context.Context, limit, offset int) ([]WebhookFailure, int, error) {
+	var total int
+	if err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM bm_webhook_failures`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count webhook failures: %w", err)
+	}
+	rows, err := s.pool.Query(ctx, `SELECT id, url, payload, attempts, last_error, created_at
+	                                FROM bm_webhook_failures ORDER BY created_at DESC, id DESC
+	                                LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query webhook failures: %w", err)
+	}
+	defer rows.Close()
+
+	items := []WebhookFailure{}
+	for rows.Next() {
+		var f WebhookFailure
+		var payload []byte
+		if err := rows.Scan(&f.ID, &f.URL, &payload, &f.Attempts, &f.LastError, &f.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("scan webhook failure: %w", err)
+		}
+		f.Payload = payload
+		items = append(items, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("iterate webhook failures: %w", err)
+	}
+	return items, total, nil
+}
@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-backend-bigmeter/internal/database/dbtest"
+)
+
+func TestWebhookDeadLetter(t *testing.T) {
+	tests := []struct {
+		name         string
+		retries      int
+		failFirst    int // requests answered 503 before the endpoint recovers
+		wantRequests int
+		wantDead     bool
+	}{
+		{name: "delivered first time", retries: 2, failFirst: 0, wantRequests: 1},
+		{name: "delivered on a retry", retries: 2, failFirst: 2, wantRequests: 3},
+		{name: "retries exhausted", retries: 2, failFirst: 100, wantRequests: 3, wantDead: true},
+		{name: "no retries", retries: 0, failFirst: 100, wantRequests: 1, wantDead: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := dbtest.Postgres(t)
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if int(requests.Add(1)) <= tt.failFirst {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			t.Cleanup(srv.Close)
+
+			dead := NewWebhookFailureStore(pg.Pool)
+			wn := NewWebhookNotifier(WebhookConfig{URL: srv.URL, Retries: tt.retries, Backoff: time.Millisecond}, dead)
+			wn.NotifySync(context.Background(), SyncEvent{Event: "monthly_sync", Status: "success", YearMonth: "202410", Branches: []string{"BA01"}})
+
+			if got := int(requests.Load()); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+			items, total, err := dead.List(context.Background(), 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (total == 1) != tt.wantDead || len(items) != total {
+				t.Fatalf("dead letters = %d (%d listed), want dead=%t", total, len(items), tt.wantDead)
+			}
+			if !tt.wantDead {
+				return
+			}
+			f := items[0]
+			var ev SyncEvent
+			if err := json.Unmarshal(f.Payload, &ev); err != nil {
+				t.Fatal(err)
+			}
+			if f.URL != srv.URL || f.Attempts != tt.wantRequests || !strings.Contains(f.LastError, "503") || ev.Event != "monthly_sync" || ev.YearMonth != "202410" {
+				t.Errorf("dead letter = %+v (payload %+v)", f, ev)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package sync
+
+import (
+	"context"
+	"sync"
+)
+
+// Backfill modes (BACKFILL_MODE)
+const (
+	// BackfillInline backfills right after each branch's cohort init (default)
+	BackfillInline = "inline"
+	// BackfillDeferred queues the backfills of a multi-branch run until every init is done
+	BackfillDeferred = "deferred"
+)
+
+// BackfillJob is an init backfill queued by a deferred run
+type BackfillJob struct {
+	Branch     string
+	FiscalYear int
+	// DebtYM is the Thai YYYYMM the cohort was actually taken from (after any fallback)
+	DebtYM      string
+	Months      int
+	TriggeredBy string
+}
+
+// BackfillQueue collects the backfills of a deferred run; it is safe for concurrent use
+type BackfillQueue struct {
+	mu   sync.Mutex
+	jobs []BackfillJob
+}
+
+// Add queues job; InitCustcodes calls it for a context from WithDeferredBackfill
+func (q *BackfillQueue) Add(job BackfillJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs = append(q.jobs, job)
+}
+
+// Jobs returns the queued backfills in the order their inits finished
+func (q *BackfillQueue) Jobs() []BackfillJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]BackfillJob(nil), q.jobs...)
+}
+
+type backfillQueueKey struct{}
+
+// WithDeferredBackfill makes InitCustcodes queue its backfill on q instead of running
+// it, so a multi-branch run can backfill after all inits (see RunBackfill).
+func WithDeferredBackfill(ctx context.Context, q *BackfillQueue) context.Context {
+	return context.WithValue(ctx, backfillQueueKey{}, q)
+}
+
+// deferredBackfill returns the queue stored by WithDeferredBackfill, or nil.
+func deferredBackfill(ctx context.Context) *BackfillQueue {
+	q, _ := ctx.Value(backfillQueueKey{}).(*BackfillQueue)
+	return q
+}
+
+// RunBackfill runs a queued init backfill. Failed months are logged and skipped, as
+// in the inline backfill.
+func (s *Service) RunBackfill(ctx context.Context, job BackfillJob) error {
+	return s.backfillRecentMonths(ctx, job.Branch, job.FiscalYear, job.DebtYM, job.Months, job.TriggeredBy)
+}
@@ -0,0 +1,30 @@
+package sync
+
+import (
+	"context"
+	"time"
+)
+
+// BranchResult is the outcome of one InitCustcodes or MonthlyDetails call
+type BranchResult struct {
+	SyncType string // yearly_init or monthly_sync
+	Branch   string
+	// YM is the debt_ym (Thai) of an init, the Gregorian month of a monthly sync
+	YM         string
+	FiscalYear int
+	Upserted   int
+	Zeroed     int
+	Duration   time.Duration
+	// Attempt is the scheduler retry attempt (0 = first try)
+	Attempt int
+	Err     error
+}
+
+// branchDone passes r to OnBranchDone when set
+func (s *Service) branchDone(ctx context.Context, r BranchResult) {
+	if s.OnBranchDone == nil {
+		return
+	}
+	r.Attempt = retryAttempt(ctx)
+	s.OnBranchDone(r)
+}
@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// detailColumns are the columns the details SQL returns, each with the names it
+// may go by: the Thai alias used by sqls/200-meter-details.sql and the Oracle column
+// name, so an alternate template can return them in any order (and with extra columns).
+// Optional columns may be left out by templates written before they were added.
+var detailColumns = []struct {
+	name     string
+	aliases  []string
+	optional bool
+}{
+	{"cust_code", []string{"เลขที่ผู้ใช้น้ำ", "CUST_CODE"}, false},
+	{"meter_no", []string{"หมายเลขมาตร", "METER_NO"}, false},
+	{"average", []string{"หน่วยน้ำเฉลี่ย", "AVERAGE"}, false},
+	{"present_meter_count", []string{"เลขมาตรที่อ่านได้", "PRESENT_METER_COUNT"}, false},
+	{"present_water_usg", []string{"หน่วยน้ำปัจจุบัน", "PRESENT_WATER_USG"}, false},
+	{"debt_ym", []string{"เดือนหนี้", "DEBT_YM"}, false},
+	{"meter_state", []string{"สถานะมาตร", "METER_STATE"}, true},
+}
+
+// detailScanner scans details rows by column name rather than position
+type detailScanner struct {
+	// pos[i] is the result position of detailColumns[i]
+	pos   []int
+	width int
+}
+
+// newDetailScanner maps the result columns to detailColumns. Names match ignoring
+// case and surrounding spaces; every required column must be present exactly once.
+func newDetailScanner(cols []string) (*detailScanner, error) {
+	index := make(map[string]int, len(cols))
+	for i, c := range cols {
+		index[strings.ToUpper(strings.TrimSpace(c))] = i
+	}
+	ds := &detailScanner{pos: make([]int, len(detailColumns)), width: len(cols)}
+	var missing []string
+	for i, dc := range detailColumns {
+		ds.pos[i] = -1
+		for _, a := range dc.aliases {
+			p, ok := index[strings.ToUpper(a)]
+			if !ok {
+				continue
+			}
+			if ds.pos[i] >= 0 && ds.pos[i] != p {
+				return nil, fmt.Errorf("details sql: column %s returned twice (%s and %s)", dc.name, cols[ds.pos[i]], cols[p])
+			}
+			ds.pos[i] = p
+		}
+		if ds.pos[i] < 0 && !dc.optional {
+			missing = append(missing, fmt.Sprintf("%s (%s)", dc.name, strings.Join(dc.aliases, " or ")))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("details sql: missing column(s): %s; got: %s", strings.Join(missing, ", "), strings.Join(cols, ", "))
+	}
+	return ds, nil
+}
+
+// scan reads the current row into the details fields, in detailColumns order;
+// extra columns are discarded and absent optional columns are left untouched.
+func (ds *detailScanner) scan(rows *slotRows, cust, mtrNo *sql.NullString, avg, presentCnt, presentUSG *sql.NullFloat64, debt, state *sql.NullString) error {
+	dest := make([]any, ds.width)
+	for i := range dest {
+		dest[i] = new(any)
+	}
+	for i, d := range []any{cust, mtrNo, avg, presentCnt, presentUSG, debt, state} {
+		if ds.pos[i] >= 0 {
+			dest[ds.pos[i]] = d
+		}
+	}
+	return rows.Scan(dest...)
+}
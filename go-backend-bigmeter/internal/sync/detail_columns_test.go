@@ -0,0 +1,66 @@
+package sync
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"go-backend-bigmeter/internal/database/dbtest"
+)
+
+func TestFetchDetailsBatchColumns(t *testing.T) {
+	tests := []struct {
+		name      string
+		columns   []string
+		row       []driver.Value
+		wantState string
+		wantErr   string
+	}{
+		{name: "template order", columns: detailsColumns,
+			row: []driver.Value{"C001", "M-1", 10.0, 1200.0, 35.0, "256710", "ปกติ"}, wantState: "ปกติ"},
+		{name: "reordered Thai aliases",
+			columns: []string{"เดือนหนี้", "หน่วยน้ำปัจจุบัน", "เลขที่ผู้ใช้น้ำ", "หน่วยน้ำเฉลี่ย", "หมายเลขมาตร", "เลขมาตรที่อ่านได้"},
+			row:     []driver.Value{"256710", 35.0, "C001", 10.0, "M-1", 1200.0}},
+		{name: "Oracle names, mixed case and an extra column",
+			columns:   []string{"PRESENT_WATER_USG", "cust_code", "ORG_NAME", " Meter_No ", "METER_STATE", "DEBT_YM", "AVERAGE", "PRESENT_METER_COUNT"},
+			row:       []driver.Value{35.0, "C001", "Org", "M-1", "ปกติ", "256710", 10.0, 1200.0},
+			wantState: "ปกติ"},
+		{name: "missing columns",
+			columns: []string{"CUST_CODE", "METER_NO", "AVERAGE", "PRESENT_METER_COUNT"},
+			row:     []driver.Value{"C001", "M-1", 10.0, 1200.0},
+			wantErr: "missing column(s): present_water_usg (หน่วยน้ำปัจจุบัน or PRESENT_WATER_USG), debt_ym"},
+		{name: "column twice",
+			columns: []string{"CUST_CODE", "เลขที่ผู้ใช้น้ำ", "METER_NO", "AVERAGE", "PRESENT_METER_COUNT", "PRESENT_WATER_USG", "DEBT_YM"},
+			row:     []driver.Value{"C001", "C001", "M-1", 10.0, 1200.0, 35.0, "256710"},
+			wantErr: "column cust_code returned twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ora, _ := dbtest.Oracle(t, oracleDetails(tt.columns, tt.row))
+			s := &Service{Oracle: ora}
+
+			rows, err := s.fetchDetailsBatch(context.Background(), detailsSQLStub, "202410", "256710", "BA01", []string{"C001"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 {
+				t.Fatalf("got %d rows, want 1", len(rows))
+			}
+			r := rows[0]
+			if r.cust != "C001" || r.meterNo.String != "M-1" || r.avg != 10 || r.count != 1200 || r.usage != 35 || r.debt.String != "256710" {
+				t.Errorf("row = %+v, want C001 M-1 avg=10 count=1200 usage=35 debt=256710", r)
+			}
+			// meter_state is optional: templates without it leave it NULL
+			if r.state.String != tt.wantState || r.state.Valid != (tt.wantState != "") {
+				t.Errorf("state = %+v, want %q", r.state, tt.wantState)
+			}
+		})
+	}
+}
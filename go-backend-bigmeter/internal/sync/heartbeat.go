@@ -0,0 +1,99 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/robfig/cron/v3"
+
+	dbpkg "go-backend-bigmeter/internal/database"
+)
+
+const heartbeatSettingKey = "scheduler_heartbeat"
+
+// Heartbeat is the scheduler's dead-man's switch: the scheduler process stamps
+// bm_settings periodically, and the API reports when the stamp goes stale or an
+// expected cron run never shows up in bm_sync_logs.
+type Heartbeat struct {
+	pg *dbpkg.Postgres
+}
+
+// NewHeartbeat creates a heartbeat backed by bm_settings
+func NewHeartbeat(pg *dbpkg.Postgres) *Heartbeat {
+	return &Heartbeat{pg: pg}
+}
+
+// Beat records now as the last heartbeat
+func (h *Heartbeat) Beat(ctx context.Context, now time.Time) error {
+	query := `INSERT INTO bm_settings (key, value, updated_at) VALUES ($1, $2, now())
+	          ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = now()`
+	if _, err := h.pg.Pool.Exec(ctx, query, heartbeatSettingKey, now.UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("save scheduler heartbeat: %w", err)
+	}
+	return nil
+}
+
+// Last returns the last heartbeat, or the zero time when the scheduler never beat
+func (h *Heartbeat) Last(ctx context.Context) (time.Time, error) {
+	var v string
+	err := h.pg.Pool.QueryRow(ctx, `SELECT value FROM bm_settings WHERE key = $1`, heartbeatSettingKey).Scan(&v)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("load scheduler heartbeat: %w", err)
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse scheduler heartbeat: %w", err)
+	}
+	return t, nil
+}
+
+// Run beats immediately and then every interval until ctx is done. Write failures are
+// logged; the next tick tries again.
+func (h *Heartbeat) Run(ctx context.Context, interval time.Duration) {
+	beat := func() {
+		bctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if err := h.Beat(bctx, time.Now()); err != nil {
+			log.Printf("heartbeat: %v", err)
+		}
+	}
+	beat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			beat()
+		}
+	}
+}
+
+// PreviousRun returns the latest time at or before now that the 6-field cron spec
+// fires, or the zero time when it did not fire in the last 400 days. The search
+// window widens step by step so frequent specs stay cheap.
+func PreviousRun(spec string, loc *time.Location, now time.Time) (time.Time, error) {
+	sched, err := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow).Parse(spec)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse cron spec %q: %w", spec, err)
+	}
+	now = now.In(loc)
+	for _, days := range []int{1, 32, 400} {
+		var prev time.Time
+		for t := sched.Next(now.AddDate(0, 0, -days)); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+			prev = t
+		}
+		if !prev.IsZero() {
+			return prev, nil
+		}
+	}
+	return time.Time{}, nil
+}
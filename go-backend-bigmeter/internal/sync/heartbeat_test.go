@@ -0,0 +1,35 @@
+package sync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPreviousRun(t *testing.T) {
+	bkk := time.FixedZone("ICT", 7*3600)
+	now := time.Date(2024, time.October, 20, 9, 0, 0, 0, bkk)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		// monthly on the 16th at 08:00: this month's run
+		{spec: "0 0 8 16 * *", want: time.Date(2024, time.October, 16, 8, 0, 0, 0, bkk)},
+		// on the 25th: last month's run
+		{spec: "0 0 8 25 * *", want: time.Date(2024, time.September, 25, 8, 0, 0, 0, bkk)},
+		// a run exactly at now counts
+		{spec: "0 0 9 * * *", want: now},
+		// yearly on 15 October
+		{spec: "0 0 22 15 10 *", want: time.Date(2024, time.October, 15, 22, 0, 0, 0, bkk)},
+		// never fires (30 February)
+		{spec: "0 0 8 30 2 *", want: time.Time{}},
+	}
+	for _, tt := range tests {
+		got, err := PreviousRun(tt.spec, bkk, now)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("PreviousRun(%s) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package sync
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobRegistry tracks sync jobs running in this process so the same
+// syncType|branch|ym is never run twice concurrently.
+type JobRegistry struct {
+	mu      sync.Mutex
+	running map[string]*runningJob
+	// logs maps a sync log id to the key of the running job writing it
+	logs map[int64]string
+}
+
+type runningJob struct {
+	started time.Time
+	// cancel aborts the job's context; nil until Context is called for the key
+	cancel context.CancelFunc
+	// canceled is set by Cancel before the job started, so its context starts canceled
+	canceled bool
+	// logIDs are the sync logs bound to the job by BindLog
+	logIDs []int64
+}
+
+// NewJobRegistry creates an empty registry
+func NewJobRegistry() *JobRegistry {
+	return &JobRegistry{running: map[string]*runningJob{}, logs: map[int64]string{}}
+}
+
+// JobKey builds the registry key, e.g. "monthly_sync|1063|202410"
+func JobKey(syncType, branch, ym string) string {
+	return syncType + "|" + branch + "|" + ym
+}
+
+// TryAcquire marks all keys as running, or none of them: when any key is already
+// running it returns those keys and acquires nothing.
+func (r *JobRegistry) TryAcquire(keys ...string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var busy []string
+	for _, k := range keys {
+		if _, ok := r.running[k]; ok {
+			busy = append(busy, k)
+		}
+	}
+	if len(busy) > 0 {
+		return busy
+	}
+	now := time.Now()
+	for _, k := range keys {
+		r.running[k] = &runningJob{started: now}
+	}
+	return nil
+}
+
+// Context derives the context an acquired key's job runs under: it expires after
+// timeout when timeout > 0 (SYNC_JOB_TIMEOUT) and is canceled by Cancel or Release.
+// Deriving it again for the same key cancels the earlier one.
+func (r *JobRegistry) Context(parent context.Context, key string, timeout time.Duration) context.Context {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.running[key]
+	if !ok {
+		job = &runningJob{started: time.Now()}
+		r.running[key] = job
+	}
+	if job.cancel != nil {
+		job.cancel()
+	}
+	job.cancel = cancel
+	if job.canceled {
+		cancel()
+	}
+	return ctx
+}
+
+// Cancel aborts the jobs among keys and returns the keys it canceled. A key acquired
+// by a run that has not reached it yet (branches run one after another) is canceled
+// too: its context starts canceled. Keys stay acquired until their job releases them.
+func (r *JobRegistry) Cancel(keys ...string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var canceled []string
+	for _, k := range keys {
+		job, ok := r.running[k]
+		if !ok || job.canceled {
+			continue
+		}
+		job.canceled = true
+		if job.cancel != nil {
+			job.cancel()
+		}
+		canceled = append(canceled, k)
+	}
+	return canceled
+}
+
+// RunningForBranch returns the running keys of branch, any sync type and ym, sorted
+func (r *JobRegistry) RunningForBranch(branch string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	for k := range r.running {
+		if parts := strings.SplitN(k, "|", 3); len(parts) == 3 && parts[1] == branch {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// BindLog records that the job holding key writes sync log logID, so the job can be
+// found by that id (KeyForLog) whatever the run later rewrites on the log row, e.g.
+// debt_ym after a DEBT_YM_FALLBACK_STEPS fallback. It is ignored when key is not
+// running. The binding ends with Release.
+func (r *JobRegistry) BindLog(key string, logID int64) {
+	if logID <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.running[key]
+	if !ok {
+		return
+	}
+	job.logIDs = append(job.logIDs, logID)
+	r.logs[logID] = key
+}
+
+// KeyForLog returns the key of the running job bound to logID by BindLog
+func (r *JobRegistry) KeyForLog(logID int64) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, ok := r.logs[logID]
+	return key, ok
+}
+
+// Release marks keys as finished and frees their contexts
+func (r *JobRegistry) Release(keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range keys {
+		job, ok := r.running[k]
+		if !ok {
+			continue
+		}
+		if job.cancel != nil {
+			job.cancel()
+		}
+		for _, id := range job.logIDs {
+			delete(r.logs, id)
+		}
+		delete(r.running, k)
+	}
+}
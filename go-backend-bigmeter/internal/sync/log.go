@@ -2,12 +2,22 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrSyncLogNotFound is returned by GetSyncLog when no row has the given id
+var ErrSyncLogNotFound = errors.New("sync log not found")
+
+// syncLogColumns is the column list scanned by scanSyncLog
+const syncLogColumns = `id, sync_type, branch_code, year_month, fiscal_year, debt_ym, status,
+	                             started_at, finished_at, duration_ms, records_upserted, records_zeroed,
+	                             error_message, triggered_by, retry_count, processed_batches, last_offset, request_id, created_at`
+
 // SyncLog represents a sync operation log entry
 type SyncLog struct {
 	ID             int64      `json:"id"`
@@ -20,10 +30,20 @@ type SyncLog struct {
 	StartedAt      time.Time  `json:"started_at"`
 	FinishedAt     *time.Time `json:"finished_at,omitempty"`
 	DurationMs     *int       `json:"duration_ms,omitempty"`
+	// DurationHuman is DurationMs formatted for display ("1.3m"); filled by the API
+	DurationHuman  string     `json:"duration_human,omitempty"`
 	RecordsUpserted *int      `json:"records_upserted,omitempty"`
 	RecordsZeroed   *int      `json:"records_zeroed,omitempty"`
 	ErrorMessage   *string    `json:"error_message,omitempty"`
 	TriggeredBy    string     `json:"triggered_by"`
+	RetryCount     int        `json:"retry_count"`
+	// ProcessedBatches counts committed monthly batches; updated live while in_progress
+	ProcessedBatches int      `json:"processed_batches"`
+	// LastOffset is how many cohort entries (ordered by cust_code) are committed; a
+	// resumed retry starts from here
+	LastOffset     int        `json:"last_offset"`
+	// RequestID is the X-Request-ID of the API call that started the run (migration 0017)
+	RequestID      *string    `json:"request_id,omitempty"`
 	CreatedAt      time.Time  `json:"created_at"`
 }
 
@@ -37,55 +57,221 @@ func NewLogRepository(pool *pgxpool.Pool) *LogRepository {
 	return &LogRepository{pool: pool}
 }
 
-// RecordSyncStart creates a new sync log entry with in_progress status
+// RecordSyncStart creates a new sync log entry with in_progress status. The request
+// id set on ctx by WithRequestID, if any, is stored with it.
 func (r *LogRepository) RecordSyncStart(ctx context.Context, syncType, branchCode, triggeredBy string, yearMonth, debtYM *string, fiscalYear *int) (int64, error) {
-	query := `INSERT INTO bm_sync_logs (sync_type, branch_code, year_month, fiscal_year, debt_ym, status, started_at, triggered_by)
-	          VALUES ($1, $2, $3, $4, $5, 'in_progress', $6, $7)
+	query := `INSERT INTO bm_sync_logs (sync_type, branch_code, year_month, fiscal_year, debt_ym, status, started_at, triggered_by, request_id)
+	          VALUES ($1, $2, $3, $4, $5, 'in_progress', $6, $7, NULLIF($8, ''))
 	          RETURNING id`
 
 	var logID int64
-	err := r.pool.QueryRow(ctx, query, syncType, branchCode, yearMonth, fiscalYear, debtYM, time.Now(), triggeredBy).Scan(&logID)
+	err := r.pool.QueryRow(ctx, query, syncType, branchCode, yearMonth, fiscalYear, debtYM, time.Now(), triggeredBy, RequestID(ctx)).Scan(&logID)
 	if err != nil {
 		return 0, fmt.Errorf("insert sync log start: %w", err)
 	}
 	return logID, nil
 }
 
-// UpdateSyncSuccess updates the log entry with success status and stats
-func (r *LogRepository) UpdateSyncSuccess(ctx context.Context, logID int64, upserted, zeroed int) error {
+// UpdateSyncSuccess updates the log entry with success status and stats.
+// retryCount is the number of failed attempts before this one (0 = first try).
+func (r *LogRepository) UpdateSyncSuccess(ctx context.Context, logID int64, upserted, zeroed, retryCount int) error {
 	now := time.Now()
 	query := `UPDATE bm_sync_logs
 	          SET status = 'success',
 	              finished_at = $2,
 	              duration_ms = EXTRACT(EPOCH FROM ($2 - started_at)) * 1000,
 	              records_upserted = $3,
-	              records_zeroed = $4
+	              records_zeroed = $4,
+	              retry_count = $5
 	          WHERE id = $1`
 
-	_, err := r.pool.Exec(ctx, query, logID, now, upserted, zeroed)
+	_, err := r.pool.Exec(ctx, query, logID, now, upserted, zeroed, retryCount)
 	if err != nil {
 		return fmt.Errorf("update sync log success: %w", err)
 	}
 	return nil
 }
 
-// UpdateSyncError updates the log entry with error status and message
+// UpdateSyncProgress writes the running counts and committed cohort offset after a
+// committed batch and bumps processed_batches, so GET /sync/logs/:id shows progress
+// before the run finishes.
+func (r *LogRepository) UpdateSyncProgress(ctx context.Context, logID int64, upserted, zeroed, lastOffset int) error {
+	query := `UPDATE bm_sync_logs
+	          SET records_upserted = $2,
+	              records_zeroed = $3,
+	              processed_batches = processed_batches + 1,
+	              last_offset = $4
+	          WHERE id = $1 AND status = 'in_progress'`
+
+	if _, err := r.pool.Exec(ctx, query, logID, upserted, zeroed, lastOffset); err != nil {
+		return fmt.Errorf("update sync log progress: %w", err)
+	}
+	return nil
+}
+
+// UpdateSyncOffset records the cohort offset a resumed run starts from, so the run can
+// itself be resumed from there if it fails before committing a batch
+func (r *LogRepository) UpdateSyncOffset(ctx context.Context, logID int64, offset int) error {
+	if _, err := r.pool.Exec(ctx, `UPDATE bm_sync_logs SET last_offset = $2 WHERE id = $1`, logID, offset); err != nil {
+		return fmt.Errorf("update sync log offset: %w", err)
+	}
+	return nil
+}
+
+// UpdateSyncDebtYM records the debt_ym an init actually used (after a fallback)
+func (r *LogRepository) UpdateSyncDebtYM(ctx context.Context, logID int64, debtYM string) error {
+	if _, err := r.pool.Exec(ctx, `UPDATE bm_sync_logs SET debt_ym = $2 WHERE id = $1`, logID, debtYM); err != nil {
+		return fmt.Errorf("update sync log debt_ym: %w", err)
+	}
+	return nil
+}
+
+// UpdateSyncError updates the log entry with error status and message. When ctx hit
+// its deadline (SYNC_JOB_TIMEOUT, MONTHLY_SYNC_BRANCH_TIMEOUT) the status is 'timeout';
+// when it was canceled (POST /sync/cancel, scheduler shutdown) it is 'cancelled'.
+// The update ignores ctx's cancellation so such a run never stays in_progress.
 func (r *LogRepository) UpdateSyncError(ctx context.Context, logID int64, errorMsg string) error {
+	status := "error"
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		status = "timeout"
+	case errors.Is(ctx.Err(), context.Canceled):
+		status = "cancelled"
+	}
 	now := time.Now()
 	query := `UPDATE bm_sync_logs
-	          SET status = 'error',
+	          SET status = $4,
 	              finished_at = $2,
 	              duration_ms = EXTRACT(EPOCH FROM ($2 - started_at)) * 1000,
 	              error_message = $3
 	          WHERE id = $1`
 
-	_, err := r.pool.Exec(ctx, query, logID, now, errorMsg)
+	_, err := r.pool.Exec(context.WithoutCancel(ctx), query, logID, now, errorMsg, status)
 	if err != nil {
 		return fmt.Errorf("update sync log error: %w", err)
 	}
 	return nil
 }
 
+type retryAttemptKey struct{}
+
+// WithRetryAttempt tags ctx with the retry attempt (0 = first try) so the
+// success log records how many retries a branch needed.
+func WithRetryAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, retryAttemptKey{}, attempt)
+}
+
+// retryAttempt returns the attempt stored by WithRetryAttempt, or 0.
+func retryAttempt(ctx context.Context) int {
+	n, _ := ctx.Value(retryAttemptKey{}).(int)
+	return n
+}
+
+// backfillTriggerSuffix marks monthly runs started by the yearly init backfill,
+// e.g. triggered_by "scheduler:backfill".
+const backfillTriggerSuffix = ":backfill"
+
+// RecentBackfillCompleted reports whether an init backfill for branch+ym finished
+// successfully within the given window.
+func (r *LogRepository) RecentBackfillCompleted(ctx context.Context, branchCode, yearMonth string, within time.Duration) (bool, error) {
+	query := `SELECT EXISTS (
+	            SELECT 1 FROM bm_sync_logs
+	            WHERE sync_type = 'monthly_sync'
+	              AND branch_code = $1
+	              AND year_month = $2
+	              AND status = 'success'
+	              AND triggered_by LIKE '%' || $3
+	              AND finished_at >= $4
+	          )`
+
+	var exists bool
+	err := r.pool.QueryRow(ctx, query, branchCode, yearMonth, backfillTriggerSuffix, time.Now().Add(-within)).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("query recent backfill: %w", err)
+	}
+	return exists, nil
+}
+
+// LastScheduledStart returns when the scheduler last started a syncType run (any
+// branch), or the zero time when it never did
+func (r *LogRepository) LastScheduledStart(ctx context.Context, syncType string) (time.Time, error) {
+	var last *time.Time
+	query := `SELECT max(started_at) FROM bm_sync_logs WHERE sync_type = $1 AND triggered_by = 'scheduler'`
+	if err := r.pool.QueryRow(ctx, query, syncType).Scan(&last); err != nil {
+		return time.Time{}, fmt.Errorf("query last scheduled %s: %w", syncType, err)
+	}
+	if last == nil {
+		return time.Time{}, nil
+	}
+	return *last, nil
+}
+
+// BranchInProgress reports whether any sync of branchCode has an in_progress log row
+// started within inProgressStaleAfter, e.g. a scheduler run in another process
+func (r *LogRepository) BranchInProgress(ctx context.Context, branchCode string) (bool, error) {
+	query := `SELECT EXISTS (
+	            SELECT 1 FROM bm_sync_logs
+	            WHERE branch_code = $1
+	              AND status = 'in_progress'
+	              AND started_at >= $2
+	          )`
+
+	var exists bool
+	err := r.pool.QueryRow(ctx, query, branchCode, time.Now().Add(-inProgressStaleAfter)).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("query in-progress sync log: %w", err)
+	}
+	return exists, nil
+}
+
+// inProgressStaleAfter bounds the cross-restart check: an in_progress log row older
+// than this is assumed to belong to a crashed process and no longer blocks a trigger.
+const inProgressStaleAfter = 2 * time.Hour
+
+// ListInProgress returns the in_progress log rows started within inProgressStaleAfter,
+// oldest first, i.e. runs that may be executing in any process.
+func (r *LogRepository) ListInProgress(ctx context.Context) ([]SyncLog, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+syncLogColumns+` FROM bm_sync_logs
+	                                WHERE status = 'in_progress' AND started_at >= $1
+	                                ORDER BY started_at`, time.Now().Add(-inProgressStaleAfter))
+	if err != nil {
+		return nil, fmt.Errorf("query in-progress sync logs: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []SyncLog
+	for rows.Next() {
+		l, err := scanSyncLog(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan sync log: %w", err)
+		}
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
+
+// HasInProgress reports whether bm_sync_logs has a recent in_progress row for the
+// same job, which catches runs started by another process (scheduler, other API replica)
+// or left behind by a restart within inProgressStaleAfter. ym matches year_month for
+// monthly_sync and debt_ym for yearly_init.
+func (r *LogRepository) HasInProgress(ctx context.Context, syncType, branchCode, ym string) (bool, error) {
+	query := `SELECT EXISTS (
+	            SELECT 1 FROM bm_sync_logs
+	            WHERE sync_type = $1
+	              AND branch_code = $2
+	              AND (year_month = $3 OR debt_ym = $3)
+	              AND status = 'in_progress'
+	              AND started_at >= $4
+	          )`
+
+	var exists bool
+	err := r.pool.QueryRow(ctx, query, syncType, branchCode, ym, time.Now().Add(-inProgressStaleAfter)).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("query in-progress sync log: %w", err)
+	}
+	return exists, nil
+}
+
 // ListSyncLogsFilter defines filters for listing sync logs
 type ListSyncLogsFilter struct {
 	BranchCode *string
@@ -134,9 +320,7 @@ func (r *LogRepository) ListSyncLogs(ctx context.Context, filter ListSyncLogsFil
 	}
 
 	// Query logs
-	query := fmt.Sprintf(`SELECT id, sync_type, branch_code, year_month, fiscal_year, debt_ym, status,
-	                             started_at, finished_at, duration_ms, records_upserted, records_zeroed,
-	                             error_message, triggered_by, created_at
+	query := fmt.Sprintf(`SELECT `+syncLogColumns+`
 	                      FROM bm_sync_logs %s
 	                      ORDER BY created_at DESC
 	                      LIMIT $%d OFFSET $%d`, whereClause, argIdx, argIdx+1)
@@ -151,13 +335,8 @@ func (r *LogRepository) ListSyncLogs(ctx context.Context, filter ListSyncLogsFil
 
 	logs := []SyncLog{}
 	for rows.Next() {
-		var log SyncLog
-		if err := rows.Scan(
-			&log.ID, &log.SyncType, &log.BranchCode, &log.YearMonth, &log.FiscalYear, &log.DebtYM,
-			&log.Status, &log.StartedAt, &log.FinishedAt, &log.DurationMs,
-			&log.RecordsUpserted, &log.RecordsZeroed, &log.ErrorMessage,
-			&log.TriggeredBy, &log.CreatedAt,
-		); err != nil {
+		log, err := scanSyncLog(rows)
+		if err != nil {
 			return nil, 0, fmt.Errorf("scan sync log: %w", err)
 		}
 		logs = append(logs, log)
@@ -169,3 +348,116 @@ func (r *LogRepository) ListSyncLogs(ctx context.Context, filter ListSyncLogsFil
 
 	return logs, total, nil
 }
+
+// GetSyncLog retrieves a single sync log by id, or ErrSyncLogNotFound
+func (r *LogRepository) GetSyncLog(ctx context.Context, id int64) (*SyncLog, error) {
+	row := r.pool.QueryRow(ctx, `SELECT `+syncLogColumns+` FROM bm_sync_logs WHERE id = $1`, id)
+	log, err := scanSyncLog(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSyncLogNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get sync log: %w", err)
+	}
+	return &log, nil
+}
+
+// MarkSyncStarted resets started_at on a pre-created log row when its run actually
+// begins, so duration_ms does not include time spent queued behind other branches.
+func (r *LogRepository) MarkSyncStarted(ctx context.Context, logID int64) error {
+	_, err := r.pool.Exec(ctx, `UPDATE bm_sync_logs SET started_at = $2, processed_batches = 0, last_offset = 0 WHERE id = $1`, logID, time.Now())
+	if err != nil {
+		return fmt.Errorf("mark sync log started: %w", err)
+	}
+	return nil
+}
+
+// scanSyncLog scans a row selected with syncLogColumns
+func scanSyncLog(row pgx.Row) (SyncLog, error) {
+	var log SyncLog
+	err := row.Scan(
+		&log.ID, &log.SyncType, &log.BranchCode, &log.YearMonth, &log.FiscalYear, &log.DebtYM,
+		&log.Status, &log.StartedAt, &log.FinishedAt, &log.DurationMs,
+		&log.RecordsUpserted, &log.RecordsZeroed, &log.ErrorMessage,
+		&log.TriggeredBy, &log.RetryCount, &log.ProcessedBatches, &log.LastOffset, &log.RequestID, &log.CreatedAt,
+	)
+	return log, err
+}
+
+type requestIDKey struct{}
+
+// WithRequestID tags ctx with the X-Request-ID of the API call behind a run, so the
+// sync log rows it creates can be correlated with the request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the id stored by WithRequestID, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+type preCreatedLogKey struct{}
+
+// WithPreCreatedLog hands a log row created by the caller (e.g. the API returning its
+// id to the client) to InitCustcodes/MonthlyDetails, which then update it instead of
+// inserting a new one.
+func WithPreCreatedLog(ctx context.Context, logID int64) context.Context {
+	return context.WithValue(ctx, preCreatedLogKey{}, logID)
+}
+
+// preCreatedLog returns the id stored by WithPreCreatedLog, or 0.
+func preCreatedLog(ctx context.Context) int64 {
+	id, _ := ctx.Value(preCreatedLogKey{}).(int64)
+	return id
+}
+
+// SyncLogFacets lists the distinct filter values present in bm_sync_logs
+type SyncLogFacets struct {
+	SyncTypes []string `json:"sync_types"`
+	Statuses  []string `json:"statuses"`
+	Branches  []string `json:"branches"`
+}
+
+// GetSyncLogFacets returns the distinct sync types, statuses, and branch codes found in the logs
+func (r *LogRepository) GetSyncLogFacets(ctx context.Context) (SyncLogFacets, error) {
+	facets := SyncLogFacets{}
+	var err error
+	if facets.SyncTypes, err = r.distinctColumn(ctx, "sync_type"); err != nil {
+		return SyncLogFacets{}, err
+	}
+	if facets.Statuses, err = r.distinctColumn(ctx, "status"); err != nil {
+		return SyncLogFacets{}, err
+	}
+	if facets.Branches, err = r.distinctColumn(ctx, "branch_code"); err != nil {
+		return SyncLogFacets{}, err
+	}
+	return facets, nil
+}
+
+// distinctColumn returns the sorted distinct non-empty values of a bm_sync_logs column.
+// column must be a trusted identifier (never user input).
+func (r *LogRepository) distinctColumn(ctx context.Context, column string) ([]string, error) {
+	query := fmt.Sprintf(`SELECT DISTINCT %[1]s FROM bm_sync_logs
+	                      WHERE %[1]s IS NOT NULL AND %[1]s <> ''
+	                      ORDER BY %[1]s`, column)
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query distinct %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("scan distinct %s: %w", column, err)
+		}
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
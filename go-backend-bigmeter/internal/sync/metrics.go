@@ -32,6 +32,39 @@ var (
 		},
 		[]string{"job", "branch"},
 	)
+
+	oracleConnWait = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "oracle_conn_wait_seconds",
+			Help:    "Time sync jobs wait for an Oracle connection slot (ORACLE_MAX_CONNS)",
+			Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 15, 30, 60, 120, 300},
+		},
+	)
+
+	ratioAlarms = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sync_details_ratio_alarms_total",
+			Help: "Monthly runs whose detail rows fell outside the DETAILS_RATIO_MIN/MAX band of the cohort size",
+		},
+		[]string{"branch", "direction"},
+	)
+
+	oracleQueryDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "oracle_query_duration_seconds",
+			Help:    "Oracle query time by query type, from execute until the rows are closed",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		},
+		[]string{"query"},
+	)
+
+	oracleQueryErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oracle_query_errors_total",
+			Help: "Failed Oracle queries by query type",
+		},
+		[]string{"query"},
+	)
 )
 
 func observeJob(job, branch, status string, start time.Time) {
@@ -51,3 +84,18 @@ func incBatches(job, branch string, n int) {
 	}
 	syncBatches.WithLabelValues(job, branch).Add(float64(n))
 }
+
+func observeOracleWait(start time.Time) {
+	oracleConnWait.Observe(time.Since(start).Seconds())
+}
+
+func incRatioAlarm(branch, direction string) {
+	ratioAlarms.WithLabelValues(branch, direction).Inc()
+}
+
+func observeOracleQuery(query string, start time.Time, err error) {
+	oracleQueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+	if err != nil {
+		oracleQueryErrors.WithLabelValues(query).Inc()
+	}
+}
@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Oracle query labels for oracle_query_duration_seconds / oracle_query_errors_total
+const (
+	oraQueryDetails = "details"
+	oraQueryInit    = "init"
+	oraQueryOraTest = "oratest"
+)
+
+// slotRows holds an Oracle connection slot until the rows are closed.
+type slotRows struct {
+	*sql.Rows
+	once    sync.Once
+	release func()
+}
+
+// Close closes the rows and frees the slot; safe to call more than once.
+func (r *slotRows) Close() error {
+	err := r.Rows.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// queryOracle runs an Oracle query after taking a slot from the ORACLE_MAX_CONNS
+// semaphore. Time spent waiting is recorded in oracle_conn_wait_seconds, which shows
+// whether raising SYNC_CONCURRENCY helps or only queues on the Oracle pool. The query
+// itself is timed under the name label, from execute until the rows are closed, so
+// slow fetches count too.
+func (s *Service) queryOracle(ctx context.Context, name, query string, args ...any) (*slotRows, error) {
+	release := func() {}
+	if s.oraSlots != nil {
+		start := time.Now()
+		select {
+		case s.oraSlots <- struct{}{}:
+		case <-ctx.Done():
+			observeOracleWait(start)
+			return nil, ctx.Err()
+		}
+		observeOracleWait(start)
+		release = func() { <-s.oraSlots }
+	}
+	start := time.Now()
+	rows, err := s.Oracle.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		observeOracleQuery(name, start, err)
+		release()
+		return nil, err
+	}
+	done := func() {
+		observeOracleQuery(name, start, rows.Err())
+		release()
+	}
+	return &slotRows{Rows: rows, release: done}, nil
+}
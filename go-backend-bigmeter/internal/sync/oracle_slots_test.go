@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"go-backend-bigmeter/internal/database/dbtest"
+)
+
+// oracleWaitSum returns the total seconds recorded in oracle_conn_wait_seconds
+func oracleWaitSum(t *testing.T) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == "oracle_conn_wait_seconds" {
+			return mf.GetMetric()[0].GetHistogram().GetSampleSum()
+		}
+	}
+	t.Fatal("oracle_conn_wait_seconds not registered")
+	return 0
+}
+
+func TestQueryOracleWaitMetric(t *testing.T) {
+	const hold = 100 * time.Millisecond
+	tests := []struct {
+		name     string
+		slots    int
+		held     bool // another query holds a slot for hold
+		wantWait bool
+	}{
+		{name: "free slot", slots: 1},
+		{name: "slot left over", slots: 2, held: true},
+		{name: "saturated", slots: 1, held: true, wantWait: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ora, _ := dbtest.Oracle(t, nil)
+			s := &Service{Oracle: ora, oraSlots: make(chan struct{}, tt.slots)}
+			ctx := context.Background()
+			if tt.held {
+				rows, err := s.queryOracle(ctx, oraQueryOraTest, "SELECT 1 FROM dual")
+				if err != nil {
+					t.Fatal(err)
+				}
+				time.AfterFunc(hold, func() { _ = rows.Close() })
+			}
+
+			before := oracleWaitSum(t)
+			rows, err := s.queryOracle(ctx, oraQueryOraTest, "SELECT 1 FROM dual")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = rows.Close()
+			waited := time.Duration((oracleWaitSum(t) - before) * float64(time.Second))
+			if got := waited >= hold/2; got != tt.wantWait {
+				t.Errorf("recorded wait %v, want waiting=%t", waited, tt.wantWait)
+			}
+			if tt.held {
+				// let the held slot go before the fake Oracle is closed
+				time.Sleep(hold)
+			}
+		})
+	}
+}
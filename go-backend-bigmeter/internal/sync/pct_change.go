@@ -0,0 +1,35 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	dbpkg "go-backend-bigmeter/internal/database"
+)
+
+// RecomputePctChange stores each row's month-over-month usage change for ym in
+// bm_meter_details.pct_change: (current - previous) / previous * 100, with previous
+// read from the month before for the same fiscal-year cohort, as the alert and
+// /details/compare calculations do. Rows whose previous month is missing or zero get
+// NULL. An empty branch recomputes every branch. Returns the number of rows updated.
+func RecomputePctChange(ctx context.Context, pg *dbpkg.Postgres, fiscalYear int, ym, branch string) (int64, error) {
+	prevYM, err := previousYM(ym)
+	if err != nil {
+		return 0, err
+	}
+	// float8 arithmetic matches the float64 computation done on read
+	const q = `UPDATE bm_meter_details cur
+               SET pct_change = (
+                   SELECT (cur.present_water_usg::float8 - prev.present_water_usg::float8) / prev.present_water_usg::float8 * 100
+                   FROM bm_meter_details prev
+                   WHERE prev.fiscal_year = cur.fiscal_year AND prev.branch_code = cur.branch_code
+                     AND prev.cust_code = cur.cust_code AND prev.year_month = $3
+                     AND prev.present_water_usg <> 0
+               )
+               WHERE cur.fiscal_year = $1 AND cur.year_month = $2 AND ($4 = '' OR cur.branch_code = $4)`
+	ct, err := pg.Pool.Exec(ctx, q, fiscalYear, ym, prevYM, branch)
+	if err != nil {
+		return 0, fmt.Errorf("pg update pct_change: %w", err)
+	}
+	return ct.RowsAffected(), nil
+}
@@ -0,0 +1,42 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+)
+
+// detailsRatio compares the detail rows a monthly run wrote (upserted + zeroed) with
+// the cohort members it processed. Every member gets one row, so the ratio is 1 on a
+// healthy run; well above 1 means the details query returns several rows per customer
+// (a filter bug), well below means rows went missing. It returns the ratio and "high",
+// "low" or "" when it stays inside [min, max]. A zero bound is not checked.
+func detailsRatio(rows, cohort int, min, max float64) (float64, string) {
+	if cohort <= 0 {
+		return 0, ""
+	}
+	ratio := float64(rows) / float64(cohort)
+	switch {
+	case max > 0 && ratio > max:
+		return ratio, "high"
+	case min > 0 && ratio < min:
+		return ratio, "low"
+	}
+	return ratio, ""
+}
+
+// checkDetailsRatio logs and counts a monthly run whose row count falls outside the
+// DETAILS_RATIO_MIN/MAX band, and passes it to OnRatioAlarm when set. The sync itself
+// still succeeds.
+func (s *Service) checkDetailsRatio(ym, branch string, rows, cohort int) {
+	ratio, dir := detailsRatio(rows, cohort, s.Config.DetailsRatioMin, s.Config.DetailsRatioMax)
+	if dir == "" {
+		return
+	}
+	msg := fmt.Sprintf("details ratio alarm: ym=%s branch=%s rows=%d cohort=%d ratio=%.2f outside [%g, %g]",
+		ym, branch, rows, cohort, ratio, s.Config.DetailsRatioMin, s.Config.DetailsRatioMax)
+	log.Printf("ERROR %s", msg)
+	incRatioAlarm(branch, dir)
+	if s.OnRatioAlarm != nil {
+		s.OnRatioAlarm(msg)
+	}
+}
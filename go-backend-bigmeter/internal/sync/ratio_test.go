@@ -0,0 +1,74 @@
+package sync
+
+import (
+	"context"
+	"database/sql/driver"
+	"math"
+	"strings"
+	"testing"
+
+	"go-backend-bigmeter/internal/config"
+)
+
+func TestDetailsRatio(t *testing.T) {
+	tests := []struct {
+		rows, cohort int
+		min, max     float64
+		wantRatio    float64
+		wantDir      string
+	}{
+		{rows: 100, cohort: 100, min: 0.5, max: 1.5, wantRatio: 1},
+		{rows: 200, cohort: 100, min: 0.5, max: 1.5, wantRatio: 2, wantDir: "high"},
+		{rows: 40, cohort: 100, min: 0.5, max: 1.5, wantRatio: 0.4, wantDir: "low"},
+		{rows: 150, cohort: 100, min: 0.5, max: 1.5, wantRatio: 1.5},
+		// a zero bound is not checked
+		{rows: 500, cohort: 100, min: 0.5, wantRatio: 5},
+		{rows: 10, cohort: 100, max: 1.5, wantRatio: 0.1},
+		{rows: 10, cohort: 0, min: 0.5, max: 1.5},
+	}
+	for _, tt := range tests {
+		ratio, dir := detailsRatio(tt.rows, tt.cohort, tt.min, tt.max)
+		if math.Abs(ratio-tt.wantRatio) > 1e-9 || dir != tt.wantDir {
+			t.Errorf("detailsRatio(%d, %d, %g, %g) = %g %q, want %g %q",
+				tt.rows, tt.cohort, tt.min, tt.max, ratio, dir, tt.wantRatio, tt.wantDir)
+		}
+	}
+}
+
+func TestMonthlyRatioAlarm(t *testing.T) {
+	tests := []struct {
+		name      string
+		repeat    int // rows Oracle returns per cust_code
+		max       float64
+		wantAlarm bool
+	}{
+		{name: "one row per customer", repeat: 1, max: 1.5},
+		// a details query missing its cust_code filter repeats customers
+		{name: "rows far exceed the cohort", repeat: 3, max: 1.5, wantAlarm: true},
+		{name: "band disabled", repeat: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows [][]driver.Value
+			for i := 0; i < tt.repeat; i++ {
+				rows = append(rows,
+					[]driver.Value{"C001", "M-1", 10.0, 100.0, 10.0, "256712", "ปกติ"},
+					[]driver.Value{"C002", "M-2", 10.0, 100.0, 10.0, "256712", "ปกติ"})
+			}
+			s, pg := newTestService(t, config.SyncConfig{DetailsRatioMax: tt.max}, oracleDetails(detailsColumns, rows...))
+			seedCohort(t, pg, 2025, "BA01", 2)
+			var alarms []string
+			s.OnRatioAlarm = func(message string) { alarms = append(alarms, message) }
+
+			if _, _, err := s.MonthlyDetails(context.Background(), "202412", "BA01", 100, "manual"); err != nil {
+				t.Fatal(err)
+			}
+			if (len(alarms) > 0) != tt.wantAlarm {
+				t.Fatalf("alarms %q, want alarm %t", alarms, tt.wantAlarm)
+			}
+			if tt.wantAlarm && !strings.Contains(alarms[0], "rows=6 cohort=2") {
+				t.Errorf("alarm %q does not report rows=6 cohort=2", alarms[0])
+			}
+		})
+	}
+}
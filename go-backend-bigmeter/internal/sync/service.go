@@ -3,14 +3,20 @@ package sync
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	gosync "sync"
 	"time"
 
+	"golang.org/x/sync/errgroup"
+
+	"go-backend-bigmeter/internal/config"
 	dbpkg "go-backend-bigmeter/internal/database"
 )
 
@@ -19,14 +25,40 @@ type Service struct {
 	Oracle   *dbpkg.Oracle
 	Postgres *dbpkg.Postgres
 	LogRepo  *LogRepository
+	Config   config.SyncConfig
+	// Jobs guards against overlapping runs of the same syncType|branch|ym
+	Jobs *JobRegistry
+	// Status lists the runs executing in this process with their batch progress
+	Status *StatusRegistry
+	// OnRatioAlarm, when set, receives the message of a monthly run whose detail rows
+	// fall outside the DETAILS_RATIO_MIN/MAX band of the cohort size
+	OnRatioAlarm func(message string)
+	// OnBranchDone, when set, receives the outcome of every InitCustcodes and (not
+	// skipped) MonthlyDetails call, e.g. for NOTIFY_PER_BRANCH
+	OnBranchDone func(BranchResult)
+	// oraSlots bounds concurrent Oracle queries; nil when ORACLE_MAX_CONNS is 0
+	oraSlots chan struct{}
+}
+
+// JobContext derives the context of an API-triggered job holding key: bounded by
+// SYNC_JOB_TIMEOUT and cancelable through Jobs.Cancel.
+func (s *Service) JobContext(parent context.Context, key string) context.Context {
+	return s.Jobs.Context(parent, key, s.Config.JobTimeout)
 }
 
-func NewService(ora *dbpkg.Oracle, pg *dbpkg.Postgres) *Service {
-	return &Service{
+func NewService(ora *dbpkg.Oracle, pg *dbpkg.Postgres, cfg config.SyncConfig) *Service {
+	s := &Service{
 		Oracle:   ora,
 		Postgres: pg,
 		LogRepo:  NewLogRepository(pg.Pool),
+		Config:   cfg,
+		Jobs:     NewJobRegistry(),
+		Status:   NewStatusRegistry(),
 	}
+	if cfg.OracleMaxConns > 0 {
+		s.oraSlots = make(chan struct{}, cfg.OracleMaxConns)
+	}
+	return s
 }
 
 // OraTest pings Oracle and logs a simple count to validate connectivity.
@@ -44,9 +76,12 @@ func (s *Service) OraTest(ctx context.Context, branch string, debtYM string) err
 	// Lightweight existence check (avoid full COUNT(*) which may be slow): fetch 1 row
 	q := `SELECT 1 FROM PWACIS.TB_TR_DEBT_TRN trn
           WHERE trn.ORG_OWNER_ID = :ORG_OWNER_ID AND trn.DEBT_YM = :DEBT_YM AND ROWNUM=1`
+	start := time.Now()
 	if r := s.Oracle.DB.QueryRowContext(ctx, q, sql.Named("ORG_OWNER_ID", branch), sql.Named("DEBT_YM", debtYM)); r != nil {
 		var one int
-		if err := r.Scan(&one); err != nil {
+		err := r.Scan(&one)
+		observeOracleQuery(oraQueryOraTest, start, err)
+		if err != nil {
 			return fmt.Errorf("ora-test: query failed: %w", err)
 		}
 	}
@@ -54,21 +89,25 @@ func (s *Service) OraTest(ctx context.Context, branch string, debtYM string) err
 	return nil
 }
 
-// InitCustcodes runs the minimal unique-200 SQL and upserts into bm_custcode_init.
-func (s *Service) InitCustcodes(ctx context.Context, fiscalYear int, branch string, debtYM string, triggeredBy string) (int, int, error) {
+// InitCustcodes runs the minimal unique top-N SQL (N = COHORT_SIZE, default 200) and
+// upserts into bm_custcode_init, then backfills backfillMonths months of details (0 skips).
+func (s *Service) InitCustcodes(ctx context.Context, fiscalYear int, branch string, debtYM string, backfillMonths int, triggeredBy string) (int, int, error) {
+	started := time.Now()
+	upserted, zeroed, err := s.initCustcodes(ctx, fiscalYear, branch, debtYM, backfillMonths, triggeredBy)
+	s.branchDone(ctx, BranchResult{SyncType: "yearly_init", Branch: branch, YM: debtYM, FiscalYear: fiscalYear,
+		Upserted: upserted, Zeroed: zeroed, Duration: time.Since(started), Err: err})
+	return upserted, zeroed, err
+}
+
+func (s *Service) initCustcodes(ctx context.Context, fiscalYear int, branch string, debtYM string, backfillMonths int, triggeredBy string) (int, int, error) {
 	started := time.Now()
 	status := "success"
 	defer func() { observeJob("yearly_init", branch, status, started) }()
 
 	// Record sync start
-	var logID int64
-	var logErr error
-	if s.LogRepo != nil {
-		logID, logErr = s.LogRepo.RecordSyncStart(ctx, "yearly_init", branch, triggeredBy, nil, &debtYM, &fiscalYear)
-		if logErr != nil {
-			log.Printf("warning: failed to record sync start: %v", logErr)
-		}
-	}
+	logID := s.recordStart(ctx, "yearly_init", branch, triggeredBy, nil, &debtYM, &fiscalYear)
+	token := s.Status.Start(RunStatus{SyncType: "yearly_init", Branch: branch, YM: debtYM, FiscalYear: fiscalYear, TriggeredBy: triggeredBy, LogID: logIDRef(logID)})
+	defer s.Status.Finish(token)
 
 	q, err := os.ReadFile(filepath.Join("sqls", "200-meter-minimal.sql"))
 	if err != nil {
@@ -77,14 +116,33 @@ func (s *Service) InitCustcodes(ctx context.Context, fiscalYear int, branch stri
 		}
 		return 0, 0, fmt.Errorf("read minimal sql: %w", err)
 	}
-	rows, err := s.Oracle.DB.QueryContext(ctx, string(q), sql.Named("ORG_OWNER_ID", branch), sql.Named("DEBT_YM", debtYM))
+	minimalSQL, err := applyCohortTiebreak(string(q), s.Config.CohortTiebreak)
 	if err != nil {
+		status = "error"
 		if s.LogRepo != nil && logID > 0 {
 			s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
 		}
-		return 0, 0, fmt.Errorf("oracle query minimal: %w", err)
+		return 0, 0, err
+	}
+	// An October debt_ym that is not loaded yet returns nothing; step back month by month
+	// (DEBT_YM_FALLBACK_STEPS) so the branch is not left with an empty cohort for the year.
+	members, usedYM, err := s.fetchCohortWithFallback(ctx, minimalSQL, branch, debtYM)
+	if err != nil {
+		status = "error"
+		if s.LogRepo != nil && logID > 0 {
+			s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
+		}
+		return 0, 0, err
+	}
+	if usedYM != debtYM {
+		log.Printf("init: branch=%s fiscal=%d debt_ym=%s empty, cohort taken from fallback debt_ym=%s", branch, fiscalYear, debtYM, usedYM)
+		if s.LogRepo != nil && logID > 0 {
+			if err := s.LogRepo.UpdateSyncDebtYM(ctx, logID, usedYM); err != nil {
+				log.Printf("warning: failed to update sync log debt_ym: %v", err)
+			}
+		}
+		debtYM = usedYM
 	}
-	defer rows.Close()
 
 	tx, err := s.Postgres.Pool.Begin(ctx)
 	if err != nil {
@@ -113,25 +171,11 @@ func (s *Service) InitCustcodes(ctx context.Context, fiscalYear int, branch stri
                     debt_ym=EXCLUDED.debt_ym`
 
 	count := 0
-	keep := make([]string, 0, 200)
-	for rows.Next() {
-		var (
-			ba, orgName, custCode, useType, useName, custName, custAddress, routeCode sql.NullString
-			meterNo, sizeName, brandName, meterState, debtYMCol                       sql.NullString
-		)
-		if err := rows.Scan(
-			&ba, &orgName, &custCode, &useType, &useName, &custName, &custAddress, &routeCode,
-			&meterNo, &sizeName, &brandName, &meterState, &debtYMCol,
-		); err != nil {
-			status = "error"
-			if s.LogRepo != nil && logID > 0 {
-				s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
-			}
-			return 0, 0, fmt.Errorf("scan minimal: %w", err)
-		}
+	keep := make([]string, 0, len(members))
+	for _, m := range members {
 		if _, err := tx.Exec(ctx, insert,
-			fiscalYear, branch, orgName.String, custCode.String, useType.String, useName.String, custName.String, custAddress.String, routeCode.String,
-			meterNo.String, sizeName.String, brandName.String, meterState.String, debtYMCol.String,
+			fiscalYear, branch, m.orgName.String, m.custCode.String, m.useType.String, m.useName.String, m.custName.String, m.address.String, m.routeCode.String,
+			m.meterNo.String, m.sizeName.String, m.brandName.String, m.meterState.String, m.debtYM.String,
 		); err != nil {
 			status = "error"
 			if s.LogRepo != nil && logID > 0 {
@@ -140,17 +184,13 @@ func (s *Service) InitCustcodes(ctx context.Context, fiscalYear int, branch stri
 			return 0, 0, fmt.Errorf("pg insert minimal: %w", err)
 		}
 		count++
-		keep = append(keep, custCode.String)
+		keep = append(keep, m.custCode.String)
 	}
-	if err := rows.Err(); err != nil {
-		status = "error"
-		if s.LogRepo != nil && logID > 0 {
-			s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
-		}
-		return 0, 0, err
-	}
-	// Prune extras not in current top-200 cohort for this branch+fiscal
-	if len(keep) > 0 {
+	// Prune extras not in the current top-N cohort for this branch+fiscal.
+	// INIT_MODE=refresh only refreshes fields, so a short Oracle result never drops members.
+	if s.Config.InitMode == "refresh" {
+		log.Printf("init: branch=%s fiscal=%d refresh mode, prune skipped", branch, fiscalYear)
+	} else if len(keep) > 0 {
 		// Build DELETE with NOT IN (...) placeholders
 		ph := make([]string, len(keep))
 		args := make([]any, 0, 2+len(keep))
@@ -184,21 +224,102 @@ func (s *Service) InitCustcodes(ctx context.Context, fiscalYear int, branch stri
 
 	// Record sync success
 	if s.LogRepo != nil && logID > 0 {
-		if err := s.LogRepo.UpdateSyncSuccess(ctx, logID, count, 0); err != nil {
+		if err := s.LogRepo.UpdateSyncSuccess(ctx, logID, count, 0, retryAttempt(ctx)); err != nil {
 			log.Printf("warning: failed to update sync log: %v", err)
 		}
 	}
 
-	// Auto-backfill last 3 months of usage details for the new cohort (October + September + August)
-	log.Printf("init: branch=%s auto-backfilling last 3 months of usage details", branch)
-	if err := s.backfillRecentMonths(ctx, branch, fiscalYear, debtYM, 3, triggeredBy); err != nil {
-		log.Printf("warning: backfill failed for branch=%s: %v", branch, err)
-		// Don't fail the whole init if backfill fails
+	// Auto-backfill recent months of usage details for the new cohort (e.g. 3 = October + September + August)
+	if q := deferredBackfill(ctx); q != nil && backfillMonths > 0 {
+		log.Printf("init: branch=%s backfill of %d months deferred until all inits finish", branch, backfillMonths)
+		q.Add(BackfillJob{Branch: branch, FiscalYear: fiscalYear, DebtYM: debtYM, Months: backfillMonths, TriggeredBy: triggeredBy})
+	} else if backfillMonths > 0 {
+		log.Printf("init: branch=%s auto-backfilling last %d months of usage details", branch, backfillMonths)
+		if err := s.backfillRecentMonths(ctx, branch, fiscalYear, debtYM, backfillMonths, triggeredBy); err != nil {
+			log.Printf("warning: backfill failed for branch=%s: %v", branch, err)
+			// Don't fail the whole init if backfill fails
+		}
 	}
 
 	return count, 0, nil
 }
 
+// cohortMember is one row of the 200-meter-minimal.sql result
+type cohortMember struct {
+	ba, orgName, custCode, useType, useName, custName, address, routeCode sql.NullString
+	meterNo, sizeName, brandName, meterState, debtYM                      sql.NullString
+}
+
+// fetchCohortWithFallback reads the cohort for debtYM (Thai YYYYMM), trying up to
+// DebtYMFallbackSteps earlier months while the result is empty. It returns the rows
+// and the debt_ym that produced them (debtYM itself when every candidate is empty).
+func (s *Service) fetchCohortWithFallback(ctx context.Context, q, branch, debtYM string) ([]cohortMember, string, error) {
+	ym := debtYM
+	for step := 0; ; step++ {
+		members, err := s.fetchCohort(ctx, q, branch, ym)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(members) > 0 {
+			return members, ym, nil
+		}
+		if step >= s.Config.DebtYMFallbackSteps {
+			return nil, debtYM, nil
+		}
+		prev, err := previousYM(ym)
+		if err != nil {
+			return nil, "", err
+		}
+		log.Printf("init: branch=%s debt_ym=%s returned no rows, trying %s", branch, ym, prev)
+		ym = prev
+	}
+}
+
+// fetchCohort runs the minimal cohort query for one debt_ym; the Oracle slot is
+// released before returning.
+func (s *Service) fetchCohort(ctx context.Context, q, branch, debtYM string) ([]cohortMember, error) {
+	rows, err := s.queryOracle(ctx, oraQueryInit, q, sql.Named("ORG_OWNER_ID", branch), sql.Named("DEBT_YM", debtYM), sql.Named("COHORT_SIZE", s.cohortSize()))
+	if err != nil {
+		return nil, fmt.Errorf("oracle query minimal: %w", err)
+	}
+	defer rows.Close()
+
+	members := make([]cohortMember, 0, s.cohortSize())
+	for rows.Next() {
+		var m cohortMember
+		if err := rows.Scan(
+			&m.ba, &m.orgName, &m.custCode, &m.useType, &m.useName, &m.custName, &m.address, &m.routeCode,
+			&m.meterNo, &m.sizeName, &m.brandName, &m.meterState, &m.debtYM,
+		); err != nil {
+			return nil, fmt.Errorf("scan minimal: %w", err)
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// recordStart returns the log row for this run: the one pre-created by the caller
+// (WithPreCreatedLog) or a newly inserted in_progress row. 0 means no logging.
+func (s *Service) recordStart(ctx context.Context, syncType, branch, triggeredBy string, ym, debtYM *string, fiscal *int) int64 {
+	if s.LogRepo == nil {
+		return 0
+	}
+	if id := preCreatedLog(ctx); id > 0 {
+		if err := s.LogRepo.MarkSyncStarted(ctx, id); err != nil {
+			log.Printf("warning: failed to mark sync start: %v", err)
+		}
+		return id
+	}
+	logID, err := s.LogRepo.RecordSyncStart(ctx, syncType, branch, triggeredBy, ym, debtYM, fiscal)
+	if err != nil {
+		log.Printf("warning: failed to record sync start: %v", err)
+	}
+	return logID
+}
+
 // backfillRecentMonths syncs the last N months of usage details after yearly init.
 // This provides historical context for the newly captured cohort.
 func (s *Service) backfillRecentMonths(ctx context.Context, branch string, fiscalYear int, debtYM string, numMonths int, triggeredBy string) error {
@@ -235,12 +356,15 @@ func (s *Service) backfillRecentMonths(ctx context.Context, branch string, fisca
 
 	log.Printf("backfill: branch=%s fiscal=%d months=%v", branch, fiscalYear, months)
 
+	// Each backfilled month gets its own log row, never the init's pre-created one
+	ctx = WithPreCreatedLog(ctx, 0)
+
 	// Sync each month using MonthlyDetailsWithFiscalYear
 	// Pass the fiscal year so all months use the same cohort
 	batchSize := 100 // Default batch size
 	for _, ym := range months {
 		log.Printf("backfill: branch=%s ym=%s fiscal=%d starting", branch, ym, fiscalYear)
-		upserted, zeroed, err := s.MonthlyDetailsWithFiscalYear(ctx, ym, branch, batchSize, triggeredBy, fiscalYear)
+		upserted, zeroed, err := s.MonthlyDetailsWithFiscalYear(ctx, ym, branch, batchSize, triggeredBy+backfillTriggerSuffix, fiscalYear)
 		if err != nil {
 			log.Printf("backfill: branch=%s ym=%s failed: %v", branch, ym, err)
 			// Continue with other months even if one fails
@@ -256,17 +380,94 @@ func (s *Service) backfillRecentMonths(ctx context.Context, branch string, fisca
 // cohort captured in bm_custcode_init for the fiscal year of that month.
 // It batches cust_codes to avoid overly large IN clauses, upserts rows into bm_meter_details,
 // and inserts "zeroed" rows for cohort custcodes that return no Oracle rows for the given month.
+//
+// Scheduled runs are skipped when an init backfill already synced the same branch+ym
+// within BACKFILL_GRACE, so the first cron after a yearly init does not redo that work.
 func (s *Service) MonthlyDetails(ctx context.Context, ym string, branch string, batchSize int, triggeredBy string) (int, int, error) {
-	return s.MonthlyDetailsWithFiscalYear(ctx, ym, branch, batchSize, triggeredBy, 0)
+	if triggeredBy == "scheduler" && s.Config.BackfillGrace > 0 && s.LogRepo != nil {
+		recent, err := s.LogRepo.RecentBackfillCompleted(ctx, branch, ym, s.Config.BackfillGrace)
+		if err != nil {
+			log.Printf("warning: backfill grace check failed for branch=%s ym=%s: %v", branch, ym, err)
+		} else if recent {
+			log.Printf("monthly: branch=%s ym=%s skipped (backfill completed within %s)", branch, ym, s.Config.BackfillGrace)
+			return 0, 0, nil
+		}
+	}
+	started := time.Now()
+	upserted, zeroed, err := s.MonthlyDetailsWithFiscalYear(ctx, ym, branch, batchSize, triggeredBy, 0)
+	// A malformed ym is rejected by monthlyDetails; report it without a fiscal year
+	var fiscal int
+	if len(ym) == 6 {
+		fiscal = fiscalYearFromYM(ym)
+	}
+	s.branchDone(ctx, BranchResult{SyncType: "monthly_sync", Branch: branch, YM: ym, FiscalYear: fiscal,
+		Upserted: upserted, Zeroed: zeroed, Duration: time.Since(started), Err: err})
+	return upserted, zeroed, err
 }
 
 // MonthlyDetailsWithFiscalYear is like MonthlyDetails but allows overriding the fiscal year.
 // If fiscalYearOverride is 0, it calculates fiscal year from ym. Otherwise, uses the override.
 // This is useful for backfilling historical months with a newly created cohort.
 func (s *Service) MonthlyDetailsWithFiscalYear(ctx context.Context, ym string, branch string, batchSize int, triggeredBy string, fiscalYearOverride int) (int, int, error) {
+	return s.monthlyDetails(ctx, ym, branch, batchSize, triggeredBy, fiscalYearOverride, SyncOptions{})
+}
+
+// CohortsForMonth returns the fiscal years whose cohort should hold ym for branch,
+// ascending: the fiscal year of ym when that cohort was captured, plus any later cohort
+// that already has ym (an init backfill reaching back across the October boundary).
+func (s *Service) CohortsForMonth(ctx context.Context, ym string, branch string) ([]int, error) {
+	rows, err := s.Postgres.Pool.Query(ctx, `
+		SELECT fiscal_year FROM bm_custcode_init WHERE branch_code=$1 AND fiscal_year=$2
+		UNION
+		SELECT fiscal_year FROM bm_meter_details WHERE branch_code=$1 AND year_month=$3
+		ORDER BY 1`, branch, fiscalYearFromYM(ym), ym)
+	if err != nil {
+		return nil, fmt.Errorf("query cohorts for branch=%s ym=%s: %w", branch, ym, err)
+	}
+	defer rows.Close()
+	var out []int
+	for rows.Next() {
+		var fy int
+		if err := rows.Scan(&fy); err != nil {
+			return nil, err
+		}
+		out = append(out, fy)
+	}
+	return out, rows.Err()
+}
+
+// SyncOptions changes how a sync run writes its results
+type SyncOptions struct {
+	// DryRun runs the Oracle queries and counts what would be upserted/zeroed, but writes
+	// nothing to Postgres (no upserts, no prune, no sync log row, no metrics)
+	DryRun bool
+	// ResumeFrom skips the first N cohort entries (ordered by cust_code), i.e. the
+	// last_offset a failed run for the same branch+ym already committed
+	ResumeFrom int
+	// LogID is a sync log row the caller already created (e.g. to return its id to a
+	// client); the run updates it instead of inserting its own. 0 falls back to
+	// WithPreCreatedLog on ctx, then to inserting a new row.
+	LogID int64
+}
+
+// MonthlyDetailsWithOptions is MonthlyDetailsWithFiscalYear with explicit SyncOptions
+// (e.g. resuming a failed run).
+func (s *Service) MonthlyDetailsWithOptions(ctx context.Context, ym string, branch string, batchSize int, triggeredBy string, fiscalYearOverride int, opts SyncOptions) (int, int, error) {
+	return s.monthlyDetails(ctx, ym, branch, batchSize, triggeredBy, fiscalYearOverride, opts)
+}
+
+// MonthlyDetailsDryRun previews a monthly sync: it returns the projected upserted and
+// zeroed counts for ym+branch without touching bm_meter_details or bm_sync_logs.
+func (s *Service) MonthlyDetailsDryRun(ctx context.Context, ym string, branch string, batchSize int) (int, int, error) {
+	return s.monthlyDetails(ctx, ym, branch, batchSize, "", 0, SyncOptions{DryRun: true})
+}
+
+func (s *Service) monthlyDetails(ctx context.Context, ym string, branch string, batchSize int, triggeredBy string, fiscalYearOverride int, opts SyncOptions) (int, int, error) {
 	started := time.Now()
 	status := "success"
-	defer func() { observeJob("monthly_details", branch, status, started) }()
+	if !opts.DryRun {
+		defer func() { observeJob("monthly_details", branch, status, started) }()
+	}
 	if len(ym) != 6 {
 		return 0, 0, fmt.Errorf("invalid ym; expect YYYYMM")
 	}
@@ -281,73 +482,106 @@ func (s *Service) MonthlyDetailsWithFiscalYear(ctx context.Context, ym string, b
 		fiscal = fiscalYearFromYM(ym)
 	}
 
-	// Record sync start
+	// Record sync start and show the run in GET /sync/status (not for dry runs)
 	var logID int64
-	var logErr error
-	if s.LogRepo != nil {
-		logID, logErr = s.LogRepo.RecordSyncStart(ctx, "monthly_sync", branch, triggeredBy, &ym, nil, &fiscal)
-		if logErr != nil {
-			log.Printf("warning: failed to record sync start: %v", logErr)
+	progress := func(upserted, zeroed int) {}
+	if opts.LogID > 0 {
+		ctx = WithPreCreatedLog(ctx, opts.LogID)
+	}
+	if !opts.DryRun {
+		logID = s.recordStart(ctx, "monthly_sync", branch, triggeredBy, &ym, nil, &fiscal)
+		token := s.Status.Start(RunStatus{SyncType: "monthly_sync", Branch: branch, YM: ym, FiscalYear: fiscal, TriggeredBy: triggeredBy, LogID: logIDRef(logID)})
+		defer s.Status.Finish(token)
+		progress = func(upserted, zeroed int) { s.Status.Progress(token, upserted, zeroed) }
+	}
+
+	// Bound the whole branch run (all batches) when MONTHLY_SYNC_BRANCH_TIMEOUT is set.
+	// Work runs on runCtx; log updates keep using ctx so they still succeed after a timeout.
+	runCtx := ctx
+	if s.Config.MonthlyBranchTimeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, s.Config.MonthlyBranchTimeout)
+		defer cancel()
+	}
+	failLog := func(err error) {
+		if s.LogRepo == nil || logID <= 0 {
+			return
+		}
+		msg := err.Error()
+		switch {
+		case errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+			msg = "branch timeout"
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			msg = "job timeout"
+		case errors.Is(ctx.Err(), context.Canceled):
+			msg = "canceled: " + msg
 		}
+		// runCtx carries both deadlines, so either timeout is logged as status 'timeout'
+		s.LogRepo.UpdateSyncError(runCtx, logID, msg)
 	}
 
 	// Load cohort from Postgres
-	// Also keep snapshot text fields for zeroed rows (use_type, meter_no, meter_state)
-	const qCohort = `SELECT cust_code, COALESCE(use_type,''), COALESCE(meter_no,''), COALESCE(meter_state,'')
-                     FROM bm_custcode_init WHERE fiscal_year=$1 AND branch_code=$2`
-	rows, err := s.Postgres.Pool.Query(ctx, qCohort, fiscal, branch)
+	// Also keep snapshot fields for zeroed rows (use_type, meter_no, meter_state, debt_ym);
+	// use_type is stored on active rows too, for the per-use_type summary
+	const qCohort = `SELECT cust_code, COALESCE(use_type,''), COALESCE(meter_no,''), COALESCE(meter_state,''), COALESCE(debt_ym,'')
+                     FROM bm_custcode_init WHERE fiscal_year=$1 AND branch_code=$2
+                     ORDER BY cust_code`
+	rows, err := s.Postgres.Pool.Query(runCtx, qCohort, fiscal, branch)
 	if err != nil {
-		if s.LogRepo != nil && logID > 0 {
-			s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
-		}
+		failLog(err)
 		return 0, 0, fmt.Errorf("pg select cohort: %w", err)
 	}
 	defer rows.Close()
 	var cohort []string
-	snap := make(map[string][3]string)
+	snap := make(map[string][4]string)
 	for rows.Next() {
-		var cc, ut, mn, ms string
-		if err := rows.Scan(&cc, &ut, &mn, &ms); err != nil {
-			if s.LogRepo != nil && logID > 0 {
-				s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
-			}
+		var cc, ut, mn, ms, dy string
+		if err := rows.Scan(&cc, &ut, &mn, &ms, &dy); err != nil {
+			failLog(err)
 			return 0, 0, fmt.Errorf("scan cohort: %w", err)
 		}
 		cohort = append(cohort, cc)
-		snap[cc] = [3]string{ut, mn, ms}
+		snap[cc] = [4]string{ut, mn, ms, dy}
 	}
 	if err := rows.Err(); err != nil {
-		if s.LogRepo != nil && logID > 0 {
-			s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
-		}
+		failLog(err)
 		return 0, 0, err
 	}
 	if len(cohort) == 0 {
 		log.Printf("month: ym=%s branch=%s fiscal=%d cohort=0 (skip)", ym, branch, fiscal)
 		// Record success with 0 counts
 		if s.LogRepo != nil && logID > 0 {
-			s.LogRepo.UpdateSyncSuccess(ctx, logID, 0, 0)
+			s.LogRepo.UpdateSyncSuccess(ctx, logID, 0, 0, retryAttempt(ctx))
 		}
 		return 0, 0, nil
 	}
 
-	// Prune any existing details rows for this ym+branch that are not in the cohort.
-	// This ensures /details returns at most the cohort size (typically 200) and
-	// removes leftovers from earlier oversized runs.
-	{
+	// Prune any existing details rows for this ym+branch+fiscal year that are not in the
+	// cohort. Rows a resumed run skips are cohort members, so they are never pruned here.
+	// This ensures /details returns at most the cohort size (COHORT_SIZE, default 200) and
+	// removes leftovers from earlier oversized runs. Only the synced fiscal year's rows
+	// are touched, so another cohort's rows for the same month survive, and with
+	// SKIP_DETAILS_PRUNE months before the current one are left alone entirely.
+	if s.Config.SkipDetailsPrune && isHistoricalYM(ym, time.Now().In(s.location())) {
+		log.Printf("month: ym=%s branch=%s historical month, prune skipped (SKIP_DETAILS_PRUNE)", ym, branch)
+	} else {
 		ph := make([]string, len(cohort))
-		args := make([]any, 0, 2+len(cohort))
-		args = append(args, ym, branch)
+		args := make([]any, 0, 3+len(cohort))
+		args = append(args, ym, branch, fiscal)
 		for i, c := range cohort {
-			ph[i] = fmt.Sprintf("$%d", i+3)
+			ph[i] = fmt.Sprintf("$%d", i+4)
 			args = append(args, c)
 		}
-		del := "DELETE FROM bm_meter_details WHERE year_month=$1 AND branch_code=$2 AND cust_code NOT IN (" + strings.Join(ph, ",") + ")"
-		if ct, err := s.Postgres.Pool.Exec(ctx, del, args...); err != nil {
-			status = "error"
-			if s.LogRepo != nil && logID > 0 {
-				s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
+		notIn := "FROM bm_meter_details WHERE year_month=$1 AND branch_code=$2 AND fiscal_year=$3 AND cust_code NOT IN (" + strings.Join(ph, ",") + ")"
+		if opts.DryRun {
+			var n int
+			if err := s.Postgres.Pool.QueryRow(runCtx, "SELECT COUNT(1) "+notIn, args...).Scan(&n); err != nil {
+				return 0, 0, fmt.Errorf("pg count details extras: %w", err)
 			}
+			log.Printf("month: dry-run ym=%s branch=%s would prune_details=%d", ym, branch, n)
+		} else if ct, err := s.Postgres.Pool.Exec(runCtx, "DELETE "+notIn, args...); err != nil {
+			status = "error"
+			failLog(err)
 			return 0, 0, fmt.Errorf("pg prune details extras: %w", err)
 		} else if n := ct.RowsAffected(); n > 0 {
 			log.Printf("month: ym=%s branch=%s pruned_details=%d", ym, branch, n)
@@ -357,9 +591,7 @@ func (s *Service) MonthlyDetailsWithFiscalYear(ctx context.Context, ym string, b
 	// Load SQL template and prepare base
 	b, err := os.ReadFile(filepath.Join("sqls", "200-meter-details.sql"))
 	if err != nil {
-		if s.LogRepo != nil && logID > 0 {
-			s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
-		}
+		failLog(err)
 		return 0, 0, fmt.Errorf("read details sql: %w", err)
 	}
 	baseSQL := string(b)
@@ -370,148 +602,107 @@ func (s *Service) MonthlyDetailsWithFiscalYear(ctx context.Context, ym string, b
 	totalZeroed := 0
 	batchCount := 0
 
-	for i := 0; i < len(cohort); i += max(1, batchSize) {
-		end := i + max(1, batchSize)
-		if end > len(cohort) {
-			end = len(cohort)
-		}
-		batch := cohort[i:end]
-
-		// Build IN clause placeholders
-		ph := make([]string, len(batch))
-		args := []any{sql.Named("ORG_OWNER_ID", branch), sql.Named("DEBT_YM", thaiYM)}
-		for j, c := range batch {
-			name := fmt.Sprintf("C%d", j)
-			ph[j] = ":" + name
-			args = append(args, sql.Named(name, c))
-		}
-		sqlText := strings.Replace(baseSQL, "/*__CUSTCODE_FILTER__*/", "AND trn.CUST_CODE IN ("+strings.Join(ph, ",")+")", 1)
-
-		// Query Oracle
-		orows, err := s.Oracle.DB.QueryContext(ctx, sqlText, args...)
-		if err != nil {
-			status = "error"
-			if s.LogRepo != nil && logID > 0 {
-				s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
+	// Resume: the cohort is ordered by cust_code, so the first ResumeFrom entries are
+	// the ones a failed run already committed
+	resumeFrom := 0
+	if !opts.DryRun && opts.ResumeFrom > 0 {
+		resumeFrom = min(opts.ResumeFrom, len(cohort))
+		log.Printf("month: ym=%s branch=%s resuming at offset %d/%d", ym, branch, resumeFrom, len(cohort))
+		if s.LogRepo != nil && logID > 0 {
+			if err := s.LogRepo.UpdateSyncOffset(ctx, logID, resumeFrom); err != nil {
+				log.Printf("warning: failed to update sync offset: %v", err)
 			}
-			return 0, 0, fmt.Errorf("oracle details batch %d-%d: %w", i, end, err)
 		}
+	}
+	// committed maps a finished batch's start to its end; lastOffset only advances over
+	// a contiguous prefix, since concurrent batches can commit out of order
+	committed := make(map[int]int)
+	lastOffset := resumeFrom
 
-		// Track which custcodes returned data
-		seen := make(map[string]bool, len(batch))
-
-		// Upsert results
-		tx, err := s.Postgres.Pool.Begin(ctx)
-		if err != nil {
-			orows.Close()
-			status = "error"
-			if s.LogRepo != nil && logID > 0 {
-				s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
-			}
-			return 0, 0, fmt.Errorf("pg begin: %w", err)
+	// Batches query Oracle concurrently (BATCH_CONCURRENCY, default 1 = sequential);
+	// their Postgres writes and the running totals are serialized by mu, so only one
+	// transaction per branch is open at a time.
+	var mu gosync.Mutex
+	g, gctx := errgroup.WithContext(runCtx)
+	g.SetLimit(s.batchConcurrency())
+	for i := resumeFrom; i < len(cohort); i += max(1, batchSize) {
+		end := i + max(1, batchSize)
+		if end > len(cohort) {
+			end = len(cohort)
 		}
-
-		upsert := `INSERT INTO bm_meter_details (
-                        fiscal_year, year_month, branch_code, org_name, cust_code, use_type, use_name, cust_name, address, route_code,
-                        meter_no, meter_size, meter_brand, meter_state, average, present_meter_count, present_water_usg, debt_ym)
-                    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18)
-                    ON CONFLICT (fiscal_year, year_month, branch_code, cust_code) DO UPDATE SET
-                        org_name=EXCLUDED.org_name,
-                        use_type=EXCLUDED.use_type,
-                        use_name=EXCLUDED.use_name,
-                        cust_name=EXCLUDED.cust_name,
-                        address=EXCLUDED.address,
-                        route_code=EXCLUDED.route_code,
-                        meter_no=EXCLUDED.meter_no,
-                        meter_size=EXCLUDED.meter_size,
-                        meter_brand=EXCLUDED.meter_brand,
-                        meter_state=EXCLUDED.meter_state,
-                        average=EXCLUDED.average,
-                        present_meter_count=EXCLUDED.present_meter_count,
-                        present_water_usg=EXCLUDED.present_water_usg,
-                        debt_ym=EXCLUDED.debt_ym`
-
-		for orows.Next() {
-			var cust, mtrNo, debt sql.NullString
-			var avg, presentCnt, presentUSG sql.NullFloat64
-			if err := orows.Scan(&cust, &mtrNo, &avg, &presentCnt, &presentUSG, &debt); err != nil {
-				orows.Close()
-				tx.Rollback(ctx)
-				status = "error"
-				if s.LogRepo != nil && logID > 0 {
-					s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
+		i, batch := i, cohort[i:end]
+		g.Go(func() error {
+			if err := runCtx.Err(); err != nil {
+				if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+					return fmt.Errorf("branch timeout after %s (batch %d/%d)", s.Config.MonthlyBranchTimeout, i, len(cohort))
 				}
-				return 0, 0, fmt.Errorf("scan details: %w", err)
+				return err
 			}
-			seen[cust.String] = true
-			if _, err := tx.Exec(ctx, upsert,
-				fiscal, ym, branch,
-				nil,                     /* org_name */
-				cust.String,             /* cust_code */
-				nil, nil, nil, nil, nil, /* use_type, use_name, cust_name, address, route_code */
-				nullableString(mtrNo), /* meter_no */
-				nil, nil, nil,         /* meter_size, meter_brand, meter_state */
-				zeroIfNull(avg), zeroIfNull(presentCnt), zeroIfNull(presentUSG), nullableString(debt),
-			); err != nil {
-				orows.Close()
-				tx.Rollback(ctx)
-				status = "error"
-				if s.LogRepo != nil && logID > 0 {
-					s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
-				}
-				return 0, 0, fmt.Errorf("pg upsert details: %w", err)
+			if err := gctx.Err(); err != nil {
+				return err // another batch already failed
 			}
-			totalUpserts++
-		}
-		if err := orows.Err(); err != nil {
-			orows.Close()
-			tx.Rollback(ctx)
-			status = "error"
-			if s.LogRepo != nil && logID > 0 {
-				s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
+			rows, err := s.fetchDetailsBatch(gctx, baseSQL, ym, thaiYM, branch, batch)
+			if err != nil {
+				return fmt.Errorf("oracle details batch %d-%d: %w", i, end, err)
 			}
-			return 0, 0, err
-		}
-		orows.Close()
 
-		// Insert zeroed rows for missing
-		for _, c := range batch {
-			if seen[c] {
-				continue
+			mu.Lock()
+			defer mu.Unlock()
+			upserted, zeroed, err := s.writeDetailsBatch(ctx, gctx, fiscal, ym, thaiYM, branch, batch, rows, snap, opts)
+			if err != nil {
+				return err
 			}
-			snapv := snap[c]
-			if _, err := tx.Exec(ctx, upsert,
-				fiscal, ym, branch, "", c, snapv[0], "", "", "", "", snapv[1], "", "", snapv[2],
-				0.0, 0.0, 0.0, thaiYM,
-			); err != nil {
-				tx.Rollback(ctx)
-				status = "error"
-				if s.LogRepo != nil && logID > 0 {
-					s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
-				}
-				return 0, 0, fmt.Errorf("pg upsert zeroed: %w", err)
+			totalUpserts += upserted
+			totalZeroed += zeroed
+			batchCount++
+			if opts.DryRun {
+				return nil
 			}
-			totalZeroed++
-		}
-
-		if err := tx.Commit(ctx); err != nil {
-			status = "error"
+			committed[i] = end
+			for e, ok := committed[lastOffset]; ok; e, ok = committed[lastOffset] {
+				delete(committed, lastOffset)
+				lastOffset = e
+			}
+			log.Printf("month: ym=%s branch=%s batch=%d-%d upserted=%d zeroed=%d", ym, branch, i, end-1, totalUpserts, totalZeroed)
+			progress(totalUpserts, totalZeroed)
 			if s.LogRepo != nil && logID > 0 {
-				s.LogRepo.UpdateSyncError(ctx, logID, err.Error())
+				if err := s.LogRepo.UpdateSyncProgress(ctx, logID, totalUpserts, totalZeroed, lastOffset); err != nil {
+					log.Printf("warning: failed to update sync progress: %v", err)
+				}
 			}
-			return 0, 0, err
-		}
-		batchCount++
-		log.Printf("month: ym=%s branch=%s batch=%d-%d upserted=%d zeroed=%d", ym, branch, i, end-1, totalUpserts, totalZeroed)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		status = "error"
+		failLog(err)
+		return 0, 0, err
+	}
+	if opts.DryRun {
+		log.Printf("month: dry-run ym=%s branch=%s would upsert=%d zeroed=%d", ym, branch, totalUpserts, totalZeroed)
+		return totalUpserts, totalZeroed, nil
 	}
 	log.Printf("month: ym=%s branch=%s completed upserted=%d zeroed=%d", ym, branch, totalUpserts, totalZeroed)
 	addRows("monthly_details", branch, "upserted", totalUpserts)
 	addRows("monthly_details", branch, "zeroed", totalZeroed)
 	incBatches("monthly_details", branch, batchCount)
+	s.checkDetailsRatio(ym, branch, totalUpserts+totalZeroed, len(cohort)-resumeFrom)
+
+	// Refresh stored pct_change for ym and for the month after it, whose previous month
+	// just changed. A failure here leaves stale values but does not fail the sync.
+	if s.Config.ComputePctChange {
+		if nextYM, err := nextYM(ym); err == nil {
+			for _, m := range []string{ym, nextYM} {
+				if _, err := RecomputePctChange(ctx, s.Postgres, fiscal, m, branch); err != nil {
+					log.Printf("warning: pct_change ym=%s branch=%s: %v", m, branch, err)
+				}
+			}
+		}
+	}
 
 	// Record sync success
 	if s.LogRepo != nil && logID > 0 {
-		if err := s.LogRepo.UpdateSyncSuccess(ctx, logID, totalUpserts, totalZeroed); err != nil {
+		if err := s.LogRepo.UpdateSyncSuccess(ctx, logID, totalUpserts, totalZeroed, retryAttempt(ctx)); err != nil {
 			log.Printf("warning: failed to update sync log: %v", err)
 		}
 	}
@@ -532,6 +723,70 @@ func toThaiYM(ym string) (string, error) {
 	return fmt.Sprintf("%d%s", y+543, mm), nil
 }
 
+// previousYM returns the month before a YYYYMM value (Thai or Gregorian year alike)
+func previousYM(ym string) (string, error) {
+	if len(ym) != 6 {
+		return "", fmt.Errorf("invalid ym %q", ym)
+	}
+	y, err := strconv.Atoi(ym[:4])
+	if err != nil {
+		return "", fmt.Errorf("invalid ym year %q", ym)
+	}
+	m, err := strconv.Atoi(ym[4:])
+	if err != nil || m < 1 || m > 12 {
+		return "", fmt.Errorf("invalid ym month %q", ym)
+	}
+	if m--; m == 0 {
+		m, y = 12, y-1
+	}
+	return fmt.Sprintf("%04d%02d", y, m), nil
+}
+
+// nextYM returns the month after a YYYYMM value
+func nextYM(ym string) (string, error) {
+	if len(ym) != 6 {
+		return "", fmt.Errorf("invalid ym %q", ym)
+	}
+	y, err := strconv.Atoi(ym[:4])
+	if err != nil {
+		return "", fmt.Errorf("invalid ym year %q", ym)
+	}
+	m, err := strconv.Atoi(ym[4:])
+	if err != nil || m < 1 || m > 12 {
+		return "", fmt.Errorf("invalid ym month %q", ym)
+	}
+	if m++; m == 13 {
+		m, y = 1, y+1
+	}
+	return fmt.Sprintf("%04d%02d", y, m), nil
+}
+
+// IsFutureYM reports whether a Gregorian YYYYMM lies after the month of now (pass now
+// in the configured TIMEZONE). Oracle has no data for such a month yet, so syncing it
+// would only write an all-zeroed dataset.
+func IsFutureYM(ym string, now time.Time) bool {
+	return ym > fmt.Sprintf("%04d%02d", now.Year(), int(now.Month()))
+}
+
+// isHistoricalYM reports whether a Gregorian YYYYMM lies before the month of now (pass
+// now in the configured TIMEZONE)
+func isHistoricalYM(ym string, now time.Time) bool {
+	return ym < fmt.Sprintf("%04d%02d", now.Year(), int(now.Month()))
+}
+
+// location is the configured TIMEZONE, falling back to the local zone
+func (s *Service) location() *time.Location {
+	loc, err := time.LoadLocation(s.Config.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// fiscalYearFromYM returns the fiscal year of ym (Oct-Dec belong to the next year).
+// GET /details filters on it by default, and a regular monthly sync stores it as
+// fiscal_year; a backfill (MonthlyDetailsWithFiscalYear) stores the cohort's fiscal
+// year instead, which GET /details reaches through its fiscal_year parameter.
 func fiscalYearFromYM(ym string) int {
 	y, _ := strconv.Atoi(ym[:4])
 	m, _ := strconv.Atoi(ym[4:])
@@ -541,15 +796,44 @@ func fiscalYearFromYM(ym string) int {
 	return y
 }
 
+// fetchFirstRe matches a row-limit clause with a literal or bound count
+var fetchFirstRe = regexp.MustCompile(`(?i)FETCH\s+FIRST\s+(\d+|:\w+)\s+ROWS\s+ONLY`)
+
+// removeFetchFirst drops any FETCH FIRST N ROWS ONLY clause (monthly queries are
+// already limited to the cohort by their IN filter).
 func removeFetchFirst(s string) string {
-	// very simple removal to be robust if template adds it; case-insensitive
-	upper := strings.ToUpper(s)
-	idx := strings.Index(upper, "FETCH FIRST 200 ROWS ONLY")
-	if idx < 0 {
-		return s
+	return fetchFirstRe.ReplaceAllString(s, "")
+}
+
+// cohortSize is COHORT_SIZE with the historical 200 as fallback
+func (s *Service) cohortSize() int {
+	if s.Config.CohortSize > 0 {
+		return s.Config.CohortSize
 	}
-	// remove that phrase only
-	return s[:idx] + s[idx+len("FETCH FIRST 200 ROWS ONLY"):]
+	return 200
+}
+
+// cohortTiebreakMarker is where the minimal SQL takes the COHORT_TIEBREAK suffix
+const cohortTiebreakMarker = "/*__COHORT_TIEBREAK__*/"
+
+// cohortTiebreakers maps COHORT_TIEBREAK to the ORDER BY suffix injected at the
+// cohortTiebreakMarker of the minimal SQL (alias d = deduplicated rows).
+var cohortTiebreakers = map[string]string{
+	"cust_code": ", d.CUST_CODE ASC",
+	"cust_id":   ", d.CUST_ID ASC",
+	"none":      "",
+}
+
+// applyCohortTiebreak fills the tiebreak marker so that usage ties at the cohort
+// boundary resolve the same way every run instead of churning members. A customized
+// SQL without the marker is an error unless COHORT_TIEBREAK=none: running it would
+// silently bring the churn back.
+func applyCohortTiebreak(q, mode string) (string, error) {
+	suffix := cohortTiebreakers[mode]
+	if suffix != "" && !strings.Contains(q, cohortTiebreakMarker) {
+		return "", fmt.Errorf("COHORT_TIEBREAK=%s but sqls/200-meter-minimal.sql has no %s marker; add it to the cohort ORDER BY or set COHORT_TIEBREAK=none", mode, cohortTiebreakMarker)
+	}
+	return strings.Replace(q, cohortTiebreakMarker, suffix, 1), nil
 }
 
 func max(a, b int) int {
@@ -564,9 +848,191 @@ func nullableString(ns sql.NullString) any {
 	}
 	return nil
 }
+func nullIfEmpty(v string) any {
+	if v == "" {
+		return nil
+	}
+	return v
+}
 func zeroIfNull(n sql.NullFloat64) float64 {
 	if n.Valid {
 		return n.Float64
 	}
 	return 0
 }
+func clampNegative(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// detailRow is one Oracle details row, buffered so the Oracle slot is released before
+// the batch's Postgres transaction opens
+type detailRow struct {
+	cust       string
+	meterNo    sql.NullString
+	avg        float64
+	count      float64
+	usage      float64
+	debt       sql.NullString
+	state      sql.NullString
+	clampedNeg bool
+}
+
+// fetchDetailsBatch queries Oracle for one batch of cohort custcodes
+func (s *Service) fetchDetailsBatch(ctx context.Context, baseSQL, ym, thaiYM, branch string, batch []string) ([]detailRow, error) {
+	// Build IN clause placeholders
+	ph := make([]string, len(batch))
+	args := []any{sql.Named("ORG_OWNER_ID", branch), sql.Named("DEBT_YM", thaiYM)}
+	for j, c := range batch {
+		name := fmt.Sprintf("C%d", j)
+		ph[j] = ":" + name
+		args = append(args, sql.Named(name, c))
+	}
+	sqlText := strings.Replace(baseSQL, "/*__CUSTCODE_FILTER__*/", "AND trn.CUST_CODE IN ("+strings.Join(ph, ",")+")", 1)
+
+	orows, err := s.queryOracle(ctx, oraQueryDetails, sqlText, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer orows.Close()
+	cols, err := orows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("details columns: %w", err)
+	}
+	scanner, err := newDetailScanner(cols)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []detailRow
+	for orows.Next() {
+		var cust, mtrNo, debt, state sql.NullString
+		var avg, presentCnt, presentUSG sql.NullFloat64
+		if err := scanner.scan(orows, &cust, &mtrNo, &avg, &presentCnt, &presentUSG, &debt, &state); err != nil {
+			return nil, fmt.Errorf("scan details: %w", err)
+		}
+		r := detailRow{
+			cust:    cust.String,
+			meterNo: mtrNo,
+			avg:     zeroIfNull(avg),
+			count:   zeroIfNull(presentCnt),
+			usage:   zeroIfNull(presentUSG),
+			debt:    debt,
+			state:   state,
+		}
+		if s.Config.ClampNegativeUsage && (r.count < 0 || r.usage < 0) {
+			log.Printf("month: ym=%s branch=%s cust=%s clamping negative usage (count=%v usg=%v)", ym, branch, r.cust, r.count, r.usage)
+			r.count, r.usage = clampNegative(r.count), clampNegative(r.usage)
+			r.clampedNeg = true
+		}
+		out = append(out, r)
+	}
+	if err := orows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+const upsertDetailsSQL = `INSERT INTO bm_meter_details (
+                        fiscal_year, year_month, branch_code, org_name, cust_code, use_type, use_name, cust_name, address, route_code,
+                        meter_no, meter_size, meter_brand, meter_state, average, present_meter_count, present_water_usg, debt_ym,
+                        usage_clamped)
+                    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19)
+                    ON CONFLICT (fiscal_year, year_month, branch_code, cust_code) DO UPDATE SET
+                        org_name=EXCLUDED.org_name,
+                        use_type=EXCLUDED.use_type,
+                        use_name=EXCLUDED.use_name,
+                        cust_name=EXCLUDED.cust_name,
+                        address=EXCLUDED.address,
+                        route_code=EXCLUDED.route_code,
+                        meter_no=EXCLUDED.meter_no,
+                        meter_size=EXCLUDED.meter_size,
+                        meter_brand=EXCLUDED.meter_brand,
+                        meter_state=EXCLUDED.meter_state,
+                        average=EXCLUDED.average,
+                        present_meter_count=EXCLUDED.present_meter_count,
+                        present_water_usg=EXCLUDED.present_water_usg,
+                        debt_ym=EXCLUDED.debt_ym,
+                        usage_clamped=EXCLUDED.usage_clamped`
+
+// writeDetailsBatch upserts one batch in its own transaction: the Oracle rows plus a
+// zeroed row for every custcode Oracle did not return. A dry run only counts.
+// Rollback uses ctx so it still runs after runCtx times out.
+func (s *Service) writeDetailsBatch(ctx, runCtx context.Context, fiscal int, ym, thaiYM, branch string, batch []string, rows []detailRow, snap map[string][4]string, opts SyncOptions) (int, int, error) {
+	// Track which custcodes returned data
+	seen := make(map[string]bool, len(batch))
+	for _, r := range rows {
+		seen[r.cust] = true
+	}
+	if opts.DryRun {
+		zeroed := 0
+		for _, c := range batch {
+			if !seen[c] {
+				zeroed++
+			}
+		}
+		return len(rows), zeroed, nil
+	}
+
+	tx, err := s.Postgres.Pool.Begin(runCtx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("pg begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	upserted := 0
+	for _, r := range rows {
+		if _, err := tx.Exec(runCtx, upsertDetailsSQL,
+			fiscal, ym, branch,
+			nil,                          /* org_name */
+			r.cust,                       /* cust_code */
+			nullIfEmpty(snap[r.cust][0]), /* use_type (cohort snapshot) */
+			nil, nil, nil, nil,           /* use_name, cust_name, address, route_code */
+			nullableString(r.meterNo), /* meter_no */
+			nil, nil,                  /* meter_size, meter_brand */
+			nullableString(r.state), /* meter_state */
+			r.avg, r.count, r.usage, nullableString(r.debt), r.clampedNeg,
+		); err != nil {
+			return 0, 0, fmt.Errorf("pg upsert details: %w", err)
+		}
+		upserted++
+	}
+
+	// Insert zeroed rows for missing
+	zeroed := 0
+	for _, c := range batch {
+		if seen[c] {
+			continue
+		}
+		snapv := snap[c]
+		// Zeroed rows carry the debt_ym the cohort was captured from; Oracle returned no
+		// debt for this month, so the current ym would be a made-up value. Snapshots
+		// written before debt_ym was persisted fall back to the current month.
+		debtYM := snapv[3]
+		if debtYM == "" {
+			debtYM = thaiYM
+		}
+		if _, err := tx.Exec(runCtx, upsertDetailsSQL,
+			fiscal, ym, branch, "", c, snapv[0], "", "", "", "", snapv[1], "", "", snapv[2],
+			0.0, 0.0, 0.0, debtYM, false,
+		); err != nil {
+			return 0, 0, fmt.Errorf("pg upsert zeroed: %w", err)
+		}
+		zeroed++
+	}
+
+	if err := tx.Commit(runCtx); err != nil {
+		return 0, 0, fmt.Errorf("pg commit: %w", err)
+	}
+	return upserted, zeroed, nil
+}
+
+// batchConcurrency is BATCH_CONCURRENCY with sequential batches as fallback
+func (s *Service) batchConcurrency() int {
+	if s.Config.BatchConcurrency > 0 {
+		return s.Config.BatchConcurrency
+	}
+	return 1
+}
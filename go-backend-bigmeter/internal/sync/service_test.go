@@ -0,0 +1,692 @@
+package sync
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-backend-bigmeter/internal/config"
+	dbpkg "go-backend-bigmeter/internal/database"
+	"go-backend-bigmeter/internal/database/dbtest"
+)
+
+// detailsColumns are the result columns of sqls/200-meter-details.sql
+var detailsColumns = []string{"เลขที่ผู้ใช้น้ำ", "หมายเลขมาตร", "หน่วยน้ำเฉลี่ย", "เลขมาตรที่อ่านได้", "หน่วยน้ำปัจจุบัน", "เดือนหนี้", "สถานะมาตร"}
+
+// detailsSQLStub stands in for the details template; the fake Oracle ignores the text
+const detailsSQLStub = `SELECT 1 FROM dual WHERE 1=1 /*__CUSTCODE_FILTER__*/`
+
+// oracleDetails answers every query with the given details rows
+func oracleDetails(columns []string, rows ...[]driver.Value) dbtest.QueryFunc {
+	return func(string, []driver.NamedValue) (dbtest.Result, error) {
+		return dbtest.Result{Columns: columns, Rows: rows}, nil
+	}
+}
+
+// oracleEcho answers a details batch with one row per bound cust_code (usage 10),
+// after waiting delay
+func oracleEcho(delay time.Duration) dbtest.QueryFunc {
+	return func(query string, args []driver.NamedValue) (dbtest.Result, error) {
+		time.Sleep(delay)
+		var rows [][]driver.Value
+		for _, a := range args {
+			if strings.HasPrefix(a.Name, "C") {
+				rows = append(rows, []driver.Value{a.Value, "M-" + fmt.Sprint(a.Value), 10.0, 100.0, 10.0, "256710", "ปกติ"})
+			}
+		}
+		return dbtest.Result{Columns: detailsColumns, Rows: rows}, nil
+	}
+}
+
+// cohortColumns are the result columns of sqls/200-meter-minimal.sql
+var cohortColumns = []string{"BA", "ORG_NAME", "CUST_CODE", "USE_TYPE", "USE_NAME", "CUST_NAME", "ADDRESS",
+	"ROUTE_CODE", "METER_NO", "METER_SIZE", "METER_BRAND", "METER_STATE", "DEBT_YM"}
+
+// oracleCohort answers the cohort query with one member per cust_code, taken at the
+// bound DEBT_YM
+func oracleCohort(custCodes ...string) dbtest.QueryFunc {
+	return func(query string, args []driver.NamedValue) (dbtest.Result, error) {
+		branch, debtYM := fmt.Sprint(dbtest.Arg(args, "ORG_OWNER_ID")), fmt.Sprint(dbtest.Arg(args, "DEBT_YM"))
+		var rows [][]driver.Value
+		for _, c := range custCodes {
+			rows = append(rows, []driver.Value{branch, "Org " + branch, c, "11", "residential", "Name " + c, "Addr", "R1",
+				"M-" + c, "1/2", "Brand", "normal", debtYM})
+		}
+		return dbtest.Result{Columns: cohortColumns, Rows: rows}, nil
+	}
+}
+
+// cohortCodes returns branch's cohort for fiscal, in cust_code order
+func cohortCodes(t *testing.T, pg *dbpkg.Postgres, fiscal int, branch string) []string {
+	t.Helper()
+	rows, err := pg.Pool.Query(context.Background(),
+		`SELECT cust_code FROM bm_custcode_init WHERE fiscal_year=$1 AND branch_code=$2 ORDER BY cust_code`, fiscal, branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var codes []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			t.Fatal(err)
+		}
+		codes = append(codes, c)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return codes
+}
+
+// newTestService returns a service on a fresh test database and a fake Oracle answering
+// with fn. The working directory is the module root, where the sqls/ templates are read.
+func newTestService(t *testing.T, cfg config.SyncConfig, fn dbtest.QueryFunc) (*Service, *dbpkg.Postgres) {
+	t.Helper()
+	pg := dbtest.Postgres(t)
+	t.Chdir(dbtest.ModuleRoot(t))
+	ora, _ := dbtest.Oracle(t, fn)
+	return NewService(ora, pg, cfg), pg
+}
+
+// seedCohort inserts cust_codes C001..Cnnn as branch's cohort for fiscal
+func seedCohort(t *testing.T, pg *dbpkg.Postgres, fiscal int, branch string, n int) {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		if _, err := pg.Pool.Exec(context.Background(),
+			`INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code, debt_ym) VALUES ($1, $2, $3, '256710')`,
+			fiscal, branch, fmt.Sprintf("C%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// lastLog returns the status and error message of the newest sync log row
+func lastLog(t *testing.T, pg *dbpkg.Postgres) (status, errMsg string) {
+	t.Helper()
+	if err := pg.Pool.QueryRow(context.Background(),
+		`SELECT status, COALESCE(error_message, '') FROM bm_sync_logs ORDER BY id DESC LIMIT 1`).Scan(&status, &errMsg); err != nil {
+		t.Fatal(err)
+	}
+	return status, errMsg
+}
+
+func TestFetchDetailsBatchClampNegative(t *testing.T) {
+	tests := []struct {
+		name        string
+		clamp       bool
+		count, usg  float64
+		wantCount   float64
+		wantUsage   float64
+		wantClamped bool
+	}{
+		{name: "clamp on, negative usage", clamp: true, count: 1200, usg: -35, wantCount: 1200, wantUsage: 0, wantClamped: true},
+		{name: "clamp on, negative count", clamp: true, count: -4, usg: 12, wantCount: 0, wantUsage: 12, wantClamped: true},
+		{name: "clamp on, positive", clamp: true, count: 1200, usg: 35, wantCount: 1200, wantUsage: 35},
+		{name: "clamp off, negative kept", clamp: false, count: 1200, usg: -35, wantCount: 1200, wantUsage: -35},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ora, _ := dbtest.Oracle(t, oracleDetails(detailsColumns,
+				[]driver.Value{"C001", "M-1", 10.0, tt.count, tt.usg, "256810", "ปกติ"}))
+			s := &Service{Oracle: ora, Config: config.SyncConfig{ClampNegativeUsage: tt.clamp}}
+
+			rows, err := s.fetchDetailsBatch(context.Background(), detailsSQLStub, "202410", "256710", "BA01", []string{"C001"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 {
+				t.Fatalf("got %d rows, want 1", len(rows))
+			}
+			r := rows[0]
+			if r.count != tt.wantCount || r.usage != tt.wantUsage || r.clampedNeg != tt.wantClamped {
+				t.Errorf("count=%v usage=%v clamped=%v, want %v %v %v",
+					r.count, r.usage, r.clampedNeg, tt.wantCount, tt.wantUsage, tt.wantClamped)
+			}
+		})
+	}
+}
+
+func TestMonthlyBranchTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		wantErr    bool
+		wantStatus string
+		wantMsg    string
+	}{
+		{name: "no timeout", timeout: 0, wantStatus: "success"},
+		{name: "within timeout", timeout: 10 * time.Second, wantStatus: "success"},
+		{name: "slow batches exceed timeout", timeout: 120 * time.Millisecond, wantErr: true, wantStatus: "timeout", wantMsg: "branch timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 6 batches of one cust_code at 50ms each
+			s, pg := newTestService(t, config.SyncConfig{MonthlyBranchTimeout: tt.timeout}, oracleEcho(50*time.Millisecond))
+			seedCohort(t, pg, 2025, "BA01", 6)
+
+			upserted, _, err := s.MonthlyDetails(context.Background(), "202410", "BA01", 1, "manual")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && upserted != 6 {
+				t.Errorf("upserted = %d, want 6", upserted)
+			}
+			status, msg := lastLog(t, pg)
+			if status != tt.wantStatus || msg != tt.wantMsg {
+				t.Errorf("log = %s %q, want %s %q", status, msg, tt.wantStatus, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestMonthlyBackfillGrace(t *testing.T) {
+	tests := []struct {
+		name        string
+		grace       time.Duration
+		triggeredBy string // of the earlier run
+		finishedAgo time.Duration
+		trigger     string // of this run
+		wantSkip    bool
+	}{
+		{name: "backfill within grace", grace: time.Hour, triggeredBy: "scheduler:backfill", finishedAgo: 10 * time.Minute, trigger: "scheduler", wantSkip: true},
+		{name: "backfill before grace", grace: time.Hour, triggeredBy: "scheduler:backfill", finishedAgo: 2 * time.Hour, trigger: "scheduler"},
+		{name: "grace disabled", grace: 0, triggeredBy: "scheduler:backfill", finishedAgo: 10 * time.Minute, trigger: "scheduler"},
+		{name: "manual run not skipped", grace: time.Hour, triggeredBy: "scheduler:backfill", finishedAgo: 10 * time.Minute, trigger: "manual"},
+		{name: "earlier run not a backfill", grace: time.Hour, triggeredBy: "scheduler", finishedAgo: 10 * time.Minute, trigger: "scheduler"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestService(t, config.SyncConfig{BackfillGrace: tt.grace}, oracleEcho(0))
+			seedCohort(t, pg, 2025, "BA01", 2)
+			finished := time.Now().Add(-tt.finishedAgo)
+			if _, err := pg.Pool.Exec(context.Background(),
+				`INSERT INTO bm_sync_logs (sync_type, branch_code, year_month, status, triggered_by, started_at, finished_at)
+				 VALUES ('monthly_sync', 'BA01', '202410', 'success', $1, $2, $2)`, tt.triggeredBy, finished); err != nil {
+				t.Fatal(err)
+			}
+
+			upserted, _, err := s.MonthlyDetails(context.Background(), "202410", "BA01", 100, tt.trigger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var runs int
+			if err := pg.Pool.QueryRow(context.Background(), `SELECT COUNT(1) FROM bm_sync_logs`).Scan(&runs); err != nil {
+				t.Fatal(err)
+			}
+			if skipped := runs == 1 && upserted == 0; skipped != tt.wantSkip {
+				t.Errorf("skipped = %t (runs=%d upserted=%d), want %t", skipped, runs, upserted, tt.wantSkip)
+			}
+		})
+	}
+}
+
+func TestMonthlyRetryCount(t *testing.T) {
+	tests := []struct {
+		name      string
+		failFirst int // Oracle calls that fail before it answers
+		wantCount int
+	}{
+		{name: "first attempt", failFirst: 0, wantCount: 0},
+		{name: "second attempt", failFirst: 1, wantCount: 1},
+		{name: "third attempt", failFirst: 2, wantCount: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			echo := oracleEcho(0)
+			s, pg := newTestService(t, config.SyncConfig{}, func(q string, args []driver.NamedValue) (dbtest.Result, error) {
+				if int(calls.Add(1)) <= tt.failFirst {
+					return dbtest.Result{}, errors.New("ORA-03113: end-of-file on communication channel")
+				}
+				return echo(q, args)
+			})
+			seedCohort(t, pg, 2025, "BA01", 2)
+
+			// the scheduler's runWithRetry tags each attempt the same way
+			var err error
+			for attempt := 0; attempt <= tt.failFirst; attempt++ {
+				_, _, err = s.MonthlyDetails(WithRetryAttempt(context.Background(), attempt), "202410", "BA01", 100, "scheduler")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var status string
+			var retries int
+			if err := pg.Pool.QueryRow(context.Background(),
+				`SELECT status, retry_count FROM bm_sync_logs ORDER BY id DESC LIMIT 1`).Scan(&status, &retries); err != nil {
+				t.Fatal(err)
+			}
+			if status != "success" || retries != tt.wantCount {
+				t.Errorf("log = %s retry_count=%d, want success %d", status, retries, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestInitModeRefresh(t *testing.T) {
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{mode: "full", want: []string{"C001", "C002"}},
+		{mode: "refresh", want: []string{"C001", "C002", "C003", "C004", "C005"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			// Oracle lags and returns 2 of the 5 existing members
+			s, pg := newTestService(t, config.SyncConfig{InitMode: tt.mode}, oracleCohort("C001", "C002"))
+			seedCohort(t, pg, 2025, "BA01", 5)
+
+			upserted, _, err := s.InitCustcodes(context.Background(), 2025, "BA01", "256710", 0, "manual")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if upserted != 2 {
+				t.Errorf("upserted = %d, want 2", upserted)
+			}
+			if got := cohortCodes(t, pg, 2025, "BA01"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cohort = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitDeferredBackfill(t *testing.T) {
+	tests := []struct {
+		name        string
+		deferred    bool
+		wantMonthly int // monthly_sync log rows written by the init call
+		wantQueued  []BackfillJob
+	}{
+		{name: "inline", wantMonthly: 2},
+		{name: "deferred", deferred: true,
+			wantQueued: []BackfillJob{{Branch: "BA01", FiscalYear: 2025, DebtYM: "256710", Months: 2, TriggeredBy: "scheduler"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestService(t, config.SyncConfig{}, oracleCohort("C001", "C002"))
+			ctx := context.Background()
+			queue := &BackfillQueue{}
+			if tt.deferred {
+				ctx = WithDeferredBackfill(ctx, queue)
+			}
+
+			if _, _, err := s.InitCustcodes(ctx, 2025, "BA01", "256710", 2, "scheduler"); err != nil {
+				t.Fatal(err)
+			}
+			var monthly int
+			if err := pg.Pool.QueryRow(context.Background(),
+				`SELECT COUNT(*) FROM bm_sync_logs WHERE sync_type='monthly_sync'`).Scan(&monthly); err != nil {
+				t.Fatal(err)
+			}
+			if monthly != tt.wantMonthly {
+				t.Errorf("backfill log rows = %d, want %d", monthly, tt.wantMonthly)
+			}
+			if got := queue.Jobs(); !reflect.DeepEqual(got, tt.wantQueued) {
+				t.Errorf("queued %+v, want %+v", got, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestInitDebtYMFallback(t *testing.T) {
+	tests := []struct {
+		name       string
+		steps      int
+		loadedYM   string // the only debt_ym Oracle has rows for
+		wantCohort []string
+		wantDebtYM string // in the sync log
+	}{
+		{name: "primary loaded", steps: 0, loadedYM: "256710", wantCohort: []string{"C001", "C002"}, wantDebtYM: "256710"},
+		{name: "fallback disabled", steps: 0, loadedYM: "256709", wantDebtYM: "256710"},
+		{name: "previous month", steps: 1, loadedYM: "256709", wantCohort: []string{"C001", "C002"}, wantDebtYM: "256709"},
+		{name: "beyond the steps", steps: 1, loadedYM: "256708", wantDebtYM: "256710"},
+		{name: "two months back", steps: 2, loadedYM: "256708", wantCohort: []string{"C001", "C002"}, wantDebtYM: "256708"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cohort := oracleCohort("C001", "C002")
+			s, pg := newTestService(t, config.SyncConfig{DebtYMFallbackSteps: tt.steps}, func(q string, args []driver.NamedValue) (dbtest.Result, error) {
+				if dbtest.Arg(args, "DEBT_YM") != tt.loadedYM {
+					return dbtest.Result{Columns: cohortColumns}, nil
+				}
+				return cohort(q, args)
+			})
+
+			if _, _, err := s.InitCustcodes(context.Background(), 2025, "BA01", "256710", 0, "manual"); err != nil {
+				t.Fatal(err)
+			}
+			if got := cohortCodes(t, pg, 2025, "BA01"); !reflect.DeepEqual(got, tt.wantCohort) {
+				t.Errorf("cohort = %v, want %v", got, tt.wantCohort)
+			}
+			var debtYM string
+			if err := pg.Pool.QueryRow(context.Background(),
+				`SELECT debt_ym FROM bm_sync_logs ORDER BY id DESC LIMIT 1`).Scan(&debtYM); err != nil {
+				t.Fatal(err)
+			}
+			if debtYM != tt.wantDebtYM {
+				t.Errorf("log debt_ym = %s, want %s", debtYM, tt.wantDebtYM)
+			}
+		})
+	}
+}
+
+func TestApplyCohortTiebreak(t *testing.T) {
+	const withMarker = "ORDER BY d.PRESENT_WATER_USG DESC /*__COHORT_TIEBREAK__*/ FETCH FIRST"
+	const noMarker = "ORDER BY d.PRESENT_WATER_USG DESC FETCH FIRST"
+	tests := []struct {
+		mode, q string
+		want    string
+		wantErr bool
+	}{
+		{mode: "cust_code", q: withMarker, want: "ORDER BY d.PRESENT_WATER_USG DESC , d.CUST_CODE ASC FETCH FIRST"},
+		{mode: "cust_id", q: withMarker, want: "ORDER BY d.PRESENT_WATER_USG DESC , d.CUST_ID ASC FETCH FIRST"},
+		{mode: "none", q: withMarker, want: "ORDER BY d.PRESENT_WATER_USG DESC  FETCH FIRST"},
+		{mode: "none", q: noMarker, want: noMarker},
+		{mode: "cust_code", q: noMarker, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := applyCohortTiebreak(tt.q, tt.mode)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s on %q: err = %v, wantErr %t", tt.mode, tt.q, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s on %q = %q, want %q", tt.mode, tt.q, got, tt.want)
+		}
+	}
+}
+
+// oracleTiedCohort answers the cohort query from ten customers with the same usage,
+// ordered by the tiebreak column the query asks for and shuffled when it asks for none,
+// like Oracle returning ties in whatever order the plan produces. cust_id runs opposite
+// to cust_code, so the two tiebreaks pick different members.
+func oracleTiedCohort() dbtest.QueryFunc {
+	codes := make([]string, 10)
+	for i := range codes {
+		codes[i] = fmt.Sprintf("C%03d", i+1)
+	}
+	return func(query string, args []driver.NamedValue) (dbtest.Result, error) {
+		order := append([]string(nil), codes...)
+		switch {
+		case strings.Contains(query, "d.CUST_CODE ASC"):
+		case strings.Contains(query, "d.CUST_ID ASC"):
+			sort.Sort(sort.Reverse(sort.StringSlice(order)))
+		default:
+			rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		}
+		n, _ := dbtest.Arg(args, "COHORT_SIZE").(int)
+		return oracleCohort(order[:n]...)(query, args)
+	}
+}
+
+func TestInitCohortTiebreakStable(t *testing.T) {
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{mode: "cust_code", want: []string{"C001", "C002", "C003"}},
+		{mode: "cust_id", want: []string{"C008", "C009", "C010"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			s, pg := newTestService(t, config.SyncConfig{CohortSize: 3, CohortTiebreak: tt.mode}, oracleTiedCohort())
+			for run := 1; run <= 5; run++ {
+				if _, _, err := s.InitCustcodes(context.Background(), 2025, "BA01", "256710", 0, "manual"); err != nil {
+					t.Fatal(err)
+				}
+				if got := cohortCodes(t, pg, 2025, "BA01"); !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("run %d: cohort = %v, want %v", run, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMonthlyZeroedDebtYM(t *testing.T) {
+	tests := []struct {
+		custCode   string
+		wantDebtYM string
+		wantZeroed bool
+	}{
+		// returned by Oracle: the debt month it reports
+		{custCode: "C001", wantDebtYM: "256712"},
+		// not returned: the debt_ym captured with the cohort, not the synced month
+		{custCode: "C002", wantDebtYM: "256710", wantZeroed: true},
+		// cohort row from before debt_ym was stored: the synced month
+		{custCode: "C003", wantDebtYM: "256712", wantZeroed: true},
+	}
+	s, pg := newTestService(t, config.SyncConfig{}, oracleDetails(detailsColumns,
+		[]driver.Value{"C001", "M-1", 10.0, 100.0, 10.0, "256712", "ปกติ"}))
+	seedCohort(t, pg, 2025, "BA01", 2)
+	if _, err := pg.Pool.Exec(context.Background(),
+		`INSERT INTO bm_custcode_init (fiscal_year, branch_code, cust_code) VALUES (2025, 'BA01', 'C003')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.MonthlyDetails(context.Background(), "202412", "BA01", 100, "manual"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		var debtYM string
+		var zeroed bool
+		if err := pg.Pool.QueryRow(context.Background(),
+			`SELECT debt_ym, (present_water_usg=0 AND present_meter_count=0 AND COALESCE(org_name, '')='')
+			 FROM bm_meter_details WHERE year_month='202412' AND branch_code='BA01' AND cust_code=$1`,
+			tt.custCode).Scan(&debtYM, &zeroed); err != nil {
+			t.Fatalf("%s: %v", tt.custCode, err)
+		}
+		if debtYM != tt.wantDebtYM || zeroed != tt.wantZeroed {
+			t.Errorf("%s: debt_ym=%s zeroed=%t, want %s %t", tt.custCode, debtYM, zeroed, tt.wantDebtYM, tt.wantZeroed)
+		}
+	}
+}
+
+func TestPreCreatedLog(t *testing.T) {
+	monthly := oracleDetails(detailsColumns, []driver.Value{"C001", "M-1", 10.0, 100.0, 10.0, "256712", "ปกติ"})
+	tests := []struct {
+		name       string
+		syncType   string
+		preCreated bool
+		oracle     dbtest.QueryFunc
+		run        func(ctx context.Context, s *Service) error
+	}{
+		{name: "monthly, inserted by the service", syncType: "monthly_sync", oracle: monthly, run: func(ctx context.Context, s *Service) error {
+			_, _, err := s.MonthlyDetails(ctx, "202412", "BA01", 100, "api")
+			return err
+		}},
+		{name: "monthly, pre-created", syncType: "monthly_sync", preCreated: true, oracle: monthly, run: func(ctx context.Context, s *Service) error {
+			_, _, err := s.MonthlyDetails(ctx, "202412", "BA01", 100, "api")
+			return err
+		}},
+		{name: "init, inserted by the service", syncType: "yearly_init", oracle: oracleCohort("C001"), run: func(ctx context.Context, s *Service) error {
+			_, _, err := s.InitCustcodes(ctx, 2025, "BA01", "256710", 0, "api")
+			return err
+		}},
+		{name: "init, pre-created", syncType: "yearly_init", preCreated: true, oracle: oracleCohort("C001"), run: func(ctx context.Context, s *Service) error {
+			_, _, err := s.InitCustcodes(ctx, 2025, "BA01", "256710", 0, "api")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestService(t, config.SyncConfig{}, tt.oracle)
+			seedCohort(t, pg, 2025, "BA01", 1)
+			ctx := context.Background()
+			var want int64
+			if tt.preCreated {
+				id, err := s.LogRepo.RecordSyncStart(ctx, tt.syncType, "BA01", "api", nil, nil, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want = id
+				ctx = WithPreCreatedLog(ctx, id)
+			}
+			if err := tt.run(ctx, s); err != nil {
+				t.Fatal(err)
+			}
+
+			var n int
+			var id int64
+			var status string
+			if err := pg.Pool.QueryRow(context.Background(),
+				`SELECT COUNT(*) OVER (), id, status FROM bm_sync_logs WHERE sync_type=$1 LIMIT 1`, tt.syncType).Scan(&n, &id, &status); err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 || status != "success" {
+				t.Errorf("got %d %s log rows (status %s), want 1 success", n, tt.syncType, status)
+			}
+			if tt.preCreated && id != want {
+				t.Errorf("log id %d, want the pre-created %d", id, want)
+			}
+		})
+	}
+}
+
+func TestFiscalYearFromYM(t *testing.T) {
+	tests := map[string]int{
+		"202401": 2024,
+		"202409": 2024,
+		"202410": 2025,
+		"202412": 2025,
+	}
+	for ym, want := range tests {
+		if got := fiscalYearFromYM(ym); got != want {
+			t.Errorf("fiscalYearFromYM(%s) = %d, want %d", ym, got, want)
+		}
+	}
+}
+
+func TestMonthlyFiscalYear(t *testing.T) {
+	tests := []struct {
+		name       string
+		ym         string
+		override   int
+		wantFiscal int
+	}{
+		{name: "before October", ym: "202409", wantFiscal: 2024},
+		{name: "October starts the next fiscal year", ym: "202410", wantFiscal: 2025},
+		// an init backfill stores the months before October under the new cohort
+		{name: "backfill override", ym: "202409", override: 2025, wantFiscal: 2025},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestService(t, config.SyncConfig{}, oracleDetails(detailsColumns,
+				[]driver.Value{"C001", "M-1", 10.0, 100.0, 10.0, "256712", "ปกติ"}))
+			seedCohort(t, pg, tt.wantFiscal, "BA01", 1)
+
+			if _, _, err := s.MonthlyDetailsWithFiscalYear(context.Background(), tt.ym, "BA01", 100, "manual", tt.override); err != nil {
+				t.Fatal(err)
+			}
+			var fiscal int
+			if err := pg.Pool.QueryRow(context.Background(),
+				`SELECT fiscal_year FROM bm_meter_details WHERE year_month=$1 AND branch_code='BA01' AND cust_code='C001'`,
+				tt.ym).Scan(&fiscal); err != nil {
+				t.Fatal(err)
+			}
+			if fiscal != tt.wantFiscal {
+				t.Errorf("fiscal_year = %d, want %d", fiscal, tt.wantFiscal)
+			}
+		})
+	}
+}
+
+func TestIsFutureYM(t *testing.T) {
+	bkk := time.FixedZone("ICT", 7*3600)
+	now := time.Date(2024, time.December, 31, 23, 30, 0, 0, bkk)
+	tests := []struct {
+		ym   string
+		want bool
+	}{
+		{ym: "202411", want: false},
+		{ym: "202412", want: false},
+		{ym: "202501", want: true},
+		{ym: "202512", want: true},
+	}
+	for _, tt := range tests {
+		if got := IsFutureYM(tt.ym, now); got != tt.want {
+			t.Errorf("IsFutureYM(%s, %s) = %t, want %t", tt.ym, now, got, tt.want)
+		}
+	}
+	// the same instant is already January in UTC+8 and later
+	if IsFutureYM("202501", now.In(time.FixedZone("UTC+8", 8*3600))) {
+		t.Error("202501 is the current month at UTC+8")
+	}
+}
+
+func TestIsHistoricalYM(t *testing.T) {
+	bkk := time.FixedZone("ICT", 7*3600)
+	// 2024-09-30 18:00 UTC is already October in Bangkok
+	now := time.Date(2024, time.September, 30, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ym   string
+		now  time.Time
+		want bool
+	}{
+		{ym: "202408", now: now, want: true},
+		{ym: "202409", now: now, want: false},
+		{ym: "202409", now: now.In(bkk), want: true},
+		{ym: "202410", now: now.In(bkk), want: false},
+		{ym: "202411", now: now.In(bkk), want: false},
+	}
+	for _, tt := range tests {
+		if got := isHistoricalYM(tt.ym, tt.now); got != tt.want {
+			t.Errorf("isHistoricalYM(%s, %s) = %t, want %t", tt.ym, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestMonthlySkipDetailsPrune(t *testing.T) {
+	const tz = "Asia/Bangkok"
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		t.Skip(err)
+	}
+	current := time.Now().In(loc).Format("200601")
+	tests := []struct {
+		name     string
+		ym       string
+		skip     bool
+		wantKept bool
+	}{
+		// C999 was in the month's cohort back then but is not in today's
+		{name: "historical month kept", ym: "202410", skip: true, wantKept: true},
+		{name: "historical month pruned without the option", ym: "202410"},
+		{name: "current month still pruned", ym: current, skip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pg := newTestService(t, config.SyncConfig{SkipDetailsPrune: tt.skip, Timezone: tz}, oracleDetails(detailsColumns,
+				[]driver.Value{"C001", "M-1", 10.0, 100.0, 10.0, "256712", "ปกติ"}))
+			ctx := context.Background()
+			fiscal := fiscalYearFromYM(tt.ym)
+			seedCohort(t, pg, fiscal, "BA01", 1)
+			if _, err := pg.Pool.Exec(ctx, `INSERT INTO bm_meter_details (fiscal_year, year_month, branch_code, cust_code)
+				VALUES ($1, $2, 'BA01', 'C999')`, fiscal, tt.ym); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := s.MonthlyDetails(ctx, tt.ym, "BA01", 100, "manual"); err != nil {
+				t.Fatal(err)
+			}
+			var n int
+			if err := pg.Pool.QueryRow(ctx,
+				`SELECT COUNT(1) FROM bm_meter_details WHERE year_month=$1 AND branch_code='BA01' AND cust_code='C999'`,
+				tt.ym).Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			if kept := n == 1; kept != tt.wantKept {
+				t.Errorf("C999 kept = %t, want %t", kept, tt.wantKept)
+			}
+		})
+	}
+}
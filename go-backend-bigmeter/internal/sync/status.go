@@ -0,0 +1,90 @@
+package sync
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RunStatus is a live view of one sync run in this process
+type RunStatus struct {
+	SyncType    string    `json:"sync_type"`
+	Branch      string    `json:"branch"`
+	YM          string    `json:"ym"` // year_month for monthly_sync, debt_ym for yearly_init
+	FiscalYear  int       `json:"fiscal_year"`
+	TriggeredBy string    `json:"triggered_by"`
+	LogID       *int64    `json:"log_id"`
+	StartedAt   time.Time `json:"started_at"`
+	Batches     int       `json:"batches_done"`
+	Upserted    int       `json:"records_upserted"`
+	Zeroed      int       `json:"records_zeroed"`
+	// Source is "process" for runs in this registry, "sync_log" for in_progress log
+	// rows of other processes (e.g. the scheduler)
+	Source string `json:"source"`
+}
+
+// StatusRegistry tracks the sync runs currently executing in this process, from any
+// trigger (scheduler, API, retry, init backfill), with their batch progress. It is
+// safe for concurrent use.
+type StatusRegistry struct {
+	mu   sync.Mutex
+	next int64
+	runs map[int64]*RunStatus
+}
+
+// NewStatusRegistry creates an empty registry
+func NewStatusRegistry() *StatusRegistry {
+	return &StatusRegistry{runs: map[int64]*RunStatus{}}
+}
+
+// Start registers a run and returns the token for Progress and Finish
+func (r *StatusRegistry) Start(run RunStatus) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.next++
+	if run.StartedAt.IsZero() {
+		run.StartedAt = time.Now()
+	}
+	r.runs[r.next] = &run
+	return r.next
+}
+
+// Progress records a committed batch and the run's running totals
+func (r *StatusRegistry) Progress(token int64, upserted, zeroed int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if run, ok := r.runs[token]; ok {
+		run.Batches++
+		run.Upserted = upserted
+		run.Zeroed = zeroed
+	}
+}
+
+// Finish removes a run from the registry
+func (r *StatusRegistry) Finish(token int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.runs, token)
+}
+
+// Snapshot returns a copy of the running syncs, oldest first
+func (r *StatusRegistry) Snapshot() []RunStatus {
+	r.mu.Lock()
+	out := make([]RunStatus, 0, len(r.runs))
+	for _, run := range r.runs {
+		run := *run
+		run.Source = "process"
+		out = append(out, run)
+	}
+	r.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
+
+// logIDRef returns a pointer for RunStatus.LogID, nil when no log row was recorded
+func logIDRef(id int64) *int64 {
+	if id <= 0 {
+		return nil
+	}
+	return &id
+}
@@ -0,0 +1,158 @@
+package sync
+
+import (
+	"fmt"
+	"slices"
+	gosync "sync"
+	"testing"
+	"time"
+)
+
+// TestStatusRegistryConcurrent registers, advances and finishes runs from many
+// goroutines while others take snapshots. Run it with -race (make test does).
+func TestStatusRegistryConcurrent(t *testing.T) {
+	tests := []struct {
+		name     string
+		runs     int
+		batches  int
+		finished int // runs 0..finished-1 finish; the rest stay registered
+	}{
+		{name: "all finish", runs: 20, batches: 5, finished: 20},
+		{name: "half running", runs: 20, batches: 5, finished: 10},
+		{name: "none finish", runs: 50, batches: 3, finished: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewStatusRegistry()
+			base := time.Date(2024, 10, 1, 8, 0, 0, 0, time.UTC)
+			stop := make(chan struct{})
+			var readers gosync.WaitGroup
+			for i := 0; i < 4; i++ {
+				readers.Add(1)
+				go func() {
+					defer readers.Done()
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+							_ = r.Snapshot()
+						}
+					}
+				}()
+			}
+
+			var wg gosync.WaitGroup
+			for i := 0; i < tt.runs; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					token := r.Start(RunStatus{SyncType: "monthly_sync", Branch: fmt.Sprintf("B%02d", i), YM: "202410",
+						StartedAt: base.Add(time.Duration(i) * time.Second)})
+					for b := 1; b <= tt.batches; b++ {
+						r.Progress(token, b*10, b)
+					}
+					if i < tt.finished {
+						r.Finish(token)
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(stop)
+			readers.Wait()
+
+			snap := r.Snapshot()
+			if len(snap) != tt.runs-tt.finished {
+				t.Fatalf("snapshot has %d runs, want %d", len(snap), tt.runs-tt.finished)
+			}
+			for i, run := range snap {
+				want := fmt.Sprintf("B%02d", tt.finished+i) // oldest first
+				if run.Branch != want || run.Batches != tt.batches || run.Upserted != tt.batches*10 ||
+					run.Zeroed != tt.batches || run.Source != "process" {
+					t.Errorf("run %d = %+v, want branch %s with %d batches", i, run, want, tt.batches)
+				}
+			}
+		})
+	}
+}
+
+func TestJobRegistryConcurrentAcquire(t *testing.T) {
+	r := NewJobRegistry()
+	key := JobKey("monthly_sync", "BA01", "202410")
+	const callers = 50
+	var wg gosync.WaitGroup
+	acquired := make(chan int, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if busy := r.TryAcquire(key); len(busy) == 0 {
+				acquired <- i
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(acquired)
+	if n := len(acquired); n != 1 {
+		t.Fatalf("%d callers acquired the same key, want 1", n)
+	}
+	r.Release(key)
+	if busy := r.TryAcquire(key); len(busy) != 0 {
+		t.Errorf("key still busy after Release: %v", busy)
+	}
+}
+
+func TestJobRegistryBindLog(t *testing.T) {
+	key := JobKey("yearly_init", "BA01", "256710")
+	tests := []struct {
+		name    string
+		acquire bool
+		logID   int64
+		release bool
+		wantOK  bool
+	}{
+		{name: "bound while running", acquire: true, logID: 7, wantOK: true},
+		{name: "cleared by release", acquire: true, logID: 7, release: true},
+		{name: "key not running", logID: 7},
+		{name: "no log id", acquire: true, logID: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewJobRegistry()
+			if tt.acquire {
+				if busy := r.TryAcquire(key); len(busy) != 0 {
+					t.Fatalf("acquire: busy %v", busy)
+				}
+			}
+			r.BindLog(key, tt.logID)
+			if tt.release {
+				r.Release(key)
+			}
+			got, ok := r.KeyForLog(tt.logID)
+			if ok != tt.wantOK || (ok && got != key) {
+				t.Errorf("KeyForLog(%d) = %q, %v, want ok=%v", tt.logID, got, ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestJobRegistryRunningForBranch(t *testing.T) {
+	r := NewJobRegistry()
+	r.TryAcquire(JobKey("yearly_init", "BA01", "256710"), JobKey("monthly_sync", "BA01", "202410"),
+		JobKey("monthly_sync", "BA011", "202410"), JobKey("monthly_sync", "BA02", "202410"))
+	r.Release(JobKey("monthly_sync", "BA02", "202410"))
+	tests := []struct {
+		branch string
+		want   []string
+	}{
+		{branch: "BA01", want: []string{"monthly_sync|BA01|202410", "yearly_init|BA01|256710"}},
+		{branch: "BA011", want: []string{"monthly_sync|BA011|202410"}},
+		{branch: "BA02"},
+		{branch: "BA"},
+	}
+	for _, tt := range tests {
+		if got := r.RunningForBranch(tt.branch); !slices.Equal(got, tt.want) {
+			t.Errorf("RunningForBranch(%s) = %v, want %v", tt.branch, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package sync
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Plausible year ranges for YYYYMM inputs. Years in the Thai range are Buddhist
+// (Gregorian + 543); anything outside both ranges is rejected rather than guessed.
+const (
+	buddhistEraOffset = 543
+	gregorianYearMin  = 2000
+	gregorianYearMax  = 2100
+	thaiYearMin       = gregorianYearMin + buddhistEraOffset
+	thaiYearMax       = gregorianYearMax + buddhistEraOffset
+)
+
+// NormalizeGregorianYM accepts either Thai YYYYMM or Gregorian YYYYMM and returns
+// Gregorian YYYYMM. It is shared by the sync CLI (YM/DEBT_YM) and the API (debt_ym).
+func NormalizeGregorianYM(ym string) (string, error) {
+	if len(ym) != 6 {
+		return "", fmt.Errorf("invalid ym; expect YYYYMM")
+	}
+	y, err := strconv.Atoi(ym[:4])
+	if err != nil {
+		return "", fmt.Errorf("invalid ym year")
+	}
+	m, err := strconv.Atoi(ym[4:])
+	if err != nil || m < 1 || m > 12 {
+		return "", fmt.Errorf("invalid ym month")
+	}
+	if y >= thaiYearMin && y <= thaiYearMax { // Thai (Buddhist) -> convert to Gregorian
+		y -= buddhistEraOffset
+	}
+	if y < gregorianYearMin || y > gregorianYearMax {
+		return "", fmt.Errorf("implausible ym year %s; expect Gregorian %d-%d or Thai %d-%d",
+			ym[:4], gregorianYearMin, gregorianYearMax, thaiYearMin, thaiYearMax)
+	}
+	return fmt.Sprintf("%04d%02d", y, m), nil
+}
@@ -0,0 +1,54 @@
+package sync
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNormalizeGregorianYM(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "202410", want: "202410"},
+		{in: "256710", want: "202410"},
+		{in: "200001", want: "200001"}, // gregorianYearMin
+		{in: "210012", want: "210012"}, // gregorianYearMax
+		{in: "254301", want: "200001"}, // thaiYearMin
+		{in: "264312", want: "210012"}, // thaiYearMax
+		{in: "199912", wantErr: true},
+		{in: "210101", wantErr: true},
+		{in: "254212", wantErr: true}, // Thai 2542 = 1999
+		{in: "264401", wantErr: true}, // neither a plausible Thai nor Gregorian year
+		{in: "300001", wantErr: true},
+		{in: "202413", wantErr: true},
+		{in: "2024", wantErr: true},
+		{in: "abcd10", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeGregorianYM(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeGregorianYM(%s) error = %v, wantErr %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeGregorianYM(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestMonthlyDetailsInvalidYM checks a malformed ym (MODE=month-once YM=123) is reported
+// to OnBranchDone as an error rather than panicking while it is described
+func TestMonthlyDetailsInvalidYM(t *testing.T) {
+	for _, ym := range []string{"123", "", "2024101"} {
+		var got []BranchResult
+		s := &Service{OnBranchDone: func(r BranchResult) { got = append(got, r) }}
+		if _, _, err := s.MonthlyDetails(context.Background(), ym, "BA01", 100, "manual"); err == nil {
+			t.Errorf("ym=%q: no error", ym)
+		}
+		if len(got) != 1 || got[0].Err == nil || got[0].FiscalYear != 0 {
+			t.Errorf("ym=%q: OnBranchDone got %+v, want one failed result without a fiscal year", ym, got)
+		}
+	}
+}
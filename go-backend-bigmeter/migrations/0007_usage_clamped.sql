@@ -0,0 +1,9 @@
+-- Migration: flag monthly detail rows whose negative Oracle usage was clamped to zero
+\echo 'Altering bm_meter_details to add usage_clamped flag'
+
+BEGIN;
+
+ALTER TABLE bm_meter_details
+  ADD COLUMN IF NOT EXISTS usage_clamped BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMIT;
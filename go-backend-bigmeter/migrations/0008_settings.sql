@@ -0,0 +1,12 @@
+-- Migration: key/value runtime settings shared by the API and sync processes
+\echo 'Creating bm_settings table'
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS bm_settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+COMMIT;
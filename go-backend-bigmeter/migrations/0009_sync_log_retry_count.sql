@@ -0,0 +1,9 @@
+-- Migration: record how many retries a sync needed before it finished
+\echo 'Altering bm_sync_logs to add retry_count'
+
+BEGIN;
+
+ALTER TABLE bm_sync_logs
+  ADD COLUMN IF NOT EXISTS retry_count INTEGER NOT NULL DEFAULT 0;
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Migration: per-batch progress for long-running monthly syncs
+\echo 'Altering bm_sync_logs to add processed_batches'
+
+BEGIN;
+
+ALTER TABLE bm_sync_logs
+  ADD COLUMN IF NOT EXISTS processed_batches INTEGER NOT NULL DEFAULT 0;
+
+COMMIT;
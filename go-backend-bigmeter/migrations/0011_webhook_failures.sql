@@ -0,0 +1,17 @@
+-- Migration: dead-letter table for sync-completion webhook callbacks that exhausted their retries
+\echo 'Creating bm_webhook_failures table'
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS bm_webhook_failures (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_failures_created_at ON bm_webhook_failures (created_at DESC);
+
+COMMIT;
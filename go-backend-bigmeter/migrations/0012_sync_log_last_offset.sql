@@ -0,0 +1,9 @@
+-- Migration: committed cohort offset so a failed monthly sync can be resumed
+\echo 'Altering bm_sync_logs to add last_offset'
+
+BEGIN;
+
+ALTER TABLE bm_sync_logs
+  ADD COLUMN IF NOT EXISTS last_offset INTEGER NOT NULL DEFAULT 0;
+
+COMMIT;
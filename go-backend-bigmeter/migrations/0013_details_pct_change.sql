@@ -0,0 +1,10 @@
+-- Migration: stored month-over-month usage change for reporting tables
+\echo 'Altering bm_meter_details to add pct_change'
+
+BEGIN;
+
+-- NULL when the previous month has no row or zero usage (same rule as the alerts)
+ALTER TABLE bm_meter_details
+  ADD COLUMN IF NOT EXISTS pct_change DOUBLE PRECISION;
+
+COMMIT;
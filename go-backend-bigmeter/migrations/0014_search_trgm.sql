@@ -0,0 +1,39 @@
+-- Migration: trigram indexes for the q search of /details and /custcodes (SEARCH_TRGM=true)
+\echo 'Creating pg_trgm search indexes'
+
+BEGIN;
+
+-- Requires a role allowed to create extensions; without these indexes the API keeps
+-- using per-column ILIKE
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- The expressions must match searchExpr() in internal/api/search.go column for column
+CREATE INDEX IF NOT EXISTS idx_bm_details_search_trgm
+  ON bm_meter_details USING gin ((
+    coalesce(cust_code, '') || E'\n' ||
+    coalesce(meter_no, '') || E'\n' ||
+    coalesce(cust_name, '') || E'\n' ||
+    coalesce(address, '') || E'\n' ||
+    coalesce(route_code, '') || E'\n' ||
+    coalesce(org_name, '') || E'\n' ||
+    coalesce(use_type, '') || E'\n' ||
+    coalesce(use_name, '')
+  ) gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_bm_cust_init_search_trgm
+  ON bm_custcode_init USING gin ((
+    coalesce(cust_code, '') || E'\n' ||
+    coalesce(meter_no, '') || E'\n' ||
+    coalesce(use_type, '') || E'\n' ||
+    coalesce(org_name, '') || E'\n' ||
+    coalesce(use_name, '') || E'\n' ||
+    coalesce(cust_name, '') || E'\n' ||
+    coalesce(address, '') || E'\n' ||
+    coalesce(route_code, '') || E'\n' ||
+    coalesce(meter_size, '') || E'\n' ||
+    coalesce(meter_brand, '') || E'\n' ||
+    coalesce(meter_state, '') || E'\n' ||
+    coalesce(debt_ym, '')
+  ) gin_trgm_ops);
+
+COMMIT;
@@ -0,0 +1,30 @@
+-- Migration: history of alert runs (scheduled digest and POST /alerts/test) for charting alert volume
+\echo 'Creating bm_alert_logs and bm_alert_log_branches tables'
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS bm_alert_logs (
+    id BIGSERIAL PRIMARY KEY,
+    ym TEXT NOT NULL,
+    prev_ym TEXT NOT NULL,
+    mode TEXT NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL,
+    total_branches INTEGER NOT NULL,
+    branches_with_alerts INTEGER NOT NULL,
+    total_customers INTEGER NOT NULL,
+    generated_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_logs_ym ON bm_alert_logs (ym, generated_at);
+
+-- Per-branch counts of a run (branches with at least one qualifying customer)
+CREATE TABLE IF NOT EXISTS bm_alert_log_branches (
+    alert_log_id BIGINT NOT NULL REFERENCES bm_alert_logs(id) ON DELETE CASCADE,
+    branch_code TEXT NOT NULL,
+    branch_name TEXT,
+    alert_count INTEGER NOT NULL,
+    PRIMARY KEY (alert_log_id, branch_code)
+);
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Migration: alert direction (decrease/increase/both) on the alert run history
+\echo 'Altering bm_alert_logs to add direction'
+
+BEGIN;
+
+-- Runs before this column existed only counted decreases
+ALTER TABLE bm_alert_logs
+  ADD COLUMN IF NOT EXISTS direction TEXT NOT NULL DEFAULT 'decrease';
+
+COMMIT;
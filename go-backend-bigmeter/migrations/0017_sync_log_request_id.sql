@@ -0,0 +1,10 @@
+-- Migration: X-Request-ID of the API call that triggered a sync run
+\echo 'Altering bm_sync_logs to add request_id'
+
+BEGIN;
+
+-- NULL for scheduler/CLI runs and rows written before this column existed
+ALTER TABLE bm_sync_logs
+  ADD COLUMN IF NOT EXISTS request_id TEXT;
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Migration: MAD threshold on the alert run history, so a stored run can be re-rendered
+\echo 'Altering bm_alert_logs to add mad_threshold'
+
+BEGIN;
+
+-- NULL for runs recorded before this column existed
+ALTER TABLE bm_alert_logs
+  ADD COLUMN IF NOT EXISTS mad_threshold DOUBLE PRECISION;
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Migration: optional short display name per branch (see BRANCH_NAME_ORDER)
+\echo 'Altering bm_branches to add alias'
+
+BEGIN;
+
+ALTER TABLE bm_branches
+  ADD COLUMN IF NOT EXISTS alias TEXT;
+
+COMMIT;
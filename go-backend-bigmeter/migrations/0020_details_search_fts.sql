@@ -0,0 +1,22 @@
+-- Migration: full-text search column for /details?q_mode=fts
+\echo 'Altering bm_meter_details to add search_tsv'
+
+BEGIN;
+
+-- 'simple' keeps words as written (no stemming or stop words). It splits on spaces and
+-- punctuation only, so a run of Thai text is one token; the API keeps the substring
+-- search for a q containing Thai script. Adding a stored generated column rewrites the
+-- table; run it outside sync windows on large installs.
+ALTER TABLE bm_meter_details
+  ADD COLUMN IF NOT EXISTS search_tsv tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple',
+      coalesce(cust_name, '') || ' ' ||
+      coalesce(address, '') || ' ' ||
+      coalesce(org_name, ''))
+  ) STORED;
+
+-- The name is looked up by the API (detailsFTSIndex in internal/api/search.go)
+CREATE INDEX IF NOT EXISTS idx_bm_details_search_tsv
+  ON bm_meter_details USING gin (search_tsv);
+
+COMMIT;
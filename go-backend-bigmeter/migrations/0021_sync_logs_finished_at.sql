@@ -0,0 +1,14 @@
+-- Migration: index for the summary cache's "synced since" check on bm_sync_logs
+\echo 'Indexing bm_sync_logs by branch and finished_at'
+
+BEGIN;
+
+-- The API drops a cached past-month summary when a sync of its branch finished after
+-- it was computed (SUMMARY_CACHE_TTL); it asks this on every cache hit.
+CREATE INDEX IF NOT EXISTS idx_sync_logs_branch_finished
+  ON bm_sync_logs (branch_code, finished_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_sync_logs_finished_at
+  ON bm_sync_logs (finished_at DESC);
+
+COMMIT;
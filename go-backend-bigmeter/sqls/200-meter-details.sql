@@ -4,7 +4,8 @@ SELECT
     cm.AVERAGE              AS "หน่วยน้ำเฉลี่ย",
     trn.PRESENT_METER_COUNT AS "เลขมาตรที่อ่านได้",
     trn.PRESENT_WATER_USG   AS "หน่วยน้ำปัจจุบัน",
-    trn.DEBT_YM             AS "เดือนหนี้"
+    trn.DEBT_YM             AS "เดือนหนี้",
+    mst.STATENAME           AS "สถานะมาตร"
 FROM
     PWACIS.TB_TR_DEBT_TRN trn
 JOIN
@@ -1,4 +1,4 @@
--- Optimized: filter + deduplicate first, then join heavy dimensions after limiting to 200 rows
+-- Optimized: filter + deduplicate first, then join heavy dimensions after limiting to the cohort size
 WITH base AS (
     SELECT /*+ MATERIALIZE */
         trn.CUST_ID,
@@ -27,13 +27,16 @@ WITH base AS (
         b.*,
         ROW_NUMBER() OVER (PARTITION BY b.CUST_CODE ORDER BY b.PRESENT_WATER_USG DESC) AS rn
     FROM base b
-), top200 AS (
+), topn AS (
     SELECT /*+ MATERIALIZE */
         d.*
     FROM dedup d
     WHERE d.rn = 1
-    ORDER BY d.PRESENT_WATER_USG DESC
-    FETCH FIRST 200 ROWS ONLY
+    -- The service appends a deterministic tiebreaker (COHORT_TIEBREAK) at the marker so
+    -- customers tied at the last cohort position are chosen the same way on every run.
+    ORDER BY d.PRESENT_WATER_USG DESC /*__COHORT_TIEBREAK__*/
+    -- Cohort size is bound by the service (COHORT_SIZE, default 200)
+    FETCH FIRST :COHORT_SIZE ROWS ONLY
 )
 SELECT
     t.BA                           AS "BA",
@@ -49,7 +52,7 @@ SELECT
     mb.BRANDNAME                   AS "ยี่ห้อมาตร",
     mst.STATENAME                  AS "สถานะมาตร",
     t.DEBT_YM                      AS "เดือนหนี้"
-FROM top200 t
+FROM topn t
 LEFT JOIN PWACIS.TB_TR_CUST_METER cm ON t.CUST_ID = cm.CUST_ID AND cm.IS_DELETED = 'F'
 LEFT JOIN PWACIS.TB_LT_METERSTATE mst ON cm.MRT_STATE_ID = mst.ID
 LEFT JOIN PWACIS.TB_MS_METER_ROUTE mr ON t.METER_ROUTE_ID = mr.ID